@@ -0,0 +1,192 @@
+package apierr
+
+import (
+	"database/sql"
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/go-sql-driver/mysql"
+)
+
+//Code is a stable machine-readable error code returned by the API
+type Code string
+
+const (
+	ValidationFailed Code = "validation_failed"
+	Unauthorized     Code = "unauthorized"
+	Forbidden        Code = "forbidden"
+	NotFound         Code = "not_found"
+	Conflict         Code = "conflict"
+	RateLimited      Code = "rate_limited"
+	Internal         Code = "internal"
+)
+
+//Status is the HTTP status code for the error code
+func (c Code) Status() int {
+	switch c {
+	case ValidationFailed:
+		return http.StatusBadRequest
+	case Unauthorized:
+		return http.StatusUnauthorized
+	case Forbidden:
+		return http.StatusForbidden
+	case NotFound:
+		return http.StatusNotFound
+	case Conflict:
+		return http.StatusConflict
+	case RateLimited:
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+//CodeForStatus maps HTTP status codes from errors.Errorc() to error codes
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return ValidationFailed
+	case http.StatusUnauthorized:
+		return Unauthorized
+	case http.StatusForbidden:
+		return Forbidden
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusTooManyRequests:
+		return RateLimited
+	}
+	return Internal
+}
+
+//FieldError describes what is wrong with one field of the request
+type FieldError struct {
+	Field   string `json:"field" doc:"JSON name of the field, e.g. \"title\""`
+	Message string `json:"message"`
+}
+
+//Error has a message that is safe to show to the user of the API,
+//while the cause is only logged.
+type Error struct {
+	Code       Code
+	Message    string
+	Fields     []FieldError
+	RetryAfter time.Duration //when rate limited
+	cause      error
+}
+
+func (e Error) Error() string {
+	if e.cause != nil {
+		return e.Message + " because " + e.cause.Error()
+	}
+	return e.Message
+}
+
+func (e Error) Unwrap() error {
+	return e.cause
+}
+
+//Errorf returns an error with a code and a message for the user
+func Errorf(code Code, format string, args ...interface{}) error {
+	return Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+//Wrapf returns an error with a code and a message for the user
+//while cause is kept for logging
+func Wrapf(cause error, code Code, format string, args ...interface{}) error {
+	return Error{Code: code, Message: fmt.Sprintf(format, args...), cause: cause}
+}
+
+//Invalid returns a validation error for one field
+func Invalid(field string, format string, args ...interface{}) error {
+	msg := fmt.Sprintf(format, args...)
+	return Error{
+		Code:    ValidationFailed,
+		Message: msg,
+		Fields:  []FieldError{{Field: field, Message: msg}},
+	}
+}
+
+//Validation returns err as a validation error
+//keeping the fields if err is already a validation error
+func Validation(err error) error {
+	if e, ok := As(err); ok && e.Code == ValidationFailed {
+		e.cause = err
+		return e
+	}
+	return Error{Code: ValidationFailed, Message: err.Error()}
+}
+
+//Limited returns a rate limited error with the time to wait before trying again
+func Limited(retryAfter time.Duration, format string, args ...interface{}) error {
+	return Error{Code: RateLimited, Message: fmt.Sprintf(format, args...), RetryAfter: retryAfter}
+}
+
+//As finds the first Error in the chain of wrapped errors
+func As(err error) (Error, bool) {
+	for ; err != nil; err = parent(err) {
+		switch e := err.(type) {
+		case Error:
+			return e, true
+		case *Error:
+			return *e, true
+		}
+	}
+	return Error{}, false
+}
+
+//From describes any error for the API without leaking internals:
+//it uses the first Error or errors.Errorc() 4xx code in the chain
+//and recognises not found and duplicate database errors.
+//Everything else is an internal error with a generic message.
+func From(err error) Error {
+	for e := err; e != nil; e = parent(e) {
+		switch t := e.(type) {
+		case Error:
+			return t.safe()
+		case *Error:
+			return t.safe()
+		case errors.IError:
+			if t.Code() > 0 {
+				//errors.Wrapf() copies the code, so use the message where the code was set
+				for p, ok := t.Parent().(errors.IError); ok && p.Code() == t.Code(); p, ok = t.Parent().(errors.IError) {
+					t = p
+				}
+				if t.Code() >= 500 {
+					break //message was not written for the user
+				}
+				return Error{Code: CodeForStatus(t.Code()), Message: t.Message()}
+			}
+		case *mysql.MySQLError:
+			switch t.Number {
+			case 1062: //ER_DUP_ENTRY
+				return Error{Code: Conflict, Message: "already exists"}
+			case 1451: //ER_ROW_IS_REFERENCED_2
+				return Error{Code: Conflict, Message: "still in use"}
+			case 1452: //ER_NO_REFERENCED_ROW_2
+				return Error{Code: ValidationFailed, Message: "refers to something that does not exist"}
+			}
+		}
+		if e == sql.ErrNoRows {
+			return Error{Code: NotFound, Message: "not found"}
+		}
+	}
+	return Error{Code: Internal, Message: "internal error"}
+} //From()
+
+//safe removes the cause which is only for logging
+func (e Error) safe() Error {
+	e.cause = nil
+	return e
+}
+
+//parent returns the wrapped error for both errors.IError and standard wrapped errors
+func parent(err error) error {
+	if e, ok := err.(errors.IError); ok {
+		return e.Parent()
+	}
+	return stderrors.Unwrap(err)
+}
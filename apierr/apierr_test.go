@@ -0,0 +1,55 @@
+package apierr_test
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jansemmelink/don8/apierr"
+)
+
+func TestFrom(t *testing.T) {
+	for _, test := range []struct {
+		err     error
+		code    apierr.Code
+		message string
+	}{
+		{errors.Errorf("db password is secret"), apierr.Internal, "internal error"},
+		{fmt.Errorf("plain: %w", errors.Errorf("no parent")), apierr.Internal, "internal error"},
+		{errors.Wrapf(errors.Errorc(http.StatusNotFound, "unknown group"), "handler failed"), apierr.NotFound, "unknown group"},
+		{errors.Errorc(http.StatusInternalServerError, "secret details"), apierr.Internal, "internal error"},
+		{errors.Wrapf(sql.ErrNoRows, "failed to get group"), apierr.NotFound, "not found"},
+		{errors.Wrapf(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, "failed"), apierr.Conflict, "already exists"},
+		{errors.Wrapf(apierr.Wrapf(errors.Errorf("secret"), apierr.Forbidden, "not allowed"), "handler failed"), apierr.Forbidden, "not allowed"},
+	} {
+		e := apierr.From(test.err)
+		if e.Code != test.code || e.Message != test.message {
+			t.Fatalf("%v -> %s:%s != %s:%s", test.err, e.Code, e.Message, test.code, test.message)
+		}
+	}
+}
+
+func TestValidation(t *testing.T) {
+	e := apierr.From(apierr.Validation(errors.Wrapf(apierr.Invalid("title", "missing title"), "invalid request")))
+	if e.Code != apierr.ValidationFailed || e.Code.Status() != http.StatusBadRequest {
+		t.Fatalf("wrong code: %+v", e)
+	}
+	if len(e.Fields) != 1 || e.Fields[0].Field != "title" {
+		t.Fatalf("wrong fields: %+v", e.Fields)
+	}
+	e = apierr.From(apierr.Validation(errors.Errorf("missing content")))
+	if e.Code != apierr.ValidationFailed || e.Message != "missing content" {
+		t.Fatalf("wrong error: %+v", e)
+	}
+}
+
+func TestLimited(t *testing.T) {
+	e := apierr.From(errors.Wrapf(apierr.Limited(90*time.Second, "too many attempts"), "handler failed"))
+	if e.Code != apierr.RateLimited || e.Code.Status() != http.StatusTooManyRequests || e.RetryAfter != 90*time.Second {
+		t.Fatalf("wrong error: %+v", e)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/db"
+)
+
+func groupTree(c *cmd) error {
+	args, err := c.parse(1)
+	if err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	tree, err := db.ListGroupTree(db.ID(args[0]))
+	if err != nil {
+		return err
+	}
+	rows := [][]string{}
+	for _, g := range tree {
+		rows = append(rows, []string{strings.Repeat("  ", g.Depth) + g.Title, string(g.ID), strconv.Itoa(g.Depth)})
+	}
+	return c.output(tree, []string{"TITLE", "ID", "DEPTH"}, rows)
+}
+
+func groupGrant(c *cmd) error {
+	role := c.flags.String("role", "coordinator", "Role of the user if not yet a member of the group")
+	args, err := c.parse(3)
+	if err != nil {
+		return err
+	}
+	if args[2] == "" {
+		return errors.Errorf("missing permission")
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	g, err := db.GetGroup(db.ID(args[0]))
+	if err != nil {
+		return errors.Wrapf(err, "unknown group %s", args[0])
+	}
+	u, err := lookupUser(args[1])
+	if err != nil {
+		return errors.Wrapf(err, "unknown user %s", args[1])
+	}
+	m, err := db.GrantGroupPermission(g.ID, u.ID, db.Permission(args[2]), *role)
+	if err != nil {
+		return err
+	}
+	grant := struct {
+		db.Member
+		Permission db.Permission `json:"permission"`
+	}{m, db.Permission(args[2])}
+	return c.output(grant,
+		[]string{"GROUP", "USER", "MEMBER", "ROLE", "PERMISSION"},
+		[][]string{{g.Title, u.Email, string(m.ID), m.Role, args[2]}})
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/config"
+	"github.com/jansemmelink/don8/queues/invitations"
+	"github.com/jansemmelink/don8/server"
+)
+
+//the server, workers and admin commands in one binary, e.g.:
+//
+//	don8 serve -config /etc/don8.json
+//	don8 user find -o json jan
+//	don8 group grant <group id> organiser@school.co.za '*'
+//	don8 replay -url https://api.don8.app conf/scenarios/signup.json
+type command struct {
+	name string //one or more words
+	args string //positional arguments after the flags
+	doc  string
+	run  func(cmd *cmd) error
+}
+
+var commands = []command{
+	{"serve", "", "Run the HTTP API server", serve},
+	{"worker invitations", "", "Send the group invitations queued by the server", workerInvitations},
+	{"config check", "", "Print the effective config with secrets redacted", configCheck},
+	{"user create", "", "Add a user and print the activation link", userCreate},
+	{"user find", "<filter>", "Find users by name or phone", userFind},
+	{"user reset", "<email>", "Print a link to set a new password", userReset},
+	{"user disable", "<id|email>", "End the user's session and prevent login", userDisable},
+	{"group tree", "<group id>", "Show the group and all its descendants", groupTree},
+	{"group grant", "<group id> <user id|email> <permission>", "Give a user a permission in a group, e.g. '*' to coordinate it", groupGrant},
+	{"session purge", "", "Delete expired sessions", sessionPurge},
+	{"tags migrate", "", "Link existing requests to tags in the tags tables", tagsMigrate},
+	{"seed", "", "Add a demo school with events, users, requests, promises and donations", seedDemo},
+	{"replay", "<scenario file> ...", "Call the API for each step in the files and check the responses", replay},
+}
+
+func main() {
+	args := os.Args[1:]
+	for _, c := range commands {
+		words := strings.Fields(c.name)
+		if len(args) < len(words) || strings.Join(args[:len(words)], " ") != c.name {
+			continue
+		}
+		os.Exit(run(c, args[len(words):]))
+	}
+	usage()
+	os.Exit(2)
+} //main()
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: don8 <command> [flags] [args]\n\nCommands:\n")
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", c.name, c.args, c.doc)
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "\nUse \"don8 <command> -h\" for the flags of a command.\n")
+}
+
+//cmd is the command being run with its flags
+type cmd struct {
+	command
+	ctx    context.Context
+	flags  *flag.FlagSet
+	loader *config.Loader
+	format *string
+	args   []string
+	config config.Config
+}
+
+func run(c command, args []string) int {
+	//stop on SIGINT (ctrl-C) or SIGTERM (docker stop or kubernetes)
+	//a second signal terminates immediately
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	fs := flag.NewFlagSet("don8 "+c.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: don8 %s [flags] %s\n\n%s\n\nFlags:\n", c.name, c.args, c.doc)
+		fs.PrintDefaults()
+	}
+	cmd := &cmd{
+		command: c,
+		ctx:     ctx,
+		flags:   fs,
+		loader:  config.NewLoader(fs),
+		format:  fs.String("o", "table", "Output format: table|json"),
+		args:    args,
+	}
+	if err := c.run(cmd); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "don8 %s failed: %+v\n", c.name, err)
+		return 1
+	}
+	return 0
+} //run()
+
+//parse the flags added by the command and load the config
+//then check the nr of positional args, which are returned
+//nrArgs -1 expects one or more
+func (c *cmd) parse(nrArgs int) ([]string, error) {
+	if err := c.flags.Parse(c.args); err != nil {
+		return nil, err
+	}
+	if (nrArgs >= 0 && c.flags.NArg() != nrArgs) || (nrArgs < 0 && c.flags.NArg() == 0) {
+		c.flags.Usage()
+		return nil, errors.Errorf("expecting arguments %s after the flags", c.command.args)
+	}
+	switch *c.format {
+	case "table", "json":
+	default:
+		return nil, errors.Errorf("invalid -o %s, expecting table|json", *c.format)
+	}
+	var err error
+	if c.config, err = c.loader.Load(); err != nil {
+		return nil, err
+	}
+	return c.flags.Args(), nil
+}
+
+//connect to the database for admin commands
+func (c *cmd) connect() error {
+	return c.config.ConnectDB(c.ctx)
+}
+
+//output writes v as JSON, or the header and rows as a table
+func (c *cmd) output(v interface{}, header []string, rows [][]string) error {
+	if *c.format == "json" {
+		jsonValue, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return errors.Wrapf(err, "cannot write JSON")
+		}
+		fmt.Println(string(jsonValue))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+//=====[ SERVER AND WORKERS ]=====
+func serve(c *cmd) error {
+	var o server.Options
+	o.Flags(c.flags)
+	if _, err := c.parse(0); err != nil {
+		return err
+	}
+	return server.Run(c.ctx, c.config, o)
+}
+
+func workerInvitations(c *cmd) error {
+	if _, err := c.parse(0); err != nil {
+		return err
+	}
+	return invitations.Run(c.ctx, c.config)
+}
+
+func configCheck(c *cmd) error {
+	if _, err := c.parse(0); err != nil {
+		return err
+	}
+	*c.format = "json" //the config file format
+	return c.output(c.config.Redacted(), nil, nil)
+}
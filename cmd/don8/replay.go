@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/scenario"
+	"github.com/jansemmelink/don8/server"
+)
+
+func replay(c *cmd) error {
+	url := c.flags.String("url", "", "Server to call (default http://localhost<addr>)")
+	inProcess := c.flags.Bool("in-process", false, "Call the API in this process instead of a running server")
+	stop := c.flags.Bool("stop", false, "Skip the remaining steps after the first failure")
+	verbose := c.flags.Bool("v", false, "Show each step as it completes")
+	var o server.Options
+	o.Flags(c.flags)
+	files, err := c.parse(-1)
+	if err != nil {
+		return err
+	}
+	var steps []scenario.Step
+	for _, f := range files {
+		fileSteps, err := scenario.Load(f)
+		if err != nil {
+			return err
+		}
+		steps = append(steps, fileSteps...)
+	}
+
+	r := scenario.Runner{
+		BaseURL:       *url,
+		StopOnFailure: *stop,
+	}
+	if *verbose {
+		r.Log = os.Stderr
+	}
+	if *inProcess {
+		h, closeHandler, err := server.NewHandler(c.ctx, c.config, o)
+		if err != nil {
+			return err
+		}
+		defer closeHandler()
+		r.Handler = h
+	} else if r.BaseURL == "" {
+		host, port, err := net.SplitHostPort(c.config.HTTP.Addr)
+		if err != nil {
+			return errors.Wrapf(err, "cannot get server url from addr \"%s\", use -url", c.config.HTTP.Addr)
+		}
+		if host == "" {
+			host = "localhost"
+		}
+		r.BaseURL = "http://" + net.JoinHostPort(host, port)
+	}
+
+	summary := r.Run(c.ctx, steps)
+	rows := [][]string{}
+	for i, result := range summary.Results {
+		status := "PASS"
+		if result.Skipped {
+			status = "SKIP"
+		} else if !result.Passed() {
+			status = "FAIL"
+		}
+		rows = append(rows, []string{strconv.Itoa(i + 1), status, result.Step.String(), strconv.Itoa(result.Status), result.Duration.String(), result.Error})
+	}
+	if err := c.output(summary, []string{"#", "RESULT", "STEP", "STATUS", "DURATION", "ERROR"}, rows); err != nil {
+		return err
+	}
+	if !summary.OK() {
+		return errors.Errorf("%s", summary)
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", summary)
+	return nil
+} //replay()
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/seed"
+)
+
+func seedDemo(c *cmd) error {
+	o := seed.DefaultOptions()
+	c.flags.Int64Var(&o.Seed, "seed", o.Seed, "Same seed gives the same data, and seeding again adds nothing")
+	c.flags.IntVar(&o.Events, "events", o.Events, "Nr of event groups in the school")
+	c.flags.IntVar(&o.Parents, "parents", o.Parents, "Nr of parent users")
+	c.flags.IntVar(&o.Coordinators, "coordinators", o.Coordinators, "Nr of coordinators per event")
+	c.flags.IntVar(&o.Requests, "requests", o.Requests, "Nr of requests per event")
+	c.flags.IntVar(&o.Invitations, "invitations", o.Invitations, "Nr of pending invitations to the school")
+	fixtureFile := c.flags.String("fixture", "", "Write the generated data to this JSON file")
+	dryRun := c.flags.Bool("dry-run", false, "Generate without writing to the database")
+	if _, err := c.parse(0); err != nil {
+		return err
+	}
+	f, err := seed.Generate(o, time.Now())
+	if err != nil {
+		return err
+	}
+	if *fixtureFile != "" {
+		jsonFixture, _ := json.MarshalIndent(f, "", "  ")
+		if err := os.WriteFile(*fixtureFile, jsonFixture, 0644); err != nil {
+			return errors.Wrapf(err, "cannot write fixture")
+		}
+	}
+
+	generated := f.Counts()
+	inserted := seed.Counts{}
+	if !*dryRun {
+		if c.config.Env == "production" {
+			return errors.Errorf("cannot seed demo data in production")
+		}
+		if err := c.connect(); err != nil {
+			return err
+		}
+		if inserted, err = seed.Apply(f); err != nil {
+			return err
+		}
+	}
+	names := []string{}
+	for name := range generated {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	rows := [][]string{}
+	for _, name := range names {
+		rows = append(rows, []string{name, strconv.Itoa(generated[name]), strconv.Itoa(inserted[name])})
+	}
+	fmt.Fprintf(os.Stderr, "Login as %s with password %s, or POST /dev/impersonate with the email of any seeded user\n", f.Users[0].Email, seed.Password)
+	return c.output(
+		map[string]interface{}{"generated": generated, "inserted": inserted, "principal": f.Users[0].Email, "password": seed.Password},
+		[]string{"TABLE", "GENERATED", "INSERTED"},
+		rows)
+} //seedDemo()
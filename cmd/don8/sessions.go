@@ -0,0 +1,22 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jansemmelink/don8/db"
+)
+
+func sessionPurge(c *cmd) error {
+	if _, err := c.parse(0); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	n, err := db.PurgeSessions(time.Now())
+	if err != nil {
+		return err
+	}
+	return c.output(map[string]int64{"purged": n}, []string{"PURGED"}, [][]string{{strconv.FormatInt(n, 10)}})
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/jansemmelink/don8/db"
+)
+
+//tagsMigrate links requests created before the tags tables to their tags,
+//after conf/mariadb/migrations/001-tags.sql created the tables
+func tagsMigrate(c *cmd) error {
+	if _, err := c.parse(0); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	n, err := db.MigrateTags()
+	if err != nil {
+		return err
+	}
+	return c.output(map[string]int{"migrated": n}, []string{"MIGRATED"}, [][]string{{strconv.Itoa(n)}})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/db"
+)
+
+//userRow is the output of user commands
+type userRow struct {
+	db.User
+	Link string `json:"link,omitempty" doc:"Activation or reset link to give to the user"`
+}
+
+func (c *cmd) outputUsers(users []userRow) error {
+	header := []string{"ID", "NAME", "PHONE", "EMAIL", "DISABLED"}
+	withLinks := false
+	for _, u := range users {
+		if u.Link != "" {
+			withLinks = true
+			header = append(header, "LINK")
+			break
+		}
+	}
+	rows := [][]string{}
+	for _, u := range users {
+		u.PwdHash = nil
+		u.Tpw = nil
+		row := []string{string(u.ID), u.Name, u.Phone, u.Email, yesNo(u.Disabled)}
+		if withLinks {
+			row = append(row, u.Link)
+		}
+		rows = append(rows, row)
+	}
+	return c.output(users, header, rows)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+//lookupUser by ID or email
+func lookupUser(idOrEmail string) (db.User, error) {
+	if strings.Contains(idOrEmail, "@") {
+		return db.GetUserByEmail(idOrEmail)
+	}
+	return db.GetUser(db.ID(idOrEmail))
+}
+
+func userCreate(c *cmd) error {
+	name := c.flags.String("name", "", "Name and surname")
+	email := c.flags.String("email", "", "Email address")
+	phone := c.flags.String("phone", "", "Phone nr, e.g. 0821234567")
+	link := c.flags.String("link", "", "Activation page of the app (default <app>/activate)")
+	if _, err := c.parse(0); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	u, err := db.AddUser(db.User{Name: *name, Email: *email, Phone: *phone})
+	if err != nil {
+		return err
+	}
+	if *link == "" {
+		*link = c.config.HTTP.AppURL + "/activate"
+	}
+	return c.outputUsers([]userRow{{User: u, Link: *link + "/" + *u.Tpw}})
+}
+
+func userFind(c *cmd) error {
+	limit := c.flags.Int("limit", 10, "Max nr of users to show (1..100)")
+	args, err := c.parse(1)
+	if err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	users, err := db.FindUsers(args[0], *limit)
+	if err != nil {
+		return err
+	}
+	rows := []userRow{}
+	for _, u := range users {
+		rows = append(rows, userRow{User: u})
+	}
+	return c.outputUsers(rows)
+}
+
+func userReset(c *cmd) error {
+	link := c.flags.String("link", "", "Reset page of the app (default <app>/reset)")
+	args, err := c.parse(1)
+	if err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	u, err := db.Reset(db.ResetRequest{Email: args[0]})
+	if err != nil {
+		return err
+	}
+	if *link == "" {
+		*link = c.config.HTTP.AppURL + "/reset"
+	}
+	return c.outputUsers([]userRow{{User: u, Link: *link + "/" + *u.Tpw}})
+}
+
+func userDisable(c *cmd) error {
+	args, err := c.parse(1)
+	if err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	u, err := lookupUser(args[0])
+	if err != nil {
+		return errors.Wrapf(err, "unknown user %s", args[0])
+	}
+	if err := db.DisableUser(u.ID); err != nil {
+		return err
+	}
+	u.Disabled = true
+	return c.outputUsers([]userRow{{User: u}})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jansemmelink/don8/config"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/importer"
+	"github.com/stewelarend/logger"
+)
+
+var log = logger.New().WithLevel(logger.LevelDebug)
+
+// import child groups and requests from a CSV or XLSX file into a group, e.g.:
+//
+//	go run ./cmd/import -group <id> -user organiser@school.co.za -file wildsfees.csv -dry-run
+func main() {
+	groupPtr := flag.String("group", "", "Parent group ID to import into")
+	userPtr := flag.String("user", "", "Email of the user who will coordinate new child groups")
+	filePtr := flag.String("file", "", "CSV or XLSX file to import")
+	dryRunPtr := flag.Bool("dry-run", false, "Only validate and report what would be done")
+	loader := config.NewLoader(flag.CommandLine)
+	flag.Parse()
+	if *groupPtr == "" || *userPtr == "" || *filePtr == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	c, err := loader.Load()
+	if err != nil {
+		log.Errorf("cannot load config: %+v", err)
+		os.Exit(1)
+	}
+	if err := c.ConnectDB(context.Background()); err != nil {
+		log.Errorf("cannot connect to the database: %+v", err)
+		os.Exit(1)
+	}
+
+	user, err := db.GetUserByEmail(*userPtr)
+	if err != nil {
+		log.Errorf("unknown user(%s): %+v", *userPtr, err)
+		os.Exit(1)
+	}
+
+	var rows []importer.Row
+	if strings.HasSuffix(strings.ToLower(*filePtr), ".xlsx") {
+		content, err := os.ReadFile(*filePtr)
+		if err != nil {
+			log.Errorf("cannot read %s: %+v", *filePtr, err)
+			os.Exit(1)
+		}
+		rows, err = importer.ReadXLSX(content)
+		if err != nil {
+			log.Errorf("cannot import %s: %+v", *filePtr, err)
+			os.Exit(1)
+		}
+	} else {
+		f, err := os.Open(*filePtr)
+		if err != nil {
+			log.Errorf("cannot open %s: %+v", *filePtr, err)
+			os.Exit(1)
+		}
+		rows, err = importer.ReadCSV(f)
+		f.Close()
+		if err != nil {
+			log.Errorf("cannot import %s: %+v", *filePtr, err)
+			os.Exit(1)
+		}
+	}
+
+	result, err := importer.Import(db.Store{}, user, db.ID(*groupPtr), rows, *dryRunPtr)
+	if err != nil {
+		log.Errorf("import failed: %+v", err)
+		os.Exit(1)
+	}
+	jsonResult, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(jsonResult))
+	if len(result.Errors) > 0 {
+		for _, e := range result.Errors {
+			fmt.Fprintln(os.Stderr, e.String())
+		}
+		os.Exit(1)
+	}
+}
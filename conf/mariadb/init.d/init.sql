@@ -2,8 +2,18 @@ CREATE DATABASE IF NOT EXISTS `don8`;
 GRANT ALL PRIVILEGES ON `don8`.* to 'don8'@'%' IDENTIFIED BY 'don8';
 
 DROP TABLE IF EXISTS `logs`;
+DROP TABLE IF EXISTS `webhook_deliveries`;
+DROP TABLE IF EXISTS `webhooks`;
+DROP TABLE IF EXISTS `outbound_messages`;
+DROP TABLE IF EXISTS `overdue_digests`;
+DROP TABLE IF EXISTS `promise_reminders`;
+DROP TABLE IF EXISTS `group_reminders`;
+DROP TABLE IF EXISTS `group_branding`;
+DROP TABLE IF EXISTS `payments`;
 DROP TABLE IF EXISTS `receives`;
 DROP TABLE IF EXISTS `promises`;
+DROP TABLE IF EXISTS `request_tags`;
+DROP TABLE IF EXISTS `tags`;
 DROP TABLE IF EXISTS `requests`;
 DROP TABLE IF EXISTS `location_schedules`;
 DROP TABLE IF EXISTS `locations`;
@@ -22,11 +32,14 @@ CREATE TABLE `users` (
   `tpw` VARCHAR(40) DEFAULT NULL,
   `tpw_exp` DATETIME DEFAULT NULL,
   `pwd_hash` VARCHAR(40) DEFAULT NULL,
+  `email_status` VARCHAR(30) NOT NULL DEFAULT '',
+  `disabled` TINYINT(1) NOT NULL DEFAULT 0,
   UNIQUE KEY `user_id` (`id`),
   UNIQUE KEY `user_phone` (`phone`),
   UNIQUE KEY `user_email` (`email`),
-  UNIQUE KEY `user_tpw` (`tpw`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+  UNIQUE KEY `user_tpw` (`tpw`),
+  FULLTEXT KEY `user_search` (`name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3 COLLATE=utf8mb3_general_ci;
 
 CREATE TABLE `sessions` (
   `id` VARCHAR(40) DEFAULT (uuid()) NOT NULL,
@@ -47,8 +60,9 @@ CREATE TABLE `groups` (
   `end` DATETIME DEFAULT NULL,
   UNIQUE KEY `group_id` (`id`),
   UNIQUE KEY `group_title` (`parent_group_id`,`title`),
-  KEY `group_start` (`start`)
-) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+  KEY `group_start` (`start`),
+  FULLTEXT KEY `group_search` (`title`,`description`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3 COLLATE=utf8mb3_general_ci;
 
 CREATE TABLE `invitations` (
   `id` VARCHAR(40) NOT NULL,
@@ -107,12 +121,43 @@ CREATE TABLE `requests` (
   `group_id` VARCHAR(40) NOT NULL,
   `title` VARCHAR(100) NOT NULL,
   `description` VARCHAR(255) DEFAULT NULL,
-  `tags` VARCHAR(255) DEFAULT NULL,
+  `tags` VARCHAR(600) DEFAULT NULL COMMENT 'copy of request_tags names as |<name>|<name>| for the FULLTEXT index',
+  `type` VARCHAR(10) NOT NULL DEFAULT 'goods',
+  `currency` VARCHAR(3) NOT NULL DEFAULT '' COMMENT 'money requests have qty in minor units of the currency',
   `units` VARCHAR(100) DEFAULT NULL,
   `qty` INT(11) DEFAULT 0,
+  `status` VARCHAR(20) NOT NULL DEFAULT 'open',
+  `needed_by` DATETIME DEFAULT NULL,
+  `priority` INT(11) NOT NULL DEFAULT 0,
+  `min_per_donor` INT(11) NOT NULL DEFAULT 0,
+  `max_per_donor` INT(11) NOT NULL DEFAULT 0,
+  `overflow_pct` INT(11) NOT NULL DEFAULT 0,
+  `waitlist` TINYINT(1) NOT NULL DEFAULT 0,
   UNIQUE KEY `request_id` (`id`),
   UNIQUE KEY `request_title` (`group_id`,`title`),
+  KEY `request_status` (`group_id`,`status`),
+  FULLTEXT KEY `request_search` (`title`,`description`,`tags`),
+  FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3 COLLATE=utf8mb3_general_ci;
+
+CREATE TABLE `tags` (
+  `id` VARCHAR(40) NOT NULL,
+  `group_id` VARCHAR(40) NOT NULL,
+  `name` VARCHAR(50) NOT NULL,
+  `colour` VARCHAR(7) NOT NULL DEFAULT '',
+  `description` VARCHAR(255) DEFAULT NULL,
+  UNIQUE KEY `tag_id` (`id`),
+  UNIQUE KEY `tag_group_name` (`group_id`,`name`),
   FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3 COLLATE=utf8mb3_general_ci;
+
+CREATE TABLE `request_tags` (
+  `request_id` VARCHAR(40) NOT NULL,
+  `tag_id` VARCHAR(40) NOT NULL,
+  UNIQUE KEY `request_tag` (`request_id`,`tag_id`),
+  KEY `request_tag_tag` (`tag_id`),
+  FOREIGN KEY (`request_id`) REFERENCES `requests`(`id`),
+  FOREIGN KEY (`tag_id`) REFERENCES `tags`(`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
 
 CREATE TABLE `promises` (
@@ -122,7 +167,13 @@ CREATE TABLE `promises` (
   `location_id` VARCHAR(40) DEFAULT NULL,
   `qty` INT(11) NOT NULL,
   `date` DATETIME NOT NULL,
+  `status` VARCHAR(30) NOT NULL DEFAULT '',
+  `time_created` DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  `reference` VARCHAR(20) DEFAULT NULL COMMENT 'pledges for money requests are paid with this reference',
   UNIQUE KEY `promise_id` (`id`),
+  UNIQUE KEY `promise_reference` (`reference`),
+  KEY `promise_status_date` (`status`,`date`),
+  KEY `promise_request_status` (`request_id`,`status`),
   FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),
   FOREIGN KEY (`request_id`) REFERENCES `requests`(`id`),
   FOREIGN KEY (`location_id`) REFERENCES `locations`(`id`)
@@ -134,6 +185,7 @@ CREATE TABLE `receives` (
   `request_id` VARCHAR(40) DEFAULT NULL,
   `promise_id` VARCHAR(40) DEFAULT NULL,
   `title` VARCHAR(100) NOT NULL,
+  `unit` VARCHAR(100) NOT NULL,
   `qty` INT(11) NOT NULL,
   UNIQUE KEY `receive_id` (`id`),
   FOREIGN KEY (`location_id`) REFERENCES `locations`(`id`),
@@ -141,6 +193,109 @@ CREATE TABLE `receives` (
   FOREIGN KEY (`promise_id`) REFERENCES `promises`(`id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
 
+CREATE TABLE `payments` (
+  `id` VARCHAR(40) NOT NULL,
+  `request_id` VARCHAR(40) NOT NULL,
+  `promise_id` VARCHAR(40) DEFAULT NULL,
+  `user_id` VARCHAR(40) DEFAULT NULL,
+  `amount` INT(11) NOT NULL COMMENT 'minor units of the currency',
+  `currency` VARCHAR(3) NOT NULL,
+  `method` VARCHAR(10) NOT NULL COMMENT 'cash|eft|card',
+  `reference` VARCHAR(100) DEFAULT NULL,
+  `date` DATETIME NOT NULL,
+  `recorded_by` VARCHAR(40) NOT NULL,
+  `time_created` DATETIME NOT NULL,
+  UNIQUE KEY `payment_id` (`id`),
+  KEY `payment_request` (`request_id`),
+  KEY `payment_promise` (`promise_id`),
+  FOREIGN KEY (`request_id`) REFERENCES `requests`(`id`),
+  FOREIGN KEY (`promise_id`) REFERENCES `promises`(`id`),
+  FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),
+  FOREIGN KEY (`recorded_by`) REFERENCES `users`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+
+CREATE TABLE `group_branding` (
+  `group_id` VARCHAR(40) NOT NULL,
+  `from_name` VARCHAR(100) DEFAULT NULL,
+  `logo_url` VARCHAR(255) DEFAULT NULL,
+  `signature` VARCHAR(255) DEFAULT NULL,
+  `locale` VARCHAR(10) DEFAULT NULL,
+  UNIQUE KEY `group_branding_group` (`group_id`),
+  FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+
+CREATE TABLE `group_reminders` (
+  `group_id` VARCHAR(40) NOT NULL,
+  `days_before` VARCHAR(100) NOT NULL,
+  `overdue_digest` TINYINT(1) DEFAULT 1,
+  UNIQUE KEY `group_reminder_group` (`group_id`),
+  FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+
+CREATE TABLE `promise_reminders` (
+  `promise_id` VARCHAR(40) NOT NULL,
+  `kind` VARCHAR(30) NOT NULL,
+  `time_sent` DATETIME NOT NULL,
+  UNIQUE KEY `promise_reminder_uniq` (`promise_id`,`kind`),
+  FOREIGN KEY (`promise_id`) REFERENCES `promises`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+
+CREATE TABLE `overdue_digests` (
+  `group_id` VARCHAR(40) NOT NULL,
+  `date` DATE NOT NULL,
+  `time_sent` DATETIME NOT NULL,
+  UNIQUE KEY `overdue_digest_uniq` (`group_id`,`date`),
+  FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+
+CREATE TABLE `outbound_messages` (
+  `id` VARCHAR(40) NOT NULL,
+  `time_created` DATETIME NOT NULL,
+  `time_updated` DATETIME NOT NULL,
+  `ref` VARCHAR(100) DEFAULT NULL,
+  `from_addr` VARCHAR(100) NOT NULL,
+  `to_addrs` VARCHAR(1000) NOT NULL,
+  `subject` VARCHAR(255) NOT NULL,
+  `status` VARCHAR(30) NOT NULL,
+  `error` VARCHAR(255) DEFAULT NULL,
+  `message_id` VARCHAR(255) DEFAULT NULL,
+  UNIQUE KEY `outbound_message_id` (`id`),
+  KEY `outbound_message_ref` (`ref`),
+  KEY `outbound_message_message_id` (`message_id`),
+  KEY `outbound_message_time` (`time_created`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+
+CREATE TABLE `webhooks` (
+  `id` VARCHAR(40) NOT NULL,
+  `group_id` VARCHAR(40) NOT NULL,
+  `url` VARCHAR(255) NOT NULL,
+  `events` VARCHAR(255) NOT NULL,
+  `secret` VARCHAR(100) NOT NULL,
+  `time_created` DATETIME NOT NULL,
+  UNIQUE KEY `webhook_id` (`id`),
+  KEY `webhook_group` (`group_id`),
+  FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+
+CREATE TABLE `webhook_deliveries` (
+  `id` VARCHAR(40) NOT NULL,
+  `webhook_id` VARCHAR(40) NOT NULL,
+  `event_id` VARCHAR(40) NOT NULL,
+  `event_type` VARCHAR(40) NOT NULL,
+  `payload` TEXT NOT NULL,
+  `status` VARCHAR(30) NOT NULL,
+  `attempts` INT NOT NULL DEFAULT 0,
+  `next_attempt` DATETIME DEFAULT NULL,
+  `response_status` INT DEFAULT NULL,
+  `error` VARCHAR(255) DEFAULT NULL,
+  `time_created` DATETIME NOT NULL,
+  `time_updated` DATETIME NOT NULL,
+  UNIQUE KEY `webhook_delivery_id` (`id`),
+  UNIQUE KEY `webhook_delivery_event` (`webhook_id`,`event_id`),
+  KEY `webhook_delivery_due` (`status`,`next_attempt`),
+  FOREIGN KEY (`webhook_id`) REFERENCES `webhooks`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+
 CREATE TABLE `logs` (
   `id` VARCHAR(40) DEFAULT (uuid()) NOT NULL,
   `table` VARCHAR(100) NOT NULL,
@@ -0,0 +1,25 @@
+-- Tags of requests were only stored in requests.tags as |<tag>|<tag>|
+-- Run this on databases created before the tags tables were added to init.d/init.sql,
+-- then "don8 tags migrate" to link the existing requests to their tags.
+
+CREATE TABLE IF NOT EXISTS `tags` (
+  `id` VARCHAR(40) NOT NULL,
+  `group_id` VARCHAR(40) NOT NULL,
+  `name` VARCHAR(50) NOT NULL,
+  `colour` VARCHAR(7) NOT NULL DEFAULT '',
+  `description` VARCHAR(255) DEFAULT NULL,
+  UNIQUE KEY `tag_id` (`id`),
+  UNIQUE KEY `tag_group_name` (`group_id`,`name`),
+  FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3 COLLATE=utf8mb3_general_ci;
+
+CREATE TABLE IF NOT EXISTS `request_tags` (
+  `request_id` VARCHAR(40) NOT NULL,
+  `tag_id` VARCHAR(40) NOT NULL,
+  UNIQUE KEY `request_tag` (`request_id`,`tag_id`),
+  KEY `request_tag_tag` (`tag_id`),
+  FOREIGN KEY (`request_id`) REFERENCES `requests`(`id`),
+  FOREIGN KEY (`tag_id`) REFERENCES `tags`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+
+ALTER TABLE `requests` MODIFY `tags` VARCHAR(600) DEFAULT NULL COMMENT 'copy of request_tags names as |<name>|<name>| for the FULLTEXT index';
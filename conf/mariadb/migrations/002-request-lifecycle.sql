@@ -0,0 +1,17 @@
+-- Requests had no status, deadline, priority or per donor limits
+-- Run this on databases created before these columns were added to init.d/init.sql.
+
+ALTER TABLE `requests`
+  ADD COLUMN IF NOT EXISTS `status` VARCHAR(20) NOT NULL DEFAULT 'open',
+  ADD COLUMN IF NOT EXISTS `needed_by` DATETIME DEFAULT NULL,
+  ADD COLUMN IF NOT EXISTS `priority` INT(11) NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS `min_per_donor` INT(11) NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS `max_per_donor` INT(11) NOT NULL DEFAULT 0,
+  ADD KEY IF NOT EXISTS `request_status` (`group_id`,`status`);
+
+-- Requests that already received their quantity are fulfilled.
+-- This only counts donations in the request unit, others are updated with the next donation.
+UPDATE `requests` AS r SET r.`status`='fulfilled'
+  WHERE r.`status`='open'
+  AND r.`qty`<=(SELECT COALESCE(SUM(rc.`qty`),0) FROM `receives` AS rc
+    WHERE rc.`request_id`=r.`id` AND rc.`unit`=COALESCE(NULLIF(r.`units`,''),'items'));
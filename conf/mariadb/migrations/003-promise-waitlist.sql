@@ -0,0 +1,11 @@
+-- Requests had no limit on the quantity promised
+-- Run this on databases created before these columns were added to init.d/init.sql.
+
+ALTER TABLE `requests`
+  ADD COLUMN IF NOT EXISTS `overflow_pct` INT(11) NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS `waitlist` TINYINT(1) NOT NULL DEFAULT 0;
+
+-- Existing promises get the same time, so their waitlist order is by id.
+ALTER TABLE `promises`
+  ADD COLUMN IF NOT EXISTS `time_created` DATETIME(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  ADD KEY IF NOT EXISTS `promise_request_status` (`request_id`,`status`);
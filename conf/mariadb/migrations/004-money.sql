@@ -0,0 +1,31 @@
+-- Requests were only for goods, with no pledges or payments of money
+-- Run this on databases created before these columns were added to init.d/init.sql.
+
+ALTER TABLE `requests`
+  ADD COLUMN IF NOT EXISTS `type` VARCHAR(10) NOT NULL DEFAULT 'goods' AFTER `tags`,
+  ADD COLUMN IF NOT EXISTS `currency` VARCHAR(3) NOT NULL DEFAULT '' COMMENT 'money requests have qty in minor units of the currency' AFTER `type`;
+
+ALTER TABLE `promises`
+  ADD COLUMN IF NOT EXISTS `reference` VARCHAR(20) DEFAULT NULL COMMENT 'pledges for money requests are paid with this reference',
+  ADD UNIQUE KEY IF NOT EXISTS `promise_reference` (`reference`);
+
+CREATE TABLE IF NOT EXISTS `payments` (
+  `id` VARCHAR(40) NOT NULL,
+  `request_id` VARCHAR(40) NOT NULL,
+  `promise_id` VARCHAR(40) DEFAULT NULL,
+  `user_id` VARCHAR(40) DEFAULT NULL,
+  `amount` INT(11) NOT NULL COMMENT 'minor units of the currency',
+  `currency` VARCHAR(3) NOT NULL,
+  `method` VARCHAR(10) NOT NULL COMMENT 'cash|eft|card',
+  `reference` VARCHAR(100) DEFAULT NULL,
+  `date` DATETIME NOT NULL,
+  `recorded_by` VARCHAR(40) NOT NULL,
+  `time_created` DATETIME NOT NULL,
+  UNIQUE KEY `payment_id` (`id`),
+  KEY `payment_request` (`request_id`),
+  KEY `payment_promise` (`promise_id`),
+  FOREIGN KEY (`request_id`) REFERENCES `requests`(`id`),
+  FOREIGN KEY (`promise_id`) REFERENCES `promises`(`id`),
+  FOREIGN KEY (`user_id`) REFERENCES `users`(`id`),
+  FOREIGN KEY (`recorded_by`) REFERENCES `users`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
@@ -0,0 +1,13 @@
+-- Received quantities had no unit, so they could not be converted to the request unit
+-- Run this on databases created before this column was added to init.d/init.sql,
+-- before 002-request-lifecycle.sql which counts the received quantities per unit.
+
+ALTER TABLE `receives`
+  ADD COLUMN IF NOT EXISTS `unit` VARCHAR(100) NOT NULL DEFAULT '' AFTER `title`;
+
+-- Existing donations were counted in the request unit.
+UPDATE `receives` AS rc LEFT JOIN `requests` AS r ON r.`id`=rc.`request_id`
+  SET rc.`unit`=COALESCE(NULLIF(r.`units`,''),'items')
+  WHERE rc.`unit`='';
+
+ALTER TABLE `receives` ALTER COLUMN `unit` DROP DEFAULT;
@@ -0,0 +1,31 @@
+-- Promises had no status and donors were not reminded of them
+-- Run this on databases created before these columns and tables were added to init.d/init.sql,
+-- before 003-promise-waitlist.sql which indexes the promise status.
+
+ALTER TABLE `promises`
+  ADD COLUMN IF NOT EXISTS `status` VARCHAR(30) NOT NULL DEFAULT '',
+  ADD KEY IF NOT EXISTS `promise_status_date` (`status`,`date`);
+
+CREATE TABLE IF NOT EXISTS `group_reminders` (
+  `group_id` VARCHAR(40) NOT NULL,
+  `days_before` VARCHAR(100) NOT NULL,
+  `overdue_digest` TINYINT(1) DEFAULT 1,
+  UNIQUE KEY `group_reminder_group` (`group_id`),
+  FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+
+CREATE TABLE IF NOT EXISTS `promise_reminders` (
+  `promise_id` VARCHAR(40) NOT NULL,
+  `kind` VARCHAR(30) NOT NULL,
+  `time_sent` DATETIME NOT NULL,
+  UNIQUE KEY `promise_reminder_uniq` (`promise_id`,`kind`),
+  FOREIGN KEY (`promise_id`) REFERENCES `promises`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+
+CREATE TABLE IF NOT EXISTS `overdue_digests` (
+  `group_id` VARCHAR(40) NOT NULL,
+  `date` DATE NOT NULL,
+  `time_sent` DATETIME NOT NULL,
+  UNIQUE KEY `overdue_digest_uniq` (`group_id`,`date`),
+  FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
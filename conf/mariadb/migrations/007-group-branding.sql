@@ -0,0 +1,12 @@
+-- Emails had no group branding
+-- Run this on databases created before this table was added to init.d/init.sql.
+
+CREATE TABLE IF NOT EXISTS `group_branding` (
+  `group_id` VARCHAR(40) NOT NULL,
+  `from_name` VARCHAR(100) DEFAULT NULL,
+  `logo_url` VARCHAR(255) DEFAULT NULL,
+  `signature` VARCHAR(255) DEFAULT NULL,
+  `locale` VARCHAR(10) DEFAULT NULL,
+  UNIQUE KEY `group_branding_group` (`group_id`),
+  FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
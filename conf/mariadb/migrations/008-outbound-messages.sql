@@ -0,0 +1,22 @@
+-- Sent emails were not logged and bounces were not recorded on the user
+-- Run this on databases created before this column and table were added to init.d/init.sql.
+
+ALTER TABLE `users`
+  ADD COLUMN IF NOT EXISTS `email_status` VARCHAR(30) NOT NULL DEFAULT '' AFTER `pwd_hash`;
+
+CREATE TABLE IF NOT EXISTS `outbound_messages` (
+  `id` VARCHAR(40) NOT NULL,
+  `time_created` DATETIME NOT NULL,
+  `time_updated` DATETIME NOT NULL,
+  `ref` VARCHAR(100) DEFAULT NULL,
+  `from_addr` VARCHAR(100) NOT NULL,
+  `to_addrs` VARCHAR(1000) NOT NULL,
+  `subject` VARCHAR(255) NOT NULL,
+  `status` VARCHAR(30) NOT NULL,
+  `error` VARCHAR(255) DEFAULT NULL,
+  `message_id` VARCHAR(255) DEFAULT NULL,
+  UNIQUE KEY `outbound_message_id` (`id`),
+  KEY `outbound_message_ref` (`ref`),
+  KEY `outbound_message_message_id` (`message_id`),
+  KEY `outbound_message_time` (`time_created`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
@@ -0,0 +1,33 @@
+-- Groups had no webhooks
+-- Run this on databases created before these tables were added to init.d/init.sql.
+
+CREATE TABLE IF NOT EXISTS `webhooks` (
+  `id` VARCHAR(40) NOT NULL,
+  `group_id` VARCHAR(40) NOT NULL,
+  `url` VARCHAR(255) NOT NULL,
+  `events` VARCHAR(255) NOT NULL,
+  `secret` VARCHAR(100) NOT NULL,
+  `time_created` DATETIME NOT NULL,
+  UNIQUE KEY `webhook_id` (`id`),
+  KEY `webhook_group` (`group_id`),
+  FOREIGN KEY (`group_id`) REFERENCES `groups`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
+
+CREATE TABLE IF NOT EXISTS `webhook_deliveries` (
+  `id` VARCHAR(40) NOT NULL,
+  `webhook_id` VARCHAR(40) NOT NULL,
+  `event_id` VARCHAR(40) NOT NULL,
+  `event_type` VARCHAR(40) NOT NULL,
+  `payload` TEXT NOT NULL,
+  `status` VARCHAR(30) NOT NULL,
+  `attempts` INT NOT NULL DEFAULT 0,
+  `next_attempt` DATETIME DEFAULT NULL,
+  `response_status` INT DEFAULT NULL,
+  `error` VARCHAR(255) DEFAULT NULL,
+  `time_created` DATETIME NOT NULL,
+  `time_updated` DATETIME NOT NULL,
+  UNIQUE KEY `webhook_delivery_id` (`id`),
+  UNIQUE KEY `webhook_delivery_event` (`webhook_id`,`event_id`),
+  KEY `webhook_delivery_due` (`status`,`next_attempt`),
+  FOREIGN KEY (`webhook_id`) REFERENCES `webhooks`(`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb3;
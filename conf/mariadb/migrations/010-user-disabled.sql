@@ -0,0 +1,5 @@
+-- Users could not be disabled
+-- Run this on databases created before this column was added to init.d/init.sql.
+
+ALTER TABLE `users`
+  ADD COLUMN IF NOT EXISTS `disabled` TINYINT(1) NOT NULL DEFAULT 0 AFTER `email_status`;
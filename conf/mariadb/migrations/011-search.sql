@@ -0,0 +1,15 @@
+-- Search had no FULLTEXT indexes
+-- Run this on databases created before these indexes were added to init.d/init.sql.
+-- The general_ci collation ignores case and accents, so "hoer" finds "Hoërskool".
+
+ALTER TABLE `users`
+  CONVERT TO CHARACTER SET utf8mb3 COLLATE utf8mb3_general_ci,
+  ADD FULLTEXT KEY IF NOT EXISTS `user_search` (`name`);
+
+ALTER TABLE `groups`
+  CONVERT TO CHARACTER SET utf8mb3 COLLATE utf8mb3_general_ci,
+  ADD FULLTEXT KEY IF NOT EXISTS `group_search` (`title`,`description`);
+
+ALTER TABLE `requests`
+  CONVERT TO CHARACTER SET utf8mb3 COLLATE utf8mb3_general_ci,
+  ADD FULLTEXT KEY IF NOT EXISTS `request_search` (`title`,`description`,`tags`);
@@ -0,0 +1,261 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/jansemmelink/don8/cors"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/emails"
+	"github.com/jansemmelink/don8/redact"
+)
+
+//Config of the server and workers, loaded by Loader.Load() from (in order of precedence):
+//flags, env vars, a JSON file and the defaults.
+//Fields tagged env:"..." and flag:"..." can be set that way, secret:"true" are redacted when printed.
+type Config struct {
+	Env       string        `json:"env" env:"DON8_ENV" flag:"env" doc:"dev|production (default production), selects defaults such as the CORS preset"`
+	DevRoutes bool          `json:"dev_routes" env:"DON8_DEV_ROUTES" flag:"dev-routes" doc:"Add /dev/ routes, e.g. to impersonate seeded users (only allowed with env dev)"`
+	Admins    string        `json:"admins" env:"DON8_ADMINS" flag:"admins" doc:"Comma separated emails of system admins, who may list outbound mail and report bounces"`
+	HTTP      HTTP          `json:"http"`
+	DB        db.Config     `json:"db"`
+	Redis     Redis         `json:"redis"`
+	Mail      emails.Config `json:"mail"`
+	SMS       SMS           `json:"sms"`
+	Session   Session       `json:"session"`
+}
+
+type HTTP struct {
+	Addr       string `json:"addr" env:"HTTP_ADDR" flag:"addr" doc:"HTTP server address"`
+	AppURL     string `json:"app_url" env:"APP_URL" flag:"app" doc:"Base URL of the app used in links sent to users"`
+	TrustProxy bool   `json:"trust_proxy" env:"HTTP_TRUST_PROXY" flag:"trust-proxy" doc:"Use X-Forwarded-For as client IP (only behind a proxy that sets it)"`
+	CORS       string `json:"cors" env:"HTTP_CORS" flag:"cors" doc:"CORS and security headers preset: dev|production (default same as env)"`
+	CORSFile   string `json:"cors_file" env:"HTTP_CORS_FILE" flag:"cors-file" doc:"JSON file with CORS policy values to replace those of the preset"`
+	//ShutdownTimeout should be less than the time the orchestrator waits after SIGTERM, e.g. 30s in kubernetes
+	ShutdownTimeout Duration `json:"shutdown_timeout" env:"HTTP_SHUTDOWN_TIMEOUT" doc:"Max time to finish requests in progress after SIGTERM"`
+}
+
+func (c *HTTP) Validate(env string) error {
+	if c.Addr == "" {
+		return errors.Errorf("missing addr")
+	}
+	if u, err := url.Parse(c.AppURL); err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.Errorf("invalid app_url \"%s\"", c.AppURL)
+	}
+	c.AppURL = strings.TrimSuffix(c.AppURL, "/")
+	if c.ShutdownTimeout <= 0 {
+		return errors.Errorf("invalid shutdown_timeout:%s", c.ShutdownTimeout)
+	}
+	if c.CORS == "" {
+		c.CORS = env
+	}
+	if _, err := cors.Load(c.CORS, c.CORSFile); err != nil {
+		return err
+	}
+	return nil
+}
+
+type Redis struct {
+	Addr     string `json:"addr" env:"REDIS_ADDR" flag:"redis" doc:"Redis address used for queues, live events and rate limits"`
+	Password string `json:"password,omitempty" env:"REDIS_PASSWORD" secret:"true"`
+	DB       int    `json:"db" env:"REDIS_DB"`
+}
+
+func (c Redis) Validate() error {
+	if c.Addr == "" {
+		return errors.Errorf("missing addr")
+	}
+	if c.DB < 0 {
+		return errors.Errorf("invalid db:%d", c.DB)
+	}
+	return nil
+}
+
+//NewClient does not connect yet, so it only fails when used
+func (c Redis) NewClient() *redis.Client {
+	return redis.NewClient(&redis.Options{
+		Addr:     c.Addr,
+		Password: c.Password,
+		DB:       c.DB,
+	})
+}
+
+//SMS gateway for messages to users who registered with only a phone nr
+//nothing is sent while the provider is not set
+type SMS struct {
+	Provider string `json:"provider" env:"SMS_PROVIDER" doc:"Empty to not send SMS, or http to post to the URL"`
+	URL      string `json:"url" env:"SMS_URL"`
+	APIKey   string `json:"api_key,omitempty" env:"SMS_API_KEY" secret:"true"`
+	Sender   string `json:"sender" env:"SMS_SENDER" doc:"Sender ID or nr shown to the recipient"`
+}
+
+func (c SMS) Validate() error {
+	switch c.Provider {
+	case "":
+	case "http":
+		if u, err := url.Parse(c.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			return errors.Errorf("invalid url \"%s\"", c.URL)
+		}
+		if c.APIKey == "" {
+			return errors.Errorf("missing api_key")
+		}
+	default:
+		return errors.Errorf("unknown provider \"%s\" (expecting http or empty)", c.Provider)
+	}
+	return nil
+}
+
+type Session struct {
+	Lifetime           Duration `json:"lifetime" env:"SESSION_LIFETIME" doc:"Time after the last request that a session expires"`
+	ActivationLifetime Duration `json:"activation_lifetime" env:"SESSION_ACTIVATION_LIFETIME" doc:"Time that register and reset links can be used"`
+	PasswordSalt       string   `json:"password_salt,omitempty" env:"PASSWORD_SALT" secret:"true" doc:"Used in password hashes, cannot change once users registered"`
+}
+
+func (c Session) Validate(env string) error {
+	if c.Lifetime <= 0 {
+		return errors.Errorf("invalid lifetime:%s", c.Lifetime)
+	}
+	if c.ActivationLifetime <= 0 {
+		return errors.Errorf("invalid activation_lifetime:%s", c.ActivationLifetime)
+	}
+	if env == "production" && c.PasswordSalt == "" {
+		return errors.Errorf("missing password_salt (required in production)")
+	}
+	return nil
+}
+
+//Defaults are used for all values not set in the file, env or flags
+//except env, which is production unless dev is set explicitly, so an unconfigured server is not permissive
+func Defaults() Config {
+	return Config{
+		Env: "production",
+		HTTP: HTTP{
+			Addr:            ":3500",
+			AppURL:          "http://localhost:3000",
+			ShutdownTimeout: Duration(25 * time.Second),
+		},
+		DB: db.Config{
+			Host:           "127.0.0.1",
+			Port:           3311,
+			Username:       "don8",
+			Password:       "don8",
+			Database:       "don8",
+			MaxConnSeconds: 2,
+			MaxConnOpen:    5,
+			MaxConnIdle:    5,
+			MaxWaitSeconds: 60,
+		},
+		Redis: Redis{
+			Addr: "localhost:6379",
+		},
+		Mail: emails.Config{
+			Sink: "file",
+			Dir:  "./mail",
+		},
+		Session: Session{
+			Lifetime:           Duration(5 * time.Minute),
+			ActivationLifetime: Duration(24 * time.Hour),
+		},
+	}
+} //Defaults()
+
+func (c *Config) Validate() error {
+	switch c.Env {
+	case "dev", "production":
+	default:
+		return errors.Errorf("invalid env \"%s\" (expecting dev|production)", c.Env)
+	}
+	if c.DevRoutes && c.Env != "dev" {
+		return errors.Errorf("dev_routes is only allowed with env dev")
+	}
+	if err := c.HTTP.Validate(c.Env); err != nil {
+		return errors.Wrapf(err, "invalid http config")
+	}
+	if err := c.DB.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid db config")
+	}
+	if err := c.Redis.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid redis config")
+	}
+	if err := c.Mail.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid mail config")
+	}
+	if err := c.SMS.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid sms config")
+	}
+	if err := c.Session.Validate(c.Env); err != nil {
+		return errors.Wrapf(err, "invalid session config")
+	}
+	return nil
+} //Config.Validate()
+
+//ConnectDB applies the session settings and connects to the database,
+//retrying for up to db.max_wait_seconds or until ctx is done, e.g. on SIGTERM
+func (c Config) ConnectDB(ctx context.Context) error {
+	db.SetPasswordSalt(c.Session.PasswordSalt)
+	db.SetLifetimes(time.Duration(c.Session.Lifetime), time.Duration(c.Session.ActivationLifetime))
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(c.DB.MaxWaitSeconds)*time.Second)
+	defer cancel()
+	return db.ConnectRetry(ctx, c.DB)
+}
+
+//Redacted returns a copy with secrets masked, to print or log it
+func (c Config) Redacted() Config {
+	r := c
+	for _, s := range settings(&r) {
+		if s.secret && s.value.Kind() == reflect.String && s.value.String() != "" {
+			s.value.SetString(redact.Mask)
+		}
+	}
+	return r
+}
+
+//Duration is written as a string in JSON, e.g. "5m" or "24h"
+type Duration time.Duration
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(v []byte) error {
+	var s string
+	if err := json.Unmarshal(v, &s); err != nil {
+		return errors.Errorf("duration must be a string like \"5m\" or \"24h\"")
+	}
+	return d.Set(s)
+}
+
+func (d *Duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.Errorf("invalid duration \"%s\"", s)
+	}
+	*d = Duration(v)
+	return nil
+}
+
+//readFile replaces values in c with those set in the JSON file
+func readFile(c *Config, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return errors.Wrapf(err, "cannot open config file %s", filename)
+	}
+	defer f.Close()
+	d := json.NewDecoder(f)
+	d.DisallowUnknownFields() //to report typing errors in names
+	if err := d.Decode(c); err != nil {
+		return errors.Wrapf(err, "invalid config file %s", filename)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package config_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jansemmelink/don8/config"
+)
+
+func TestLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "don8.json")
+	os.WriteFile(filename, []byte(`{
+		"http":{"addr":":8080"},
+		"db":{"host":"db.local","password":"file-pw"},
+		"session":{"lifetime":"30m"}
+	}`), 0644)
+	os.Setenv("DB_HOST", "db.env")
+	os.Setenv("REDIS_ADDR", "redis.env:6379")
+	defer os.Unsetenv("DB_HOST")
+	defer os.Unsetenv("REDIS_ADDR")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := config.NewLoader(fs)
+	if err := fs.Parse([]string{"-config", filename, "-env", "dev", "-redis", "redis.flag:6379", "-trust-proxy"}); err != nil {
+		t.Fatal(err)
+	}
+	c, err := l.Load()
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	for _, test := range []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{"http.addr from file", c.HTTP.Addr, ":8080"},
+		{"db.host from env", c.DB.Host, "db.env"},
+		{"db.password from file", c.DB.Password, "file-pw"},
+		{"db.port default", c.DB.Port, 3311},
+		{"redis.addr from flag", c.Redis.Addr, "redis.flag:6379"},
+		{"http.trust_proxy from flag", c.HTTP.TrustProxy, true},
+		{"http.cors same as env", c.HTTP.CORS, "dev"},
+		{"session.lifetime from file", time.Duration(c.Session.Lifetime), 30 * time.Minute},
+		{"session.activation_lifetime default", time.Duration(c.Session.ActivationLifetime), 24 * time.Hour},
+	} {
+		if test.value != test.expected {
+			t.Errorf("%s: %v, expected %v", test.name, test.value, test.expected)
+		}
+	}
+
+	r := c.Redacted()
+	if r.DB.Password != "***" || c.DB.Password != "file-pw" {
+		t.Fatalf("redacted %s, original %s", r.DB.Password, c.DB.Password)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if env := config.Defaults().Env; env != "production" {
+		t.Errorf("default env %s", env)
+	}
+	for _, args := range [][]string{
+		{"-env", "staging"},
+		{"-env", "production"}, //without password salt
+		{"-env", "dev", "-app", "localhost"},
+		{"-env", "dev", "-cors", "test"},
+		{"-dev-routes"}, //only in dev
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		l := config.NewLoader(fs)
+		fs.Parse(args)
+		if _, err := l.Load(); err == nil {
+			t.Errorf("%v loaded", args)
+		}
+	}
+
+	os.Setenv("SESSION_LIFETIME", "5 minutes")
+	defer os.Unsetenv("SESSION_LIFETIME")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := config.NewLoader(fs)
+	fs.Parse([]string{"-env", "dev"})
+	if _, err := l.Load(); err == nil {
+		t.Errorf("invalid duration loaded")
+	}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-msvc/errors"
+)
+
+//Loader defines flags for the config and loads it after the flags were parsed, e.g.:
+//
+//	loader := config.NewLoader(flag.CommandLine)
+//	flag.Parse()
+//	c, err := loader.Load()
+type Loader struct {
+	file  *string
+	flags map[string]*flagValue
+}
+
+//NewLoader defines -config and a flag for each field tagged flag:"..." in fs
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{
+		file:  fs.String("config", os.Getenv("DON8_CONFIG"), "JSON config file (env DON8_CONFIG)"),
+		flags: map[string]*flagValue{},
+	}
+	defaults := Defaults()
+	for _, s := range settings(&defaults) {
+		if s.flag == "" {
+			continue
+		}
+		v := &flagValue{isBool: s.value.Kind() == reflect.Bool}
+		usage := s.doc
+		if s.env != "" {
+			usage += fmt.Sprintf(" (env %s)", s.env)
+		}
+		fs.Var(v, s.flag, usage)
+		l.flags[s.flag] = v
+	}
+	return l
+}
+
+//Load the config from defaults, file, env and flags then validate it
+func (l *Loader) Load() (Config, error) {
+	c := Defaults()
+	if *l.file != "" {
+		if err := readFile(&c, *l.file); err != nil {
+			return Config{}, err
+		}
+	}
+	for _, s := range settings(&c) {
+		if s.env != "" {
+			if v, ok := os.LookupEnv(s.env); ok && v != "" {
+				if err := s.set(v); err != nil {
+					return Config{}, errors.Wrapf(err, "invalid env %s", s.env)
+				}
+			}
+		}
+		if f, ok := l.flags[s.flag]; ok && f.isSet {
+			if err := s.set(f.value); err != nil {
+				return Config{}, errors.Wrapf(err, "invalid flag -%s", s.flag)
+			}
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return Config{}, errors.Wrapf(err, "invalid config")
+	}
+	return c, nil
+} //Loader.Load()
+
+//flagValue records if the flag was set so that only those replace the file and env values
+type flagValue struct {
+	value  string
+	isSet  bool
+	isBool bool
+}
+
+func (f *flagValue) String() string { return f.value }
+
+func (f *flagValue) Set(s string) error {
+	f.value = s
+	f.isSet = true
+	return nil
+}
+
+//IsBoolFlag allows -trust-proxy without =true
+func (f *flagValue) IsBoolFlag() bool { return f.isBool }
+
+//setting is a field in the config that can be set from a string
+type setting struct {
+	name   string //JSON path, e.g. "db.host"
+	env    string
+	flag   string
+	doc    string
+	secret bool
+	value  reflect.Value
+}
+
+var durationType = reflect.TypeOf(Duration(0))
+
+//settings lists all fields in c, including those of nested structs
+func settings(c *Config) []setting {
+	return appendSettings(nil, "", reflect.ValueOf(c).Elem())
+}
+
+func appendSettings(list []setting, prefix string, v reflect.Value) []setting {
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		if f.Type.Kind() == reflect.Struct {
+			list = appendSettings(list, prefix+name+".", v.Field(i))
+			continue
+		}
+		list = append(list, setting{
+			name:   prefix + name,
+			env:    f.Tag.Get("env"),
+			flag:   f.Tag.Get("flag"),
+			doc:    f.Tag.Get("doc"),
+			secret: f.Tag.Get("secret") == "true",
+			value:  v.Field(i),
+		})
+	}
+	return list
+}
+
+func (s setting) set(v string) error {
+	if s.value.Type() == durationType {
+		return s.value.Addr().Interface().(*Duration).Set(v)
+	}
+	switch s.value.Kind() {
+	case reflect.String:
+		s.value.SetString(v)
+	case reflect.Int:
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.Errorf("%s=\"%s\" is not an integer", s.name, v)
+		}
+		s.value.SetInt(int64(i))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.Errorf("%s=\"%s\" is not true|false", s.name, v)
+		}
+		s.value.SetBool(b)
+	default:
+		return errors.Errorf("%s cannot be set from a string", s.name)
+	}
+	return nil
+} //setting.set()
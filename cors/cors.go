@@ -0,0 +1,206 @@
+package cors
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/go-msvc/errors"
+)
+
+//Policy controls which web sites may call the API from a browser
+//and the security headers added to every response
+type Policy struct {
+	//AllowedOrigins are exact origins, e.g. "https://don8.app",
+	//or patterns, e.g. "https://*.don8.app" or "http://localhost:*"
+	AllowedOrigins   []string          `json:"allowed_origins"`
+	AllowedMethods   []string          `json:"allowed_methods"`
+	AllowedHeaders   []string          `json:"allowed_headers"`
+	ExposedHeaders   []string          `json:"exposed_headers"`
+	AllowCredentials bool              `json:"allow_credentials"`
+	MaxAge           int               `json:"max_age" doc:"Seconds that browsers may cache a preflight response"`
+	SecurityHeaders  map[string]string `json:"security_headers"`
+}
+
+var (
+	defaultMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+	defaultHeaders = []string{"Accept", "Content-Type", "Don8-Auth-Sid", "X-Request-ID"}
+	exposedHeaders = []string{"X-Request-ID", "Retry-After"}
+)
+
+//Presets per environment
+//production has no allowed origins until configured with the web app's origin
+var Presets = map[string]Policy{
+	"dev": {
+		AllowedOrigins:   []string{"http://localhost:*", "http://127.0.0.1:*"},
+		AllowedMethods:   defaultMethods,
+		AllowedHeaders:   defaultHeaders,
+		ExposedHeaders:   exposedHeaders,
+		AllowCredentials: true,
+		MaxAge:           60,
+		SecurityHeaders: map[string]string{
+			"X-Content-Type-Options": "nosniff",
+			"X-Frame-Options":        "DENY",
+			"Referrer-Policy":        "no-referrer",
+		},
+	},
+	"production": {
+		AllowedOrigins:   []string{},
+		AllowedMethods:   defaultMethods,
+		AllowedHeaders:   defaultHeaders,
+		ExposedHeaders:   exposedHeaders,
+		AllowCredentials: true,
+		MaxAge:           600,
+		SecurityHeaders: map[string]string{
+			"X-Content-Type-Options":    "nosniff",
+			"X-Frame-Options":           "DENY",
+			"Referrer-Policy":           "no-referrer",
+			"Content-Security-Policy":   "default-src 'none'; frame-ancestors 'none'",
+			"Strict-Transport-Security": "max-age=31536000; includeSubDomains",
+		},
+	},
+}
+
+//Load returns the named preset with the values set in the optional JSON file replacing it
+func Load(preset string, filename string) (Policy, error) {
+	p, ok := Presets[preset]
+	if !ok {
+		return Policy{}, errors.Errorf("unknown CORS preset \"%s\"", preset)
+	}
+	p = p.copy() //decoding reuses slices and maps
+	if filename != "" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return Policy{}, errors.Wrapf(err, "cannot open CORS policy file %s", filename)
+		}
+		defer f.Close()
+		if err := json.NewDecoder(f).Decode(&p); err != nil {
+			return Policy{}, errors.Wrapf(err, "invalid CORS policy file %s", filename)
+		}
+	}
+	if err := p.Validate(); err != nil {
+		return Policy{}, errors.Wrapf(err, "invalid CORS policy")
+	}
+	return p, nil
+}
+
+func (p Policy) copy() Policy {
+	c := p
+	c.AllowedOrigins = append([]string{}, p.AllowedOrigins...)
+	c.AllowedMethods = append([]string{}, p.AllowedMethods...)
+	c.AllowedHeaders = append([]string{}, p.AllowedHeaders...)
+	c.ExposedHeaders = append([]string{}, p.ExposedHeaders...)
+	c.SecurityHeaders = map[string]string{}
+	for n, v := range p.SecurityHeaders {
+		c.SecurityHeaders[n] = v
+	}
+	return c
+}
+
+func (p Policy) Validate() error {
+	for _, o := range p.AllowedOrigins {
+		if _, err := path.Match(o, ""); err != nil {
+			return errors.Wrapf(err, "invalid origin pattern \"%s\"", o)
+		}
+		if o == "*" && p.AllowCredentials {
+			return errors.Errorf("cannot allow any origin with credentials")
+		}
+	}
+	if p.MaxAge < 0 {
+		return errors.Errorf("negative max_age:%d", p.MaxAge)
+	}
+	return nil
+}
+
+//Allowed is true if the origin may call the API
+func (p Policy) Allowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	for _, o := range p.AllowedOrigins {
+		if ok, _ := path.Match(o, origin); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Policy) methodAllowed(method string) bool {
+	for _, m := range p.AllowedMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Policy) headersAllowed(requested string) bool {
+	for _, h := range strings.Split(requested, ",") {
+		if h = strings.TrimSpace(h); h == "" {
+			continue
+		}
+		allowed := false
+		for _, a := range p.AllowedHeaders {
+			if strings.EqualFold(a, h) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+//Handler applies the policy before calling h.
+//Preflight requests are answered here with 204, or 403 when not allowed.
+//Other requests from origins that are not allowed are served without CORS headers
+//so the browser does not let the calling web site read the response.
+func (p Policy) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(httpRes http.ResponseWriter, httpReq *http.Request) {
+		for n, v := range p.SecurityHeaders {
+			httpRes.Header().Set(n, v)
+		}
+		httpRes.Header().Add("Vary", "Origin")
+		origin := httpReq.Header.Get("Origin")
+		allowed := p.Allowed(origin)
+
+		if httpReq.Method == http.MethodOptions && httpReq.Header.Get("Access-Control-Request-Method") != "" {
+			httpRes.Header().Add("Vary", "Access-Control-Request-Method")
+			httpRes.Header().Add("Vary", "Access-Control-Request-Headers")
+			if !allowed ||
+				!p.methodAllowed(httpReq.Header.Get("Access-Control-Request-Method")) ||
+				!p.headersAllowed(httpReq.Header.Get("Access-Control-Request-Headers")) {
+				httpRes.WriteHeader(http.StatusForbidden)
+				return
+			}
+			p.allowOrigin(httpRes, origin)
+			httpRes.Header().Set("Access-Control-Allow-Methods", strings.Join(p.AllowedMethods, ", "))
+			httpRes.Header().Set("Access-Control-Allow-Headers", strings.Join(p.AllowedHeaders, ", "))
+			if p.MaxAge > 0 {
+				httpRes.Header().Set("Access-Control-Max-Age", strconv.Itoa(p.MaxAge))
+			}
+			httpRes.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if allowed {
+			p.allowOrigin(httpRes, origin)
+			if len(p.ExposedHeaders) > 0 {
+				httpRes.Header().Set("Access-Control-Expose-Headers", strings.Join(p.ExposedHeaders, ", "))
+			}
+		}
+		h.ServeHTTP(httpRes, httpReq)
+	})
+} //Policy.Handler()
+
+func (p Policy) allowOrigin(httpRes http.ResponseWriter, origin string) {
+	httpRes.Header().Set("Access-Control-Allow-Origin", origin)
+	if p.AllowCredentials {
+		httpRes.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,99 @@
+package cors_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jansemmelink/don8/cors"
+)
+
+func TestPreflight(t *testing.T) {
+	p, err := cors.Load("production", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.AllowedOrigins = []string{"https://*.don8.app"}
+	called := false
+	h := p.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { called = true }))
+
+	for _, test := range []struct {
+		origin   string
+		method   string
+		headers  string
+		expected int
+	}{
+		{"https://app.don8.app", "POST", "content-type, don8-auth-sid", http.StatusNoContent},
+		{"https://evil.example", "POST", "content-type", http.StatusForbidden},
+		{"https://app.don8.app", "PATCH", "", http.StatusForbidden},
+		{"https://app.don8.app", "GET", "X-Secret", http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodOptions, "/groups/", nil)
+		req.Header.Set("Origin", test.origin)
+		req.Header.Set("Access-Control-Request-Method", test.method)
+		req.Header.Set("Access-Control-Request-Headers", test.headers)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != test.expected {
+			t.Errorf("%s %s %s -> %d, expected %d", test.origin, test.method, test.headers, w.Code, test.expected)
+		}
+		allowOrigin := w.Header().Get("Access-Control-Allow-Origin")
+		if (test.expected == http.StatusNoContent) != (allowOrigin == test.origin) {
+			t.Errorf("%s %s -> Access-Control-Allow-Origin:%s", test.origin, test.method, allowOrigin)
+		}
+	}
+	if called {
+		t.Fatalf("preflight passed to handler")
+	}
+}
+
+func TestRequest(t *testing.T) {
+	p := cors.Presets["dev"]
+	h := p.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+
+	req := httptest.NewRequest(http.MethodGet, "/groups/", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Header().Get("Access-Control-Allow-Origin") != "http://localhost:3000" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("allowed origin got %+v", w.Header())
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("missing security headers: %+v", w.Header())
+	}
+
+	req.Header.Set("Origin", "https://evil.example")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("other origin got %d %+v", w.Code, w.Header())
+	}
+}
+
+func TestLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "cors.json")
+	os.WriteFile(filename, []byte(`{"allowed_origins":["https://don8.app"],"security_headers":{"X-Frame-Options":"SAMEORIGIN"}}`), 0644)
+	p, err := cors.Load("production", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Allowed("https://don8.app") || p.Allowed("https://www.don8.app") {
+		t.Fatalf("origins %+v", p.AllowedOrigins)
+	}
+	if p.SecurityHeaders["X-Frame-Options"] != "SAMEORIGIN" || p.SecurityHeaders["X-Content-Type-Options"] != "nosniff" {
+		t.Fatalf("security headers %+v", p.SecurityHeaders)
+	}
+	if cors.Presets["production"].SecurityHeaders["X-Frame-Options"] != "DENY" {
+		t.Fatalf("preset changed")
+	}
+
+	os.WriteFile(filename, []byte(`{"allowed_origins":["*"]}`), 0644)
+	if _, err := cors.Load("production", filename); err == nil {
+		t.Fatalf("any origin allowed with credentials")
+	}
+	if _, err := cors.Load("staging", ""); err == nil {
+		t.Fatalf("unknown preset loaded")
+	}
+}
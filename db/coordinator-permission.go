@@ -1,17 +1,21 @@
 package db
 
-import "github.com/go-msvc/errors"
+import (
+	"database/sql"
+
+	"github.com/go-msvc/errors"
+)
 
 type Permission string
 
 type MemberPermission struct {
-	MemberID   ID
-	Permission Permission
+	MemberID   ID         `json:"member_id" db:"member_id"`
+	Permission Permission `json:"permission" db:"permissions"`
 }
 
 func AddMemberPermission(cp MemberPermission) (MemberPermission, error) {
 	if _, err := db.Exec(
-		"INSERT INTO `member_permissions` SET member_id=?,permission=?",
+		"INSERT IGNORE INTO `member_permissions` SET `member_id`=?,`permissions`=?",
 		cp.MemberID,
 		cp.Permission,
 	); err != nil {
@@ -23,7 +27,7 @@ func AddMemberPermission(cp MemberPermission) (MemberPermission, error) {
 func ListMemberPermissions(memberID ID) ([]Permission, error) {
 	var cps []MemberPermission
 	if err := db.Select(&cps,
-		"SELECT FROM `member_permissions` WHERE member_id=? ORDER BY permission",
+		"SELECT `member_id`,`permissions` FROM `member_permissions` WHERE `member_id`=? ORDER BY `permissions`",
 		memberID,
 	); err != nil {
 		return nil, errors.Wrapf(err, "failed to list member permissions")
@@ -49,7 +53,7 @@ func DelMemberPermission(memberID ID, permissionList []Permission) error {
 	//delete selected permissions
 	for _, p := range permissionList {
 		if _, err := db.Exec(
-			"DELETE FROM `member_permissions` WHERE member_id=? AND permission=?",
+			"DELETE FROM `member_permissions` WHERE `member_id`=? AND `permissions`=?",
 			memberID,
 			p,
 		); err != nil {
@@ -58,3 +62,42 @@ func DelMemberPermission(memberID ID, permissionList []Permission) error {
 	}
 	return nil
 }
+
+//IsGroupCoordinator is true when the user has all permissions (|*|) in the group
+func IsGroupCoordinator(groupID ID, userID ID) (bool, error) {
+	var n int
+	if err := db.Get(&n,
+		"SELECT COUNT(*) FROM `members` AS m"+
+			" JOIN `member_permissions` AS p ON p.`member_id`=m.`id`"+
+			" WHERE m.`group_id`=? AND m.`user_id`=? AND p.`permissions`=?",
+		groupID,
+		userID,
+		"*",
+	); err != nil {
+		return false, errors.Wrapf(err, "failed to check group(id=%s) coordinator", groupID)
+	}
+	return n > 0, nil
+}
+
+//GrantGroupPermission gives the user a permission in the group, e.g. "*" to coordinate it,
+//and makes the user a member with the role if not yet a member
+func GrantGroupPermission(groupID ID, userID ID, p Permission, role string) (Member, error) {
+	var m Member
+	err := db.Get(&m,
+		"SELECT `id`,`group_id`,`user_id`,`role` FROM `members` WHERE `group_id`=? AND `user_id`=?",
+		groupID,
+		userID,
+	)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			return Member{}, errors.Wrapf(err, "failed to get group(id=%s) member(user_id=%s)", groupID, userID)
+		}
+		if m, err = AddMember(Member{GroupID: groupID, UserID: userID, Role: role}); err != nil {
+			return Member{}, err
+		}
+	}
+	if _, err := AddMemberPermission(MemberPermission{MemberID: m.ID, Permission: p}); err != nil {
+		return Member{}, err
+	}
+	return m, nil
+} //GrantGroupPermission()
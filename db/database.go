@@ -5,14 +5,14 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"os"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gchaincl/sqlhooks"
 	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/metrics"
+	"github.com/jansemmelink/don8/redact"
 	"github.com/jmoiron/sqlx"
 	"github.com/stewelarend/logger"
 
@@ -26,20 +26,13 @@ var (
 
 func init() {
 	sql.Register("mysqlwithlog", sqlhooks.Wrap(&mysql.MySQLDriver{}, Hooks{}))
+}
 
-	c := Config{
-		Host:           os.Getenv("DB_HOST"),
-		Port:           intDefault(os.Getenv("DB_PORT"), 3311),
-		Username:       strDefault(os.Getenv("DB_USERNAME"), "don8"),
-		Password:       strDefault(os.Getenv("DB_PASSWORD"), "don8"),
-		Database:       strDefault(os.Getenv("DB_DATABASE"), "don8"),
-		MaxConnSeconds: intDefault(os.Getenv("DB_MAX_CONN_SECONDS"), 2),
-		MaxConnOpen:    intDefault(os.Getenv("DB_MAX_CONN_OPEN"), 5),
-		MaxConnIdle:    intDefault(os.Getenv("DB_MAX_CONN_IDLE"), 5),
-	}
-
+//Connect creates the pool of connections to the database
+//it must be called before any other function in this package
+func Connect(c Config) error {
 	if err := c.Validate(); err != nil {
-		panic(errors.Wrapf(err, "invalid database config"))
+		return errors.Wrapf(err, "invalid database config")
 	}
 
 	//connect to the database to create the pool of connections
@@ -56,48 +49,64 @@ func init() {
 	select {
 	case connResult := <-connResultChan:
 		if connResult.err != nil {
-			panic(errors.Wrapf(connResult.err, "failed to connect to database %s on %s:%d", c.Database, c.Host, c.Port))
+			return errors.Wrapf(connResult.err, "failed to connect to database %s on %s:%d", c.Database, c.Host, c.Port)
 		}
 
 		db = connResult.db
 		db.SetMaxOpenConns(c.MaxConnOpen)
 		db.SetMaxIdleConns(c.MaxConnIdle)
-
-		return
+		return nil
 
 	case <-time.After(time.Duration(c.MaxConnSeconds) * time.Second):
-		panic(errors.Errorf("%d second timeout connecting to db %s on %s:%d", c.MaxConnSeconds, c.Database, c.Host, c.Port))
+		return errors.Errorf("%d second timeout connecting to db %s on %s:%d", c.MaxConnSeconds, c.Database, c.Host, c.Port)
 
 	} //select
-}
+} //Connect()
 
-func intDefault(s string, def int) int {
-	if i64, err := strconv.ParseInt(s, 10, 64); err != nil {
-		return def
-	} else {
-		if int(i64) == 0 {
-			return def
+//ConnectRetry calls Connect until it succeeds or ctx is done,
+//e.g. while the database is still starting in docker-compose
+func ConnectRetry(ctx context.Context, c Config) error {
+	retryInterval := 2 * time.Second
+	for attempt := 1; ; attempt++ {
+		err := Connect(c)
+		if err == nil {
+			return nil
+		}
+		log.Errorf("database connect attempt %d failed (retry in %s): %+v", attempt, retryInterval, err)
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(err, "gave up connecting to the database after %d attempts", attempt)
+		case <-time.After(retryInterval):
 		}
-		return int(i64)
 	}
+} //ConnectRetry()
+
+//Ping checks that the database can be used, e.g. for readiness checks
+func Ping(ctx context.Context) error {
+	if db == nil {
+		return errors.Errorf("not connected")
+	}
+	return db.PingContext(ctx)
 }
 
-func strDefault(s string, def string) string {
-	if s != "" {
-		return s
+//Close the pool of connections when the program terminates
+func Close() error {
+	if db == nil {
+		return nil
 	}
-	return def
+	return db.Close()
 }
 
 type Config struct {
-	Host           string `json:"host"`
-	Port           int    `json:"port"`
-	Username       string `json:"username"`
-	Password       string `json:"password"`
-	Database       string `json:"database"`
-	MaxConnSeconds int    `json:"max_conn_seconds" doc:"Max nr of seconds to wait for db connection to be established"`
-	MaxConnOpen    int    `json:"max_conn_open" doc:"Max nr of open connections in pool"`
-	MaxConnIdle    int    `json:"max_conn_idle" doc:"Max nr of idle connections in pool"`
+	Host           string `json:"host" env:"DB_HOST"`
+	Port           int    `json:"port" env:"DB_PORT"`
+	Username       string `json:"username" env:"DB_USERNAME"`
+	Password       string `json:"password" env:"DB_PASSWORD" secret:"true"`
+	Database       string `json:"database" env:"DB_DATABASE"`
+	MaxConnSeconds int    `json:"max_conn_seconds" env:"DB_MAX_CONN_SECONDS" doc:"Max nr of seconds to wait for db connection to be established"`
+	MaxConnOpen    int    `json:"max_conn_open" env:"DB_MAX_CONN_OPEN" doc:"Max nr of open connections in pool"`
+	MaxConnIdle    int    `json:"max_conn_idle" env:"DB_MAX_CONN_IDLE" doc:"Max nr of idle connections in pool"`
+	MaxWaitSeconds int    `json:"max_wait_seconds" env:"DB_MAX_WAIT_SECONDS" doc:"Max nr of seconds to retry connecting at startup"`
 }
 
 func (c *Config) Validate() error {
@@ -105,7 +114,7 @@ func (c *Config) Validate() error {
 		c.Host = "127.0.0.1"
 	}
 	if c.Port == 0 {
-		c.Port = 3307
+		c.Port = 3311 //as exposed in docker-compose.yml
 	}
 	if c.Username == "" {
 		return errors.Errorf("missing username")
@@ -134,6 +143,12 @@ func (c *Config) Validate() error {
 	if c.MaxConnIdle < 0 {
 		return errors.Errorf("invalid max_conn_idle:%d", c.MaxConnIdle)
 	}
+	if c.MaxWaitSeconds == 0 {
+		c.MaxWaitSeconds = 60
+	}
+	if c.MaxWaitSeconds < 0 {
+		return errors.Errorf("invalid max_wait_seconds:%d", c.MaxWaitSeconds)
+	}
 	return nil
 } //Config.Validate()
 
@@ -197,7 +212,7 @@ func NamedSelect(list interface{}, query string, arg interface{}) (err error) {
 		return errors.Wrapf(err, "failed to prepare SQL statement")
 	}
 	log.Debugf("query: %s", query)
-	log.Debugf("  arg: %v", arg)
+	log.Debugf("  arg: %s", redact.Value(arg))
 	err = st.Select(list, arg)
 	if err != nil {
 		return errors.Wrapf(err, "failed to get list of rows")
@@ -210,17 +225,29 @@ type Hooks struct{}
 
 type HookBegin struct{}
 
-// Before hook will print the query with it's args and return the context with the timestamp
+var sqlDuration = metrics.Default.Histogram("don8_sql_duration_seconds", "Duration of SQL statements", metrics.DefaultBuckets, "statement")
+
+//max length of the statement label, long enough to tell statements apart
+const maxStatementLabel = 200
+
+// Before hook will log the query with redacted args and return the context with the timestamp
 func (h Hooks) Before(ctx context.Context, query string, args ...interface{}) (context.Context, error) {
-	jsonArgs, _ := json.Marshal(args)
-	log.Infof("SQL... %s (%d args=%s)", query, len(args), string(jsonArgs))
+	if log.Level() >= logger.LevelDebug {
+		jsonArgs, _ := json.Marshal(redact.SQLArgs(query, args))
+		log.Debugf("SQL... %s (%d args=%s)", query, len(args), string(jsonArgs))
+	}
 	return context.WithValue(ctx, HookBegin{}, time.Now()), nil
 }
 
-// After hook will get the timestamp registered on the Before hook and print the elapsed time
+// After hook will get the timestamp registered on the Before hook and observe the elapsed time
 func (h Hooks) After(ctx context.Context, query string, args ...interface{}) (context.Context, error) {
-	//begin := ctx.Value(HookBegin{}).(time.Time)
-	//log.Infof("SQL (dur: %s) %s (%d args=%+v)", time.Since(begin), query, len(args), args)
+	if begin, ok := ctx.Value(HookBegin{}).(time.Time); ok {
+		statement := strings.Join(strings.Fields(query), " ")
+		if len(statement) > maxStatementLabel {
+			statement = statement[:maxStatementLabel]
+		}
+		sqlDuration.Observe(time.Since(begin).Seconds(), statement)
+	}
 	return ctx, nil
 }
 
@@ -1,18 +1,22 @@
 package db
 
 import (
+	"strings"
+
 	"github.com/go-msvc/errors"
 	"github.com/google/uuid"
+	"github.com/jansemmelink/don8/events"
+	"github.com/jansemmelink/don8/model"
 )
 
 type Donation struct {
-	ID         ID     `db:"id"`
-	LocationID ID     `db:"location_id" doc:"Location where donation was made."`
-	RequestID  *ID    `db:"request_id,omitempty" doc:"Request is defined if received requested or promised items. Absent for ad hoc drop of general goods not specifically requested."`
-	PromiseID  *ID    `db:"promise_id,omitempty" doc:"Promise is defined when a user delivers on a promise. Absent for ad hoc anonymous drops."`
-	Title      string `db:"title" doc:"From request.title, or free text when receiving items without specific request."`
-	Unit       string `db:"unit" doc:"From request.unit, or free text when receiving items without specific request."`
-	Qty        int    `db:"qty" doc:"Nr of units donated"`
+	ID         ID     `json:"id" db:"id"`
+	LocationID ID     `json:"location_id" db:"location_id" doc:"Location where donation was made."`
+	RequestID  *ID    `json:"request_id,omitempty" db:"request_id,omitempty" doc:"Request is defined if received requested or promised items. Absent for ad hoc drop of general goods not specifically requested."`
+	PromiseID  *ID    `json:"promise_id,omitempty" db:"promise_id,omitempty" doc:"Promise is defined when a user delivers on a promise. Absent for ad hoc anonymous drops."`
+	Title      string `json:"title" db:"title" doc:"From request.title, or free text when receiving items without specific request."`
+	Unit       string `json:"unit" db:"unit" doc:"From request.unit, or free text when receiving items without specific request."`
+	Qty        int    `json:"qty" db:"qty" doc:"Nr of units donated"`
 }
 
 func AddDonation(d Donation) (Donation, error) {
@@ -40,16 +44,34 @@ func AddDonation(d Donation) (Donation, error) {
 			return Donation{}, errors.Wrapf(err, "failed to get request(id=%s)", *d.RequestID)
 		}
 		request = &r
+		if request.Type == RequestTypeMoney {
+			return Donation{}, errors.Errorf("money for request(id=%s) is recorded as payments, not donations", request.ID)
+		}
 		if d.Title != "" && d.Title != request.Title {
 			return Donation{}, errors.Errorf("donation.title(%s) != donation.request.title(%s)", d.Title, request.Title)
 		}
 		d.Title = request.Title
+
+		//donation may be in any unit compatible with the request, e.g. "g" for a request in "kg"
+		if d.Unit == "" {
+			d.Unit = string(request.Unit())
+		}
+		if err := model.Unit(d.Unit).Compatible(request.Unit()); err != nil {
+			return Donation{}, errors.Wrapf(err, "donation unit not compatible with request")
+		}
+		unitDef, err := model.ParseUnit(d.Unit)
+		if err != nil {
+			return Donation{}, errors.Wrapf(err, "invalid donation unit")
+		}
+		d.Unit = string(unitDef.Name)
 	}
 
 	//Title and Unit must be specified or be obtained from the request
 	if d.Title == "" {
 		return Donation{}, errors.Errorf("cannot add donation without request and no title")
 	}
+	//ad hoc donations without a request keep their free text unit, e.g. "bags"
+	d.Unit = strings.TrimSpace(d.Unit)
 	if d.Unit == "" {
 		return Donation{}, errors.Errorf("cannot add donation without request and no unit")
 	}
@@ -57,10 +79,20 @@ func AddDonation(d Donation) (Donation, error) {
 		return Donation{}, errors.Errorf("cannot add donation with qty:%d (it is < 1)", d.Qty)
 	}
 
+	//progress before the donation, to know if this donation meets the request
+	var before *RequestProgress
+	if request != nil {
+		if progress, err := GetRequestProgress(*request); err != nil {
+			log.Errorf("cannot get request(id=%s) progress: %+v", request.ID, err)
+		} else {
+			before = &progress
+		}
+	}
+
 	//ok to insert
 	id := uuid.New().String()
 	if _, err := db.Exec(
-		"INSERT INTO `received` SET `id`=?,`location_id`=?,`request_id`=?,`promise_id`=?,`title`=?,`unit`=?,`qty`=?",
+		"INSERT INTO `receives` SET `id`=?,`location_id`=?,`request_id`=?,`promise_id`=?,`title`=?,`unit`=?,`qty`=?",
 		id,
 		d.LocationID,
 		d.RequestID,
@@ -72,5 +104,23 @@ func AddDonation(d Donation) (Donation, error) {
 		return Donation{}, errors.Wrapf(err, "failed to insert donation")
 	}
 	d.ID = ID(id)
+
+	//promise is no longer open/overdue once delivered
+	if promise != nil {
+		if err := SetPromiseStatus(promise.ID, PromiseStatusDelivered); err != nil {
+			log.Errorf("failed to mark promise delivered: %+v", err)
+		}
+	}
+	if request != nil {
+		after := publishRequestEvent(events.DonationReceived, request.ID, d)
+		publishRequestMet(*request, before, after)
+		if err := syncRequestStatus(request.ID); err != nil {
+			log.Errorf("failed to update request(id=%s) status: %+v", request.ID, err)
+		}
+	} else if groupID, err := locationGroupID(d.LocationID); err != nil {
+		log.Errorf("cannot publish donation event for location(id=%s): %+v", d.LocationID, err)
+	} else {
+		events.Publish(events.DonationReceived, string(groupID), d, nil)
+	}
 	return d, nil
 }
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"github.com/jansemmelink/don8/events"
+)
+
+//publishRequestEvent publishes a change that affects request progress
+//with the updated totals of the request, which are returned when known
+func publishRequestEvent(t events.Type, requestID ID, data interface{}) *RequestProgress {
+	r, err := GetRequest(requestID)
+	if err != nil {
+		log.Errorf("cannot publish %s event for request(id=%s): %+v", t, requestID, err)
+		return nil
+	}
+	progress, err := GetRequestProgress(r)
+	if err != nil {
+		log.Errorf("cannot publish %s event totals for request(id=%s): %+v", t, requestID, err)
+		events.Publish(t, string(r.GroupID), data, nil)
+		return nil
+	}
+	events.Publish(t, string(r.GroupID), data, progress)
+	return &progress
+}
+
+//publishRequestMet when a change made the received quantity reach the requested quantity
+func publishRequestMet(r Request, before *RequestProgress, after *RequestProgress) {
+	if before == nil || after == nil {
+		return
+	}
+	if before.Received < float64(before.Qty) && after.Received >= float64(after.Qty) {
+		events.Publish(events.RequestMet, string(r.GroupID), r, *after)
+	}
+}
+
+//locationGroupID is used for donations not linked to a request
+func locationGroupID(locationID ID) (ID, error) {
+	var groupID ID
+	if err := db.Get(&groupID, "SELECT `group_id` FROM `locations` WHERE `id`=?", locationID); err != nil {
+		return "", err
+	}
+	return groupID, nil
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/emails"
+)
+
+//GroupBranding is used in emails sent on behalf of a group
+//Child groups inherit unset values from their parent groups.
+type GroupBranding struct {
+	GroupID ID `json:"group_id" db:"group_id"`
+	emails.Branding
+	Locale string `json:"locale,omitempty" db:"locale" doc:"Default locale for emails from this group, e.g. \"af\" or \"en\""`
+}
+
+func (b *GroupBranding) Validate() error {
+	if b.GroupID == "" {
+		return apierr.Invalid("group_id", "missing group_id")
+	}
+	b.FromName = strings.TrimSpace(b.FromName)
+	b.LogoURL = strings.TrimSpace(b.LogoURL)
+	if b.LogoURL != "" && !strings.HasPrefix(b.LogoURL, "https://") && !strings.HasPrefix(b.LogoURL, "http://") {
+		return apierr.Invalid("logo_url", "invalid logo_url \"%s\" expecting http(s)://...", b.LogoURL)
+	}
+	b.Signature = strings.TrimSpace(b.Signature)
+	if b.Locale != "" {
+		locale, ok := supportedLocale(b.Locale)
+		if !ok {
+			return apierr.Invalid("locale", "unsupported locale \"%s\" (expecting one of %s, optionally with a region e.g. \"en-ZA\")", b.Locale, strings.Join(emails.Locales(), "|"))
+		}
+		b.Locale = locale
+	}
+	return nil
+}
+
+//supportedLocale accepts a supported locale "xx" or "xx-YY" and returns "xx"
+func supportedLocale(s string) (string, bool) {
+	locale := strings.ToLower(strings.TrimSpace(s))
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		region := locale[i+1:]
+		if len(region) != 2 || strings.Trim(region, "abcdefghijklmnopqrstuvwxyz") != "" {
+			return "", false
+		}
+		locale = locale[:i]
+	}
+	for _, l := range emails.Locales() {
+		if l == locale {
+			return locale, true
+		}
+	}
+	return "", false
+}
+
+type groupBrandingRow struct {
+	GroupID       ID      `db:"group_id"`
+	ParentGroupID *ID     `db:"parent_group_id"`
+	FromName      *string `db:"from_name"`
+	LogoURL       *string `db:"logo_url"`
+	Signature     *string `db:"signature"`
+	Locale        *string `db:"locale"`
+}
+
+//GetGroupBranding returns the group's own branding with unset values from parent groups
+func GetGroupBranding(groupID ID) (GroupBranding, error) {
+	b := GroupBranding{GroupID: groupID}
+	id := groupID
+	for depth := 0; id != "" && depth < 10; depth++ {
+		var row groupBrandingRow
+		if err := db.Get(&row,
+			"SELECT g.`id` AS `group_id`,g.`parent_group_id`,b.`from_name`,b.`logo_url`,b.`signature`,b.`locale`"+
+				" FROM `groups` AS g LEFT JOIN `group_branding` AS b ON b.`group_id`=g.`id`"+
+				" WHERE g.`id`=?",
+			id,
+		); err != nil {
+			if err == sql.ErrNoRows {
+				return GroupBranding{}, errors.Errorf("unknown group(id=%s)", id)
+			}
+			return GroupBranding{}, errors.Wrapf(err, "failed to get group(id=%s) branding", id)
+		}
+		if b.FromName == "" && row.FromName != nil {
+			b.FromName = *row.FromName
+		}
+		if b.LogoURL == "" && row.LogoURL != nil {
+			b.LogoURL = *row.LogoURL
+		}
+		if b.Signature == "" && row.Signature != nil {
+			b.Signature = *row.Signature
+		}
+		if b.Locale == "" && row.Locale != nil {
+			b.Locale = *row.Locale
+		}
+		id = ""
+		if row.ParentGroupID != nil {
+			id = *row.ParentGroupID
+		}
+	}
+	return b, nil
+} //GetGroupBranding()
+
+//SetGroupBranding replaces the group's own branding (empty values are inherited from the parent)
+func SetGroupBranding(b GroupBranding) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	if _, err := db.Exec(
+		"INSERT INTO `group_branding` SET `group_id`=?,`from_name`=?,`logo_url`=?,`signature`=?,`locale`=?"+
+			" ON DUPLICATE KEY UPDATE `from_name`=VALUES(`from_name`),`logo_url`=VALUES(`logo_url`),`signature`=VALUES(`signature`),`locale`=VALUES(`locale`)",
+		b.GroupID,
+		nullString(b.FromName),
+		nullString(b.LogoURL),
+		nullString(b.Signature),
+		nullString(b.Locale),
+	); err != nil {
+		return errors.Wrapf(err, "failed to set group(id=%s) branding", b.GroupID)
+	}
+	return nil
+} //SetGroupBranding()
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,28 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/jansemmelink/don8/db"
+)
+
+func TestGroupBrandingLocale(t *testing.T) {
+	for locale, expected := range map[string]string{
+		"":      "",
+		"af":    "af",
+		" EN ":  "en",
+		"af-ZA": "af",
+		"en_gb": "en",
+	} {
+		b := db.GroupBranding{GroupID: "1", Locale: locale}
+		if err := b.Validate(); err != nil || b.Locale != expected {
+			t.Errorf("locale %q -> %q, %v (expected %q)", locale, b.Locale, err, expected)
+		}
+	}
+	for _, invalid := range []string{"english", "afrikaans", "e", "fr", "en-", "en-ZAF", "en-1", "xx-en"} {
+		b := db.GroupBranding{GroupID: "1", Locale: invalid}
+		if err := b.Validate(); err == nil {
+			t.Errorf("invalid locale %q -> %q accepted", invalid, b.Locale)
+		}
+	}
+}
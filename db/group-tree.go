@@ -0,0 +1,272 @@
+package db
+
+import (
+	"sort"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/model"
+	"github.com/jmoiron/sqlx"
+)
+
+//MaxGroupDepth is the max nr of levels read below a group,
+//which also stops the recursive queries if the data has a cycle
+const MaxGroupDepth = 20
+
+//GroupTotals are counted in one group, or in a group and all its descendants
+type GroupTotals struct {
+	Members      int          `json:"members" doc:"Nr of different users who are members"`
+	Requests     int          `json:"requests"`
+	OpenRequests int          `json:"open_requests" doc:"Nr of requests open for promises"`
+	Quantities   []UnitTotals `json:"quantities" doc:"Requested, promised and received quantities per unit, with money in minor units per currency"`
+}
+
+//UnitTotals are the quantities of all requests in the unit
+type UnitTotals struct {
+	Unit      model.Unit `json:"unit"`
+	Requested float64    `json:"requested"`
+	Promised  float64    `json:"promised"`
+	Received  float64    `json:"received" doc:"Received in this unit, also when donated in other compatible units"`
+}
+
+//GroupNode is a group in the tree from GetGroupTree()
+type GroupNode struct {
+	GroupTreeEntry
+	Totals    GroupTotals `json:"totals" doc:"Totals of this group only"`
+	RollUp    GroupTotals `json:"roll_up" doc:"Totals of this group and all its descendants, also those below the max depth"`
+	Truncated bool        `json:"truncated,omitempty" doc:"The group has sub-groups below the max depth that are not listed"`
+	Children  []GroupNode `json:"children,omitempty"`
+}
+
+//GroupTreeMember is a membership counted in the group tree
+type GroupTreeMember struct {
+	GroupID ID `db:"group_id"`
+	UserID  ID `db:"user_id"`
+}
+
+//GroupTreeRequest is a request counted in the group tree
+type GroupTreeRequest struct {
+	ID       ID               `db:"id"`
+	GroupID  ID               `db:"group_id"`
+	Type     RequestType      `db:"type"`
+	Currency model.Currency   `db:"currency"`
+	Units    *string          `db:"units"`
+	Qty      int              `db:"qty"`
+	Status   RequestStatus    `db:"status"`
+	Promised int              `db:"promised"`
+	Received []model.Quantity `db:"-"`
+}
+
+//GroupTreeData is what the tree is built from
+type GroupTreeData struct {
+	Groups   []GroupTreeEntry //from ListGroupTree(), starting with the top group
+	Members  []GroupTreeMember
+	Requests []GroupTreeRequest
+}
+
+//GetGroupTree returns the group with its descendants up to maxDepth levels below it,
+//each with the totals of the group and the roll-up totals of its whole subtree
+func GetGroupTree(id ID, maxDepth int) (GroupNode, error) {
+	data := GroupTreeData{}
+	var err error
+	if data.Groups, err = ListGroupTree(id); err != nil {
+		return GroupNode{}, err
+	}
+	groupIDs := []string{}
+	for _, g := range data.Groups {
+		groupIDs = append(groupIDs, string(g.ID))
+	}
+
+	query, args, err := sqlx.In("SELECT `group_id`,`user_id` FROM `members` WHERE `group_id` IN (?)", groupIDs)
+	if err != nil {
+		return GroupNode{}, errors.Wrapf(err, "failed to make group tree members query")
+	}
+	if err := db.Select(&data.Members, db.Rebind(query), args...); err != nil {
+		return GroupNode{}, errors.Wrapf(err, "failed to get group(id=%s) tree members", id)
+	}
+
+	query, args, err = sqlx.In("SELECT r.`id`,r.`group_id`,r.`type`,r.`currency`,r.`units`,COALESCE(r.`qty`,0) AS `qty`,r.`status`,"+
+		"COALESCE((SELECT SUM(p.`qty`) FROM `promises` AS p WHERE p.`request_id`=r.`id` AND p.`status` NOT IN (?,?)),0) AS `promised`"+
+		" FROM `requests` AS r WHERE r.`group_id` IN (?)",
+		PromiseStatusWithdrawn,
+		PromiseStatusWaitlisted,
+		groupIDs,
+	)
+	if err != nil {
+		return GroupNode{}, errors.Wrapf(err, "failed to make group tree requests query")
+	}
+	if err := db.Select(&data.Requests, db.Rebind(query), args...); err != nil {
+		return GroupNode{}, errors.Wrapf(err, "failed to get group(id=%s) tree requests", id)
+	}
+
+	//donations may be received in other compatible units, and money as payments
+	var received []struct {
+		RequestID ID     `db:"request_id"`
+		Unit      string `db:"unit"`
+		Qty       int    `db:"qty"`
+	}
+	query, args, err = sqlx.In("SELECT rc.`request_id`,rc.`unit`,SUM(rc.`qty`) AS `qty` FROM `receives` AS rc"+
+		" JOIN `requests` AS r ON r.`id`=rc.`request_id`"+
+		" WHERE r.`group_id` IN (?)"+
+		" GROUP BY rc.`request_id`,rc.`unit`"+
+		" UNION ALL"+
+		" SELECT pm.`request_id`,pm.`currency`,SUM(pm.`amount`) FROM `payments` AS pm"+
+		" JOIN `requests` AS r ON r.`id`=pm.`request_id`"+
+		" WHERE r.`group_id` IN (?)"+
+		" GROUP BY pm.`request_id`,pm.`currency`",
+		groupIDs,
+		groupIDs,
+	)
+	if err != nil {
+		return GroupNode{}, errors.Wrapf(err, "failed to make group tree received query")
+	}
+	if err := db.Select(&received, db.Rebind(query), args...); err != nil {
+		return GroupNode{}, errors.Wrapf(err, "failed to get group(id=%s) tree received totals", id)
+	}
+	requestIndex := map[ID]int{}
+	for i, r := range data.Requests {
+		requestIndex[r.ID] = i
+	}
+	for _, rcv := range received {
+		i := requestIndex[rcv.RequestID]
+		data.Requests[i].Received = append(data.Requests[i].Received, model.Quantity{Qty: float64(rcv.Qty), Unit: model.Unit(rcv.Unit)})
+	}
+	return data.Build(maxDepth)
+} //GetGroupTree()
+
+//Build the tree with children up to maxDepth levels below the top group,
+//but with roll-up totals that include all the groups in the data
+func (data GroupTreeData) Build(maxDepth int) (GroupNode, error) {
+	if len(data.Groups) == 0 {
+		return GroupNode{}, apierr.Errorf(apierr.NotFound, "group not found")
+	}
+	children := map[ID][]GroupTreeEntry{}
+	for _, g := range data.Groups[1:] {
+		children[g.ParentGroupID] = append(children[g.ParentGroupID], g)
+	}
+	own := map[ID]*groupTotaller{}
+	for _, g := range data.Groups {
+		own[g.ID] = newGroupTotaller()
+	}
+	for _, m := range data.Members {
+		if t, ok := own[m.GroupID]; ok {
+			t.users[m.UserID] = true
+		}
+	}
+	for _, r := range data.Requests {
+		t, ok := own[r.GroupID]
+		if !ok {
+			continue
+		}
+		unit := Request{Type: r.Type, Currency: r.Currency, Units: r.Units}.Unit()
+		received, err := model.Sum(unit, r.Received...)
+		if err != nil {
+			return GroupNode{}, errors.Wrapf(err, "cannot total request(id=%s) received quantities", r.ID)
+		}
+		t.requests++
+		if r.Status == RequestStatusOpen {
+			t.open++
+		}
+		ut := t.unit(unit)
+		ut.Requested += float64(r.Qty)
+		ut.Promised += float64(r.Promised)
+		ut.Received += received
+	}
+
+	var build func(g GroupTreeEntry) (GroupNode, *groupTotaller)
+	build = func(g GroupTreeEntry) (GroupNode, *groupTotaller) {
+		node := GroupNode{GroupTreeEntry: g, Totals: own[g.ID].totals()}
+		rollUp := newGroupTotaller()
+		rollUp.add(own[g.ID])
+		for _, c := range children[g.ID] {
+			child, childRollUp := build(c)
+			rollUp.add(childRollUp)
+			if g.Depth < maxDepth {
+				node.Children = append(node.Children, child)
+			} else {
+				node.Truncated = true
+			}
+		}
+		node.RollUp = rollUp.totals()
+		return node, rollUp
+	}
+	top, _ := build(data.Groups[0])
+	return top, nil
+} //GroupTreeData.Build()
+
+type groupTotaller struct {
+	users    map[ID]bool
+	units    map[model.Unit]*UnitTotals
+	requests int
+	open     int
+}
+
+func newGroupTotaller() *groupTotaller {
+	return &groupTotaller{users: map[ID]bool{}, units: map[model.Unit]*UnitTotals{}}
+}
+
+func (t *groupTotaller) unit(unit model.Unit) *UnitTotals {
+	ut, ok := t.units[unit]
+	if !ok {
+		ut = &UnitTotals{Unit: unit}
+		t.units[unit] = ut
+	}
+	return ut
+}
+
+func (t *groupTotaller) add(o *groupTotaller) {
+	for id := range o.users {
+		t.users[id] = true
+	}
+	for unit, out := range o.units {
+		ut := t.unit(unit)
+		ut.Requested += out.Requested
+		ut.Promised += out.Promised
+		ut.Received += out.Received
+	}
+	t.requests += o.requests
+	t.open += o.open
+}
+
+func (t *groupTotaller) totals() GroupTotals {
+	totals := GroupTotals{
+		Members:      len(t.users),
+		Requests:     t.requests,
+		OpenRequests: t.open,
+		Quantities:   []UnitTotals{},
+	}
+	for _, ut := range t.units {
+		totals.Quantities = append(totals.Quantities, *ut)
+	}
+	sort.Slice(totals.Quantities, func(i, j int) bool { return totals.Quantities[i].Unit < totals.Quantities[j].Unit })
+	return totals
+}
+
+//checkGroupParent fails if the parent does not exist,
+//or if moving the group under it would make a cycle
+func checkGroupParent(id ID, parentGroupID ID) error {
+	var ancestors []ID
+	if err := db.Select(&ancestors,
+		"WITH RECURSIVE `ancestors` AS ("+
+			"SELECT `id`,`parent_group_id`,0 AS `depth` FROM `groups` WHERE `id`=?"+
+			" UNION ALL"+
+			" SELECT g.`id`,g.`parent_group_id`,a.`depth`+1"+
+			" FROM `groups` AS g JOIN `ancestors` AS a ON g.`id`=a.`parent_group_id`"+
+			" WHERE a.`depth`<?"+
+			")"+
+			" SELECT `id` FROM `ancestors`",
+		parentGroupID,
+		MaxGroupDepth,
+	); err != nil {
+		return errors.Wrapf(err, "failed to get group(id=%s) ancestors", parentGroupID)
+	}
+	if len(ancestors) == 0 {
+		return apierr.Invalid("parent_group_id", "unknown parent group")
+	}
+	for _, a := range ancestors {
+		if a == id {
+			return apierr.Invalid("parent_group_id", "cannot move a group under itself or its own sub-group")
+		}
+	}
+	return nil
+} //checkGroupParent()
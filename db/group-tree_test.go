@@ -0,0 +1,95 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/model"
+)
+
+func TestGroupTreeBuild(t *testing.T) {
+	kg := "kg"
+	data := db.GroupTreeData{
+		Groups: []db.GroupTreeEntry{
+			{ID: "school", Title: "School"},
+			{ID: "fete", ParentGroupID: "school", Title: "Fete", Depth: 1},
+			{ID: "stall", ParentGroupID: "fete", Title: "Stall", Depth: 2},
+		},
+		Members: []db.GroupTreeMember{
+			{GroupID: "school", UserID: "a"},
+			{GroupID: "fete", UserID: "a"},
+			{GroupID: "stall", UserID: "b"},
+		},
+		Requests: []db.GroupTreeRequest{
+			{ID: "flour", GroupID: "stall", Units: &kg, Qty: 2, Status: db.RequestStatusFulfilled, Promised: 3, Received: []model.Quantity{{Qty: 1, Unit: "kg"}, {Qty: 1000, Unit: "g"}}},
+			{ID: "sugar", GroupID: "stall", Units: &kg, Qty: 5, Status: db.RequestStatusOpen, Received: []model.Quantity{{Qty: 500, Unit: "g"}}},
+			{ID: "tables", GroupID: "fete", Qty: 10, Status: db.RequestStatusOpen},
+		},
+	}
+	tree, err := data.Build(1)
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if len(tree.Children) != 1 || len(tree.Children[0].Children) != 0 || !tree.Children[0].Truncated {
+		t.Fatalf("depth 1: %+v", tree)
+	}
+	rollUp := tree.RollUp
+	if rollUp.Members != 2 || rollUp.Requests != 3 || rollUp.OpenRequests != 2 || len(rollUp.Quantities) != 2 {
+		t.Fatalf("roll-up: %+v", rollUp)
+	}
+	if q := rollUp.Quantities[1]; q.Unit != "kg" || q.Requested != 7 || q.Promised != 3 || q.Received != 2.5 {
+		t.Fatalf("kg: %+v", q)
+	}
+	if tree.Totals.Members != 1 || tree.Totals.Requests != 0 || tree.Children[0].Totals.Requests != 1 {
+		t.Fatalf("totals: %+v", tree)
+	}
+	if _, err := (db.GroupTreeData{}).Build(1); err == nil {
+		t.Fatalf("built tree without groups")
+	}
+}
+
+func TestGroupTree(t *testing.T) {
+	requireDB(t)
+	u, err := db.AddUser(db.User{Name: "Tree", Phone: "0821111114", Email: "tree@b.c"})
+	if err != nil {
+		t.Fatalf("failed to create user: %+v", err)
+	}
+	defer db.DelUser(u.ID)
+	school, err := db.AddGroup(u, db.NewGroup{Title: "Tree school", UserRole: "Organiser"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelGroup(school.ID)
+	fete, err := db.AddGroup(u, db.NewGroup{ParentGroupID: school.ID, Title: "Fete", UserRole: "Organiser"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelGroup(fete.ID)
+	stall, err := db.AddGroup(u, db.NewGroup{ParentGroupID: fete.ID, Title: "Stall", UserRole: "Organiser"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelGroup(stall.ID)
+	r, err := db.AddRequest(db.Request{GroupID: stall.ID, Title: "Flour", Qty: 10})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelRequest(r.ID)
+
+	tree, err := db.GetGroupTree(school.ID, db.MaxGroupDepth)
+	if err != nil || len(tree.Children) != 1 || len(tree.Children[0].Children) != 1 || tree.RollUp.Requests != 1 || tree.RollUp.Members != 1 {
+		t.Fatalf("tree: %+v %+v", tree, err)
+	}
+
+	parentID := stall.ID
+	if err := db.UpdGroup(db.UpdGroupRequest{ID: school.ID, ParentGroupID: &parentID}); err == nil {
+		t.Fatalf("moved group under its own sub-group")
+	}
+	parentID = school.ID
+	if err := db.UpdGroup(db.UpdGroupRequest{ID: stall.ID, ParentGroupID: &parentID}); err != nil {
+		t.Fatalf("move: %+v", err)
+	}
+	if tree, _ := db.GetGroupTree(school.ID, db.MaxGroupDepth); len(tree.Children) != 2 {
+		t.Fatalf("moved: %+v", tree)
+	}
+}
@@ -1,11 +1,13 @@
 package db
 
 import (
+	"database/sql"
 	"strings"
 	"time"
 
 	"github.com/go-msvc/errors"
 	"github.com/google/uuid"
+	"github.com/jansemmelink/don8/apierr"
 )
 
 var localTime = time.Now().Location()
@@ -24,7 +26,7 @@ type NewGroup struct {
 func (g *NewGroup) Validate() error {
 	g.Title = strings.TrimSpace(g.Title)
 	if g.Title == "" {
-		return errors.Errorf("missing title")
+		return apierr.Invalid("title", "missing title")
 	}
 	if g.Description != nil {
 		*g.Description = strings.TrimSpace(*g.Description) //optional
@@ -32,13 +34,13 @@ func (g *NewGroup) Validate() error {
 
 	if g.Start != nil || g.End != nil {
 		if g.Start == nil {
-			return errors.Errorf("end specified without start")
+			return apierr.Invalid("start", "end specified without start")
 		}
 		*g.Start = strings.TrimSpace(*g.Start)
 		st, err := time.ParseInLocation("2006-01-02 15:04", *g.Start, localTime)
 		if err != nil {
 			if st, err = time.ParseInLocation("2006-01-02", *g.Start, localTime); err != nil {
-				return errors.Errorf("invalid start \"%s\" expected CCYY-MM-DD or CCYY-MM-DD HH:MM", *g.Start)
+				return apierr.Invalid("start", "invalid start \"%s\" expected CCYY-MM-DD or CCYY-MM-DD HH:MM", *g.Start)
 			}
 		}
 		if g.End == nil || *g.End == "" {
@@ -48,11 +50,11 @@ func (g *NewGroup) Validate() error {
 		et, err := time.ParseInLocation("2006-01-02 15:04", *g.End, localTime)
 		if err != nil {
 			if et, err = time.ParseInLocation("2006-01-02", *g.End, localTime); err != nil {
-				return errors.Errorf("invalid end \"%s\" expected CCYY-MM-DD or CCYY-MM-DD HH:MM", *g.End)
+				return apierr.Invalid("end", "invalid end \"%s\" expected CCYY-MM-DD or CCYY-MM-DD HH:MM", *g.End)
 			}
 		}
 		if et.Before(st) {
-			return errors.Errorf("end \"%s\" is before start \"%s\"", *g.End, *g.Start)
+			return apierr.Invalid("end", "end \"%s\" is before start \"%s\"", *g.End, *g.Start)
 		}
 		sqlst := SqlTime(st)
 		g.startTime = &sqlst
@@ -61,7 +63,7 @@ func (g *NewGroup) Validate() error {
 	} //if time specified
 	g.UserRole = strings.TrimSpace(g.UserRole) //required
 	if g.UserRole == "" {
-		return errors.Errorf("missing user_role")
+		return apierr.Invalid("user_role", "missing user_role")
 	}
 	return nil
 }
@@ -139,27 +141,45 @@ type MyGroup struct {
 	Permission  []string `json:"permissions" db:"-" doc:"List of permissions, |*| for group owner(s)."`
 }
 
-func MyGroups(user User, filter string, fromTime *time.Time, toTime *time.Time) ([]MyGroup, error) {
-	var list []MyGroup
-	sql := "SELECT g.`id` AS `group_id`,g.`parent_group_id`,g.`title`,g.`description`,g.`start`,g.`end` FROM `groups` AS g JOIN `members` AS m ON m.`group_id`=g.`id` WHERE m.`user_id`=?"
+//MyGroupList is one page of MyGroups()
+type MyGroupList struct {
+	Groups []MyGroup `json:"groups"`
+	Page
+}
+
+var MyGroupSort = SortFields{
+	Default: "start",
+	Columns: map[string]string{
+		"start": "g.`start`",
+		"end":   "g.`end`",
+		"title": "g.`title`",
+	},
+	ID: "g.`id`",
+}
+
+func MyGroups(user User, filter string, fromTime *time.Time, toTime *time.Time, page PageRequest) (MyGroupList, error) {
+	list := MyGroupList{Groups: []MyGroup{}}
+	from := "FROM `groups` AS g JOIN `members` AS m ON m.`group_id`=g.`id` WHERE m.`user_id`=?"
 	args := []interface{}{user.ID}
 
 	filter = strings.TrimSpace(filter)
 	if filter != "" {
-		sql += " AND g.`title` LIKE ?"
+		from += " AND g.`title` LIKE ?"
 		args = append(args, "%"+filter+"%")
 	}
 	if fromTime != nil {
-		sql += " AND g.`end` > ?"
+		from += " AND g.`end` > ?"
 		args = append(args, SqlTime(*fromTime))
 	}
 	if toTime != nil {
-		sql += " AND g.`start` < ?"
+		from += " AND g.`start` < ?"
 		args = append(args, SqlTime(*toTime))
 	}
-	sql += " ORDER BY g.`start`"
-	if err := db.Select(&list, sql, args...); err != nil {
-		return nil, errors.Wrapf(err, "failed to list my own groups")
+	var err error
+	if list.Page, err = selectPage(&list.Groups,
+		"g.`id` AS `group_id`,g.`parent_group_id`,g.`title`,g.`description`,g.`start`,g.`end`,m.`role`",
+		from, args, page, MyGroupSort); err != nil {
+		return MyGroupList{}, errors.Wrapf(err, "failed to list my own groups")
 	}
 	return list, nil
 }
@@ -175,6 +195,55 @@ func GetGroup(id ID) (Group, error) {
 	return g, nil
 }
 
+//GetChildGroupByTitle returns nil if not found
+func GetChildGroupByTitle(parentGroupID ID, title string) (*Group, error) {
+	var g Group
+	if err := db.Get(&g,
+		"SELECT id,parent_group_id,title,description FROM `groups` WHERE parent_group_id=? AND title=?",
+		parentGroupID,
+		title,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil //not found
+		}
+		return nil, errors.Wrapf(err, "failed to get group(parent_group_id=%s,title=%s)", parentGroupID, title)
+	}
+	return &g, nil
+} //GetChildGroupByTitle()
+
+//GroupTreeEntry is a group in ListGroupTree() with its depth below the top group
+type GroupTreeEntry struct {
+	ID            ID     `json:"id" db:"id"`
+	ParentGroupID ID     `json:"parent_group_id,omitempty" db:"parent_group_id"`
+	Title         string `json:"title" db:"title"`
+	Depth         int    `json:"depth" db:"depth" doc:"0 for the top group, 1 for its children etc."`
+}
+
+//ListGroupTree returns the group and its descendants up to MaxGroupDepth levels below it,
+//each group followed by its children sorted by title
+func ListGroupTree(id ID) ([]GroupTreeEntry, error) {
+	var list []GroupTreeEntry
+	if err := db.Select(&list,
+		"WITH RECURSIVE `tree` AS ("+
+			"SELECT `id`,COALESCE(`parent_group_id`,'') AS `parent_group_id`,`title`,0 AS `depth`,CAST(`title` AS CHAR(4000)) AS `path`"+
+			" FROM `groups` WHERE `id`=?"+
+			" UNION ALL"+
+			" SELECT g.`id`,g.`parent_group_id`,g.`title`,t.`depth`+1,CONCAT(t.`path`,CHAR(0),g.`title`)"+
+			" FROM `groups` AS g JOIN `tree` AS t ON g.`parent_group_id`=t.`id`"+
+			" WHERE t.`depth`<?"+
+			")"+
+			" SELECT `id`,`parent_group_id`,`title`,`depth` FROM `tree` ORDER BY `path`",
+		id,
+		MaxGroupDepth,
+	); err != nil {
+		return nil, errors.Wrapf(err, "failed to list group(id=%s) tree", id)
+	}
+	if len(list) == 0 {
+		return nil, apierr.Errorf(apierr.NotFound, "group(id=%s) not found", id)
+	}
+	return list, nil
+} //ListGroupTree()
+
 type FullGroup struct {
 	Parent *Group `json:"parent,omitempty"`
 	Group
@@ -207,25 +276,29 @@ func GetFullGroup(id ID) (FullGroup, error) {
 }
 
 type UpdGroupRequest struct {
-	ID          ID      `json:"id"`
-	Title       *string `json:"title,omitempty"`
-	Description *string `json:"description,omitempty"`
+	ID            ID      `json:"id"`
+	ParentGroupID *ID     `json:"parent_group_id,omitempty" doc:"Move the group under this group, or \"\" to make it a top group"`
+	Title         *string `json:"title,omitempty"`
+	Description   *string `json:"description,omitempty"`
 }
 
 func (req UpdGroupRequest) Validate() error {
 	if req.ID == "" {
-		return errors.Errorf("missing id")
+		return apierr.Invalid("id", "missing id")
+	}
+	if req.ParentGroupID != nil && *req.ParentGroupID == req.ID {
+		return apierr.Invalid("parent_group_id", "group cannot be its own parent")
 	}
 	if req.Title != nil {
 		*req.Title = strings.TrimSpace(*req.Title)
 		if *req.Title == "" {
-			return errors.Errorf("empty title not allowed")
+			return apierr.Invalid("title", "empty title not allowed")
 		}
 	}
 	if req.Description != nil {
 		*req.Description = strings.TrimSpace(*req.Description)
 		if *req.Description == "" {
-			return errors.Errorf("empty description not allowed")
+			return apierr.Invalid("description", "empty description not allowed")
 		}
 	}
 	return nil
@@ -255,16 +328,30 @@ func UpdGroup(req UpdGroupRequest) error {
 		args = append(args, *req.Description)
 		changes++
 	}
+	if req.ParentGroupID != nil {
+		if *req.ParentGroupID != "" {
+			if err := checkGroupParent(req.ID, *req.ParentGroupID); err != nil {
+				return err
+			}
+		}
+		if changes > 0 {
+			sql += ","
+		} else {
+			sql += " "
+		}
+		sql += "`parent_group_id`=?"
+		args = append(args, *req.ParentGroupID)
+		changes++
+	}
 	if changes < 1 {
-		return errors.Errorf("no changes specified")
+		return apierr.Errorf(apierr.ValidationFailed, "no changes specified")
 	}
 	//finish the query SQL then exec
 	sql += " WHERE `id`=?"
 	args = append(args, req.ID)
 	_, err := db.Exec(sql, args...)
 	if err != nil {
-		log.Errorf("failed to update group(id:%s): %+v", req.ID, err)
-		return errors.Errorf("failed to update")
+		return errors.Wrapf(err, "failed to update group(id:%s)", req.ID)
 	}
 
 	return nil
@@ -286,6 +373,13 @@ func DelGroup(id ID) error {
 		return errors.Wrapf(err, "failed to delete group members")
 	}
 
+	if _, err := db.Exec("DELETE FROM `request_tags` WHERE `tag_id` IN (SELECT `id` FROM `tags` WHERE `group_id`=?)", id); err != nil {
+		return errors.Wrapf(err, "failed to delete group request tags")
+	}
+	if _, err := db.Exec("DELETE FROM `tags` WHERE `group_id`=?", id); err != nil {
+		return errors.Wrapf(err, "failed to delete group tags")
+	}
+
 	if _, err := db.Exec("DELETE FROM `groups` WHERE id=?", id); err != nil {
 		return errors.Wrapf(err, "failed to delete group(id=%s)", id)
 	}
@@ -7,6 +7,7 @@ import (
 )
 
 func TestGroups(t *testing.T) {
+	requireDB(t)
 	u, err := db.AddUser(db.User{Name: "A", Phone: "0821111111", Email: "a@b.c"})
 	if err != nil {
 		t.Fatalf("failed to create user for group member")
@@ -43,12 +44,12 @@ func TestGroups(t *testing.T) {
 	}()
 
 	for _, filter := range []string{"AHS", "AHMP", "Wildsfees"} {
-		groups, err := db.MyGroups(u, filter, nil, nil)
+		list, err := db.MyGroups(u, filter, nil, nil, db.PageRequest{})
 		if err != nil {
 			t.Fatalf("failed to find %s: %+v", filter, err)
 		}
-		t.Logf("Found %d %s groups", len(groups), filter)
-		for _, g := range groups {
+		t.Logf("Found %d %s groups", list.Total, filter)
+		for _, g := range list.Groups {
 			t.Logf("  %s: %+v", filter, g)
 		}
 	}
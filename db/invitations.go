@@ -9,7 +9,9 @@ import (
 
 	"github.com/go-msvc/errors"
 	"github.com/google/uuid"
-	"github.com/jansemmelink/events/email"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/emails"
+	"github.com/jansemmelink/don8/events"
 )
 
 type Invitation struct {
@@ -17,7 +19,7 @@ type Invitation struct {
 	GroupID     ID               `json:"-" db:"group_id"`
 	Group       *Group           `json:"group,omitempty" db:"-"`
 	Email       string           `json:"email" db:"email"`
-	TimeCreated SqlTime          `json:"time_created" db:"time_updates"`
+	TimeCreated SqlTime          `json:"time_created" db:"time_created"`
 	TimeUpdated SqlTime          `json:"time_updated" db:"time_updated"`
 	Status      InvitationStatus `json:"status" db:"status"`
 }
@@ -25,13 +27,13 @@ type Invitation struct {
 //Validate new invitation when received and about to create in db
 func (inv *Invitation) Validate() error {
 	if inv.GroupID == "" {
-		return errors.Errorf("missing group_id")
+		return apierr.Invalid("group_id", "missing group_id")
 	}
 	if inv.Email == "" {
-		return errors.Errorf("missing email")
+		return apierr.Invalid("email", "missing email")
 	}
-	if validEmail, err := email.Valid(inv.Email); err != nil {
-		return errors.Errorf("invalid email(%s)", inv.Email)
+	if validEmail, err := emails.Valid(inv.Email); err != nil {
+		return apierr.Invalid("email", "invalid email(%s)", inv.Email)
 	} else {
 		inv.Email = validEmail
 	}
@@ -55,12 +57,13 @@ func AddInvitation(req Invitation) (*Invitation, error) {
 	); err != nil {
 		return nil, errors.Wrapf(err, "failed to create invitation")
 	}
+	events.Publish(events.InvitationCreated, string(req.GroupID), req, nil)
 	return &req, nil
 } //AddInvitation()
 
 func GetInvitationByEmail(groupID ID, email string) (*Invitation, error) {
 	var inv Invitation
-	if err := db.Get(&inv, "SELECT `id`,`group_id`,`email`,`time_created`,`time_updates` FROM `invitations` AS i WHERE i.`group_id`=? AND i.`email`=?",
+	if err := db.Get(&inv, "SELECT `id`,`group_id`,`email`,`time_created`,`time_updated`,`status` FROM `invitations` AS i WHERE i.`group_id`=? AND i.`email`=?",
 		groupID,
 		email,
 	); err != nil {
@@ -77,7 +80,7 @@ func GetInvitationByEmail(groupID ID, email string) (*Invitation, error) {
 //output is keyed on email, similar to GetMembers() output
 func GetPendingInvitations(groupID ID) (map[string]Invitation, error) {
 	var invitations []Invitation
-	if err := db.Select(&invitations, "SELECT id,group_id,email,time_create,time_updated FROM `invitations` WHERE group_id=?", groupID); err != nil {
+	if err := db.Select(&invitations, "SELECT id,group_id,email,time_created,time_updated,status FROM `invitations` WHERE group_id=?", groupID); err != nil {
 		log.Errorf("failed to get group(id:%s) invitations: %+v", groupID, err)
 		return nil, errors.Errorf("failed to get invitations")
 	}
@@ -88,6 +91,37 @@ func GetPendingInvitations(groupID ID) (map[string]Invitation, error) {
 	return invitationByEmail, nil
 } //GetPendingInvitations()
 
+//InvitationList is one page of ListGroupInvitations()
+type InvitationList struct {
+	Invitations []Invitation `json:"invitations"`
+	Page
+}
+
+var InvitationSort = SortFields{
+	Default: "email",
+	Columns: map[string]string{
+		"email":        "`email`",
+		"time_created": "`time_created`",
+		"time_updated": "`time_updated`",
+		"status":       "`status`",
+	},
+	ID: "`id`",
+}
+
+func ListGroupInvitations(groupID ID, page PageRequest) (InvitationList, error) {
+	list := InvitationList{Invitations: []Invitation{}}
+	var err error
+	if list.Page, err = selectPage(&list.Invitations,
+		"`id`,`group_id`,`email`,`time_created`,`time_updated`,`status`",
+		"FROM `invitations` WHERE `group_id`=?",
+		[]interface{}{groupID},
+		page,
+		InvitationSort); err != nil {
+		return InvitationList{}, errors.Wrapf(err, "failed to list group(id:%s) invitations", groupID)
+	}
+	return list, nil
+} //ListGroupInvitations()
+
 func DelInviation(id ID) error {
 	if _, err := db.Exec("DELETE FROM `invitations` WHERE id=?", id); err != nil {
 		return errors.Wrapf(err, "failed to delete invitation")
@@ -102,12 +136,14 @@ const (
 	InvitationStatusNone InvitationStatus = iota
 	InvitationStatusSent
 	InvitationStatusBlocked
+	InvitationStatusUndeliverable
 )
 
 var (
 	InvitationStatusValToStr = map[InvitationStatus]string{
-		InvitationStatusSent:    "sent",
-		InvitationStatusBlocked: "blocked",
+		InvitationStatusSent:          "sent",
+		InvitationStatusBlocked:       "blocked",
+		InvitationStatusUndeliverable: "undeliverable",
 	}
 	InvitationStatusStrToVal = map[string]InvitationStatus{}
 )
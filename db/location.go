@@ -6,11 +6,11 @@ import (
 )
 
 type Location struct {
-	ID               ID     `db:"id"`
-	GroupID          ID     `db:"group_id"`
-	Title            string `db:"title"`
-	Description      string `db:"description"`
-	FinalDestination bool   `db:"final_destination"`
+	ID               ID      `json:"id" db:"id"`
+	GroupID          ID      `json:"group_id" db:"group_id"`
+	Title            string  `json:"title" db:"title"`
+	Description      *string `json:"description,omitempty" db:"description"`
+	FinalDestination bool    `json:"final_destination" db:"final_destination" doc:"True where donations must end up, e.g. the stall, false for collection points"`
 }
 
 func AddLocation(c Location) (Location, error) {
@@ -28,15 +28,32 @@ func AddLocation(c Location) (Location, error) {
 	return c, nil
 }
 
-func ListGroupLocations(groupID ID) ([]Location, error) {
-	var locations []Location
-	if err := db.Select(&locations,
-		"SELECT `id`,`title`,`description`,`final_destination` FROM `locations` WHERE `group_id`=? ORDER BY `title`",
-		groupID,
-	); err != nil {
-		return nil, errors.Wrapf(err, "failed to list group locations")
+//LocationList is one page of ListGroupLocations()
+type LocationList struct {
+	Locations []Location `json:"locations"`
+	Page
+}
+
+var LocationSort = SortFields{
+	Default: "title",
+	Columns: map[string]string{
+		"title": "`title`",
+	},
+	ID: "`id`",
+}
+
+func ListGroupLocations(groupID ID, page PageRequest) (LocationList, error) {
+	list := LocationList{Locations: []Location{}}
+	var err error
+	if list.Page, err = selectPage(&list.Locations,
+		"`id`,`group_id`,`title`,`description`,`final_destination`",
+		"FROM `locations` WHERE `group_id`=?",
+		[]interface{}{groupID},
+		page,
+		LocationSort); err != nil {
+		return LocationList{}, errors.Wrapf(err, "failed to list group locations")
 	}
-	return locations, nil
+	return list, nil
 }
 
 func DelLocation(id string) error {
@@ -0,0 +1,36 @@
+package db_test
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/jansemmelink/don8/config"
+	"github.com/jansemmelink/don8/db"
+)
+
+//TestMain connects to the database configured in env, e.g. DB_HOST and DB_PORT
+func TestMain(m *testing.M) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := config.NewLoader(fs)
+	fs.Parse([]string{"-env", "dev"})
+	c, err := l.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cannot load config: %+v\n", err)
+		os.Exit(1)
+	}
+	//no retries: tests that need the database are skipped when it is not running
+	if dbErr = db.Connect(c.DB); dbErr != nil {
+		fmt.Fprintf(os.Stderr, "skipping database tests: %+v\n", dbErr)
+	}
+	os.Exit(m.Run())
+}
+
+var dbErr error
+
+func requireDB(t *testing.T) {
+	if dbErr != nil {
+		t.Skipf("no database: %v", dbErr)
+	}
+}
@@ -5,25 +5,28 @@ import (
 
 	"github.com/go-msvc/errors"
 	"github.com/google/uuid"
+	"github.com/jansemmelink/don8/events"
 )
 
 type Member struct {
-	ID      ID     `db:"id"`
-	GroupID ID     `db:"group_id"`
-	UserID  ID     `db:"user_id"`
-	Role    string `db:"role"`
+	ID      ID     `json:"id" db:"id"`
+	GroupID ID     `json:"group_id" db:"group_id"`
+	UserID  ID     `json:"user_id" db:"user_id"`
+	Role    string `json:"role" db:"role"`
 }
 
 func AddMember(c Member) (Member, error) {
 	id := uuid.New().String()
-	if _, err := db.Exec("INSERT INTO `members` SET `id`=?,`group_id`=?,`user_id`=?",
+	if _, err := db.Exec("INSERT INTO `members` SET `id`=?,`group_id`=?,`user_id`=?,`role`=?",
 		id,
 		c.GroupID,
 		c.UserID,
+		c.Role,
 	); err != nil {
 		return Member{}, errors.Wrapf(err, "failed to add member")
 	}
 	c.ID = ID(id)
+	events.Publish(events.MemberJoined, string(c.GroupID), c, nil)
 	return c, nil
 }
 
@@ -36,15 +39,45 @@ type MemberListEntry struct {
 	Role    string `json:"role" db:"role"`
 }
 
-func ListGroupMembers(groupID ID) ([]MemberListEntry, error) {
-	var members []MemberListEntry
-	if err := db.Select(&members,
-		"SELECT c.`id`,c.`user_id`,c.`role`,u.`name`,u.`phone`,u.`email` FROM `members` as c JOIN `users` as u ON c.`user_id`=u.`id` WHERE c.`group_id`=? ORDER BY u.`name`",
-		groupID,
-	); err != nil {
-		return nil, errors.Wrapf(err, "failed to list group members")
+//MemberList is one page of ListGroupMembers()
+type MemberList struct {
+	Members []MemberListEntry `json:"members"`
+	Page
+}
+
+var MemberSort = SortFields{
+	Default: "name",
+	Columns: map[string]string{
+		"name":  "u.`name`",
+		"email": "u.`email`",
+		"role":  "m.`role`",
+	},
+	ID: "m.`id`",
+}
+
+func ListGroupMembers(groupID ID, page PageRequest) (MemberList, error) {
+	type memberRow struct {
+		MemberListEntry
+		Name  string `db:"name"`
+		Phone string `db:"phone"`
+		Email string `db:"email"`
 	}
-	return members, nil
+	var rows []memberRow
+	p, err := selectPage(&rows,
+		"m.`id`,m.`group_id`,m.`user_id`,m.`role`,u.`name`,u.`phone`,u.`email`",
+		"FROM `members` AS m JOIN `users` AS u ON m.`user_id`=u.`id` WHERE m.`group_id`=?",
+		[]interface{}{groupID},
+		page,
+		MemberSort)
+	if err != nil {
+		return MemberList{}, errors.Wrapf(err, "failed to list group members")
+	}
+	list := MemberList{Members: make([]MemberListEntry, len(rows)), Page: p}
+	for i, row := range rows {
+		list.Members[i] = row.MemberListEntry
+		list.Members[i].User = &User{ID: row.UserID, Name: row.Name, Phone: row.Phone, Email: row.Email}
+	}
+	return list, nil
 }
 
 func GetMemberByEmail(groupID ID, email string) (*Member, error) {
@@ -62,20 +95,27 @@ func GetMemberByEmail(groupID ID, email string) (*Member, error) {
 } //GetMemberByEmail()
 
 func GetMembersBy(groupID ID, by string) (map[string]MemberListEntry, error) {
-	members, err := ListGroupMembers(groupID)
-	if err != nil {
-		log.Errorf("GetMembersBy(%s,%s): failed to get members: %+v", groupID, by, err)
-		return nil, err
-	}
 	memberByEmail := map[string]MemberListEntry{}
-	for _, m := range members {
-		switch by {
-		case "email":
-			memberByEmail[m.User.Email] = m
-		default:
-			log.Errorf("failed to get members with unknown key field(%s)", by)
-			return nil, errors.Errorf("failed to get members")
+	page := PageRequest{Size: MaxPageSize}
+	for {
+		list, err := ListGroupMembers(groupID, page)
+		if err != nil {
+			log.Errorf("GetMembersBy(%s,%s): failed to get members: %+v", groupID, by, err)
+			return nil, err
+		}
+		for _, m := range list.Members {
+			switch by {
+			case "email":
+				memberByEmail[m.User.Email] = m
+			default:
+				log.Errorf("failed to get members with unknown key field(%s)", by)
+				return nil, errors.Errorf("failed to get members")
+			}
+		}
+		if list.NextCursor == "" {
+			break
 		}
+		page.Cursor = list.NextCursor
 	}
 	return memberByEmail, nil
 }
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"crypto/rand"
+	"sort"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/model"
+	"github.com/jmoiron/sqlx"
+)
+
+//RequestType is what is requested
+type RequestType string
+
+const (
+	RequestTypeGoods RequestType = "goods" //qty in units
+	RequestTypeMoney RequestType = "money" //qty is an amount in minor units of the currency
+)
+
+//validateType sets the defaults for the type of request
+func (req *Request) validateType() error {
+	switch req.Type {
+	case "", RequestTypeGoods:
+		req.Type = RequestTypeGoods
+		if req.Currency != "" {
+			return apierr.Invalid("currency", "currency only applies to money requests")
+		}
+	case RequestTypeMoney:
+		if req.Units != nil {
+			return apierr.Invalid("units", "money requests have no units, qty is the amount in minor units of the currency")
+		}
+		def, err := req.Currency.Def()
+		if err != nil {
+			return apierr.Invalid("currency", "%s", err)
+		}
+		req.Currency = def.Code
+	default:
+		return apierr.Invalid("type", "unknown type \"%s\", expecting goods|money", req.Type)
+	}
+	return nil
+}
+
+//pledgeReferenceChars are easy to read and type, i.e. no 0/O or 1/I
+const pledgeReferenceChars = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+//newPledgeReference makes the reference that a donor uses when paying a pledge,
+//e.g. "D8K7M3P9QX", short enough for the reference field of bank payments
+func newPledgeReference() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrapf(err, "failed to make pledge reference")
+	}
+	ref := []byte("D8")
+	for _, c := range b {
+		ref = append(ref, pledgeReferenceChars[int(c)%len(pledgeReferenceChars)])
+	}
+	return string(ref), nil
+}
+
+//MoneyTotals are the amounts in one currency, in minor units
+type MoneyTotals struct {
+	Currency  model.Currency        `json:"currency"`
+	Requested int                   `json:"requested"`
+	Pledged   int                   `json:"pledged" doc:"Pledges that are not withdrawn or waitlisted"`
+	Paid      int                   `json:"paid"`
+	ByMethod  map[PaymentMethod]int `json:"by_method" doc:"Paid per payment method"`
+}
+
+//GroupMoney are the money totals of one group
+type GroupMoney struct {
+	GroupTreeEntry
+	Totals []MoneyTotals `json:"totals" doc:"Totals of this group only, per currency"`
+}
+
+//MoneyReport from GetGroupMoney()
+type MoneyReport struct {
+	Groups []GroupMoney  `json:"groups" doc:"The group and those sub-groups with money requests or payments"`
+	Totals []MoneyTotals `json:"totals" doc:"Totals of the group and all its sub-groups, per currency"`
+}
+
+//MoneyAmount is summed into the report,
+//either requested and pledged amounts, or paid amounts with the method
+type MoneyAmount struct {
+	GroupID   ID             `db:"group_id"`
+	Currency  model.Currency `db:"currency"`
+	Requested int            `db:"requested"`
+	Pledged   int            `db:"pledged"`
+	Method    PaymentMethod  `db:"method"`
+	Paid      int            `db:"paid"`
+}
+
+//GetGroupMoney totals the money requests, pledges and payments in the group and its sub-groups
+func GetGroupMoney(id ID) (MoneyReport, error) {
+	groups, err := ListGroupTree(id)
+	if err != nil {
+		return MoneyReport{}, err
+	}
+	if len(groups) == 0 {
+		return MoneyReport{}, apierr.Errorf(apierr.NotFound, "group not found")
+	}
+	groupIDs := []string{}
+	for _, g := range groups {
+		groupIDs = append(groupIDs, string(g.ID))
+	}
+
+	var amounts []MoneyAmount
+	query, args, err := sqlx.In("SELECT r.`group_id`,r.`currency`,SUM(r.`qty`) AS `requested`,"+
+		"SUM(COALESCE((SELECT SUM(p.`qty`) FROM `promises` AS p WHERE p.`request_id`=r.`id` AND p.`status` NOT IN (?,?)),0)) AS `pledged`"+
+		" FROM `requests` AS r WHERE r.`group_id` IN (?) AND r.`type`=?"+
+		" GROUP BY r.`group_id`,r.`currency`",
+		PromiseStatusWithdrawn,
+		PromiseStatusWaitlisted,
+		groupIDs,
+		RequestTypeMoney,
+	)
+	if err != nil {
+		return MoneyReport{}, errors.Wrapf(err, "failed to make group money requests query")
+	}
+	if err := db.Select(&amounts, db.Rebind(query), args...); err != nil {
+		return MoneyReport{}, errors.Wrapf(err, "failed to get group(id=%s) money requests", id)
+	}
+
+	var paid []MoneyAmount
+	query, args, err = sqlx.In("SELECT r.`group_id`,pm.`currency`,pm.`method`,SUM(pm.`amount`) AS `paid`"+
+		" FROM `payments` AS pm JOIN `requests` AS r ON r.`id`=pm.`request_id`"+
+		" WHERE r.`group_id` IN (?)"+
+		" GROUP BY r.`group_id`,pm.`currency`,pm.`method`",
+		groupIDs,
+	)
+	if err != nil {
+		return MoneyReport{}, errors.Wrapf(err, "failed to make group payments query")
+	}
+	if err := db.Select(&paid, db.Rebind(query), args...); err != nil {
+		return MoneyReport{}, errors.Wrapf(err, "failed to get group(id=%s) payments", id)
+	}
+	return SumMoney(groups, append(amounts, paid...)), nil
+} //GetGroupMoney()
+
+//SumMoney makes the report of the groups from ListGroupTree(),
+//which starts with the top group that is always in the report
+func SumMoney(groups []GroupTreeEntry, amounts []MoneyAmount) MoneyReport {
+	own := map[ID]map[model.Currency]*MoneyTotals{}
+	all := map[model.Currency]*MoneyTotals{}
+	add := func(totals map[model.Currency]*MoneyTotals, a MoneyAmount) {
+		t, ok := totals[a.Currency]
+		if !ok {
+			t = &MoneyTotals{Currency: a.Currency, ByMethod: map[PaymentMethod]int{}}
+			totals[a.Currency] = t
+		}
+		t.Requested += a.Requested
+		t.Pledged += a.Pledged
+		if a.Paid != 0 {
+			t.Paid += a.Paid
+			t.ByMethod[a.Method] += a.Paid
+		}
+	}
+	for _, a := range amounts {
+		if _, ok := own[a.GroupID]; !ok {
+			own[a.GroupID] = map[model.Currency]*MoneyTotals{}
+		}
+		add(own[a.GroupID], a)
+		add(all, a)
+	}
+
+	report := MoneyReport{Groups: []GroupMoney{}, Totals: moneyTotalsList(all)}
+	for i, g := range groups {
+		if totals, ok := own[g.ID]; ok || i == 0 {
+			report.Groups = append(report.Groups, GroupMoney{GroupTreeEntry: g, Totals: moneyTotalsList(totals)})
+		}
+	}
+	return report
+} //SumMoney()
+
+func moneyTotalsList(totals map[model.Currency]*MoneyTotals) []MoneyTotals {
+	list := []MoneyTotals{}
+	for _, t := range totals {
+		list = append(list, *t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Currency < list[j].Currency })
+	return list
+}
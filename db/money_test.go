@@ -0,0 +1,204 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jansemmelink/don8/db"
+)
+
+func TestMoneyRequestValidate(t *testing.T) {
+	r := db.Request{GroupID: "g", Title: "Building fund", Type: db.RequestTypeMoney, Qty: 500000}
+	if err := r.Validate(); err != nil || r.Currency != "ZAR" || r.Unit() != "ZAR" {
+		t.Fatalf("validate: %+v %+v", r, err)
+	}
+	goods := db.Request{GroupID: "g", Title: "Flour", Qty: 10}
+	if err := goods.Validate(); err != nil || goods.Type != db.RequestTypeGoods {
+		t.Fatalf("goods: %+v %+v", goods, err)
+	}
+	kg := "kg"
+	for _, invalid := range []db.Request{
+		{GroupID: "g", Title: "Fund", Type: db.RequestTypeMoney, Qty: 100, Units: &kg},
+		{GroupID: "g", Title: "Fund", Type: db.RequestTypeMoney, Qty: 100, Currency: "XYZ"},
+		{GroupID: "g", Title: "Flour", Qty: 10, Currency: "ZAR"},
+		{GroupID: "g", Title: "Flour", Qty: 10, Type: "services"},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("invalid request accepted: %+v", invalid)
+		}
+	}
+}
+
+func TestMatchStatement(t *testing.T) {
+	pledges := []db.Pledge{
+		{PromiseID: "p1", RequestID: "r", Reference: "D8AAAA2222", Amount: 10000},
+		{PromiseID: "p2", RequestID: "r", Reference: "D8BBBB3333", Amount: 20000, Paid: 5000},
+		{PromiseID: "p3", RequestID: "r", Reference: "D8CCCC4444", Amount: 5000, Paid: 5000},
+	}
+	rec := db.MatchStatement([]db.StatementLine{
+		{Line: 2, Reference: "d8-aaaa 2222", Amount: 10000},
+		{Line: 3, Description: "EFT D8BBBB3333 THANKS", Amount: 10000},
+		{Line: 4, Reference: "D8CCCC4444", Amount: 5000},
+		{Line: 5, Reference: "school fees", Amount: 5000},
+		{Line: 6, Description: "BANK FEES", Amount: -1250},
+		{Line: 7, Reference: "D8AAAA2222", Amount: 10000},
+		{Line: 8, Reference: "D8BBBB3333", Amount: 15000},
+	}, pledges)
+	expected := []db.ReconcileStatus{
+		db.ReconcileMatched,
+		db.ReconcileMismatch,
+		db.ReconcilePaid,
+		db.ReconcileUnmatched,
+		db.ReconcileSkipped,
+		db.ReconcilePaid, //paid by line 2
+		db.ReconcileMatched,
+	}
+	for i, status := range expected {
+		if rec.Lines[i].Status != status {
+			t.Errorf("line %d: %s != %s", rec.Lines[i].Line, rec.Lines[i].Status, status)
+		}
+	}
+	if rec.Lines[1].Due != 15000 || rec.Lines[1].Pledge.PromiseID != "p2" {
+		t.Errorf("mismatch: %+v", rec.Lines[1])
+	}
+	if rec.Matched != 2 || rec.Mismatched != 1 || rec.Paid != 2 || rec.Unmatched != 1 {
+		t.Errorf("counts: %+v", rec)
+	}
+	if pledges[0].Paid != 0 {
+		t.Errorf("pledges changed: %+v", pledges[0])
+	}
+}
+
+func TestSumMoney(t *testing.T) {
+	groups := []db.GroupTreeEntry{
+		{ID: "school", Title: "School"},
+		{ID: "fete", ParentGroupID: "school", Title: "Fete", Depth: 1},
+		{ID: "stall", ParentGroupID: "fete", Title: "Stall", Depth: 2},
+	}
+	report := db.SumMoney(groups, []db.MoneyAmount{
+		{GroupID: "fete", Currency: "ZAR", Requested: 100000, Pledged: 30000},
+		{GroupID: "stall", Currency: "ZAR", Requested: 5000},
+		{GroupID: "fete", Currency: "ZAR", Method: db.PaymentMethodCash, Paid: 2000},
+		{GroupID: "fete", Currency: "ZAR", Method: db.PaymentMethodEFT, Paid: 10000},
+		{GroupID: "stall", Currency: "ZAR", Method: db.PaymentMethodCash, Paid: 500},
+		{GroupID: "stall", Currency: "USD", Method: db.PaymentMethodCard, Paid: 100},
+	})
+	if len(report.Groups) != 3 || len(report.Groups[0].Totals) != 0 || len(report.Groups[2].Totals) != 2 {
+		t.Fatalf("groups: %+v", report.Groups)
+	}
+	if len(report.Totals) != 2 || report.Totals[0].Currency != "USD" {
+		t.Fatalf("totals: %+v", report.Totals)
+	}
+	zar := report.Totals[1]
+	if zar.Requested != 105000 || zar.Pledged != 30000 || zar.Paid != 12500 || zar.ByMethod[db.PaymentMethodCash] != 2500 || zar.ByMethod[db.PaymentMethodEFT] != 10000 {
+		t.Fatalf("ZAR: %+v", zar)
+	}
+	if fete := report.Groups[1].Totals[0]; fete.Paid != 12000 {
+		t.Fatalf("fete: %+v", fete)
+	}
+}
+
+func TestMoneyRequest(t *testing.T) {
+	requireDB(t)
+	u, err := db.AddUser(db.User{Name: "Money", Phone: "0821111117", Email: "money@b.c"})
+	if err != nil {
+		t.Fatalf("failed to create user: %+v", err)
+	}
+	defer db.DelUser(u.ID)
+	g, err := db.AddGroup(u, db.NewGroup{Title: "Money test", UserRole: "Organiser"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelGroup(g.ID)
+	r, err := db.AddRequest(db.Request{GroupID: g.ID, Title: "Building fund", Type: db.RequestTypeMoney, Qty: 50000})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelRequest(r.ID)
+	defer db.Db().Exec("DELETE FROM `promises` WHERE `request_id`=?", r.ID)
+	defer db.Db().Exec("DELETE FROM `payments` WHERE `request_id`=?", r.ID)
+
+	pledge, err := db.AddPromise(db.Promise{RequestID: r.ID, UserID: u.ID, Qty: 30000, Date: db.SqlTime(time.Now())})
+	if err != nil || pledge.Reference == nil {
+		t.Fatalf("pledge: %+v %+v", pledge, err)
+	}
+	if _, err := db.AddPayment(db.Payment{RequestID: r.ID, Amount: 20000, Method: db.PaymentMethodCash, RecordedBy: u.ID}); err != nil {
+		t.Fatalf("cash: %+v", err)
+	}
+	if _, err := db.AddPayment(db.Payment{RequestID: r.ID, Amount: 100, Method: db.PaymentMethodEFT, RecordedBy: u.ID}); err == nil {
+		t.Fatalf("eft without reference accepted")
+	}
+
+	statement := []db.StatementLine{{Line: 2, Date: "2030-03-01", Reference: *pledge.Reference, Amount: 30000}}
+	rec, err := db.ReconcileStatement(g.ID, "ZAR", statement, true, u.ID)
+	if err != nil || rec.Matched != 1 || rec.Recorded != 1 {
+		t.Fatalf("reconcile: %+v %+v", rec, err)
+	}
+	if rec, _ := db.ReconcileStatement(g.ID, "ZAR", statement, true, u.ID); rec.Paid != 1 || rec.Recorded != 0 {
+		t.Fatalf("reconciled twice: %+v", rec)
+	}
+	if p, _ := db.GetPromise(pledge.ID); p.Status != db.PromiseStatusDelivered {
+		t.Fatalf("pledge status: %s", p.Status)
+	}
+	if r, _ := db.GetRequest(r.ID); r.Status != db.RequestStatusFulfilled {
+		t.Fatalf("request status: %s", r.Status)
+	}
+
+	report, err := db.GetGroupMoney(g.ID)
+	if err != nil || len(report.Totals) != 1 || report.Totals[0].Paid != 50000 || report.Totals[0].ByMethod[db.PaymentMethodEFT] != 30000 {
+		t.Fatalf("report: %+v %+v", report, err)
+	}
+	tree, err := db.GetGroupTree(g.ID, 1)
+	if err != nil || len(tree.Totals.Quantities) != 1 || tree.Totals.Quantities[0].Unit != "ZAR" || tree.Totals.Quantities[0].Received != 50000 {
+		t.Fatalf("tree: %+v %+v", tree, err)
+	}
+}
+
+//TestReconcileConcurrently records the same statement at the same time, which must pay the pledge once
+func TestReconcileConcurrently(t *testing.T) {
+	requireDB(t)
+	u, err := db.AddUser(db.User{Name: "Reconcile", Phone: "0821111118", Email: "reconcile@b.c"})
+	if err != nil {
+		t.Fatalf("failed to create user: %+v", err)
+	}
+	defer db.DelUser(u.ID)
+	g, err := db.AddGroup(u, db.NewGroup{Title: "Reconcile test", UserRole: "Organiser"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelGroup(g.ID)
+	r, err := db.AddRequest(db.Request{GroupID: g.ID, Title: "Bus fund", Type: db.RequestTypeMoney, Qty: 50000})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelRequest(r.ID)
+	defer db.Db().Exec("DELETE FROM `promises` WHERE `request_id`=?", r.ID)
+	defer db.Db().Exec("DELETE FROM `payments` WHERE `request_id`=?", r.ID)
+	pledge, err := db.AddPromise(db.Promise{RequestID: r.ID, UserID: u.ID, Qty: 30000, Date: db.SqlTime(time.Now())})
+	if err != nil {
+		t.Fatalf("pledge: %+v", err)
+	}
+
+	statement := []db.StatementLine{{Line: 2, Date: "2030-03-01", Reference: *pledge.Reference, Amount: 30000}}
+	recorded := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			rec, err := db.ReconcileStatement(g.ID, "ZAR", statement, true, u.ID)
+			if err != nil {
+				t.Errorf("reconcile: %+v", err)
+			}
+			recorded <- rec.Recorded
+		}()
+	}
+	total := 0
+	for i := 0; i < 3; i++ {
+		total += <-recorded
+	}
+	var nrPayments int
+	if err := db.Db().Get(&nrPayments, "SELECT COUNT(*) FROM `payments` WHERE `promise_id`=?", pledge.ID); err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if total != 1 || nrPayments != 1 {
+		t.Fatalf("recorded %d with %d payments, expected 1", total, nrPayments)
+	}
+} //TestReconcileConcurrently()
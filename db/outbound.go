@@ -0,0 +1,190 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/google/uuid"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/emails"
+)
+
+type OutboundMessage struct {
+	ID          ID             `json:"id" db:"id"`
+	TimeCreated SqlTime        `json:"time_created" db:"time_created"`
+	TimeUpdated SqlTime        `json:"time_updated" db:"time_updated"`
+	Ref         *string        `json:"ref,omitempty" db:"ref" doc:"What the message is about, e.g. \"invitation:<id>\""`
+	FromAddr    string         `json:"from" db:"from_addr"`
+	ToAddrs     string         `json:"to" db:"to_addrs" doc:"Comma separated list of recipient addresses"`
+	Subject     string         `json:"subject" db:"subject"`
+	Status      OutboundStatus `json:"status" db:"status"`
+	Error       *string        `json:"error,omitempty" db:"error"`
+	MessageID   *string        `json:"message_id,omitempty" db:"message_id"`
+}
+
+type OutboundStatus string
+
+const (
+	OutboundStatusQueued  OutboundStatus = "queued"
+	OutboundStatusSent    OutboundStatus = "sent"
+	OutboundStatusFailed  OutboundStatus = "failed"
+	OutboundStatusBounced OutboundStatus = "bounced"
+)
+
+//DeliveryLog implements emails.Recorder to keep record of all emails in the outbound_messages table
+type DeliveryLog struct{}
+
+func (DeliveryLog) Queued(e emails.Email) (string, error) {
+	to := make([]string, len(e.To))
+	for i, a := range e.To {
+		to[i] = a.Addr
+	}
+	id := ID(uuid.New().String())
+	now := SqlTime(time.Now())
+	if _, err := db.Exec("INSERT INTO `outbound_messages` SET `id`=?,`time_created`=?,`time_updated`=?,`ref`=?,`from_addr`=?,`to_addrs`=?,`subject`=?,`status`=?",
+		id,
+		now,
+		now,
+		nullString(e.Ref),
+		e.From.Addr,
+		strings.Join(to, ","),
+		e.Subject,
+		OutboundStatusQueued,
+	); err != nil {
+		return "", errors.Wrapf(err, "failed to insert outbound message")
+	}
+	return string(id), nil
+}
+
+func (DeliveryLog) Sent(id string, messageID string) error {
+	if _, err := db.Exec("UPDATE `outbound_messages` SET `status`=?,`message_id`=?,`time_updated`=? WHERE `id`=?",
+		OutboundStatusSent,
+		messageID,
+		SqlTime(time.Now()),
+		id,
+	); err != nil {
+		return errors.Wrapf(err, "failed to update outbound message(id=%s)", id)
+	}
+	return nil
+}
+
+//Failed records the error and when the failure is permanent, mark the recipient undeliverable
+func (DeliveryLog) Failed(id string, sendErr error) error {
+	if _, err := db.Exec("UPDATE `outbound_messages` SET `status`=?,`error`=?,`time_updated`=? WHERE `id`=?",
+		OutboundStatusFailed,
+		truncate(sendErr.Error(), 255),
+		SqlTime(time.Now()),
+		id,
+	); err != nil {
+		return errors.Wrapf(err, "failed to update outbound message(id=%s)", id)
+	}
+	if pe, ok := emails.IsPermanent(sendErr); ok {
+		return MarkUndeliverable(pe.Addr)
+	}
+	return nil
+}
+
+//Undeliverable is checked before sending, so we stop sending to bounced addresses
+func (DeliveryLog) Undeliverable(addr string) (bool, error) {
+	return IsUndeliverable(addr)
+}
+
+//BounceOutboundMessage is called when a bounce is received for a message that was sent
+func BounceOutboundMessage(messageID string, addr string, reason string) (OutboundMessage, error) {
+	var m OutboundMessage
+	if err := db.Get(&m, "SELECT `id`,`time_created`,`time_updated`,`ref`,`from_addr`,`to_addrs`,`subject`,`status`,`error`,`message_id` FROM `outbound_messages` WHERE `message_id`=?", messageID); err != nil {
+		if err == sql.ErrNoRows {
+			return OutboundMessage{}, apierr.Errorf(apierr.NotFound, "unknown message_id(%s)", messageID)
+		}
+		return OutboundMessage{}, errors.Wrapf(err, "failed to get outbound message(message_id=%s)", messageID)
+	}
+	if _, err := db.Exec("UPDATE `outbound_messages` SET `status`=?,`error`=?,`time_updated`=? WHERE `id`=?",
+		OutboundStatusBounced,
+		truncate(reason, 255),
+		SqlTime(time.Now()),
+		m.ID,
+	); err != nil {
+		return OutboundMessage{}, errors.Wrapf(err, "failed to update outbound message(id=%s)", m.ID)
+	}
+	addrs := strings.Split(m.ToAddrs, ",")
+	if addr != "" {
+		addrs = []string{addr}
+	}
+	for _, a := range addrs {
+		if err := MarkUndeliverable(a); err != nil {
+			return OutboundMessage{}, err
+		}
+	}
+	m.Status = OutboundStatusBounced
+	m.Error = &reason
+	return m, nil
+} //BounceOutboundMessage()
+
+//ListOutboundMessages filtered on optional ref and/or recipient address
+func ListOutboundMessages(ref string, addr string, limit int) ([]OutboundMessage, error) {
+	sql := "SELECT `id`,`time_created`,`time_updated`,`ref`,`from_addr`,`to_addrs`,`subject`,`status`,`error`,`message_id` FROM `outbound_messages` WHERE 1=1"
+	args := []interface{}{}
+	if ref != "" {
+		sql += " AND `ref`=?"
+		args = append(args, ref)
+	}
+	if addr != "" {
+		sql += " AND FIND_IN_SET(?,`to_addrs`)>0"
+		args = append(args, addr)
+	}
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	sql += " ORDER BY `time_created` DESC LIMIT ?"
+	args = append(args, limit)
+	var list []OutboundMessage
+	if err := db.Select(&list, sql, args...); err != nil {
+		return nil, errors.Wrapf(err, "failed to list outbound messages")
+	}
+	return list, nil
+} //ListOutboundMessages()
+
+//MarkUndeliverable marks users and invitations with this email address so we stop sending to it
+func MarkUndeliverable(addr string) error {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	if addr == "" {
+		return nil
+	}
+	log.Infof("Marking email(%s) undeliverable", addr)
+	if _, err := db.Exec("UPDATE `users` SET `email_status`=? WHERE `email`=?", EmailStatusUndeliverable, addr); err != nil {
+		return errors.Wrapf(err, "failed to mark user email(%s) undeliverable", addr)
+	}
+	if _, err := db.Exec("UPDATE `invitations` SET `status`=?,`time_updated`=? WHERE `email`=?", InvitationStatusUndeliverable, SqlTime(time.Now()), addr); err != nil {
+		return errors.Wrapf(err, "failed to mark invitation email(%s) undeliverable", addr)
+	}
+	return nil
+} //MarkUndeliverable()
+
+//IsUndeliverable is true when a previous send to the address failed permanently
+func IsUndeliverable(addr string) (bool, error) {
+	addr = strings.ToLower(strings.TrimSpace(addr))
+	var n int
+	if err := db.Get(&n, "SELECT (SELECT COUNT(*) FROM `users` WHERE `email`=? AND `email_status`=?)+(SELECT COUNT(*) FROM `invitations` WHERE `email`=? AND `status`=?)",
+		addr,
+		EmailStatusUndeliverable,
+		addr,
+		InvitationStatusUndeliverable,
+	); err != nil {
+		return false, errors.Wrapf(err, "failed to check email(%s)", addr)
+	}
+	return n > 0, nil
+}
+
+const EmailStatusUndeliverable = "undeliverable"
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
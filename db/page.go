@@ -0,0 +1,119 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-msvc/errors"
+)
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+//PageRequest selects one page of a list
+type PageRequest struct {
+	Cursor string `json:"cursor,omitempty" doc:"next_cursor from the previous page, or empty for the first page"`
+	Size   int    `json:"size,omitempty" doc:"Nr of items per page 1..100 (default 20)"`
+	Sort   string `json:"sort,omitempty" doc:"Field to sort on, prefixed with \"-\" for descending order"`
+	offset int    //from Validate()
+}
+
+//Page is returned with each list
+type Page struct {
+	NextCursor string `json:"next_cursor,omitempty" doc:"Pass as cursor to get the next page, empty on the last page"`
+	Total      int    `json:"total" doc:"Total nr of items in the list"`
+}
+
+//SortFields is the list of fields that a list can be sorted on
+type SortFields struct {
+	Default string            //default sort when not specified, e.g. "title" or "-date"
+	Columns map[string]string //sort field name -> SQL column
+	ID      string            //SQL column used to break ties so pages are stable
+}
+
+//Names of the sort fields, e.g. for documentation
+func (s SortFields) Names() []string {
+	names := []string{}
+	for n := range s.Columns {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//cursor is encoded as opaque string in the API
+//so that we can change to keyset pagination later without changing the API
+type cursor struct {
+	Sort   string `json:"s"`
+	Offset int    `json:"o"`
+}
+
+func (c cursor) String() string {
+	jsonCursor, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(jsonCursor)
+}
+
+//Validate the page request against the sort fields of a list
+func (p *PageRequest) Validate(sortFields SortFields) error {
+	if p.Size == 0 {
+		p.Size = DefaultPageSize
+	}
+	if p.Size < 1 || p.Size > MaxPageSize {
+		return errors.Errorf("invalid page size %d, expecting 1..%d", p.Size, MaxPageSize)
+	}
+	if p.Sort == "" {
+		p.Sort = sortFields.Default
+	}
+	if _, ok := sortFields.Columns[strings.TrimPrefix(p.Sort, "-")]; !ok {
+		return errors.Errorf("cannot sort on \"%s\", expecting one of %s (prefix with - for descending)", p.Sort, strings.Join(sortFields.Names(), "|"))
+	}
+	p.offset = 0
+	if p.Cursor != "" {
+		var c cursor
+		jsonCursor, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+		if err != nil {
+			return errors.Errorf("invalid cursor")
+		}
+		if err := json.Unmarshal(jsonCursor, &c); err != nil || c.Offset < 0 {
+			return errors.Errorf("invalid cursor")
+		}
+		if c.Sort != p.Sort {
+			return errors.Errorf("cursor is for sort=%s, cannot continue with sort=%s", c.Sort, p.Sort)
+		}
+		p.offset = c.Offset
+	}
+	return nil
+} //PageRequest.Validate()
+
+//selectPage selects one page into list (pointer to slice) with the total count
+//from is the SQL "FROM ... WHERE ..." clause shared by the count and the select.
+func selectPage(list interface{}, columns string, from string, args []interface{}, page PageRequest, sortFields SortFields) (Page, error) {
+	if err := page.Validate(sortFields); err != nil {
+		return Page{}, errors.Wrapf(err, "invalid page request")
+	}
+	var p Page
+	if err := db.Get(&p.Total, "SELECT COUNT(*) "+from, args...); err != nil {
+		return Page{}, errors.Wrapf(err, "failed to count")
+	}
+
+	order := " ASC"
+	if strings.HasPrefix(page.Sort, "-") {
+		order = " DESC"
+	}
+	sql := "SELECT " + columns + " " + from +
+		" ORDER BY " + sortFields.Columns[strings.TrimPrefix(page.Sort, "-")] + order + "," + sortFields.ID + order +
+		" LIMIT ? OFFSET ?"
+	if err := db.Select(list, sql, append(args, page.Size, page.offset)...); err != nil {
+		return Page{}, errors.Wrapf(err, "failed to select")
+	}
+
+	if next := page.offset + reflect.ValueOf(list).Elem().Len(); next < p.Total {
+		p.NextCursor = cursor{Sort: page.Sort, Offset: next}.String()
+	}
+	return p, nil
+} //selectPage()
@@ -0,0 +1,85 @@
+package db_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jansemmelink/don8/db"
+)
+
+func TestPageRequest(t *testing.T) {
+	page := db.PageRequest{}
+	if err := page.Validate(db.RequestSort); err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if page.Size != db.DefaultPageSize || page.Sort != db.RequestSort.Default {
+		t.Fatalf("wrong defaults: %+v", page)
+	}
+	for _, invalid := range []db.PageRequest{
+		{Size: -1},
+		{Size: db.MaxPageSize + 1},
+		{Sort: "pwd_hash"},
+		{Cursor: "not-a-cursor"},
+	} {
+		if err := invalid.Validate(db.RequestSort); err == nil {
+			t.Fatalf("accepted invalid %+v", invalid)
+		}
+	}
+}
+
+//TestSelectPage walks the pages with the cursor, sorted on a column with equal values
+//so that the id must decide the order of those with the same qty
+func TestSelectPage(t *testing.T) {
+	requireDB(t)
+	u, err := db.AddUser(db.User{Name: "Pager", Phone: "0821111114", Email: "pager@b.c"})
+	if err != nil {
+		t.Fatalf("failed to create user: %+v", err)
+	}
+	defer db.DelUser(u.ID)
+	g, err := db.AddGroup(u, db.NewGroup{Title: "Page test", UserRole: "Organiser"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelGroup(g.ID)
+	for i, qty := range []int{2, 1, 2, 3, 2} {
+		r, err := db.AddRequest(db.Request{GroupID: g.ID, Title: fmt.Sprintf("Request %d", i), Qty: qty})
+		if err != nil {
+			t.Fatalf("failed: %+v", err)
+		}
+		defer db.DelRequest(r.ID)
+	}
+
+	for _, sort := range []string{"qty", "-qty"} {
+		list := []db.Request{}
+		page := db.PageRequest{Size: 2, Sort: sort}
+		for nrPages := 1; ; nrPages++ {
+			requests, err := db.FindRequests(g.ID, db.RequestFilter{}, page)
+			if err != nil {
+				t.Fatalf("%s: page %d failed: %+v", sort, nrPages, err)
+			}
+			if requests.Total != 5 || len(requests.Requests) > 2 {
+				t.Fatalf("%s: page %d has %d of total %d", sort, nrPages, len(requests.Requests), requests.Total)
+			}
+			list = append(list, requests.Requests...)
+			if requests.NextCursor == "" {
+				if nrPages != 3 {
+					t.Fatalf("%s: %d pages != 3", sort, nrPages)
+				}
+				break
+			}
+			page.Cursor = requests.NextCursor
+		}
+		if len(list) != 5 {
+			t.Fatalf("%s: %d requests != 5", sort, len(list))
+		}
+		for i := 1; i < len(list); i++ {
+			a, b := list[i-1], list[i]
+			if sort == "-qty" {
+				a, b = b, a
+			}
+			if a.Qty > b.Qty || (a.Qty == b.Qty && a.ID >= b.ID) {
+				t.Fatalf("%s: wrong order at %d: %+v", sort, i, list)
+			}
+		}
+	}
+} //TestSelectPage()
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/google/uuid"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/events"
+	"github.com/jansemmelink/don8/model"
+	"github.com/jmoiron/sqlx"
+)
+
+//PaymentMethod is how money was paid
+type PaymentMethod string
+
+const (
+	PaymentMethodCash PaymentMethod = "cash"
+	PaymentMethodEFT  PaymentMethod = "eft"
+	PaymentMethodCard PaymentMethod = "card"
+)
+
+//Payment is money received for a money request, optionally paying a pledge
+type Payment struct {
+	ID          ID             `json:"id" db:"id"`
+	RequestID   ID             `json:"request_id" db:"request_id"`
+	PromiseID   *ID            `json:"promise_id,omitempty" db:"promise_id" doc:"The pledge that is paid, absent for payments without a pledge"`
+	UserID      *ID            `json:"user_id,omitempty" db:"user_id" doc:"The donor, from the pledge when paying a pledge"`
+	Amount      int            `json:"amount" db:"amount" doc:"Amount in minor units of the currency, e.g. cents"`
+	Currency    model.Currency `json:"currency" db:"currency" doc:"Currency of the request"`
+	Method      PaymentMethod  `json:"method" db:"method" doc:"cash|eft|card"`
+	Reference   *string        `json:"reference,omitempty" db:"reference" doc:"EFT reference or card slip reference, required for eft"`
+	Date        SqlTime        `json:"date" db:"date" doc:"Date when paid"`
+	RecordedBy  ID             `json:"recorded_by" db:"recorded_by" doc:"User who recorded the payment"`
+	TimeCreated SqlTime        `json:"time_created" db:"time_created"`
+}
+
+//maxPaymentReference is the size of the reference column
+const maxPaymentReference = 100
+
+//paymentColumns are selected into Payment
+const paymentColumns = "`id`,`request_id`,`promise_id`,`user_id`,`amount`,`currency`,`method`,`reference`,`date`,`recorded_by`,`time_created`"
+
+func (p *Payment) Validate() error {
+	if p.RequestID == "" {
+		return apierr.Invalid("request_id", "missing request_id")
+	}
+	if p.Amount < 1 {
+		return apierr.Invalid("amount", "amount must be positive")
+	}
+	if p.Reference != nil {
+		*p.Reference = strings.TrimSpace(*p.Reference)
+		if *p.Reference == "" {
+			p.Reference = nil
+		} else if len(*p.Reference) > maxPaymentReference {
+			return apierr.Invalid("reference", "reference longer than %d characters", maxPaymentReference)
+		}
+	}
+	switch p.Method {
+	case PaymentMethodCash, PaymentMethodCard:
+	case PaymentMethodEFT:
+		if p.Reference == nil {
+			return apierr.Invalid("reference", "missing reference for eft payment")
+		}
+	default:
+		return apierr.Invalid("method", "unknown method \"%s\", expecting cash|eft|card", p.Method)
+	}
+	if time.Time(p.Date).IsZero() {
+		p.Date = SqlTime(time.Now())
+	}
+	return nil
+}
+
+//AddPayment records money received for a money request,
+//and marks the pledge delivered when it is paid in full
+func AddPayment(p Payment) (Payment, error) {
+	if err := p.Validate(); err != nil {
+		return Payment{}, apierr.Validation(err)
+	}
+	r, err := GetRequest(p.RequestID)
+	if err != nil {
+		return Payment{}, apierr.Wrapf(err, apierr.NotFound, "unknown request")
+	}
+	if r.Type != RequestTypeMoney {
+		return Payment{}, apierr.Invalid("request_id", "payments are only for money requests")
+	}
+	if p.Currency == "" {
+		p.Currency = r.Currency
+	}
+	if p.Currency != r.Currency {
+		return Payment{}, apierr.Invalid("currency", "payment currency %s differs from request currency %s", p.Currency, r.Currency)
+	}
+
+	var before *RequestProgress
+	if progress, err := GetRequestProgress(r); err != nil {
+		log.Errorf("cannot get request(id=%s) progress: %+v", r.ID, err)
+	} else {
+		before = &progress
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return Payment{}, errors.Wrapf(err, "failed to start transaction")
+	}
+	defer tx.Rollback()
+	var pledge *Promise
+	if p.PromiseID != nil {
+		pr, err := lockPledge(tx, *p.PromiseID)
+		if err != nil || pr.RequestID != r.ID {
+			return Payment{}, apierr.Invalid("promise_id", "unknown pledge for this request")
+		}
+		if pr.Status == PromiseStatusWithdrawn {
+			return Payment{}, apierr.Errorf(apierr.Conflict, "pledge was withdrawn")
+		}
+		pledge = &pr
+		p.UserID = &pr.UserID
+	}
+	if p, err = insertPayment(tx, p, pledge); err != nil {
+		return Payment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Payment{}, errors.Wrapf(err, "failed to add payment")
+	}
+
+	after := publishRequestEvent(events.PaymentReceived, r.ID, p)
+	publishRequestMet(r, before, after)
+	if err := syncRequestStatus(r.ID); err != nil {
+		log.Errorf("failed to update request(id=%s) status: %+v", r.ID, err)
+	}
+	return p, nil
+} //AddPayment()
+
+//lockPledge reads the pledge and locks it until the transaction ends,
+//so that payments of the same pledge are recorded one at a time
+func lockPledge(tx *sqlx.Tx, id ID) (Promise, error) {
+	var p Promise
+	if err := tx.Get(&p, "SELECT "+promiseColumns+" FROM `promises` WHERE `id`=? FOR UPDATE", id); err != nil {
+		return Promise{}, errors.Wrapf(err, "failed to lock pledge(id=%s)", id)
+	}
+	return p, nil
+}
+
+//insertPayment adds the payment in the transaction,
+//and marks the pledge (if not nil) delivered when it is paid in full
+func insertPayment(tx *sqlx.Tx, p Payment, pledge *Promise) (Payment, error) {
+	p.ID = ID(uuid.New().String())
+	p.TimeCreated = SqlTime(time.Now())
+	if _, err := tx.Exec("INSERT INTO `payments` SET `id`=?,`request_id`=?,`promise_id`=?,`user_id`=?,`amount`=?,`currency`=?,"+
+		"`method`=?,`reference`=?,`date`=?,`recorded_by`=?,`time_created`=?",
+		p.ID,
+		p.RequestID,
+		p.PromiseID,
+		p.UserID,
+		p.Amount,
+		p.Currency,
+		p.Method,
+		p.Reference,
+		p.Date,
+		p.RecordedBy,
+		p.TimeCreated,
+	); err != nil {
+		return Payment{}, errors.Wrapf(err, "failed to add payment")
+	}
+	if pledge == nil || pledge.Status == PromiseStatusDelivered {
+		return p, nil
+	}
+	var paid int
+	if err := tx.Get(&paid, "SELECT COALESCE(SUM(`amount`),0) FROM `payments` WHERE `promise_id`=?", pledge.ID); err != nil {
+		return Payment{}, errors.Wrapf(err, "failed to get pledge(id=%s) paid total", pledge.ID)
+	}
+	if paid >= pledge.Qty {
+		if _, err := tx.Exec("UPDATE `promises` SET `status`=? WHERE `id`=?", PromiseStatusDelivered, pledge.ID); err != nil {
+			return Payment{}, errors.Wrapf(err, "failed to mark pledge(id=%s) paid", pledge.ID)
+		}
+	}
+	return p, nil
+} //insertPayment()
+
+//PaymentListEntry is a payment in ListPayments()
+type PaymentListEntry struct {
+	Payment
+	RequestTitle string  `json:"request_title" db:"request_title"`
+	UserName     *string `json:"user_name,omitempty" db:"user_name"`
+}
+
+//PaymentList is one page of ListPayments()
+type PaymentList struct {
+	Payments []PaymentListEntry `json:"payments"`
+	Page
+}
+
+var PaymentSort = SortFields{
+	Default: "-date",
+	Columns: map[string]string{
+		"date":    "pm.`date`",
+		"amount":  "pm.`amount`",
+		"method":  "pm.`method`",
+		"request": "r.`title`",
+	},
+	ID: "pm.`id`",
+}
+
+//ListPayments lists payments for requests in the group, optionally only for one request or method
+func ListPayments(groupID ID, requestID ID, method PaymentMethod, page PageRequest) (PaymentList, error) {
+	from := "FROM `payments` AS pm JOIN `requests` AS r ON r.`id`=pm.`request_id` LEFT JOIN `users` AS u ON u.`id`=pm.`user_id`" +
+		" WHERE r.`group_id`=?"
+	args := []interface{}{groupID}
+	if requestID != "" {
+		from += " AND pm.`request_id`=?"
+		args = append(args, requestID)
+	}
+	if method != "" {
+		from += " AND pm.`method`=?"
+		args = append(args, method)
+	}
+	columns := "pm." + strings.ReplaceAll(paymentColumns, ",", ",pm.") + ",r.`title` AS `request_title`,u.`name` AS `user_name`"
+	list := PaymentList{Payments: []PaymentListEntry{}}
+	var err error
+	if list.Page, err = selectPage(&list.Payments, columns, from, args, page, PaymentSort); err != nil {
+		return PaymentList{}, errors.Wrapf(err, "failed to list payments")
+	}
+	return list, nil
+}
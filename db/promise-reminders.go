@@ -0,0 +1,253 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/model"
+)
+
+//MaxReminderDaysBefore limits how far before the due date a reminder may be sent
+const MaxReminderDaysBefore = 30
+
+//MaxOverdueDays limits how many days after the due date an overdue promise is listed in the daily digest
+const MaxOverdueDays = 7
+
+//DefaultReminderDaysBefore applies to groups that did not configure reminders
+var DefaultReminderDaysBefore = []int{3, 0}
+
+type GroupReminders struct {
+	GroupID       ID    `json:"group_id" db:"group_id"`
+	DaysBefore    []int `json:"days_before" db:"-" doc:"Send promise reminders this many days before the due date, 0 for on the due date"`
+	OverdueDigest bool  `json:"overdue_digest" db:"overdue_digest" doc:"Send daily digest of overdue promises to group coordinators"`
+}
+
+func (gr *GroupReminders) Validate() error {
+	if gr.GroupID == "" {
+		return apierr.Invalid("group_id", "missing group_id")
+	}
+	days := map[int]bool{}
+	for _, d := range gr.DaysBefore {
+		if d < 0 || d > MaxReminderDaysBefore {
+			return apierr.Invalid("days_before", "invalid days_before:%d (expecting 0..%d)", d, MaxReminderDaysBefore)
+		}
+		days[d] = true
+	}
+	//sort and remove duplicates
+	gr.DaysBefore = []int{}
+	for d := range days {
+		gr.DaysBefore = append(gr.DaysBefore, d)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(gr.DaysBefore)))
+	return nil
+}
+
+//GetGroupReminders returns the defaults when the group did not configure reminders
+func GetGroupReminders(groupID ID) (GroupReminders, error) {
+	var row struct {
+		GroupID       ID     `db:"group_id"`
+		DaysBefore    string `db:"days_before"`
+		OverdueDigest bool   `db:"overdue_digest"`
+	}
+	if err := db.Get(&row, "SELECT `group_id`,`days_before`,`overdue_digest` FROM `group_reminders` WHERE `group_id`=?", groupID); err != nil {
+		if err == sql.ErrNoRows {
+			return GroupReminders{
+				GroupID:       groupID,
+				DaysBefore:    DefaultReminderDaysBefore,
+				OverdueDigest: true,
+			}, nil
+		}
+		return GroupReminders{}, errors.Wrapf(err, "failed to get group(id=%s) reminders", groupID)
+	}
+	gr := GroupReminders{
+		GroupID:       row.GroupID,
+		DaysBefore:    []int{},
+		OverdueDigest: row.OverdueDigest,
+	}
+	for _, s := range strings.Split(row.DaysBefore, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		d, err := strconv.Atoi(s)
+		if err != nil {
+			return GroupReminders{}, errors.Errorf("group(id=%s) has invalid reminder days_before(%s)", groupID, row.DaysBefore)
+		}
+		gr.DaysBefore = append(gr.DaysBefore, d)
+	}
+	return gr, nil
+} //GetGroupReminders()
+
+func SetGroupReminders(gr GroupReminders) error {
+	if err := gr.Validate(); err != nil {
+		return err
+	}
+	days := make([]string, len(gr.DaysBefore))
+	for i, d := range gr.DaysBefore {
+		days[i] = strconv.Itoa(d)
+	}
+	if _, err := db.Exec(
+		"INSERT INTO `group_reminders` SET `group_id`=?,`days_before`=?,`overdue_digest`=?"+
+			" ON DUPLICATE KEY UPDATE `days_before`=VALUES(`days_before`),`overdue_digest`=VALUES(`overdue_digest`)",
+		gr.GroupID,
+		strings.Join(days, ","),
+		gr.OverdueDigest,
+	); err != nil {
+		return errors.Wrapf(err, "failed to set group(id=%s) reminders", gr.GroupID)
+	}
+	return nil
+} //SetGroupReminders()
+
+//PromiseReminder has all details needed to remind a user or a coordinator of a promise
+type PromiseReminder struct {
+	PromiseID    ID             `db:"promise_id"`
+	GroupID      ID             `db:"group_id"`
+	GroupTitle   string         `db:"group_title"`
+	UserName     string         `db:"user_name"`
+	UserEmail    string         `db:"user_email"`
+	UserPhone    string         `db:"user_phone"`
+	RequestTitle string         `db:"request_title"`
+	Type         RequestType    `db:"type"`
+	Currency     model.Currency `db:"currency"`
+	Units        *string        `db:"units"`
+	Qty          int            `db:"qty"`
+	Date         SqlTime        `db:"date"`
+	Status       PromiseStatus  `db:"status"`
+	Sent         string         `db:"sent"` //comma separated kinds of reminders already sent
+}
+
+//ReminderSent is true if the kind of reminder was already sent for the promise
+func (p PromiseReminder) ReminderSent(kind string) bool {
+	for _, k := range strings.Split(p.Sent, ",") {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+const promiseReminderSelect = "SELECT p.`id` AS `promise_id`,r.`group_id`,g.`title` AS `group_title`," +
+	"u.`name` AS `user_name`,u.`email` AS `user_email`,u.`phone` AS `user_phone`," +
+	"r.`title` AS `request_title`,r.`type`,r.`currency`,r.`units`,p.`qty`,p.`date`,p.`status`" +
+	" FROM `promises` AS p" +
+	" JOIN `requests` AS r ON r.`id`=p.`request_id`" +
+	" JOIN `groups` AS g ON g.`id`=r.`group_id`" +
+	" JOIN `users` AS u ON u.`id`=p.`user_id`"
+
+//ListPromisesDue lists open promises due on or after from and before to,
+//with the kinds of reminders already sent for each
+func ListPromisesDue(from, to time.Time) ([]PromiseReminder, error) {
+	var list []PromiseReminder
+	if err := db.Select(&list,
+		strings.Replace(promiseReminderSelect, " FROM `promises` AS p",
+			",COALESCE((SELECT GROUP_CONCAT(pr.`kind`) FROM `promise_reminders` AS pr WHERE pr.`promise_id`=p.`id`),'') AS `sent`"+
+				" FROM `promises` AS p", 1)+
+			" WHERE p.`status`=? AND p.`date`>=? AND p.`date`<? ORDER BY p.`date`",
+		PromiseStatusOpen,
+		SqlTime(from),
+		SqlTime(to),
+	); err != nil {
+		return nil, errors.Wrapf(err, "failed to list promises due")
+	}
+	return list, nil
+} //ListPromisesDue()
+
+//MarkPromisesOverdue changes open promises due before the specified time to overdue
+//and returns the nr of promises that were marked
+func MarkPromisesOverdue(before time.Time) (int, error) {
+	result, err := db.Exec("UPDATE `promises` SET `status`=? WHERE `status`=? AND `date`<?",
+		PromiseStatusOverdue,
+		PromiseStatusOpen,
+		SqlTime(before),
+	)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to mark promises overdue")
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+} //MarkPromisesOverdue()
+
+//ListOverduePromises lists overdue promises in all groups that were due on or after since,
+//so that promises that are never delivered do not stay in the digests forever
+func ListOverduePromises(since time.Time) ([]PromiseReminder, error) {
+	var list []PromiseReminder
+	if err := db.Select(&list,
+		promiseReminderSelect+" WHERE p.`status`=? AND p.`date`>=? ORDER BY r.`group_id`,p.`date`",
+		PromiseStatusOverdue,
+		SqlTime(since),
+	); err != nil {
+		return nil, errors.Wrapf(err, "failed to list overdue promises")
+	}
+	return list, nil
+} //ListOverduePromises()
+
+//ClaimPromiseReminder records that the reminder is being sent and return false
+//if it was already sent before, so that reminders are never duplicated
+func ClaimPromiseReminder(promiseID ID, kind string) (bool, error) {
+	result, err := db.Exec("INSERT IGNORE INTO `promise_reminders` SET `promise_id`=?,`kind`=?,`time_sent`=?",
+		promiseID,
+		kind,
+		SqlTime(time.Now()),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to claim promise(id=%s) reminder(%s)", promiseID, kind)
+	}
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+} //ClaimPromiseReminder()
+
+//ReleasePromiseReminder undo the claim when failed to send, so it is retried later
+func ReleasePromiseReminder(promiseID ID, kind string) error {
+	if _, err := db.Exec("DELETE FROM `promise_reminders` WHERE `promise_id`=? AND `kind`=?", promiseID, kind); err != nil {
+		return errors.Wrapf(err, "failed to release promise(id=%s) reminder(%s)", promiseID, kind)
+	}
+	return nil
+} //ReleasePromiseReminder()
+
+//ClaimOverdueDigest is like ClaimPromiseReminder for the daily group digest
+func ClaimOverdueDigest(groupID ID, date time.Time) (bool, error) {
+	result, err := db.Exec("INSERT IGNORE INTO `overdue_digests` SET `group_id`=?,`date`=?,`time_sent`=?",
+		groupID,
+		date.Format("2006-01-02"),
+		SqlTime(time.Now()),
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to claim group(id=%s) overdue digest", groupID)
+	}
+	n, _ := result.RowsAffected()
+	return n == 1, nil
+} //ClaimOverdueDigest()
+
+func ReleaseOverdueDigest(groupID ID, date time.Time) error {
+	if _, err := db.Exec("DELETE FROM `overdue_digests` WHERE `group_id`=? AND `date`=?", groupID, date.Format("2006-01-02")); err != nil {
+		return errors.Wrapf(err, "failed to release group(id=%s) overdue digest", groupID)
+	}
+	return nil
+} //ReleaseOverdueDigest()
+
+//ListGroupCoordinators returns the users with all permissions (|*|) in the group
+func ListGroupCoordinators(groupID ID) ([]User, error) {
+	var users []User
+	if err := db.Select(&users,
+		"SELECT u.`id`,u.`name`,u.`phone`,u.`email` FROM `members` AS m"+
+			" JOIN `member_permissions` AS p ON p.`member_id`=m.`id`"+
+			" JOIN `users` AS u ON u.`id`=m.`user_id`"+
+			" WHERE m.`group_id`=? AND p.`permissions`=?"+
+			" ORDER BY u.`name`",
+		groupID,
+		"*",
+	); err != nil {
+		return nil, errors.Wrapf(err, "failed to list group(id=%s) coordinators", groupID)
+	}
+	return users, nil
+} //ListGroupCoordinators()
+
+//ReminderKind is used to record which reminder was sent for a promise
+func ReminderKind(daysBefore int) string {
+	return fmt.Sprintf("before-%d", daysBefore)
+}
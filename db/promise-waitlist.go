@@ -0,0 +1,124 @@
+package db
+
+import (
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/events"
+	"github.com/jmoiron/sqlx"
+)
+
+//PromiseLimit is the most that may be promised in total, including the overflow
+func (r Request) PromiseLimit() int {
+	return r.Qty + r.Qty*r.OverflowPct/100
+}
+
+//ReservePromise returns the status of a new promise for qty when promised is already promised,
+//i.e. open if it fits in the limit, else waitlisted or refused as the request allows
+func (r Request) ReservePromise(qty int, promised int) (PromiseStatus, error) {
+	if promised+qty <= r.PromiseLimit() {
+		return PromiseStatusOpen, nil
+	}
+	if r.Waitlist {
+		return PromiseStatusWaitlisted, nil
+	}
+	left := r.PromiseLimit() - promised
+	if left < 0 {
+		left = 0
+	}
+	return "", apierr.Errorf(apierr.Conflict, "only %d %s can still be promised", left, r.Unit())
+}
+
+//PromoteWaitlisted returns the waitlisted promises that fit in the limit,
+//taken in the order that they were made, when promised is already promised.
+//It stops at the first promise that does not fit, so later (smaller) promises do not jump the queue.
+func (r Request) PromoteWaitlisted(promised int, waitlisted []Promise) []Promise {
+	promoted := []Promise{}
+	for _, p := range waitlisted {
+		if promised+p.Qty > r.PromiseLimit() {
+			break
+		}
+		promised += p.Qty
+		p.Status = PromiseStatusOpen
+		promoted = append(promoted, p)
+	}
+	return promoted
+}
+
+//lockRequest reads the request and locks it until the transaction ends,
+//so that promises for the same request are reserved one at a time
+func lockRequest(tx *sqlx.Tx, id ID) (Request, error) {
+	var r Request
+	if err := tx.Get(&r, "SELECT "+requestColumns+" FROM `requests` WHERE `id`=? FOR UPDATE", id); err != nil {
+		return Request{}, errors.Wrapf(err, "failed to lock request(id=%s)", id)
+	}
+	return r, nil
+}
+
+//promisedQty is the total of promises that are not withdrawn or waitlisted
+func promisedQty(tx *sqlx.Tx, requestID ID) (int, error) {
+	var qty int
+	if err := tx.Get(&qty, "SELECT COALESCE(SUM(`qty`),0) FROM `promises` WHERE `request_id`=? AND `status` NOT IN (?,?)",
+		requestID,
+		PromiseStatusWithdrawn,
+		PromiseStatusWaitlisted,
+	); err != nil {
+		return 0, errors.Wrapf(err, "failed to get request(id=%s) promised total", requestID)
+	}
+	return qty, nil
+}
+
+//promoteWaitlist opens the waitlisted promises that now fit,
+//in a transaction that locked the request
+func promoteWaitlist(tx *sqlx.Tx, r Request) ([]Promise, error) {
+	var waitlisted []Promise
+	if err := tx.Select(&waitlisted, "SELECT "+promiseColumns+" FROM `promises`"+
+		" WHERE `request_id`=? AND `status`=? ORDER BY `time_created`,`id`",
+		r.ID,
+		PromiseStatusWaitlisted,
+	); err != nil {
+		return nil, errors.Wrapf(err, "failed to get request(id=%s) waitlist", r.ID)
+	}
+	if len(waitlisted) == 0 {
+		return nil, nil
+	}
+	promised, err := promisedQty(tx, r.ID)
+	if err != nil {
+		return nil, err
+	}
+	promoted := r.PromoteWaitlisted(promised, waitlisted)
+	for _, p := range promoted {
+		if _, err := tx.Exec("UPDATE `promises` SET `status`=? WHERE `id`=?", p.Status, p.ID); err != nil {
+			return nil, errors.Wrapf(err, "failed to promote promise(id=%s)", p.ID)
+		}
+	}
+	return promoted, nil
+} //promoteWaitlist()
+
+//PromoteWaitlist opens waitlisted promises when more can be promised,
+//e.g. after the request qty was increased
+func PromoteWaitlist(requestID ID) ([]Promise, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to start transaction")
+	}
+	defer tx.Rollback()
+	r, err := lockRequest(tx, requestID)
+	if err != nil {
+		return nil, err
+	}
+	promoted, err := promoteWaitlist(tx, r)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, errors.Wrapf(err, "failed to promote request(id=%s) waitlist", requestID)
+	}
+	publishPromoted(promoted)
+	return promoted, nil
+}
+
+func publishPromoted(promoted []Promise) {
+	for _, p := range promoted {
+		publishRequestEvent(events.PromiseUpdated, p.RequestID, p)
+	}
+}
@@ -0,0 +1,84 @@
+package db_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jansemmelink/don8/db"
+)
+
+func TestPromiseReservation(t *testing.T) {
+	r := db.Request{Qty: 20, OverflowPct: 10}
+	if r.PromiseLimit() != 22 {
+		t.Fatalf("limit %d", r.PromiseLimit())
+	}
+	if status, err := r.ReservePromise(2, 20); err != nil || status != db.PromiseStatusOpen {
+		t.Fatalf("within overflow: %q %+v", status, err)
+	}
+	if _, err := r.ReservePromise(3, 20); err == nil {
+		t.Fatalf("promise above limit accepted")
+	}
+	r.Waitlist = true
+	if status, err := r.ReservePromise(3, 20); err != nil || status != db.PromiseStatusWaitlisted {
+		t.Fatalf("waitlist: %q %+v", status, err)
+	}
+
+	//first come first served, so smaller ones wait behind a large one that does not fit
+	promoted := r.PromoteWaitlisted(17, []db.Promise{{ID: "a", Qty: 2}, {ID: "b", Qty: 4}, {ID: "c", Qty: 3}})
+	if len(promoted) != 1 || promoted[0].ID != "a" || promoted[0].Status != db.PromiseStatusOpen {
+		t.Fatalf("promoted: %+v", promoted)
+	}
+}
+
+func TestConcurrentPromises(t *testing.T) {
+	requireDB(t)
+	u, err := db.AddUser(db.User{Name: "Promiser", Phone: "0821111116", Email: "promiser@b.c"})
+	if err != nil {
+		t.Fatalf("failed to create user: %+v", err)
+	}
+	defer db.DelUser(u.ID)
+	g, err := db.AddGroup(u, db.NewGroup{Title: "Promise test", UserRole: "Organiser"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelGroup(g.ID)
+	r, err := db.AddRequest(db.Request{GroupID: g.ID, Title: "Scones", Qty: 20, OverflowPct: 10, Waitlist: true})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelRequest(r.ID)
+	defer db.Db().Exec("DELETE FROM `promises` WHERE `request_id`=?", r.ID)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	open := []db.Promise{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := db.AddPromise(db.Promise{RequestID: r.ID, UserID: u.ID, Qty: 2, Date: db.SqlTime(time.Now())})
+			if err != nil {
+				t.Errorf("failed to promise: %+v", err)
+				return
+			}
+			if p.Status == db.PromiseStatusOpen {
+				mutex.Lock()
+				open = append(open, p)
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	progress, err := db.GetRequestProgress(r)
+	if err != nil || len(open) != 11 || progress.Promised != 22 || progress.Waitlisted != 78 {
+		t.Fatalf("%d open promises, progress %+v %+v", len(open), progress, err)
+	}
+
+	if _, err := db.WithdrawPromise(open[0].ID); err != nil {
+		t.Fatalf("withdraw: %+v", err)
+	}
+	if progress, _ := db.GetRequestProgress(r); progress.Promised != 22 || progress.Waitlisted != 76 {
+		t.Fatalf("waitlisted promise not opened: %+v", progress)
+	}
+}
@@ -1,95 +1,225 @@
 package db
 
 import (
-	"strings"
 	"time"
 
 	"github.com/go-msvc/errors"
 	"github.com/google/uuid"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/events"
 )
 
 type Promise struct {
-	ID         ID      `db:"id"`
-	RequestID  ID      `db:"request_id" doc:"This describes the items being donated"`
-	UserID     ID      `db:"user_id" doc:"The user promising to make the donation"`
-	LocationID *ID     `db:"location_id" doc:"Location where user intend to make the donation, or NULL if cannot commit."`
-	Qty        int     `db:"qty" doc:"Quantity that user promise to donate"`
-	Date       SqlTime `db:"date" doc:"Date by when user promise to make the donation"`
+	ID         ID            `json:"id" db:"id"`
+	RequestID  ID            `json:"request_id" db:"request_id" doc:"This describes the items being donated"`
+	UserID     ID            `json:"user_id" db:"user_id" doc:"The user promising to make the donation"`
+	LocationID *ID           `json:"location_id,omitempty" db:"location_id" doc:"Location where user intend to make the donation, or NULL if cannot commit."`
+	Qty        int           `json:"qty" db:"qty" doc:"Quantity that user promise to donate"`
+	Date       SqlTime       `json:"date" db:"date" doc:"Date by when user promise to make the donation"`
+	Status     PromiseStatus `json:"status,omitempty" db:"status" doc:"Empty while open, then overdue, delivered or withdrawn, or waitlisted when more was promised than requested"`
+	Reference  *string       `json:"reference,omitempty" db:"reference" doc:"Pledges for money requests have a reference for the donor to use when paying"`
 }
 
+//promiseColumns are selected into Promise
+const promiseColumns = "`id`,`request_id`,`user_id`,`location_id`,`qty`,`date`,`status`,`reference`"
+
+type PromiseStatus string
+
+const (
+	PromiseStatusOpen      PromiseStatus = ""
+	PromiseStatusOverdue   PromiseStatus = "overdue"
+	PromiseStatusDelivered PromiseStatus = "delivered"
+	PromiseStatusWithdrawn PromiseStatus = "withdrawn"
+	//waiting for other promises to be withdrawn, not counted as promised
+	PromiseStatusWaitlisted PromiseStatus = "waitlisted"
+)
+
+//AddPromise reserves the qty in the request, or waitlists the promise when the request allows it,
+//with the request locked so that concurrent promises cannot promise more than the limit.
+//Promises for money requests are pledges of an amount in minor units and get a reference.
 func AddPromise(p Promise) (Promise, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return Promise{}, errors.Wrapf(err, "failed to start transaction")
+	}
+	defer tx.Rollback()
+	r, err := lockRequest(tx, p.RequestID)
+	if err != nil {
+		return Promise{}, errors.Wrapf(err, "cannot promise unknown request")
+	}
+	var userPromised int
+	if err := tx.Get(&userPromised, "SELECT COALESCE(SUM(`qty`),0) FROM `promises` WHERE `request_id`=? AND `user_id`=? AND `status`<>?",
+		p.RequestID,
+		p.UserID,
+		PromiseStatusWithdrawn,
+	); err != nil {
+		return Promise{}, errors.Wrapf(err, "failed to get user(id=%s) promised total", p.UserID)
+	}
+	if err := r.CanPromise(p.Qty, userPromised); err != nil {
+		return Promise{}, err
+	}
+	promised, err := promisedQty(tx, r.ID)
+	if err != nil {
+		return Promise{}, err
+	}
+	if p.Status, err = r.ReservePromise(p.Qty, promised); err != nil {
+		return Promise{}, err
+	}
+	p.Reference = nil
+	if r.Type == RequestTypeMoney {
+		ref, err := newPledgeReference()
+		if err != nil {
+			return Promise{}, err
+		}
+		p.Reference = &ref
+	}
 	id := uuid.New().String()
-	if _, err := db.Exec(
-		"INSERT INTO `promises` SET `id`=?,`user_id`=?,`request_id`=?,`location_id`=?,`qty`=?,`date`=?",
+	if _, err := tx.Exec(
+		"INSERT INTO `promises` SET `id`=?,`user_id`=?,`request_id`=?,`location_id`=?,`qty`=?,`date`=?,`status`=?,`reference`=?",
 		id,
 		p.UserID,
 		p.RequestID,
 		p.LocationID,
 		p.Qty,
 		p.Date,
+		p.Status,
+		p.Reference,
 	); err != nil {
 		return Promise{}, errors.Wrapf(err, "failed to add promise")
 	}
+	if err := tx.Commit(); err != nil {
+		return Promise{}, errors.Wrapf(err, "failed to add promise")
+	}
 	p.ID = ID(id)
+	publishRequestEvent(events.PromiseCreated, p.RequestID, p)
 	return p, nil
 }
 
 type PromiseListEntry struct {
-	ID            ID      `db:"id"`
-	GroupID       ID      `db:"group_id"`
-	UserID        ID      `db:"user_id"`
-	UserName      string  `db:"user_name"`
-	UserPhone     string  `db:"user_phone"`
-	RequestID     ID      `db:"request_id"`
-	RequestTitle  string  `db:"request_title"`
-	RequestQty    int     `db:"request_qty"`
-	LocationID    *ID     `db:"location_id" doc:"Location where user intend to make the donation"`
-	LocationTitle *string `db:"location_title"`
-	Qty           int     `db:"promise_qty" doc:"Quantity that user promise to donate"`
-	Date          SqlTime `db:"date" doc:"Date by when user promise to make the donation"`
+	ID            ID            `json:"id" db:"id"`
+	GroupID       ID            `json:"group_id" db:"group_id"`
+	UserID        ID            `json:"user_id" db:"user_id"`
+	UserName      string        `json:"user_name" db:"user_name"`
+	UserPhone     string        `json:"user_phone" db:"user_phone"`
+	RequestID     ID            `json:"request_id" db:"request_id"`
+	RequestTitle  string        `json:"request_title" db:"request_title"`
+	RequestQty    int           `json:"request_qty" db:"request_qty"`
+	LocationID    *ID           `json:"location_id,omitempty" db:"location_id" doc:"Location where user intend to make the donation"`
+	LocationTitle *string       `json:"location_title,omitempty" db:"location_title"`
+	Qty           int           `json:"qty" db:"promise_qty" doc:"Quantity that user promise to donate"`
+	Date          SqlTime       `json:"date" db:"date" doc:"Date by when user promise to make the donation"`
+	Status        PromiseStatus `json:"status,omitempty" db:"status" doc:"Empty while open, then overdue, delivered or withdrawn, or waitlisted when more was promised than requested"`
+	Reference     *string       `json:"reference,omitempty" db:"reference" doc:"Reference to pay a pledge for a money request"`
+}
+
+//PromiseList is one page of GetPromises()
+type PromiseList struct {
+	Promises []PromiseListEntry `json:"promises"`
+	Page
+}
+
+var PromiseSort = SortFields{
+	Default: "date",
+	Columns: map[string]string{
+		"date":    "p.`date`",
+		"qty":     "p.`qty`",
+		"user":    "u.`name`",
+		"request": "r.`title`",
+		"status":  "p.`status`",
+	},
+	ID: "p.`id`",
 }
 
 //groupID is required
-func GetPromises(groupID string, userID string, requestID string, locationID string, beforeDate *time.Time, orderColumns []string) ([]PromiseListEntry, error) {
+func GetPromises(groupID string, userID string, requestID string, locationID string, beforeDate *time.Time, page PageRequest) (PromiseList, error) {
 	if groupID == "" {
-		return nil, errors.Errorf("missing group_id filter")
+		return PromiseList{}, errors.Errorf("missing group_id filter")
 	}
 
-	sql := "SELECT p.`id`,r.`group_id`,p.`user_id`,u.`name` AS `user_name`,u.`phone` AS `user_phone`,p.`request_id`,r.`title` AS `request_title`,p.`location_id`,l.`title` AS `location_title`,p.`qty` AS `promise_qty`,p.`date`,r.`qty` AS `request_qty` FROM `promises` as p JOIN `requests` as r ON p.`request_id`=r.`id` JOIN `users` AS u ON p.`user_id`=u.`id` JOIN `locations` AS l ON p.`location_id`=l.`id` WHERE r.`group_id`=?"
+	from := "FROM `promises` as p JOIN `requests` as r ON p.`request_id`=r.`id` JOIN `users` AS u ON p.`user_id`=u.`id` LEFT JOIN `locations` AS l ON p.`location_id`=l.`id` WHERE r.`group_id`=?"
 	args := []interface{}{groupID}
 
 	if userID != "" {
-		sql += " AND `user_id`=?"
+		from += " AND p.`user_id`=?"
 		args = append(args, userID)
 	}
 	if requestID != "" {
-		sql += " AND `request_id`=?"
+		from += " AND p.`request_id`=?"
 		args = append(args, requestID)
 	}
 	if locationID != "" {
-		sql += " AND `location_id`=?"
+		from += " AND p.`location_id`=?"
 		args = append(args, locationID)
 	}
 	if beforeDate != nil {
-		sql += " AND `date`<?"
-		args = append(args, *beforeDate)
+		from += " AND p.`date`<?"
+		args = append(args, SqlTime(*beforeDate))
 	}
 
-	if len(orderColumns) > 0 {
-		sql += " ORDER BY " + strings.Join(orderColumns, ",")
+	list := PromiseList{Promises: []PromiseListEntry{}}
+	var err error
+	if list.Page, err = selectPage(&list.Promises,
+		"p.`id`,r.`group_id`,p.`user_id`,u.`name` AS `user_name`,u.`phone` AS `user_phone`,p.`request_id`,r.`title` AS `request_title`,p.`location_id`,l.`title` AS `location_title`,p.`qty` AS `promise_qty`,p.`date`,p.`status`,p.`reference`,r.`qty` AS `request_qty`",
+		from, args, page, PromiseSort); err != nil {
+		return PromiseList{}, errors.Wrapf(err, "failed to list promises")
 	}
-
-	var promises []PromiseListEntry
-	if err := db.Select(&promises, sql, args...); err != nil {
-		return nil, errors.Wrapf(err, "failed to list promises")
-	}
-	return promises, nil
+	return list, nil
 }
 
 func GetPromise(id ID) (Promise, error) {
 	var p Promise
-	if err := db.Get(&p, "SELECT `id`,`request_id`,`user_id`,`location_id`,`qty`,`date` FROM `promises` WHERE `id`=?", id); err != nil {
+	if err := db.Get(&p, "SELECT "+promiseColumns+" FROM `promises` WHERE `id`=?", id); err != nil {
 		return Promise{}, errors.Wrapf(err, "failed to get promise(id=%s)", id)
 	}
 	return p, nil
 }
+
+func SetPromiseStatus(id ID, status PromiseStatus) error {
+	if _, err := db.Exec("UPDATE `promises` SET `status`=? WHERE `id`=?", status, id); err != nil {
+		return errors.Wrapf(err, "failed to set promise(id=%s).status=%s", id, status)
+	}
+	return nil
+}
+
+//WithdrawPromise is used when the user can no longer make the donation,
+//then waitlisted promises that now fit are opened
+func WithdrawPromise(id ID) (Promise, error) {
+	p, err := GetPromise(id)
+	if err != nil {
+		return Promise{}, err
+	}
+	switch p.Status {
+	case PromiseStatusDelivered:
+		return Promise{}, apierr.Errorf(apierr.Conflict, "cannot withdraw a delivered promise")
+	case PromiseStatusWithdrawn:
+		return p, nil
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return Promise{}, errors.Wrapf(err, "failed to start transaction")
+	}
+	defer tx.Rollback()
+	r, err := lockRequest(tx, p.RequestID)
+	if err != nil {
+		return Promise{}, err
+	}
+	//the status may have changed before the request was locked
+	result, err := tx.Exec("UPDATE `promises` SET `status`=? WHERE `id`=? AND `status`=?", PromiseStatusWithdrawn, id, p.Status)
+	if err != nil {
+		return Promise{}, errors.Wrapf(err, "failed to withdraw promise(id=%s)", id)
+	}
+	if n, _ := result.RowsAffected(); n != 1 {
+		return Promise{}, apierr.Errorf(apierr.Conflict, "promise changed, try again")
+	}
+	promoted, err := promoteWaitlist(tx, r)
+	if err != nil {
+		return Promise{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Promise{}, errors.Wrapf(err, "failed to withdraw promise(id=%s)", id)
+	}
+	p.Status = PromiseStatusWithdrawn
+	publishRequestEvent(events.PromiseWithdrawn, p.RequestID, p)
+	publishPromoted(promoted)
+	return p, nil
+}
@@ -0,0 +1,247 @@
+package db
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/events"
+	"github.com/jansemmelink/don8/model"
+	"github.com/jmoiron/sqlx"
+)
+
+//StatementLine is a transaction in a bank statement, see importer.ReadStatementCSV()
+type StatementLine struct {
+	Line        int    `json:"line" doc:"Line nr in the file"`
+	Date        string `json:"date,omitempty" doc:"CCYY-MM-DD when the date could be read, else as in the file"`
+	Description string `json:"description,omitempty"`
+	Reference   string `json:"reference,omitempty"`
+	Amount      int    `json:"amount" doc:"Amount in minor units, negative for debits"`
+}
+
+//ReconcileStatus is the result of matching a statement line to a pledge
+type ReconcileStatus string
+
+const (
+	ReconcileMatched   ReconcileStatus = "matched"   //pays what is still due on the pledge
+	ReconcileMismatch  ReconcileStatus = "mismatch"  //pledge found, but the amount differs from what is due
+	ReconcilePaid      ReconcileStatus = "paid"      //pledge was already paid in full, e.g. the statement was imported before
+	ReconcileUnmatched ReconcileStatus = "unmatched" //no known pledge reference in the line
+	ReconcileSkipped   ReconcileStatus = "skipped"   //debits are not donations
+)
+
+//Pledge is an unwithdrawn promise for a money request, with what was paid so far
+type Pledge struct {
+	PromiseID    ID     `json:"promise_id" db:"promise_id"`
+	RequestID    ID     `json:"request_id" db:"request_id"`
+	RequestTitle string `json:"request_title" db:"request_title"`
+	UserID       ID     `json:"user_id" db:"user_id"`
+	UserName     string `json:"user_name" db:"user_name"`
+	Reference    string `json:"reference" db:"reference"`
+	Amount       int    `json:"amount" db:"amount"`
+	Paid         int    `json:"paid" db:"paid"`
+}
+
+//ReconcileLine is a statement line with the pledge that it pays
+type ReconcileLine struct {
+	StatementLine
+	Status  ReconcileStatus `json:"status" doc:"matched|mismatch|paid|unmatched|skipped"`
+	Pledge  *Pledge         `json:"pledge,omitempty"`
+	Due     int             `json:"due,omitempty" doc:"Amount still due on the pledge before this line"`
+	Payment *Payment        `json:"payment,omitempty" doc:"Payment recorded for a matched line"`
+}
+
+//Reconciliation of a bank statement with the pledges in a group
+type Reconciliation struct {
+	Currency   model.Currency  `json:"currency"`
+	Lines      []ReconcileLine `json:"lines"`
+	Matched    int             `json:"matched"`
+	Mismatched int             `json:"mismatched"`
+	Paid       int             `json:"paid"`
+	Unmatched  int             `json:"unmatched"`
+	Recorded   int             `json:"recorded" doc:"Nr of payments recorded for matched lines"`
+}
+
+//pledgeReferenceRegex finds references from newPledgeReference()
+var pledgeReferenceRegex = regexp.MustCompile(`D8[` + pledgeReferenceChars + `]{8}`)
+
+//MatchStatement matches credit lines to pledges on the pledge reference in the line reference or description.
+//Lines are taken in order, so when a pledge appears in more lines, the later lines see what the earlier ones paid.
+func MatchStatement(lines []StatementLine, pledges []Pledge) Reconciliation {
+	byReference := map[string]*Pledge{}
+	for i := range pledges {
+		p := pledges[i]
+		byReference[p.Reference] = &p
+	}
+	rec := Reconciliation{Lines: []ReconcileLine{}}
+	for _, line := range lines {
+		rl := ReconcileLine{StatementLine: line, Status: ReconcileUnmatched}
+		if line.Amount <= 0 {
+			rl.Status = ReconcileSkipped
+			rec.Lines = append(rec.Lines, rl)
+			continue
+		}
+		//banks may add spaces or dashes in references
+		text := strings.NewReplacer(" ", "", "-", "").Replace(strings.ToUpper(line.Reference + " " + line.Description))
+		for _, ref := range pledgeReferenceRegex.FindAllString(text, -1) {
+			if p, ok := byReference[ref]; ok {
+				pledge := *p
+				rl.Pledge = &pledge
+				rl.Due = p.Amount - p.Paid
+				switch {
+				case rl.Due <= 0:
+					rl.Due = 0
+					rl.Status = ReconcilePaid
+				case line.Amount == rl.Due:
+					rl.Status = ReconcileMatched
+					p.Paid += line.Amount
+				default:
+					rl.Status = ReconcileMismatch
+				}
+				break
+			}
+		}
+		switch rl.Status {
+		case ReconcileMatched:
+			rec.Matched++
+		case ReconcileMismatch:
+			rec.Mismatched++
+		case ReconcilePaid:
+			rec.Paid++
+		case ReconcileUnmatched:
+			rec.Unmatched++
+		}
+		rec.Lines = append(rec.Lines, rl)
+	}
+	return rec
+} //MatchStatement()
+
+//pledgesFrom selects the pledges in the groups (IN (?)) in a currency
+const pledgesFrom = " FROM `promises` AS p JOIN `requests` AS r ON r.`id`=p.`request_id`" +
+	" WHERE r.`group_id` IN (?) AND r.`type`=? AND r.`currency`=? AND p.`reference` IS NOT NULL AND p.`status`<>?"
+
+//ReconcileStatement matches the statement lines to pledges in the currency in the group and its sub-groups,
+//and when record is true, records the matched lines as EFT payments in one transaction with the pledges locked,
+//so that when the same statement is reconciled at the same time, the other sees these payments and records none.
+func ReconcileStatement(groupID ID, currency model.Currency, lines []StatementLine, record bool, recordedBy ID) (Reconciliation, error) {
+	groups, err := ListGroupTree(groupID)
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	groupIDs := []string{}
+	for _, g := range groups {
+		groupIDs = append(groupIDs, string(g.ID))
+	}
+	if len(groupIDs) == 0 {
+		return Reconciliation{}, errors.Errorf("unknown group(id=%s)", groupID)
+	}
+	pledgesArgs := []interface{}{groupIDs, RequestTypeMoney, currency, PromiseStatusWithdrawn}
+
+	var q sqlx.Queryer = db
+	var tx *sqlx.Tx
+	if record {
+		if tx, err = db.Beginx(); err != nil {
+			return Reconciliation{}, errors.Wrapf(err, "failed to start transaction")
+		}
+		defer tx.Rollback()
+		//lock before reading what was paid, which then includes payments committed while waiting for the lock
+		query, args, err := sqlx.In("SELECT p.`id`"+pledgesFrom+" FOR UPDATE", pledgesArgs...)
+		if err != nil {
+			return Reconciliation{}, errors.Wrapf(err, "failed to make pledges query")
+		}
+		var ids []ID
+		if err := tx.Select(&ids, tx.Rebind(query), args...); err != nil {
+			return Reconciliation{}, errors.Wrapf(err, "failed to lock group(id=%s) pledges", groupID)
+		}
+		q = tx
+	}
+	var pledges []Pledge
+	query, args, err := sqlx.In("SELECT p.`id` AS `promise_id`,p.`request_id`,r.`title` AS `request_title`,p.`user_id`,u.`name` AS `user_name`,"+
+		"p.`reference`,p.`qty` AS `amount`,"+
+		"COALESCE((SELECT SUM(pm.`amount`) FROM `payments` AS pm WHERE pm.`promise_id`=p.`id`),0) AS `paid`"+
+		strings.Replace(pledgesFrom, " WHERE", " JOIN `users` AS u ON u.`id`=p.`user_id` WHERE", 1),
+		pledgesArgs...,
+	)
+	if err != nil {
+		return Reconciliation{}, errors.Wrapf(err, "failed to make pledges query")
+	}
+	if err := sqlx.Select(q, &pledges, db.Rebind(query), args...); err != nil {
+		return Reconciliation{}, errors.Wrapf(err, "failed to get group(id=%s) pledges", groupID)
+	}
+
+	rec := MatchStatement(lines, pledges)
+	rec.Currency = currency
+	if !record {
+		return rec, nil
+	}
+
+	//progress of the requests before the payments, to publish when they are met
+	requests := map[ID]Request{}
+	before := map[ID]*RequestProgress{}
+	for i, rl := range rec.Lines {
+		if rl.Status != ReconcileMatched {
+			continue
+		}
+		if _, ok := requests[rl.Pledge.RequestID]; !ok {
+			r, err := GetRequest(rl.Pledge.RequestID)
+			if err != nil {
+				return Reconciliation{}, errors.Wrapf(err, "failed to get request for line %d", rl.Line)
+			}
+			requests[r.ID] = r
+			if progress, err := GetRequestProgress(r); err != nil {
+				log.Errorf("cannot get request(id=%s) progress: %+v", r.ID, err)
+			} else {
+				before[r.ID] = &progress
+			}
+		}
+		date := SqlTime(time.Now())
+		if t, err := time.ParseInLocation("2006-01-02", rl.Date, time.Local); err == nil {
+			date = SqlTime(t)
+		}
+		reference := rl.Reference
+		if reference == "" {
+			reference = rl.Pledge.Reference
+		}
+		if len(reference) > maxPaymentReference {
+			reference = reference[:maxPaymentReference]
+		}
+		p := Payment{
+			RequestID:  rl.Pledge.RequestID,
+			PromiseID:  &rl.Pledge.PromiseID,
+			UserID:     &rl.Pledge.UserID,
+			Amount:     rl.Amount,
+			Currency:   currency,
+			Method:     PaymentMethodEFT,
+			Reference:  &reference,
+			Date:       date,
+			RecordedBy: recordedBy,
+		}
+		if err := p.Validate(); err != nil {
+			return Reconciliation{}, errors.Wrapf(err, "invalid payment for line %d", rl.Line)
+		}
+		//a matched line pays what is due, so the pledge is then paid in full
+		if p, err = insertPayment(tx, p, &Promise{ID: rl.Pledge.PromiseID, Qty: rl.Pledge.Amount}); err != nil {
+			return Reconciliation{}, errors.Wrapf(err, "failed to record payment for line %d", rl.Line)
+		}
+		rec.Lines[i].Payment = &p
+		rec.Recorded++
+	}
+	if err := tx.Commit(); err != nil {
+		return Reconciliation{}, errors.Wrapf(err, "failed to record payments")
+	}
+
+	after := map[ID]*RequestProgress{}
+	for _, rl := range rec.Lines {
+		if rl.Payment != nil {
+			after[rl.Payment.RequestID] = publishRequestEvent(events.PaymentReceived, rl.Payment.RequestID, *rl.Payment)
+		}
+	}
+	for id, r := range requests {
+		publishRequestMet(r, before[id], after[id])
+		if err := syncRequestStatus(id); err != nil {
+			log.Errorf("failed to update request(id=%s) status: %+v", id, err)
+		}
+	}
+	return rec, nil
+} //ReconcileStatement()
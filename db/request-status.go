@@ -0,0 +1,97 @@
+package db
+
+import (
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/events"
+)
+
+//RequestStatus is where a request is in its lifecycle
+type RequestStatus string
+
+const (
+	RequestStatusDraft     RequestStatus = "draft"     //not yet shown to donors
+	RequestStatusOpen      RequestStatus = "open"      //accepting promises
+	RequestStatusFulfilled RequestStatus = "fulfilled" //received the full quantity
+	RequestStatusClosed    RequestStatus = "closed"    //no longer needed, may be opened again
+	RequestStatusCancelled RequestStatus = "cancelled" //final
+)
+
+//requestTransitions are the status changes that users may make,
+//fulfilled is only set when the full quantity is received
+var requestTransitions = map[RequestStatus][]RequestStatus{
+	RequestStatusDraft:     {RequestStatusOpen, RequestStatusCancelled},
+	RequestStatusOpen:      {RequestStatusClosed, RequestStatusCancelled},
+	RequestStatusFulfilled: {RequestStatusOpen, RequestStatusClosed},
+	RequestStatusClosed:    {RequestStatusOpen, RequestStatusCancelled},
+	RequestStatusCancelled: {},
+}
+
+func (s RequestStatus) Validate() error {
+	if _, ok := requestTransitions[s]; !ok {
+		return errors.Errorf("unknown status \"%s\", expecting draft|open|fulfilled|closed|cancelled", s)
+	}
+	return nil
+}
+
+//CanChangeTo is nil if users may change a request from this status to the other
+func (s RequestStatus) CanChangeTo(to RequestStatus) error {
+	if err := to.Validate(); err != nil {
+		return apierr.Invalid("status", "%s", err)
+	}
+	for _, allowed := range requestTransitions[s] {
+		if to == allowed {
+			return nil
+		}
+	}
+	return apierr.Errorf(apierr.Conflict, "cannot change request status from %s to %s", s, to)
+}
+
+//statusAfter is the status of a request with the progress, i.e. open requests
+//become fulfilled when the full quantity is received and open again when more is needed
+func (s RequestStatus) statusAfter(p RequestProgress) RequestStatus {
+	switch {
+	case s == RequestStatusOpen && p.Received >= float64(p.Qty):
+		return RequestStatusFulfilled
+	case s == RequestStatusFulfilled && p.Received < float64(p.Qty):
+		return RequestStatusOpen
+	}
+	return s
+}
+
+//CanPromise fails if the request does not accept the promise, where userPromised
+//is what the user already promised for this request
+func (r Request) CanPromise(qty int, userPromised int) error {
+	if r.Status != RequestStatusOpen {
+		return apierr.Errorf(apierr.Conflict, "request is %s and does not accept promises", r.Status)
+	}
+	if r.MinPerDonor > 0 && qty < r.MinPerDonor {
+		return apierr.Invalid("qty", "promise at least %d %s", r.MinPerDonor, r.Unit())
+	}
+	if r.MaxPerDonor > 0 && userPromised+qty > r.MaxPerDonor {
+		return apierr.Invalid("qty", "promise at most %d %s in total, you already promised %d", r.MaxPerDonor, r.Unit(), userPromised)
+	}
+	return nil
+}
+
+//syncRequestStatus updates the status of the request from its progress
+func syncRequestStatus(id ID) error {
+	r, err := GetRequest(id)
+	if err != nil {
+		return err
+	}
+	progress, err := GetRequestProgress(r)
+	if err != nil {
+		return err
+	}
+	status := r.Status.statusAfter(progress)
+	if status == r.Status {
+		return nil
+	}
+	if _, err := db.Exec("UPDATE `requests` SET `status`=? WHERE `id`=? AND `status`=?", status, id, r.Status); err != nil {
+		return errors.Wrapf(err, "failed to update request(id=%s) status", id)
+	}
+	r.Status = status
+	events.Publish(events.RequestUpdated, string(r.GroupID), r, progress)
+	return nil
+} //syncRequestStatus()
@@ -0,0 +1,110 @@
+package db_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jansemmelink/don8/db"
+)
+
+func TestRequestStatus(t *testing.T) {
+	for _, ok := range [][2]db.RequestStatus{
+		{db.RequestStatusDraft, db.RequestStatusOpen},
+		{db.RequestStatusOpen, db.RequestStatusClosed},
+		{db.RequestStatusFulfilled, db.RequestStatusOpen},
+		{db.RequestStatusClosed, db.RequestStatusOpen},
+	} {
+		if err := ok[0].CanChangeTo(ok[1]); err != nil {
+			t.Errorf("%s->%s: %+v", ok[0], ok[1], err)
+		}
+	}
+	for _, notOk := range [][2]db.RequestStatus{
+		{db.RequestStatusOpen, db.RequestStatusFulfilled},
+		{db.RequestStatusOpen, db.RequestStatusDraft},
+		{db.RequestStatusCancelled, db.RequestStatusOpen},
+		{db.RequestStatusOpen, "paused"},
+	} {
+		if err := notOk[0].CanChangeTo(notOk[1]); err == nil {
+			t.Errorf("%s->%s allowed", notOk[0], notOk[1])
+		}
+	}
+
+	r := db.Request{GroupID: "g", Title: "Flour", Qty: 10, MinPerDonor: 2, MaxPerDonor: 5}
+	if err := r.Validate(); err != nil || r.Status != db.RequestStatusOpen {
+		t.Fatalf("validate: %s %+v", r.Status, err)
+	}
+	if err := r.CanPromise(2, 3); err != nil {
+		t.Errorf("promise within limits: %+v", err)
+	}
+	if err := r.CanPromise(1, 0); err == nil {
+		t.Errorf("promise below min_per_donor accepted")
+	}
+	if err := r.CanPromise(3, 3); err == nil {
+		t.Errorf("promise above max_per_donor accepted")
+	}
+	r.Status = db.RequestStatusClosed
+	if err := r.CanPromise(2, 0); err == nil {
+		t.Errorf("promise for closed request accepted")
+	}
+
+	for _, invalid := range []db.Request{
+		{GroupID: "g", Title: "Flour", Qty: 10, Status: db.RequestStatusFulfilled},
+		{GroupID: "g", Title: "Flour", Qty: 10, Priority: 10},
+		{GroupID: "g", Title: "Flour", Qty: 10, MinPerDonor: 11},
+		{GroupID: "g", Title: "Flour", Qty: 10, MinPerDonor: 5, MaxPerDonor: 4},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("invalid request accepted: %+v", invalid)
+		}
+	}
+}
+
+func TestRequestLifecycle(t *testing.T) {
+	requireDB(t)
+	u, err := db.AddUser(db.User{Name: "Lifecycle", Phone: "0821111115", Email: "lifecycle@b.c"})
+	if err != nil {
+		t.Fatalf("failed to create user: %+v", err)
+	}
+	defer db.DelUser(u.ID)
+	g, err := db.AddGroup(u, db.NewGroup{Title: "Lifecycle test", UserRole: "Organiser"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelGroup(g.ID)
+	neededBy := db.SqlTime(time.Date(2030, 1, 31, 0, 0, 0, 0, time.Local))
+	flour, err := db.AddRequest(db.Request{GroupID: g.ID, Title: "Flour", Qty: 10, Priority: 1, NeededBy: &neededBy})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelRequest(flour.ID)
+	eggs, err := db.AddRequest(db.Request{GroupID: g.ID, Title: "Eggs", Qty: 24, Priority: 5, Status: db.RequestStatusDraft})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelRequest(eggs.ID)
+
+	list, err := db.FindRequests(g.ID, db.RequestFilter{}, db.PageRequest{Sort: "-priority"})
+	if err != nil || list.Total != 2 || list.Requests[0].ID != eggs.ID {
+		t.Fatalf("sort: %+v %+v", list, err)
+	}
+	before := time.Date(2030, 2, 1, 0, 0, 0, 0, time.Local)
+	list, err = db.FindRequests(g.ID, db.RequestFilter{Statuses: []db.RequestStatus{db.RequestStatusOpen}, NeededBefore: &before}, db.PageRequest{})
+	if err != nil || list.Total != 1 || list.Requests[0].ID != flour.ID {
+		t.Fatalf("filter: %+v %+v", list, err)
+	}
+
+	open := db.RequestStatusOpen
+	if err := db.UpdRequest(db.UpdRequestRequest{ID: eggs.ID, Status: &open}); err != nil {
+		t.Fatalf("open: %+v", err)
+	}
+	cancelled := db.RequestStatusCancelled
+	if err := db.UpdRequest(db.UpdRequestRequest{ID: eggs.ID, Status: &cancelled}); err != nil {
+		t.Fatalf("cancel: %+v", err)
+	}
+	if err := db.UpdRequest(db.UpdRequestRequest{ID: eggs.ID, Status: &open}); err == nil {
+		t.Fatalf("opened cancelled request")
+	}
+	if r, _ := db.GetRequest(eggs.ID); r.Status != db.RequestStatusCancelled {
+		t.Fatalf("status: %s", r.Status)
+	}
+}
@@ -1,58 +1,48 @@
 package db
 
 import (
-	"net/http"
+	"database/sql"
 	"strings"
+	"time"
 
 	"github.com/go-msvc/errors"
 	"github.com/google/uuid"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/events"
+	"github.com/jansemmelink/don8/model"
 )
 
 type Request struct {
-	ID          ID      `json:"id" db:"id"`
-	GroupID     ID      `json:"group_id" db:"group_id"`
-	Title       string  `json:"title" db:"title"`
-	Description *string `json:"description" db:"description"`
-	Tags        *string `json:"tags" db:"tags" doc:"Written as |<tag>|<tag>|...| so we can search with SQL tags like \"|<sometag>|\""`
-	Units       *string `json:"units" db:"units" doc:"Unit of measurement, e.g. \"items\" or \"kg\" or \"L\" or \"dozen\" etc..."`
-	Qty         int     `json:"qty" db:"qty" doc:"Quantity requested in total from all donars"`
+	ID          ID             `json:"id" db:"id"`
+	GroupID     ID             `json:"group_id" db:"group_id"`
+	Title       string         `json:"title" db:"title"`
+	Description *string        `json:"description" db:"description"`
+	Tags        TagList        `json:"tags" db:"tags" doc:"Names of tags in the group, added to the group when new"`
+	Type        RequestType    `json:"type" db:"type" doc:"goods (default) or money"`
+	Currency    model.Currency `json:"currency,omitempty" db:"currency" doc:"Currency of a money request (default ZAR), then qty and all amounts are in minor units, e.g. cents"`
+	Units       *string        `json:"units" db:"units" doc:"Unit of measurement, e.g. \"items\" or \"kg\" or \"L\" or \"dozen\" or \"pack of 6\" etc... (default \"items\"), not used for money requests"`
+	Qty         int            `json:"qty" db:"qty" doc:"Quantity requested in total from all donars, or amount in minor units for money requests"`
+	Status      RequestStatus  `json:"status" db:"status" doc:"draft|open|fulfilled|closed|cancelled, new requests are draft or open (default)"`
+	NeededBy    *SqlTime       `json:"needed_by,omitempty" db:"needed_by" doc:"Optional date by when it is needed as CCYY-MM-DD"`
+	Priority    int            `json:"priority" db:"priority" doc:"0 for normal up to 9 for most urgent"`
+	MinPerDonor int            `json:"min_per_donor,omitempty" db:"min_per_donor" doc:"Smallest quantity one donor may promise, 0 for any"`
+	MaxPerDonor int            `json:"max_per_donor,omitempty" db:"max_per_donor" doc:"Largest quantity one donor may promise in total, 0 for any"`
+	OverflowPct int            `json:"overflow_pct,omitempty" db:"overflow_pct" doc:"Accept promises for up to this % more than qty, 0..100 (default 0)"`
+	Waitlist    bool           `json:"waitlist,omitempty" db:"waitlist" doc:"Waitlist promises for more than can still be promised, instead of refusing them"`
 }
 
-func TagsFromString(s string) []string {
-	s = strings.ReplaceAll(s, ",", "|")
-	s = strings.ReplaceAll(s, " ", "|")
-	tags := strings.Split(s, "|")
-	for i := 0; i < len(tags); i++ {
-		tags[i] = strings.TrimSpace(tags[i])
-	}
-	nonEmptyTags := []string{}
-	for _, t := range tags {
-		if t != "" {
-			nonEmptyTags = append(nonEmptyTags, t)
-		}
-	}
-	return nonEmptyTags
-}
+//requestColumns are selected into Request
+const requestColumns = "`id`,`group_id`,`title`,`description`,`tags`,`type`,`currency`,`units`,`qty`,`status`,`needed_by`,`priority`,`min_per_donor`,`max_per_donor`,`overflow_pct`,`waitlist`"
 
-//tagString return "|xxx|yyy|zzz|" as we store tags in the db for easy match with SQL like %"|xxx|"%
-func tagsDbString(tags []string) string {
-	if len(tags) == 0 {
-		return ""
-	}
-	return "|" + strings.Join(tags, "|") + "|"
-}
-
-//tagCSV return "xxx,yyy,zzz" as we display tags to the API
-func TagsCSV(tags []string) string {
-	return strings.Join(tags, ",")
-}
+//MaxRequestPriority is the most urgent priority
+const MaxRequestPriority = 9
 
 func (req *Request) Validate() error {
 	if req.GroupID == "" {
-		return errors.Errorf("missing group_id")
+		return apierr.Invalid("group_id", "missing group_id")
 	}
 	if req.Title == "" {
-		return errors.Errorf("missing title")
+		return apierr.Invalid("title", "missing title")
 	}
 	//Description is optional, but remove outer spaces
 	if req.Description != nil {
@@ -61,84 +51,192 @@ func (req *Request) Validate() error {
 			req.Description = nil
 		}
 	}
-	//Tags are optional, but convert to valid pipe-separated tags
-	if req.Tags != nil {
-		tags := tagsDbString(TagsFromString(*req.Tags))
-		if tags != "" {
-			req.Tags = &tags
-		} else {
-			req.Tags = nil
+	//Tags are optional
+	req.Tags = req.Tags.normalise()
+	if err := req.Tags.Validate(); err != nil {
+		return apierr.Invalid("tags", "%s", err)
+	}
+	//Units are optional (default items), but must be a known unit
+	if req.Units != nil {
+		def, err := model.ParseUnit(*req.Units)
+		if err != nil {
+			return apierr.Invalid("units", "invalid units: %s", err)
 		}
+		units := string(def.Name)
+		req.Units = &units
+	}
+	if err := req.validateType(); err != nil {
+		return err
 	}
 	if req.Qty < 1 {
-		return errors.Errorf("missing qty")
+		return apierr.Invalid("qty", "missing qty")
+	}
+	//new requests are open unless saved as draft
+	if req.Status == "" {
+		req.Status = RequestStatusOpen
+	}
+	if req.Status != RequestStatusOpen && req.Status != RequestStatusDraft {
+		return apierr.Invalid("status", "new request status must be draft or open")
+	}
+	return req.validateLimits()
+}
+
+//validateLimits checks the priority and per donor quantities
+func (req Request) validateLimits() error {
+	if req.Priority < 0 || req.Priority > MaxRequestPriority {
+		return apierr.Invalid("priority", "priority must be 0..%d", MaxRequestPriority)
+	}
+	if req.MinPerDonor < 0 || req.MinPerDonor > req.Qty {
+		return apierr.Invalid("min_per_donor", "min_per_donor must be 0..%d", req.Qty)
+	}
+	if req.MaxPerDonor < 0 || (req.MaxPerDonor > 0 && req.MaxPerDonor < req.MinPerDonor) {
+		return apierr.Invalid("max_per_donor", "max_per_donor must be 0 or at least min_per_donor")
+	}
+	if req.OverflowPct < 0 || req.OverflowPct > 100 {
+		return apierr.Invalid("overflow_pct", "overflow_pct must be 0..100")
 	}
 	return nil
 }
 
+//Unit returns the unit of the request (default items),
+//which is the currency for money requests
+func (req Request) Unit() model.Unit {
+	if req.Type == RequestTypeMoney {
+		return model.Unit(req.Currency)
+	}
+	if req.Units == nil || *req.Units == "" {
+		return model.DefaultUnit
+	}
+	return model.Unit(*req.Units)
+}
+
 func AddRequest(r Request) (Request, error) {
 	if err := r.Validate(); err != nil {
-		return Request{}, errors.Errorc(http.StatusBadRequest, err.Error())
+		return Request{}, apierr.Validation(err)
 	}
 	id := uuid.New().String()
-	if _, err := db.Exec("INSERT INTO `requests` SET `id`=?,`group_id`=?,`title`=?,`description`=?,`tags`=?,`units`=?,`qty`=?",
+	if _, err := db.Exec("INSERT INTO `requests` SET `id`=?,`group_id`=?,`title`=?,`description`=?,`type`=?,`currency`=?,`units`=?,`qty`=?,"+
+		"`status`=?,`needed_by`=?,`priority`=?,`min_per_donor`=?,`max_per_donor`=?,`overflow_pct`=?,`waitlist`=?",
 		id,
 		r.GroupID,
 		r.Title,
 		r.Description,
-		r.Tags,
+		r.Type,
+		r.Currency,
 		r.Units,
 		r.Qty,
+		r.Status,
+		r.NeededBy,
+		r.Priority,
+		r.MinPerDonor,
+		r.MaxPerDonor,
+		r.OverflowPct,
+		r.Waitlist,
 	); err != nil {
 		return Request{}, errors.Wrapf(err, "failed to add request")
 	}
 	r.ID = ID(id)
+	if err := setRequestTags(r); err != nil {
+		return Request{}, err
+	}
+	publishRequestEvent(events.RequestCreated, r.ID, r)
 	return r, nil
 }
 
-func FindRequests(groupID ID, filter string, tags []string, limit int) ([]Request, error) {
-	sql := "SELECT id,group_id,title,description,tags,units,qty FROM `requests` WHERE `group_id`=?"
+//RequestList is one page of FindRequests()
+type RequestList struct {
+	Requests []Request `json:"requests"`
+	Page
+}
+
+var RequestSort = SortFields{
+	Default: "title",
+	Columns: map[string]string{
+		"title":     "`title`",
+		"qty":       "`qty`",
+		"status":    "`status`",
+		"priority":  "`priority`",
+		"needed_by": "COALESCE(`needed_by`,'9999-12-31')", //requests without a date last
+	},
+	ID: "`id`",
+}
+
+//RequestFilter selects the requests in FindRequests()
+type RequestFilter struct {
+	Text         string          //in the title or description
+	Tags         []string        //all of these tags
+	Statuses     []RequestStatus //any of these, or all when empty
+	Type         RequestType     //only this type when not empty
+	NeededBefore *time.Time      //needed before this time
+	MinPriority  int
+}
+
+func FindRequests(groupID ID, filter RequestFilter, page PageRequest) (RequestList, error) {
+	from := "FROM `requests` WHERE `group_id`=?"
 	args := []interface{}{groupID}
 
-	if filter != "" {
-		sql += " AND (title like ? OR description like ?)"
-		args = append(args, "%"+filter+"%") //for title like ...
-		args = append(args, "%"+filter+"%") //for description like ...
+	if filter.Text != "" {
+		from += " AND (title like ? OR description like ?)"
+		args = append(args, "%"+filter.Text+"%") //for title like ...
+		args = append(args, "%"+filter.Text+"%") //for description like ...
 	}
 
-	for _, tag := range tags {
-		tag = strings.TrimSpace(tag)
-		if tag != "" {
-			sql += " AND tags like ?"
-			args = append(args, "%|"+tag+"|%")
-		}
+	for _, tag := range TagList(filter.Tags).normalise() {
+		from += " AND EXISTS (SELECT 1 FROM `request_tags` AS rt JOIN `tags` AS t ON rt.`tag_id`=t.`id` WHERE rt.`request_id`=`requests`.`id` AND t.`name`=?)"
+		args = append(args, tag)
 	}
 
-	if limit < 1 {
-		limit = 10
+	if len(filter.Statuses) > 0 {
+		from += " AND `status` IN (?" + strings.Repeat(",?", len(filter.Statuses)-1) + ")"
+		for _, status := range filter.Statuses {
+			args = append(args, status)
+		}
+	}
+	if filter.Type != "" {
+		from += " AND `type`=?"
+		args = append(args, filter.Type)
+	}
+	if filter.NeededBefore != nil {
+		from += " AND `needed_by`<?"
+		args = append(args, SqlTime(*filter.NeededBefore))
 	}
-	if limit > 100 {
-		limit = 100
+	if filter.MinPriority > 0 {
+		from += " AND `priority`>=?"
+		args = append(args, filter.MinPriority)
 	}
-	sql += " LIMIT ?"
-	args = append(args, limit)
 
-	var requests []Request
-	if err := db.Select(&requests, sql, args...); err != nil {
-		return nil, errors.Wrapf(err, "failed to find requests")
+	list := RequestList{Requests: []Request{}}
+	var err error
+	if list.Page, err = selectPage(&list.Requests, requestColumns, from, args, page, RequestSort); err != nil {
+		return RequestList{}, errors.Wrapf(err, "failed to find requests")
 	}
-	return requests, nil
+	return list, nil
 }
 
 func GetRequest(id ID) (Request, error) {
 	var request Request
-	if err := db.Get(&request, "SELECT id,group_id,title,description,tags,units,qty FROM requests WHERE id=?", id); err != nil {
+	if err := db.Get(&request, "SELECT "+requestColumns+" FROM `requests` WHERE `id`=?", id); err != nil {
 		return Request{}, errors.Wrapf(err, "failed to get request(id=%s)", id)
 	}
 	return request, nil
 }
 
+//GetRequestByTitle returns nil if not found
+func GetRequestByTitle(groupID ID, title string) (*Request, error) {
+	var request Request
+	if err := db.Get(&request, "SELECT "+requestColumns+" FROM `requests` WHERE `group_id`=? AND `title`=?", groupID, title); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil //not found
+		}
+		return nil, errors.Wrapf(err, "failed to get request(group_id=%s,title=%s)", groupID, title)
+	}
+	return &request, nil
+} //GetRequestByTitle()
+
 func DelRequest(id ID) error {
+	if _, err := db.Exec("DELETE FROM `request_tags` WHERE `request_id`=?", id); err != nil {
+		return errors.Wrapf(err, "failed to delete request(id=%s) tags", id)
+	}
 	if _, err := db.Exec("DELETE FROM `requests` WHERE `id`=?", id); err != nil {
 		return errors.Wrapf(err, "failed to delete request(id=%s)", id)
 	}
@@ -148,7 +246,8 @@ func DelRequest(id ID) error {
 type FullRequest struct {
 	Group Group `json:"group"`
 	Request
-	Promises []Promise `json:"promises,omitempty"`
+	Progress RequestProgress `json:"progress"`
+	Promises []Promise       `json:"promises,omitempty"`
 	//Receives []Receive `json:"receives,omitempty"`
 }
 
@@ -161,131 +260,257 @@ func GetFullRequest(id ID) (FullRequest, error) {
 	if err != nil {
 		return FullRequest{}, err
 	}
+	progress, err := GetRequestProgress(r)
+	if err != nil {
+		return FullRequest{}, err
+	}
 	fr := FullRequest{
-		Group:   g,
-		Request: r,
+		Group:    g,
+		Request:  r,
+		Progress: progress,
 		//		Promises: []Promise{},
 	}
 	// if err := db.Select(&fr.Promises, "SELECT id,parent_group_id,title,description FROM `groups` WHERE `parent_group_id`=? ORDER BY `title`", id); err != nil {
 	// 	log.Errorf("failed to read group(%s).children: %+v", id, err)
 	// }
 
-	//return tags as CSV to the API
 	return fr, nil
 } //GetFullRequest()
 
+//RequestProgress has totals normalised into the request's unit,
+//or amounts in minor units of the currency for money requests
+type RequestProgress struct {
+	Unit       model.Unit `json:"unit" doc:"Unit of all quantities in this progress (same as request units)"`
+	Qty        int        `json:"qty" doc:"Quantity requested"`
+	Promised   float64    `json:"promised" doc:"Total quantity promised"`
+	Waitlisted float64    `json:"waitlisted,omitempty" doc:"Total quantity of promises waiting for others to be withdrawn"`
+	Received   float64    `json:"received" doc:"Total quantity received"`
+}
+
+func GetRequestProgress(r Request) (RequestProgress, error) {
+	progress := RequestProgress{
+		Unit: r.Unit(),
+		Qty:  r.Qty,
+	}
+
+	//promises are always made in the request unit
+	var promised struct {
+		Promised   sql.NullInt64 `db:"promised"`
+		Waitlisted sql.NullInt64 `db:"waitlisted"`
+	}
+	if err := db.Get(&promised, "SELECT SUM(IF(`status`=?,0,`qty`)) AS `promised`,SUM(IF(`status`=?,`qty`,0)) AS `waitlisted`"+
+		" FROM `promises` WHERE `request_id`=? AND `status`<>?",
+		PromiseStatusWaitlisted,
+		PromiseStatusWaitlisted,
+		r.ID,
+		PromiseStatusWithdrawn,
+	); err != nil {
+		return RequestProgress{}, errors.Wrapf(err, "failed to get request(id=%s) promised total", r.ID)
+	}
+	progress.Promised = float64(promised.Promised.Int64)
+	progress.Waitlisted = float64(promised.Waitlisted.Int64)
+
+	//money is received as payments in the request currency
+	if r.Type == RequestTypeMoney {
+		var paid int
+		if err := db.Get(&paid, "SELECT COALESCE(SUM(`amount`),0) FROM `payments` WHERE `request_id`=?", r.ID); err != nil {
+			return RequestProgress{}, errors.Wrapf(err, "failed to get request(id=%s) paid total", r.ID)
+		}
+		progress.Received = float64(paid)
+		return progress, nil
+	}
+
+	//donations may be received in other compatible units
+	var received []struct {
+		Unit string `db:"unit"`
+		Qty  int    `db:"qty"`
+	}
+	if err := db.Select(&received, "SELECT `unit`,SUM(`qty`) AS `qty` FROM `receives` WHERE `request_id`=? GROUP BY `unit`", r.ID); err != nil {
+		return RequestProgress{}, errors.Wrapf(err, "failed to get request(id=%s) received totals", r.ID)
+	}
+	quantities := make([]model.Quantity, len(received))
+	for i, rcv := range received {
+		quantities[i] = model.Quantity{Qty: float64(rcv.Qty), Unit: model.Unit(rcv.Unit)}
+	}
+	var err error
+	if progress.Received, err = model.Sum(progress.Unit, quantities...); err != nil {
+		return RequestProgress{}, errors.Wrapf(err, "cannot total request(id=%s) received quantities", r.ID)
+	}
+	return progress, nil
+} //GetRequestProgress()
+
 type UpdRequestRequest struct {
-	ID          ID      `json:"id"`
-	Title       *string `json:"title,omitempty"`
-	Description *string `json:"description,omitempty"`
-	Tags        *string `json:"tags,omitempty"`
-	Units       *string `json:"units,omitempty"`
-	Qty         *int    `json:"qty,omitempty"`
+	ID          ID             `json:"id"`
+	Title       *string        `json:"title,omitempty"`
+	Description *string        `json:"description,omitempty"`
+	Tags        *TagList       `json:"tags,omitempty" doc:"Replaces all the tags, [] to remove all"`
+	Units       *string        `json:"units,omitempty"`
+	Qty         *int           `json:"qty,omitempty"`
+	Status      *RequestStatus `json:"status,omitempty" doc:"open, closed or cancelled, fulfilled is set when the full quantity is received"`
+	NeededBy    *SqlTime       `json:"needed_by,omitempty" doc:"Date by when it is needed as CCYY-MM-DD"`
+	Priority    *int           `json:"priority,omitempty"`
+	MinPerDonor *int           `json:"min_per_donor,omitempty"`
+	MaxPerDonor *int           `json:"max_per_donor,omitempty"`
+	OverflowPct *int           `json:"overflow_pct,omitempty"`
+	Waitlist    *bool          `json:"waitlist,omitempty"`
 }
 
 func (req *UpdRequestRequest) Validate() error {
 	if req.ID == "" {
-		return errors.Errorf("missing id")
+		return apierr.Invalid("id", "missing id")
 	}
 	if req.Title != nil {
 		*req.Title = strings.TrimSpace(*req.Title)
 		if *req.Title == "" {
-			return errors.Errorf("empty title not allowed")
+			return apierr.Invalid("title", "empty title not allowed")
 		}
 	}
 	if req.Description != nil {
 		*req.Description = strings.TrimSpace(*req.Description)
 		//allow empty description...
 		// if *req.Description == "" {
-		// 	return errors.Errorf("empty description not allowed")
+		// 	return apierr.Invalid("description", "empty description not allowed")
 		// }
 	}
 
-	//Tags are optional, but convert to valid pipe-separated tags
 	if req.Tags != nil {
-		tags := tagsDbString(TagsFromString(*req.Tags))
-		if tags != "" {
-			*req.Tags = tags
-		} else {
-			req.Tags = nil
+		*req.Tags = req.Tags.normalise()
+		if err := req.Tags.Validate(); err != nil {
+			return apierr.Invalid("tags", "%s", err)
 		}
 	}
 	if req.Units != nil {
-		*req.Units = strings.TrimSpace(*req.Units) //empty units are allowed
+		def, err := model.ParseUnit(*req.Units) //empty units are allowed (default items)
+		if err != nil {
+			return apierr.Invalid("units", "invalid units: %s", err)
+		}
+		*req.Units = string(def.Name)
 	}
 	if req.Qty != nil {
 		if *req.Qty < 0 {
-			return errors.Errorf("invalid new qty:%d", *req.Qty)
+			return apierr.Invalid("qty", "invalid new qty:%d", *req.Qty)
+		}
+	}
+	if req.Status != nil {
+		if err := req.Status.Validate(); err != nil {
+			return apierr.Invalid("status", "%s", err)
 		}
 	}
 	return nil
 }
 
 func UpdRequest(req UpdRequestRequest) error {
+	r, err := GetRequest(req.ID)
+	if err != nil {
+		return errors.Wrapf(err, "cannot update unknown request")
+	}
+
 	sql := "UPDATE `requests` SET"
 	args := []interface{}{}
 	changes := 0
-	if req.Title != nil && *req.Title != "" {
+	set := func(column string, value interface{}) {
 		if changes > 0 {
 			sql += ","
 		} else {
 			sql += " "
 		}
-		sql += "`title`=?"
-		args = append(args, *req.Title)
+		sql += "`" + column + "`=?"
+		args = append(args, value)
 		changes++
 	}
-	if req.Description != nil { //may be ""
-		if changes > 0 {
-			sql += ","
-		} else {
-			sql += " "
-		}
-		sql += "`description`=?"
-		args = append(args, *req.Description)
-		changes++
+	if req.Title != nil && *req.Title != "" {
+		set("title", *req.Title)
 	}
-	if req.Tags != nil { //may be ""
-		if changes > 0 {
-			sql += ","
-		} else {
-			sql += " "
-		}
-		sql += "`tags`=?"
-		args = append(args, *req.Tags)
-		changes++
+	if req.Description != nil { //may be ""
+		set("description", *req.Description)
 	}
 	if req.Units != nil { //may be ""
-		if changes > 0 {
-			sql += ","
-		} else {
-			sql += " "
+		if r.Type == RequestTypeMoney {
+			return apierr.Invalid("units", "money requests have no units")
 		}
-		sql += "`units`=?"
-		args = append(args, *req.Description)
-		changes++
+		//existing promises and donations must still be valid in the new unit
+		if err := r.Unit().Compatible(model.Unit(*req.Units)); err != nil {
+			return errors.Wrapf(err, "cannot change request units")
+		}
+		if r.Unit() != model.Unit(*req.Units) {
+			//promise qty are stored in the request unit, so cannot change after promises were made
+			progress, err := GetRequestProgress(r)
+			if err != nil {
+				return errors.Wrapf(err, "cannot change request units")
+			}
+			if progress.Promised > 0 {
+				return errors.Errorf("cannot change units from \"%s\" to \"%s\" after promises were made", r.Unit(), *req.Units)
+			}
+		}
+		set("units", *req.Units)
 	}
 	if req.Qty != nil { //may be 0
-		if changes > 0 {
-			sql += ","
-		} else {
-			sql += " "
+		set("qty", *req.Qty)
+		r.Qty = *req.Qty
+	}
+	if req.Status != nil && *req.Status != r.Status {
+		if err := r.Status.CanChangeTo(*req.Status); err != nil {
+			return err
 		}
-		sql += "`qty`=?"
-		args = append(args, *req.Qty)
-		changes++
+		set("status", *req.Status)
+	}
+	if req.NeededBy != nil {
+		set("needed_by", *req.NeededBy)
+	}
+	if req.Priority != nil {
+		set("priority", *req.Priority)
+		r.Priority = *req.Priority
+	}
+	if req.MinPerDonor != nil {
+		set("min_per_donor", *req.MinPerDonor)
+		r.MinPerDonor = *req.MinPerDonor
+	}
+	if req.MaxPerDonor != nil {
+		set("max_per_donor", *req.MaxPerDonor)
+		r.MaxPerDonor = *req.MaxPerDonor
 	}
-	if changes < 1 {
+	if req.OverflowPct != nil {
+		set("overflow_pct", *req.OverflowPct)
+		r.OverflowPct = *req.OverflowPct
+	}
+	if req.Waitlist != nil {
+		set("waitlist", *req.Waitlist)
+	}
+	if err := r.validateLimits(); err != nil {
+		return err
+	}
+	if changes < 1 && req.Tags == nil {
 		return errors.Errorf("no changes specified")
 	}
 
 	//finish the query SQL then exec
-	sql += " WHERE `id`=?"
-	args = append(args, req.ID)
-	_, err := db.Exec(sql, args...)
-	if err != nil {
-		log.Errorf("failed to update request: %+v", err)
-		return errors.Errorf("failed to update")
+	if changes > 0 {
+		sql += " WHERE `id`=?"
+		args = append(args, req.ID)
+		if _, err := db.Exec(sql, args...); err != nil {
+			return errors.Wrapf(err, "failed to update request(id=%s)", req.ID)
+		}
+	}
+	if req.Tags != nil {
+		r.Tags = *req.Tags
+		if err := setRequestTags(r); err != nil {
+			return err
+		}
+	}
+	//a new qty or status may (un)fulfil the request
+	if req.Qty != nil || req.Status != nil {
+		if err := syncRequestStatus(req.ID); err != nil {
+			return err
+		}
+	}
+	//and waitlisted promises may fit in a larger qty or overflow
+	if req.Qty != nil || req.OverflowPct != nil {
+		if _, err := PromoteWaitlist(req.ID); err != nil {
+			return err
+		}
+	}
+	if r, err := GetRequest(req.ID); err == nil {
+		publishRequestEvent(events.RequestUpdated, req.ID, r)
 	}
 	return nil
 } //UpdRequest()
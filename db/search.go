@@ -0,0 +1,118 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/search"
+	"github.com/jmoiron/sqlx"
+)
+
+//maxSearchMatches limits the rows read from each table,
+//from which the facets are counted and the best hits returned
+const maxSearchMatches = 1000
+
+//Search groups, requests and members in the groups the user may see
+func Search(userID ID, q search.Query) (search.Result, error) {
+	groupIDs, err := VisibleGroupIDs(userID)
+	if err != nil {
+		return search.Result{}, err
+	}
+	q.GroupIDs = groupIDs
+	return SearchIndex{}.Search(q)
+}
+
+//VisibleGroupIDs are the groups the user is a member of and all their descendants
+func VisibleGroupIDs(userID ID) ([]string, error) {
+	var ids []string
+	if err := db.Select(&ids,
+		"WITH RECURSIVE `visible` AS ("+
+			"SELECT `group_id` AS `id` FROM `members` WHERE `user_id`=?"+
+			" UNION"+
+			" SELECT g.`id` FROM `groups` AS g JOIN `visible` AS v ON g.`parent_group_id`=v.`id`"+
+			")"+
+			" SELECT `id` FROM `visible`",
+		userID,
+	); err != nil {
+		return nil, errors.Wrapf(err, "failed to get groups visible to user(id=%s)", userID)
+	}
+	return ids, nil
+}
+
+//SearchIndex searches with the FULLTEXT indexes in init.sql
+//The columns use an accent insensitive collation, so "hoer*" matches "Hoër"
+type SearchIndex struct{}
+
+//searchRow is the hit with the copy of the tag names in `requests`
+type searchRow struct {
+	ID      string  `db:"id"`
+	GroupID string  `db:"group_id"`
+	Title   string  `db:"title"`
+	Tags    TagList `db:"tags"`
+	Score   float64 `db:"score"`
+}
+
+func (SearchIndex) Search(q search.Query) (search.Result, error) {
+	if err := q.Validate(); err != nil {
+		return search.Result{}, err
+	}
+	hits := []search.Hit{}
+	if len(q.GroupIDs) == 0 {
+		return search.NewResult(hits, q), nil
+	}
+
+	//every term is required and also matches words that start with it
+	terms := search.Terms(q.Text)
+	for i, t := range terms {
+		terms[i] = "+" + t + "*"
+	}
+	against := strings.Join(terms, " ")
+
+	for _, t := range []struct {
+		kind     search.Kind
+		columns  string
+		from     string
+		groupCol string
+		match    string
+	}{
+		{search.KindGroup, "`id`,`id` AS `group_id`,`title`,NULL AS `tags`", "`groups`", "`id`",
+			"MATCH(`title`,`description`)"},
+		{search.KindRequest, "`id`,`group_id`,`title`,`tags`", "`requests`", "`group_id`",
+			"MATCH(`title`,`description`,`tags`)"},
+		{search.KindMember, "m.`id`,m.`group_id`,u.`name` AS `title`,NULL AS `tags`", "`members` AS m JOIN `users` AS u ON m.`user_id`=u.`id`", "m.`group_id`",
+			"MATCH(u.`name`)"},
+	} {
+		if !q.Want(t.kind) || (t.kind != search.KindRequest && len(q.Tags) > 0) {
+			continue //only requests have tags
+		}
+		score := "0"
+		where := t.groupCol + " IN (?)"
+		args := []interface{}{}
+		if against != "" {
+			score = t.match + " AGAINST(? IN BOOLEAN MODE)"
+			where += " AND " + score
+			args = append(args, against, q.GroupIDs, against)
+		} else {
+			args = append(args, q.GroupIDs)
+		}
+		for _, tag := range q.Tags {
+			where += " AND EXISTS (SELECT 1 FROM `request_tags` AS rt JOIN `tags` AS t ON rt.`tag_id`=t.`id` WHERE rt.`request_id`=`requests`.`id` AND t.`name`=?)"
+			args = append(args, tag)
+		}
+		args = append(args, maxSearchMatches)
+		query := "SELECT " + t.columns + "," + score + " AS `score` FROM " + t.from + " WHERE " + where + " ORDER BY `score` DESC LIMIT ?"
+
+		query, args, err := sqlx.In(query, args...)
+		if err != nil {
+			return search.Result{}, errors.Wrapf(err, "failed to make %s search query", t.kind)
+		}
+		var rows []searchRow
+		if err := db.Select(&rows, db.Rebind(query), args...); err != nil {
+			return search.Result{}, errors.Wrapf(err, "failed to search %ss", t.kind)
+		}
+		for _, r := range rows {
+			hits = append(hits, search.Hit{Kind: t.kind, ID: r.ID, GroupID: r.GroupID, Title: r.Title, Tags: r.Tags, Score: r.Score})
+		}
+	}
+	return search.NewResult(hits, q), nil
+} //SearchIndex.Search()
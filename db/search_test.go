@@ -0,0 +1,47 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/search"
+)
+
+func TestSearch(t *testing.T) {
+	requireDB(t)
+	u, err := db.AddUser(db.User{Name: "Anél Koekemoer", Phone: "0821111112", Email: "anel@b.c"})
+	if err != nil {
+		t.Fatalf("failed to create user: %+v", err)
+	}
+	defer db.DelUser(u.ID)
+	school, err := db.AddGroup(u, db.NewGroup{Title: "Hoërskool Zoektest", UserRole: "Organiser"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelGroup(school.ID)
+	fees, err := db.AddGroup(u, db.NewGroup{ParentGroupID: school.ID, Title: "Koekverkoping", UserRole: "Organiser"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelGroup(fees.ID)
+	r, err := db.AddRequest(db.Request{GroupID: fees.ID, Title: "Koeke", Tags: db.TagList{"bak", "kos"}, Qty: 10})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelRequest(r.ID)
+
+	res, err := db.Search(u.ID, search.Query{Text: "hoer zoek"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if res.Total != 1 || res.Hits[0].ID != string(school.ID) {
+		t.Fatalf("hoer zoek: %+v", res)
+	}
+	res, err = db.Search(u.ID, search.Query{Text: "koek", Kinds: []search.Kind{search.KindRequest}, Tags: []string{"bak"}})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if res.Total != 1 || res.Hits[0].ID != string(r.ID) || res.Facets["kos"] != 1 {
+		t.Fatalf("koek: %+v", res)
+	}
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"github.com/go-msvc/errors"
+)
+
+//Seed functions insert generated demo data with the given IDs.
+//Rows that already exist are skipped, so seeding again with the same data changes nothing.
+//They return true if the row was inserted.
+//Events are not published, so seeding does not call webhooks or notify users.
+
+func SeedUser(u User, pwd string) (bool, error) {
+	return seed("user", u.ID,
+		"INSERT IGNORE INTO `users` SET `id`=?,`name`=?,`phone`=?,`email`=?,`pwd_hash`=?",
+		u.ID, u.Name, u.Phone, u.Email, HashPassword(u.Email, pwd))
+}
+
+func SeedGroup(g Group) (bool, error) {
+	var parentGroupID *ID
+	if g.ParentGroupID != "" {
+		parentGroupID = &g.ParentGroupID
+	}
+	return seed("group", g.ID,
+		"INSERT IGNORE INTO `groups` SET `id`=?,`parent_group_id`=?,`title`=?,`description`=?,`start`=?,`end`=?",
+		g.ID, parentGroupID, g.Title, g.Description, g.Start, g.End)
+}
+
+func SeedMember(m Member, permissions []Permission) (bool, error) {
+	inserted, err := seed("member", m.ID,
+		"INSERT IGNORE INTO `members` SET `id`=?,`group_id`=?,`user_id`=?,`role`=?",
+		m.ID, m.GroupID, m.UserID, m.Role)
+	if err != nil {
+		return false, err
+	}
+	for _, p := range permissions {
+		if _, err := AddMemberPermission(MemberPermission{MemberID: m.ID, Permission: p}); err != nil {
+			return inserted, err
+		}
+	}
+	return inserted, nil
+}
+
+func SeedLocation(l Location) (bool, error) {
+	return seed("location", l.ID,
+		"INSERT IGNORE INTO `locations` SET `id`=?,`group_id`=?,`title`=?,`description`=?,`final_destination`=?",
+		l.ID, l.GroupID, l.Title, l.Description, l.FinalDestination)
+}
+
+func SeedRequest(r Request) (bool, error) {
+	if err := r.Validate(); err != nil {
+		return false, errors.Wrapf(err, "invalid request(id:%s)", r.ID)
+	}
+	inserted, err := seed("request", r.ID,
+		"INSERT IGNORE INTO `requests` SET `id`=?,`group_id`=?,`title`=?,`description`=?,`units`=?,`qty`=?,"+
+			"`status`=?,`needed_by`=?,`priority`=?,`min_per_donor`=?,`max_per_donor`=?",
+		r.ID, r.GroupID, r.Title, r.Description, r.Units, r.Qty,
+		r.Status, r.NeededBy, r.Priority, r.MinPerDonor, r.MaxPerDonor)
+	if err != nil || !inserted {
+		return inserted, err
+	}
+	return true, setRequestTags(r)
+}
+
+func SeedPromise(p Promise) (bool, error) {
+	return seed("promise", p.ID,
+		"INSERT IGNORE INTO `promises` SET `id`=?,`request_id`=?,`user_id`=?,`location_id`=?,`qty`=?,`date`=?,`status`=?",
+		p.ID, p.RequestID, p.UserID, p.LocationID, p.Qty, p.Date, p.Status)
+}
+
+//SeedDonation also marks the request fulfilled when it received the full quantity
+func SeedDonation(d Donation) (bool, error) {
+	inserted, err := seed("donation", d.ID,
+		"INSERT IGNORE INTO `receives` SET `id`=?,`location_id`=?,`request_id`=?,`promise_id`=?,`title`=?,`unit`=?,`qty`=?",
+		d.ID, d.LocationID, d.RequestID, d.PromiseID, d.Title, d.Unit, d.Qty)
+	if err != nil || !inserted || d.RequestID == nil {
+		return inserted, err
+	}
+	return true, syncRequestStatus(*d.RequestID)
+}
+
+//SeedInvitation adds a pending invitation, i.e. not yet sent
+func SeedInvitation(inv Invitation) (bool, error) {
+	return seed("invitation", inv.ID,
+		"INSERT IGNORE INTO `invitations` SET `id`=?,`group_id`=?,`email`=?,`time_created`=?,`time_updated`=?,`status`=''",
+		inv.ID, inv.GroupID, inv.Email, inv.TimeCreated, inv.TimeUpdated)
+}
+
+func seed(name string, id ID, query string, args ...interface{}) (bool, error) {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to seed %s(id:%s)", name, id)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to seed %s(id:%s)", name, id)
+	}
+	return n == 1, nil
+}
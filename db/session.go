@@ -7,6 +7,7 @@ import (
 
 	"github.com/go-msvc/errors"
 	"github.com/google/uuid"
+	"github.com/jansemmelink/don8/apierr"
 )
 
 type Session struct {
@@ -17,6 +18,17 @@ type Session struct {
 	ExpiryTime SqlTime `json:"expiry_time" db:"expiry_type"`
 }
 
+//lifetimes changed with SetLifetimes()
+var (
+	sessionLifetime    = 5 * time.Minute //extended on each use
+	activationLifetime = 24 * time.Hour  //of the temporary password sent to register or reset
+)
+
+func SetLifetimes(session, activation time.Duration) {
+	sessionLifetime = session
+	activationLifetime = activation
+}
+
 func NewSession(user User) (Session, error) {
 	if _, err := db.Exec("DELETE FROM `sessions` WHERE `user_id`=?", user.ID); err != nil {
 		if err != sql.ErrNoRows {
@@ -26,7 +38,7 @@ func NewSession(user User) (Session, error) {
 
 	id := ID(uuid.New().String())
 	stt := time.Now()
-	exp := stt.Add(time.Minute * 5)
+	exp := stt.Add(sessionLifetime)
 	if _, err := db.Exec("INSERT INTO `sessions` SET `id`=?,`user_id`=?,start_time=?,expiry_time=?",
 		id,
 		user.ID,
@@ -57,26 +69,33 @@ type LoginRequest struct {
 
 func (req LoginRequest) Validate() error {
 	if req.Email == "" {
-		return errors.Errorf("missing email")
+		return apierr.Invalid("email", "missing email")
 	}
 	if req.Password == "" {
-		return errors.Errorf("missing password")
+		return apierr.Invalid("password", "missing password")
 	}
 	return nil
 }
 
+//Login fails with the same message for unknown email and wrong password
+//so it cannot be used to find registered addresses
 func Login(req LoginRequest) (Session, error) {
 	user, err := GetUserByEmail(req.Email)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Session{}, apierr.Errorf(apierr.Unauthorized, "wrong email or password")
+		}
 		return Session{}, err
 	}
 	if user.PwdHash == nil {
 		return Session{}, errors.Errorc(http.StatusUnauthorized, "account not yet activated")
 	}
-	pwdHash := HashPassword(req.Email, req.Password)
-	if *user.PwdHash != pwdHash {
-		log.Errorf("user(id:%s, email:%s) wrong password(%s)->%s != %s", user.ID, user.Email, req.Password, pwdHash, *user.PwdHash)
-		return Session{}, errors.Errorc(http.StatusUnauthorized, "wrong password")
+	if *user.PwdHash != HashPassword(req.Email, req.Password) {
+		log.Errorf("user(id:%s) wrong password", user.ID)
+		return Session{}, apierr.Errorf(apierr.Unauthorized, "wrong email or password")
+	}
+	if user.Disabled {
+		return Session{}, apierr.Errorf(apierr.Forbidden, "account disabled")
 	}
 	return NewSession(user)
 }
@@ -84,11 +103,11 @@ func Login(req LoginRequest) (Session, error) {
 func Logout(sid ID) error {
 	result, err := db.Exec("DELETE FROM `sessions` WHERE `id`=?", sid)
 	if err != nil {
-		log.Errorf("failed to delete session(%s): %+v", sid, err)
+		log.Errorf("failed to delete session: %+v", err)
 		return errors.Errorf("failed to delete session")
 	}
 	if n, _ := result.RowsAffected(); n != 1 {
-		log.Errorf("delete %d for session(%s): %+v", n, sid, err)
+		log.Errorf("delete %d for session: %+v", n, err)
 		return errors.Errorf("failed to delete session")
 	}
 	return nil
@@ -115,10 +134,10 @@ func GetSession(sid ID) (Session, error) {
 		sid,
 	); err != nil {
 		if err == sql.ErrNoRows {
-			return Session{}, errors.Errorf("unknown session(%s)", sid)
+			return Session{}, errors.Errorf("unknown session")
 		}
-		log.Errorf("failed to get session(id:%s): %+v", sid, err)
-		return Session{}, errors.Errorf("failed to get session(%s)", sid)
+		log.Errorf("failed to get session: %+v", err)
+		return Session{}, errors.Errorf("failed to get session")
 	}
 
 	if time.Time(su.Expiry).Before(time.Now()) {
@@ -127,16 +146,16 @@ func GetSession(sid ID) (Session, error) {
 	}
 
 	//extend the session
-	exp := time.Now().Add(time.Minute * 5)
+	exp := time.Now().Add(sessionLifetime)
 	result, err := db.Exec("UPDATE `sessions` SET `expiry_time`=? WHERE `id`=?",
 		SqlTime(exp),
 		sid)
 	if err != nil {
-		log.Errorf("failed to extend session(id:%s): %+v", sid, err)
+		log.Errorf("failed to extend session: %+v", err)
 		return Session{}, errors.Errorf("failed to extend session")
 	}
 	if n, _ := result.RowsAffected(); n != 1 {
-		log.Errorf("failed to extend session(id:%s) affected %d rows", sid, n)
+		log.Errorf("failed to extend session affected %d rows", n)
 		return Session{}, errors.Errorf("failed to extend session")
 	}
 
@@ -157,9 +176,20 @@ func GetSession(sid ID) (Session, error) {
 func DelSession(sid ID) error {
 	if _, err := db.Exec("DELETE FROM `sessions` WHERE `id`=?", sid); err != nil {
 		if err != sql.ErrNoRows {
-			log.Errorf("failed to delete session(sid:%s): %+v", sid, err)
-			return errors.Wrapf(err, "failed to delete session(sid:%s): %+v", sid, err)
+			log.Errorf("failed to delete session: %+v", err)
+			return errors.Wrapf(err, "failed to delete session")
 		}
 	}
 	return nil
 } //DelSession()
+
+//PurgeSessions deletes sessions that expired before the time
+//and returns the nr deleted
+func PurgeSessions(before time.Time) (int64, error) {
+	result, err := db.Exec("DELETE FROM `sessions` WHERE `expiry_time`<?", SqlTime(before))
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to purge sessions")
+	}
+	n, _ := result.RowsAffected()
+	return n, nil
+} //PurgeSessions()
@@ -44,6 +44,15 @@ func (t *SqlTime) UnmarshalJSON(v []byte) error {
 	if len(s) < 2 || !strings.HasPrefix(s, "\"") || !strings.HasSuffix(s, "\"") {
 		return errors.Errorf("invalid time string %s (expects quoted \"2006-01-02 15:04:05\")", s)
 	}
+	//also accept a date only, e.g. for the date by when a request is needed
+	if len(s) == len("\"2006-01-02\"") {
+		timeValue, err := time.Parse("2006-01-02", s[1:len(s)-1])
+		if err != nil {
+			return err
+		}
+		*t = SqlTime(timeValue)
+		return nil
+	}
 	return t.Scan(v[1 : len(v)-1])
 }
 
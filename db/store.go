@@ -0,0 +1,99 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jansemmelink/don8/model"
+	"github.com/jansemmelink/don8/search"
+)
+
+//Store calls the functions of this package for the API server,
+//which takes the store as a dependency so that tests can replace it with a fake
+type Store struct{}
+
+func (Store) Activate(req ActivateRequest) (Session, error)        { return Activate(req) }
+func (Store) AddUser(newUser User) (User, error)                   { return AddUser(newUser) }
+func (Store) Login(req LoginRequest) (Session, error)              { return Login(req) }
+func (Store) Logout(sid ID) error                                  { return Logout(sid) }
+func (Store) GetSession(sid ID) (Session, error)                   { return GetSession(sid) }
+func (Store) Reset(req ResetRequest) (User, error)                 { return Reset(req) }
+func (Store) GetUserByEmail(email string) (User, error)            { return GetUserByEmail(email) }
+func (Store) NewSession(user User) (Session, error)                { return NewSession(user) }
+func (Store) AddGroup(user User, newGroup NewGroup) (Group, error) { return AddGroup(user, newGroup) }
+func (Store) GetGroup(id ID) (Group, error)                        { return GetGroup(id) }
+func (Store) GetFullGroup(id ID) (FullGroup, error)                { return GetFullGroup(id) }
+func (Store) GetGroupTree(id ID, maxDepth int) (GroupNode, error)  { return GetGroupTree(id, maxDepth) }
+func (Store) UpdGroup(req UpdGroupRequest) error                   { return UpdGroup(req) }
+func (Store) GetChildGroupByTitle(parentGroupID ID, title string) (*Group, error) {
+	return GetChildGroupByTitle(parentGroupID, title)
+}
+func (Store) MyGroups(user User, filter string, fromTime *time.Time, toTime *time.Time, page PageRequest) (MyGroupList, error) {
+	return MyGroups(user, filter, fromTime, toTime, page)
+}
+func (Store) IsGroupCoordinator(groupID ID, userID ID) (bool, error) {
+	return IsGroupCoordinator(groupID, userID)
+}
+func (Store) GetMemberByEmail(groupID ID, email string) (*Member, error) {
+	return GetMemberByEmail(groupID, email)
+}
+func (Store) ListGroupMembers(groupID ID, page PageRequest) (MemberList, error) {
+	return ListGroupMembers(groupID, page)
+}
+func (Store) ListGroupInvitations(groupID ID, page PageRequest) (InvitationList, error) {
+	return ListGroupInvitations(groupID, page)
+}
+func (Store) ListGroupLocations(groupID ID, page PageRequest) (LocationList, error) {
+	return ListGroupLocations(groupID, page)
+}
+func (Store) GetGroupBranding(groupID ID) (GroupBranding, error)   { return GetGroupBranding(groupID) }
+func (Store) SetGroupBranding(b GroupBranding) error               { return SetGroupBranding(b) }
+func (Store) GetGroupReminders(groupID ID) (GroupReminders, error) { return GetGroupReminders(groupID) }
+func (Store) SetGroupReminders(gr GroupReminders) error            { return SetGroupReminders(gr) }
+func (Store) AddRequest(r Request) (Request, error)                { return AddRequest(r) }
+func (Store) GetRequest(id ID) (Request, error)                    { return GetRequest(id) }
+func (Store) GetFullRequest(id ID) (FullRequest, error)            { return GetFullRequest(id) }
+func (Store) GetRequestByTitle(groupID ID, title string) (*Request, error) {
+	return GetRequestByTitle(groupID, title)
+}
+func (Store) UpdRequest(req UpdRequestRequest) error { return UpdRequest(req) }
+func (Store) FindRequests(groupID ID, filter RequestFilter, page PageRequest) (RequestList, error) {
+	return FindRequests(groupID, filter, page)
+}
+func (Store) ListTags(groupID ID, prefix string, limit int) ([]Tag, error) {
+	return ListTags(groupID, prefix, limit)
+}
+func (Store) AddTag(t Tag) (Tag, error)                   { return AddTag(t) }
+func (Store) GetTag(id ID) (Tag, error)                   { return GetTag(id) }
+func (Store) UpdTag(req UpdTagRequest) (Tag, error)       { return UpdTag(req) }
+func (Store) MergeTags(fromID ID, intoID ID) (Tag, error) { return MergeTags(fromID, intoID) }
+func (Store) DelTag(id ID) error                          { return DelTag(id) }
+func (Store) GetTagStats(groupID ID) ([]TagStats, error)  { return GetTagStats(groupID) }
+func (Store) AddPromise(p Promise) (Promise, error)       { return AddPromise(p) }
+func (Store) GetPromise(id ID) (Promise, error)           { return GetPromise(id) }
+func (Store) GetPromises(groupID string, userID string, requestID string, locationID string, beforeDate *time.Time, page PageRequest) (PromiseList, error) {
+	return GetPromises(groupID, userID, requestID, locationID, beforeDate, page)
+}
+func (Store) WithdrawPromise(id ID) (Promise, error) { return WithdrawPromise(id) }
+func (Store) AddPayment(p Payment) (Payment, error)  { return AddPayment(p) }
+func (Store) ListPayments(groupID ID, requestID ID, method PaymentMethod, page PageRequest) (PaymentList, error) {
+	return ListPayments(groupID, requestID, method, page)
+}
+func (Store) GetGroupMoney(id ID) (MoneyReport, error) { return GetGroupMoney(id) }
+func (Store) ReconcileStatement(groupID ID, currency model.Currency, lines []StatementLine, record bool, recordedBy ID) (Reconciliation, error) {
+	return ReconcileStatement(groupID, currency, lines, record, recordedBy)
+}
+func (Store) AddWebhook(w Webhook) (Webhook, error)      { return AddWebhook(w) }
+func (Store) ListWebhooks(groupID ID) ([]Webhook, error) { return ListWebhooks(groupID) }
+func (Store) DelWebhook(groupID ID, id ID) error         { return DelWebhook(groupID, id) }
+func (Store) ListWebhookDeliveries(groupID ID, webhookID ID, status WebhookDeliveryStatus, page PageRequest) (WebhookDeliveryList, error) {
+	return ListWebhookDeliveries(groupID, webhookID, status, page)
+}
+func (Store) ListOutboundMessages(ref string, addr string, limit int) ([]OutboundMessage, error) {
+	return ListOutboundMessages(ref, addr, limit)
+}
+func (Store) BounceOutboundMessage(messageID string, addr string, reason string) (OutboundMessage, error) {
+	return BounceOutboundMessage(messageID, addr, reason)
+}
+func (Store) Search(userID ID, q search.Query) (search.Result, error) { return Search(userID, q) }
+func (Store) Ping(ctx context.Context) error                          { return Ping(ctx) }
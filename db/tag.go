@@ -0,0 +1,524 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-msvc/errors"
+	"github.com/google/uuid"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/model"
+	"github.com/jmoiron/sqlx"
+)
+
+//TagList is the names of the tags of a request
+//In JSON it is a list, but a comma separated string is also accepted, e.g. "baking, cake tins"
+//In the `requests` table it is a copy of the names as "|<tag>|<tag>|" for the FULLTEXT index,
+//while `request_tags` links the request to the tags of its group.
+type TagList []string
+
+const (
+	maxTagLength = 50
+	maxTags      = 10 //per request, so the copy in `requests`.`tags` fits in 600 characters
+)
+
+//ParseTags splits on commas (and on | used in the db), see TagList.normalise()
+func ParseTags(s string) TagList {
+	return TagList(strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '|' })).normalise()
+}
+
+//normalise trims the names and removes empty names and duplicates, ignoring case
+func (list TagList) normalise() TagList {
+	names := TagList{}
+	for _, name := range list {
+		name = strings.Join(strings.Fields(name), " ")
+		if name != "" && !names.Has(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+//Has is true if the list has the name, ignoring case
+func (list TagList) Has(name string) bool {
+	for _, n := range list {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+//Equal is true if both lists have the same names, ignoring case and order
+func (list TagList) Equal(other TagList) bool {
+	if len(list) != len(other) {
+		return false
+	}
+	for _, name := range other {
+		if !list.Has(name) {
+			return false
+		}
+	}
+	return true
+}
+
+func (list TagList) Validate() error {
+	if len(list) > maxTags {
+		return errors.Errorf("%d tags, maximum is %d", len(list), maxTags)
+	}
+	for _, name := range list {
+		if err := validTagName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validTagName(name string) error {
+	if name == "" || len([]rune(name)) > maxTagLength {
+		return errors.Errorf("tag \"%s\" must be 1..%d characters", name, maxTagLength)
+	}
+	if strings.ContainsAny(name, ",|") {
+		return errors.Errorf("tag \"%s\" may not contain ',' or '|'", name)
+	}
+	return nil
+}
+
+func (list TagList) MarshalJSON() ([]byte, error) {
+	if list == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]string(list))
+}
+
+func (list *TagList) UnmarshalJSON(value []byte) error {
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		*list = ParseTags(s)
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(value, &names); err != nil {
+		return errors.Errorf("tags must be a list of names or a comma separated string")
+	}
+	*list = TagList(names).normalise()
+	return nil
+}
+
+//Scan the copy of the names in the `requests` table
+func (list *TagList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*list = TagList{}
+	case []byte:
+		*list = ParseTags(string(v))
+	case string:
+		*list = ParseTags(v)
+	default:
+		return errors.Errorf("cannot scan %T into tags", value)
+	}
+	return nil
+}
+
+//Tag is in the vocabulary of a group, shared by the requests in the group
+type Tag struct {
+	ID          ID      `json:"id" db:"id"`
+	GroupID     ID      `json:"group_id" db:"group_id"`
+	Name        string  `json:"name" db:"name"`
+	Colour      string  `json:"colour" db:"colour" doc:"Colour to show the tag in, as \"#rrggbb\" (default none)"`
+	Description *string `json:"description" db:"description"`
+	Requests    int     `json:"requests" db:"requests" doc:"Nr of requests with this tag"`
+}
+
+var colourPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+func (t *Tag) Validate() error {
+	if t.GroupID == "" {
+		return apierr.Invalid("group_id", "missing group_id")
+	}
+	t.Name = strings.Join(strings.Fields(t.Name), " ")
+	if err := validTagName(t.Name); err != nil {
+		return apierr.Invalid("name", "%s", err)
+	}
+	if t.Colour != "" && !colourPattern.MatchString(t.Colour) {
+		return apierr.Invalid("colour", "colour \"%s\" must be like \"#e8a33d\"", t.Colour)
+	}
+	if t.Description != nil {
+		*t.Description = strings.TrimSpace(*t.Description)
+		if *t.Description == "" {
+			t.Description = nil
+		}
+	}
+	return nil
+}
+
+const tagColumns = "t.`id`,t.`group_id`,t.`name`,t.`colour`,t.`description`," +
+	"(SELECT COUNT(*) FROM `request_tags` AS rt WHERE rt.`tag_id`=t.`id`) AS `requests`"
+
+func AddTag(t Tag) (Tag, error) {
+	if err := t.Validate(); err != nil {
+		return Tag{}, err
+	}
+	id := uuid.New().String()
+	if _, err := db.Exec("INSERT INTO `tags` SET `id`=?,`group_id`=?,`name`=?,`colour`=?,`description`=?",
+		id,
+		t.GroupID,
+		t.Name,
+		t.Colour,
+		t.Description,
+	); err != nil {
+		return Tag{}, errors.Wrapf(err, "failed to add tag(%s)", t.Name)
+	}
+	t.ID = ID(id)
+	t.Requests = 0
+	return t, nil
+}
+
+func GetTag(id ID) (Tag, error) {
+	var t Tag
+	if err := db.Get(&t, "SELECT "+tagColumns+" FROM `tags` AS t WHERE t.`id`=?", id); err != nil {
+		if err == sql.ErrNoRows {
+			return Tag{}, apierr.Errorf(apierr.NotFound, "unknown tag(id=%s)", id)
+		}
+		return Tag{}, errors.Wrapf(err, "failed to get tag(id=%s)", id)
+	}
+	return t, nil
+}
+
+//ListTags returns the tags of the group, most used first,
+//with prefix to autocomplete the name or any word in it
+func ListTags(groupID ID, prefix string, limit int) ([]Tag, error) {
+	if limit < 1 {
+		limit = 10
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	query := "SELECT " + tagColumns + " FROM `tags` AS t WHERE t.`group_id`=?"
+	args := []interface{}{groupID}
+	if prefix = strings.TrimSpace(prefix); prefix != "" {
+		like := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix) + "%"
+		query += " AND (t.`name` LIKE ? OR t.`name` LIKE ?)"
+		args = append(args, like, "% "+like)
+	}
+	query += " ORDER BY `requests` DESC,t.`name` LIMIT ?"
+	args = append(args, limit)
+	tags := []Tag{}
+	if err := db.Select(&tags, query, args...); err != nil {
+		return nil, errors.Wrapf(err, "failed to list group(id=%s) tags", groupID)
+	}
+	return tags, nil
+}
+
+type UpdTagRequest struct {
+	ID          ID      `json:"id"`
+	Name        *string `json:"name,omitempty" doc:"Rename the tag on all its requests"`
+	Colour      *string `json:"colour,omitempty"`
+	Description *string `json:"description,omitempty"`
+}
+
+//UpdTag changes the tag, but cannot rename it to another tag of the group,
+//which must be done with MergeTags()
+func UpdTag(req UpdTagRequest) (Tag, error) {
+	t, err := GetTag(req.ID)
+	if err != nil {
+		return Tag{}, err
+	}
+	oldName := t.Name
+	if req.Name != nil {
+		t.Name = *req.Name
+	}
+	if req.Colour != nil {
+		t.Colour = *req.Colour
+	}
+	if req.Description != nil {
+		t.Description = req.Description
+	}
+	if err := t.Validate(); err != nil {
+		return Tag{}, err
+	}
+	if !strings.EqualFold(t.Name, oldName) {
+		var otherID ID
+		if err := db.Get(&otherID, "SELECT `id` FROM `tags` WHERE `group_id`=? AND `name`=?", t.GroupID, t.Name); err == nil {
+			return Tag{}, apierr.Errorf(apierr.Conflict, "tag \"%s\" already exists, merge into it instead", t.Name)
+		} else if err != sql.ErrNoRows {
+			return Tag{}, errors.Wrapf(err, "failed to check tag name")
+		}
+	}
+	//the copies of the name in the requests change in the same transaction
+	tx, err := db.Beginx()
+	if err != nil {
+		return Tag{}, errors.Wrapf(err, "failed to start transaction")
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("UPDATE `tags` SET `name`=?,`colour`=?,`description`=? WHERE `id`=?",
+		t.Name,
+		t.Colour,
+		t.Description,
+		t.ID,
+	); err != nil {
+		return Tag{}, errors.Wrapf(err, "failed to update tag(id=%s)", t.ID)
+	}
+	if t.Name != oldName {
+		requestIDs, err := tagRequestIDs(tx, t.ID)
+		if err != nil {
+			return Tag{}, err
+		}
+		if err := updateTagCopies(tx, requestIDs); err != nil {
+			return Tag{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Tag{}, errors.Wrapf(err, "failed to update tag(id=%s)", t.ID)
+	}
+	return t, nil
+} //UpdTag()
+
+//MergeTags moves the requests of tag fromID to tag intoID in the same group
+//and deletes tag fromID, e.g. to merge "bake" into "baking"
+func MergeTags(fromID ID, intoID ID) (Tag, error) {
+	from, err := GetTag(fromID)
+	if err != nil {
+		return Tag{}, err
+	}
+	into, err := GetTag(intoID)
+	if err != nil {
+		return Tag{}, err
+	}
+	if from.GroupID != into.GroupID {
+		return Tag{}, apierr.Errorf(apierr.ValidationFailed, "cannot merge tags of different groups")
+	}
+	if from.ID == into.ID {
+		return Tag{}, apierr.Errorf(apierr.ValidationFailed, "cannot merge a tag into itself")
+	}
+	tx, err := db.Beginx()
+	if err != nil {
+		return Tag{}, errors.Wrapf(err, "failed to start transaction")
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("INSERT IGNORE INTO `request_tags` (`request_id`,`tag_id`) SELECT `request_id`,? FROM `request_tags` WHERE `tag_id`=?",
+		into.ID,
+		from.ID,
+	); err != nil {
+		return Tag{}, errors.Wrapf(err, "failed to merge tag requests")
+	}
+	if err := delTag(tx, from.ID); err != nil {
+		return Tag{}, err
+	}
+	requestIDs, err := tagRequestIDs(tx, into.ID)
+	if err != nil {
+		return Tag{}, err
+	}
+	if err := updateTagCopies(tx, requestIDs); err != nil {
+		return Tag{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Tag{}, errors.Wrapf(err, "failed to merge tags")
+	}
+	return GetTag(into.ID)
+} //MergeTags()
+
+//DelTag removes the tag from its requests and from the group
+func DelTag(id ID) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return errors.Wrapf(err, "failed to start transaction")
+	}
+	defer tx.Rollback()
+	if err := delTag(tx, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return errors.Wrapf(err, "failed to delete tag(id=%s)", id)
+	}
+	return nil
+}
+
+//delTag deletes the tag and updates the copies of the names in its requests in the transaction
+func delTag(tx *sqlx.Tx, id ID) error {
+	requestIDs, err := tagRequestIDs(tx, id)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM `request_tags` WHERE `tag_id`=?", id); err != nil {
+		return errors.Wrapf(err, "failed to delete tag(id=%s) from requests", id)
+	}
+	if _, err := tx.Exec("DELETE FROM `tags` WHERE `id`=?", id); err != nil {
+		return errors.Wrapf(err, "failed to delete tag(id=%s)", id)
+	}
+	return updateTagCopies(tx, requestIDs)
+}
+
+func tagRequestIDs(q sqlx.Queryer, tagID ID) ([]ID, error) {
+	var requestIDs []ID
+	if err := sqlx.Select(q, &requestIDs, "SELECT `request_id` FROM `request_tags` WHERE `tag_id`=?", tagID); err != nil {
+		return nil, errors.Wrapf(err, "failed to get requests of tag(id=%s)", tagID)
+	}
+	return requestIDs, nil
+}
+
+//setRequestTags links the request to the tags with its names,
+//adding names that are not yet in the vocabulary of the group
+func setRequestTags(r Request) error {
+	for _, name := range r.Tags {
+		if _, err := db.Exec("INSERT IGNORE INTO `tags` SET `id`=?,`group_id`=?,`name`=?", uuid.New().String(), r.GroupID, name); err != nil {
+			return errors.Wrapf(err, "failed to add tag(%s)", name)
+		}
+	}
+	if _, err := db.Exec("DELETE FROM `request_tags` WHERE `request_id`=?", r.ID); err != nil {
+		return errors.Wrapf(err, "failed to delete request(id=%s) tags", r.ID)
+	}
+	if len(r.Tags) > 0 {
+		query, args, err := sqlx.In("INSERT INTO `request_tags` (`request_id`,`tag_id`) SELECT ?,`id` FROM `tags` WHERE `group_id`=? AND `name` IN (?)",
+			r.ID, r.GroupID, []string(r.Tags))
+		if err != nil {
+			return errors.Wrapf(err, "failed to make request tags query")
+		}
+		if _, err := db.Exec(query, args...); err != nil {
+			return errors.Wrapf(err, "failed to add request(id=%s) tags", r.ID)
+		}
+	}
+	return updateTagCopies(db, []ID{r.ID})
+} //setRequestTags()
+
+//updateTagCopies writes the names of the tags into `requests`.`tags`
+func updateTagCopies(e sqlx.Execer, requestIDs []ID) error {
+	if len(requestIDs) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In("UPDATE `requests` AS r SET r.`tags`=("+
+		"SELECT CONCAT('|',GROUP_CONCAT(t.`name` ORDER BY t.`name` SEPARATOR '|'),'|')"+
+		" FROM `request_tags` AS rt JOIN `tags` AS t ON rt.`tag_id`=t.`id` WHERE rt.`request_id`=r.`id`)"+
+		" WHERE r.`id` IN (?)",
+		requestIDs)
+	if err != nil {
+		return errors.Wrapf(err, "failed to make request tags query")
+	}
+	if _, err := e.Exec(query, args...); err != nil {
+		return errors.Wrapf(err, "failed to update request tags")
+	}
+	return nil
+}
+
+//MigrateTags links existing requests to tags, from the names in `requests`.`tags`,
+//for requests created before the `tags` and `request_tags` tables were added
+//It returns the nr of requests migrated and can safely be run again.
+func MigrateTags() (int, error) {
+	var requests []Request
+	if err := db.Select(&requests, "SELECT r.`id`,r.`group_id`,r.`tags` FROM `requests` AS r"+
+		" WHERE r.`tags` IS NOT NULL AND r.`tags`<>''"+
+		" AND NOT EXISTS (SELECT 1 FROM `request_tags` AS rt WHERE rt.`request_id`=r.`id`)"); err != nil {
+		return 0, errors.Wrapf(err, "failed to get requests to migrate")
+	}
+	for i, r := range requests {
+		if err := r.Tags.Validate(); err != nil {
+			return i, errors.Wrapf(err, "invalid tags on request(id=%s)", r.ID)
+		}
+		if err := setRequestTags(r); err != nil {
+			return i, err
+		}
+	}
+	return len(requests), nil
+}
+
+//TagStats are the totals of the requests with a tag in one unit,
+//so a tag has more stats when its requests have different units
+type TagStats struct {
+	TagID     ID         `json:"tag_id"`
+	Name      string     `json:"name"`
+	Colour    string     `json:"colour"`
+	Unit      model.Unit `json:"unit" doc:"Unit of the quantities, or currency of money amounts in minor units, empty when the tag has no requests"`
+	Requests  int        `json:"requests" doc:"Nr of requests"`
+	Requested float64    `json:"requested" doc:"Total quantity requested"`
+	Promised  float64    `json:"promised" doc:"Total quantity promised"`
+	Received  float64    `json:"received" doc:"Total quantity received"`
+}
+
+//GetTagStats totals the requests of each tag in the group, sorted by name and unit
+func GetTagStats(groupID ID) ([]TagStats, error) {
+	var rows []struct {
+		TagID     ID             `db:"tag_id"`
+		Name      string         `db:"name"`
+		Colour    string         `db:"colour"`
+		RequestID *ID            `db:"request_id"`
+		Type      RequestType    `db:"type"`
+		Currency  model.Currency `db:"currency"`
+		Units     *string        `db:"units"`
+		Qty       int            `db:"qty"`
+		Promised  int            `db:"promised"`
+	}
+	if err := db.Select(&rows, "SELECT t.`id` AS `tag_id`,t.`name`,t.`colour`,r.`id` AS `request_id`,COALESCE(r.`type`,'') AS `type`,COALESCE(r.`currency`,'') AS `currency`,r.`units`,COALESCE(r.`qty`,0) AS `qty`,"+
+		"COALESCE((SELECT SUM(p.`qty`) FROM `promises` AS p WHERE p.`request_id`=r.`id` AND p.`status` NOT IN (?,?)),0) AS `promised`"+
+		" FROM `tags` AS t"+
+		" LEFT JOIN `request_tags` AS rt ON rt.`tag_id`=t.`id`"+
+		" LEFT JOIN `requests` AS r ON r.`id`=rt.`request_id`"+
+		" WHERE t.`group_id`=?",
+		PromiseStatusWithdrawn,
+		PromiseStatusWaitlisted,
+		groupID,
+	); err != nil {
+		return nil, errors.Wrapf(err, "failed to get group(id=%s) tag requests", groupID)
+	}
+
+	//donations may be received in other compatible units, and money as payments
+	var received []struct {
+		RequestID ID     `db:"request_id"`
+		Unit      string `db:"unit"`
+		Qty       int    `db:"qty"`
+	}
+	if err := db.Select(&received, "SELECT `request_id`,`unit`,SUM(`qty`) AS `qty` FROM `receives`"+
+		" WHERE `request_id` IN (SELECT rt.`request_id` FROM `request_tags` AS rt JOIN `tags` AS t ON rt.`tag_id`=t.`id` WHERE t.`group_id`=?)"+
+		" GROUP BY `request_id`,`unit`"+
+		" UNION ALL"+
+		" SELECT `request_id`,`currency`,SUM(`amount`) FROM `payments`"+
+		" WHERE `request_id` IN (SELECT rt.`request_id` FROM `request_tags` AS rt JOIN `tags` AS t ON rt.`tag_id`=t.`id` WHERE t.`group_id`=?)"+
+		" GROUP BY `request_id`,`currency`",
+		groupID,
+		groupID,
+	); err != nil {
+		return nil, errors.Wrapf(err, "failed to get group(id=%s) tag received totals", groupID)
+	}
+	receivedByRequest := map[ID][]model.Quantity{}
+	for _, rcv := range received {
+		receivedByRequest[rcv.RequestID] = append(receivedByRequest[rcv.RequestID], model.Quantity{Qty: float64(rcv.Qty), Unit: model.Unit(rcv.Unit)})
+	}
+
+	statsByKey := map[string]*TagStats{}
+	for _, row := range rows {
+		unit := model.Unit("")
+		if row.RequestID != nil {
+			unit = Request{Type: row.Type, Currency: row.Currency, Units: row.Units}.Unit()
+		}
+		key := string(row.TagID) + "|" + string(unit)
+		stats, ok := statsByKey[key]
+		if !ok {
+			stats = &TagStats{TagID: row.TagID, Name: row.Name, Colour: row.Colour, Unit: unit}
+			statsByKey[key] = stats
+		}
+		if row.RequestID == nil {
+			continue
+		}
+		receivedQty, err := model.Sum(unit, receivedByRequest[*row.RequestID]...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot total request(id=%s) received quantities", *row.RequestID)
+		}
+		stats.Requests++
+		stats.Requested += float64(row.Qty)
+		stats.Promised += float64(row.Promised)
+		stats.Received += receivedQty
+	}
+	list := []TagStats{}
+	for _, stats := range statsByKey {
+		list = append(list, *stats)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Unit < list[j].Unit
+	})
+	return list, nil
+} //GetTagStats()
@@ -0,0 +1,113 @@
+package db_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jansemmelink/don8/db"
+)
+
+func TestTagList(t *testing.T) {
+	for s, expected := range map[string]db.TagList{
+		"baking, cake tins":             {"baking", "cake tins"},
+		"|baking|food|":                 {"baking", "food"},
+		" Baked   goods ,baked goods,,": {"Baked goods"},
+		"":                              {},
+	} {
+		if tags := db.ParseTags(s); !reflect.DeepEqual(tags, expected) {
+			t.Errorf("ParseTags(%q)=%q, expected %q", s, tags, expected)
+		}
+	}
+
+	var r db.Request
+	if err := json.Unmarshal([]byte(`{"tags":["Cake tins"," cake  TINS","drinks"]}`), &r); err != nil || !reflect.DeepEqual(r.Tags, db.TagList{"Cake tins", "drinks"}) {
+		t.Errorf("list: %q %+v", r.Tags, err)
+	}
+	if err := json.Unmarshal([]byte(`{"tags":"Cake tins,drinks"}`), &r); err != nil || !reflect.DeepEqual(r.Tags, db.TagList{"Cake tins", "drinks"}) {
+		t.Errorf("string: %q %+v", r.Tags, err)
+	}
+	if err := json.Unmarshal([]byte(`{"tags":12}`), &r); err == nil {
+		t.Errorf("number accepted as tags")
+	}
+	if jsonValue, _ := json.Marshal(db.Request{}); !reflect.DeepEqual(jsonValue, []byte(`{"id":"","group_id":"","title":"","description":null,"tags":[],"type":"","units":null,"qty":0,"status":"","priority":0}`)) {
+		t.Errorf("json: %s", jsonValue)
+	}
+
+	if !db.ParseTags("a,B").Equal(db.TagList{"b", "A"}) || db.ParseTags("a,b").Equal(db.TagList{"a"}) {
+		t.Errorf("Equal() failed")
+	}
+	for _, invalid := range []db.TagList{
+		{"a|b"},
+		{"a,b"},
+		{"a very long tag name with more than fifty characters"},
+		{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("invalid tags %q accepted", invalid)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	requireDB(t)
+	u, err := db.AddUser(db.User{Name: "Tagger", Phone: "0821111113", Email: "tagger@b.c"})
+	if err != nil {
+		t.Fatalf("failed to create user: %+v", err)
+	}
+	defer db.DelUser(u.ID)
+	g, err := db.AddGroup(u, db.NewGroup{Title: "Tag test", UserRole: "Organiser"})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelGroup(g.ID)
+	flour, err := db.AddRequest(db.Request{GroupID: g.ID, Title: "Flour", Tags: db.ParseTags("Baked goods,food"), Qty: 10})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelRequest(flour.ID)
+	cake, err := db.AddRequest(db.Request{GroupID: g.ID, Title: "Cake", Tags: db.ParseTags("bake"), Qty: 2})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelRequest(cake.ID)
+
+	tags, err := db.ListTags(g.ID, "goo", 10)
+	if err != nil || len(tags) != 1 || tags[0].Name != "Baked goods" || tags[0].Requests != 1 {
+		t.Fatalf("autocomplete: %+v %+v", tags, err)
+	}
+	bakedGoods := tags[0]
+	tags, _ = db.ListTags(g.ID, "bake", 10)
+	if len(tags) != 2 {
+		t.Fatalf("autocomplete bake: %+v", tags)
+	}
+	bake := tags[0]
+	if bake.Name != "bake" {
+		bake = tags[1]
+	}
+
+	list, err := db.FindRequests(g.ID, db.RequestFilter{Tags: []string{"baked goods"}}, db.PageRequest{})
+	if err != nil || list.Total != 1 || list.Requests[0].ID != flour.ID {
+		t.Fatalf("find: %+v %+v", list, err)
+	}
+
+	name := "Baking"
+	if _, err := db.UpdTag(db.UpdTagRequest{ID: bakedGoods.ID, Name: &name}); err != nil {
+		t.Fatalf("rename: %+v", err)
+	}
+	if r, _ := db.GetRequest(flour.ID); !r.Tags.Equal(db.TagList{"Baking", "food"}) {
+		t.Fatalf("renamed tags: %q", r.Tags)
+	}
+	merged, err := db.MergeTags(bake.ID, bakedGoods.ID)
+	if err != nil || merged.Requests != 2 {
+		t.Fatalf("merge: %+v %+v", merged, err)
+	}
+	if r, _ := db.GetRequest(cake.ID); !r.Tags.Equal(db.TagList{"Baking"}) {
+		t.Fatalf("merged tags: %q", r.Tags)
+	}
+
+	stats, err := db.GetTagStats(g.ID)
+	if err != nil || len(stats) != 2 || stats[0].Name != "Baking" || stats[0].Requests != 2 || stats[0].Requested != 12 {
+		t.Fatalf("stats: %+v %+v", stats, err)
+	}
+}
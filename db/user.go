@@ -4,23 +4,24 @@ import (
 	"crypto/sha1"
 	"fmt"
 	"net/http"
-	"os"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/go-msvc/errors"
 	"github.com/google/uuid"
+	"github.com/jansemmelink/don8/apierr"
 )
 
 type User struct {
-	ID      ID       `json:"id"`
-	Name    string   `json:"name" doc:"User name and surname used when members contact the donar, or when user is represents a user as a member."`
-	Phone   string   `json:"phone" doc:"Phone must have 0 + 9 digits"`
-	Email   string   `json:"email" doc:"Email address"`
-	PwdHash *string  `json:"pwd_hash,omitempty" db:"pwd_hash,omitempty"`
-	Tpw     *string  `json:"tpw,omitempty" db:"tpw,omitempty"`
-	TpwExp  *SqlTime `json:"tpw_exp,omitempty" db:"tpw_exp,omitempty"`
+	ID       ID       `json:"id"`
+	Name     string   `json:"name" doc:"User name and surname used when members contact the donar, or when user is represents a user as a member."`
+	Phone    string   `json:"phone" doc:"Phone must have 0 + 9 digits"`
+	Email    string   `json:"email" doc:"Email address"`
+	PwdHash  *string  `json:"pwd_hash,omitempty" db:"pwd_hash,omitempty"`
+	Tpw      *string  `json:"tpw,omitempty" db:"tpw,omitempty"`
+	TpwExp   *SqlTime `json:"tpw_exp,omitempty" db:"tpw_exp,omitempty"`
+	Disabled bool     `json:"disabled,omitempty" db:"disabled" doc:"Disabled users cannot login or reset their password"`
 }
 
 const phonePattern = "0[0-9]{9}"
@@ -30,15 +31,15 @@ var phoneRegex = regexp.MustCompile("^" + phonePattern + "$")
 func (u *User) Validate() error {
 	u.Name = strings.TrimSpace(u.Name)
 	if u.Name == "" {
-		return errors.Errorf("invalid name \"%s\"", u.Name)
+		return apierr.Invalid("name", "invalid name \"%s\"", u.Name)
 	}
 	var err error
 	if u.Phone, err = nationalPhone(u.Phone); err != nil {
-		return err
+		return apierr.Invalid("phone", "%s", err)
 	}
 	u.Email = strings.TrimSpace(u.Email) //not pattern checked... will send message to it to verify
 	if u.Email == "" {
-		return errors.Errorf("missing email")
+		return apierr.Invalid("email", "missing email")
 	}
 	return nil
 }
@@ -83,7 +84,7 @@ func AddUser(newUser User) (User, error) {
 	{
 		tpw := uuid.New().String()
 		newUser.Tpw = &tpw
-		tpwExp := SqlTime(time.Now().Add(time.Hour * 24))
+		tpwExp := SqlTime(time.Now().Add(activationLifetime))
 		newUser.TpwExp = &tpwExp
 	}
 	_, err := db.Exec(
@@ -108,10 +109,10 @@ type ActivateRequest struct {
 
 func (req ActivateRequest) Validate() error {
 	if req.Tpw == "" {
-		return errors.Errorf("missing tpw")
+		return apierr.Invalid("tpw", "missing tpw")
 	}
 	if req.Pwd == "" {
-		return errors.Errorf("missing pwd")
+		return apierr.Invalid("pwd", "missing pwd")
 	}
 	return nil
 }
@@ -122,21 +123,22 @@ func Activate(req ActivateRequest) (Session, error) {
 	}
 	var user User
 	if err := db.Get(&user, "SELECT `id`,`name`,`email`,`phone`,`tpw_exp` FROM `users` WHERE `tpw`=?", req.Tpw); err != nil {
-		log.Errorf("failed to get user(tpw:%s) for activation: %+v", req.Tpw, err)
+		log.Errorf("failed to get user by tpw for activation: %+v", err)
 		return Session{}, errors.Errorc(http.StatusNotFound, "failed to activate")
 	}
 	if user.TpwExp == nil {
 		return Session{}, errors.Errorc(http.StatusInternalServerError, "tpw_exp not set") //found tpw, so tpw_exp must be set!
 	}
 	if time.Time(*user.TpwExp).Before(time.Now()) {
-		log.Errorf("user(tpw:%s,id:%s) tpw expired at %s", req.Tpw, user.ID, *user.TpwExp)
+		log.Errorf("user(id:%s) tpw expired at %s", user.ID, *user.TpwExp)
 		return Session{}, errors.Errorc(http.StatusUnauthorized, "activation link expired")
 	}
 
 	passwordHash := HashPassword(user.Email, req.Pwd)
 	if _, err := db.Exec(
-		"UPDATE `users` SET `tpw`=null,`tpw_exp`=null,`pwd_hash`=?",
+		"UPDATE `users` SET `tpw`=null,`tpw_exp`=null,`pwd_hash`=? WHERE `id`=?",
 		passwordHash,
+		user.ID,
 	); err != nil {
 		log.Errorf("failed to set password: %+v", err)
 		return Session{}, errors.Errorc(http.StatusInternalServerError, "failed to set password")
@@ -156,7 +158,7 @@ type ResetRequest struct {
 
 func (req ResetRequest) Validate() error {
 	if req.Email == "" {
-		return errors.Errorf("missing email")
+		return apierr.Invalid("email", "missing email")
 	}
 	return nil
 }
@@ -166,10 +168,13 @@ func Reset(req ResetRequest) (User, error) {
 	if err != nil {
 		return User{}, err
 	}
+	if user.Disabled {
+		return User{}, apierr.Errorf(apierr.Forbidden, "account disabled")
+	}
 	{
 		tpw := uuid.New().String()
 		user.Tpw = &tpw
-		tpwExp := SqlTime(time.Now().Add(time.Hour * 24))
+		tpwExp := SqlTime(time.Now().Add(activationLifetime))
 		user.TpwExp = &tpwExp
 	}
 	if _, err := db.Exec(
@@ -178,7 +183,7 @@ func Reset(req ResetRequest) (User, error) {
 		user.TpwExp,
 		user.ID,
 	); err != nil {
-		log.Errorf("failed to reset user(%+v): %+v", user, err)
+		log.Errorf("failed to reset user(id:%s): %+v", user.ID, err)
 		return User{}, errors.Errorf("failed to reset user")
 	}
 	return user, nil
@@ -205,7 +210,7 @@ func FindUsers(filter string, limit int) ([]User, error) {
 func GetUser(id ID) (User, error) {
 	var u User
 	if err := db.Get(&u,
-		"SELECT `id`,`name`,`phone`,`email`,`pwd_hash`,`tpw`,`tpw_exp` FROM `users` WHERE id=?",
+		"SELECT `id`,`name`,`phone`,`email`,`pwd_hash`,`tpw`,`tpw_exp`,`disabled` FROM `users` WHERE id=?",
 		id,
 	); err != nil {
 		return User{}, errors.Wrapf(err, "failed to get user(id=%s)", id)
@@ -216,7 +221,7 @@ func GetUser(id ID) (User, error) {
 func GetUserByTpw(tpw ID) (User, error) {
 	var u User
 	if err := db.Get(&u,
-		"SELECT `id`,`name`,`phone`,`email`,`pwd_hash`,`tpw`,`tpw_exp` FROM `users` WHERE tpw=?",
+		"SELECT `id`,`name`,`phone`,`email`,`pwd_hash`,`tpw`,`tpw_exp`,`disabled` FROM `users` WHERE tpw=?",
 		tpw,
 	); err != nil {
 		return User{}, errors.Wrapf(err, "failed to get user(id=%s)", tpw)
@@ -232,7 +237,7 @@ func GetUserByPhone(phone string) (User, error) {
 	}
 	var u User
 	if err := db.Get(&u,
-		"SELECT `id`,`name`,`phone`,`email`,`pwd_hash`,`tpw`,`tpw_exp` FROM `users` WHERE phone=?",
+		"SELECT `id`,`name`,`phone`,`email`,`pwd_hash`,`tpw`,`tpw_exp`,`disabled` FROM `users` WHERE phone=?",
 		phone,
 	); err != nil {
 		return User{}, errors.Wrapf(err, "failed to get user(phone=%s)", phone)
@@ -243,7 +248,7 @@ func GetUserByPhone(phone string) (User, error) {
 func GetUserByEmail(email string) (User, error) {
 	var u User
 	if err := db.Get(&u,
-		"SELECT `id`,`name`,`phone`,`email`,`pwd_hash`,`tpw`,`tpw_exp` FROM `users` WHERE email=?",
+		"SELECT `id`,`name`,`phone`,`email`,`pwd_hash`,`tpw`,`tpw_exp`,`disabled` FROM `users` WHERE email=?",
 		email,
 	); err != nil {
 		return User{}, errors.Wrapf(err, "failed to get user(email=%s)", email)
@@ -251,6 +256,24 @@ func GetUserByEmail(email string) (User, error) {
 	return u, nil
 } //GetUserByEmail()
 
+//DisableUser ends the user's session and prevents login and password reset
+func DisableUser(id ID) error {
+	result, err := db.Exec("UPDATE `users` SET `disabled`=1,`tpw`=null,`tpw_exp`=null WHERE `id`=?", id)
+	if err != nil {
+		return errors.Wrapf(err, "failed to disable user(id=%s)", id)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		if _, err := GetUser(id); err != nil {
+			return apierr.Wrapf(err, apierr.NotFound, "user(id=%s) not found", id)
+		}
+		//already disabled
+	}
+	if _, err := db.Exec("DELETE FROM `sessions` WHERE `user_id`=?", id); err != nil {
+		return errors.Wrapf(err, "failed to delete user(id=%s) sessions", id)
+	}
+	return nil
+} //DisableUser()
+
 func DelUser(id ID) error {
 	if _, err := db.Exec("DELETE FROM `users` WHERE id=?", id); err != nil {
 		return errors.Wrapf(err, "failed to delete user(id=%s)", id)
@@ -274,10 +297,12 @@ func (u User) Compare(uu User) error {
 	return nil
 }
 
-var salt = "naephiesha9odahX5reewoutaico3oop" //default that can be changed with env var PASSWORD_SALT
+var salt = "naephiesha9odahX5reewoutaico3oop" //default that can be changed with SetPasswordSalt()
 
-func init() {
-	if s := os.Getenv("PASSWORD_SALT"); s != "" {
+//SetPasswordSalt changes the salt used in password hashes
+//existing users cannot login after it changed, so set it once before the first user registers
+func SetPasswordSalt(s string) {
+	if s != "" {
 		salt = s
 	}
 }
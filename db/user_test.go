@@ -7,6 +7,7 @@ import (
 )
 
 func TestUsers(t *testing.T) {
+	requireDB(t)
 	//todo: nead to test in a clean db! consider using sqlite for testing
 	u1, err := db.AddUser(db.User{
 		Name:  "Jan Semmelink",
@@ -60,3 +61,43 @@ func TestUsers(t *testing.T) {
 		}
 	}
 }
+
+func TestActivate(t *testing.T) {
+	requireDB(t)
+	u1, err := db.AddUser(db.User{
+		Name:  "Activate One",
+		Phone: "0827770001",
+		Email: "activate.1@test.don8",
+	})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelUser(u1.ID)
+	u2, err := db.AddUser(db.User{
+		Name:  "Activate Two",
+		Phone: "0827770002",
+		Email: "activate.2@test.don8",
+	})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	defer db.DelUser(u2.ID)
+
+	s, err := db.Activate(db.ActivateRequest{Tpw: *u1.Tpw, Pwd: "Test-1234"})
+	if err != nil {
+		t.Fatalf("failed to activate u1: %+v", err)
+	}
+	defer db.Logout(s.ID)
+
+	if u, err := db.GetUser(u1.ID); err != nil {
+		t.Fatalf("failed to get u1: %+v", err)
+	} else if u.PwdHash == nil || u.Tpw != nil {
+		t.Fatalf("u1 not activated: %+v", u)
+	}
+	//activating u1 must not change the other users
+	if u, err := db.GetUser(u2.ID); err != nil {
+		t.Fatalf("failed to get u2: %+v", err)
+	} else if u.PwdHash != nil || u.Tpw == nil || *u.Tpw != *u2.Tpw {
+		t.Fatalf("u2 changed by activating u1: %+v", u)
+	}
+} //TestActivate()
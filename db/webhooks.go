@@ -0,0 +1,333 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/google/uuid"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/events"
+	"github.com/jansemmelink/don8/webhooks"
+)
+
+//WebhookEvents are the event types that can be sent to webhooks
+var WebhookEvents = []events.Type{
+	events.PromiseCreated,
+	events.PromiseUpdated,
+	events.PromiseWithdrawn,
+	events.DonationReceived,
+	events.PaymentReceived,
+	events.MemberJoined,
+	events.RequestUpdated,
+	events.RequestMet,
+}
+
+type Webhook struct {
+	ID          ID            `json:"id" db:"id"`
+	GroupID     ID            `json:"group_id" db:"group_id"`
+	URL         string        `json:"url" db:"url" doc:"https URL that events are posted to"`
+	Events      []events.Type `json:"events" db:"-" doc:"Event types to post, e.g. [\"promise.created\",\"request.met\"]"`
+	Secret      string        `json:"secret,omitempty" db:"secret" doc:"Key of the HMAC-SHA256 Don8-Signature header, only returned when the webhook is added"`
+	TimeCreated SqlTime       `json:"time_created" db:"time_created"`
+}
+
+func (w *Webhook) Validate() error {
+	if w.GroupID == "" {
+		return apierr.Invalid("group_id", "missing group_id")
+	}
+	w.URL = strings.TrimSpace(w.URL)
+	if err := webhooks.CheckURL(w.URL); err != nil {
+		return apierr.Invalid("url", "%s", err)
+	}
+	if len(w.URL) > 255 {
+		return apierr.Invalid("url", "url is longer than 255 characters")
+	}
+	if len(w.Events) == 0 {
+		return apierr.Invalid("events", "missing events")
+	}
+	valid := map[events.Type]bool{}
+	names := make([]string, len(WebhookEvents))
+	for i, t := range WebhookEvents {
+		valid[t] = true
+		names[i] = string(t)
+	}
+	selected := map[events.Type]bool{}
+	list := []events.Type{}
+	for _, t := range w.Events {
+		if !valid[t] {
+			return apierr.Invalid("events", "invalid event \"%s\" expecting %s", t, strings.Join(names, "|"))
+		}
+		if !selected[t] {
+			selected[t] = true
+			list = append(list, t)
+		}
+	}
+	w.Events = list
+	return nil
+} //Webhook.Validate()
+
+//webhookRow stores the event types as comma separated list
+type webhookRow struct {
+	Webhook
+	Events string `db:"events"`
+}
+
+func (row webhookRow) webhook() Webhook {
+	w := row.Webhook
+	w.Events = []events.Type{}
+	for _, t := range strings.Split(row.Events, ",") {
+		if t != "" {
+			w.Events = append(w.Events, events.Type(t))
+		}
+	}
+	return w
+}
+
+const webhookColumns = "`id`,`group_id`,`url`,`events`,`secret`,`time_created`"
+
+//AddWebhook returns the webhook with its new secret
+func AddWebhook(w Webhook) (Webhook, error) {
+	if err := w.Validate(); err != nil {
+		return Webhook{}, err
+	}
+	var err error
+	if w.Secret, err = webhooks.NewSecret(); err != nil {
+		return Webhook{}, err
+	}
+	w.ID = ID(uuid.New().String())
+	w.TimeCreated = SqlTime(time.Now())
+	types := make([]string, len(w.Events))
+	for i, t := range w.Events {
+		types[i] = string(t)
+	}
+	if _, err := db.Exec("INSERT INTO `webhooks` SET `id`=?,`group_id`=?,`url`=?,`events`=?,`secret`=?,`time_created`=?",
+		w.ID,
+		w.GroupID,
+		w.URL,
+		strings.Join(types, ","),
+		w.Secret,
+		w.TimeCreated,
+	); err != nil {
+		return Webhook{}, errors.Wrapf(err, "failed to add webhook")
+	}
+	return w, nil
+} //AddWebhook()
+
+//ListWebhooks of a group without their secrets
+func ListWebhooks(groupID ID) ([]Webhook, error) {
+	var rows []webhookRow
+	if err := db.Select(&rows, "SELECT "+webhookColumns+" FROM `webhooks` WHERE `group_id`=? ORDER BY `time_created`", groupID); err != nil {
+		return nil, errors.Wrapf(err, "failed to list group(id=%s) webhooks", groupID)
+	}
+	list := make([]Webhook, len(rows))
+	for i, row := range rows {
+		list[i] = row.webhook()
+		list[i].Secret = ""
+	}
+	return list, nil
+}
+
+//GetWebhook returns nil if not found
+func GetWebhook(id ID) (*Webhook, error) {
+	var row webhookRow
+	if err := db.Get(&row, "SELECT "+webhookColumns+" FROM `webhooks` WHERE `id`=?", id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to get webhook(id=%s)", id)
+	}
+	w := row.webhook()
+	return &w, nil
+}
+
+//DelWebhook deletes the webhook and its delivery log
+func DelWebhook(groupID ID, id ID) error {
+	w, err := GetWebhook(id)
+	if err != nil {
+		return err
+	}
+	if w == nil || w.GroupID != groupID {
+		return apierr.Errorf(apierr.NotFound, "unknown webhook(id=%s)", id)
+	}
+	if _, err := db.Exec("DELETE FROM `webhook_deliveries` WHERE `webhook_id`=?", id); err != nil {
+		return errors.Wrapf(err, "failed to delete webhook(id=%s) deliveries", id)
+	}
+	if _, err := db.Exec("DELETE FROM `webhooks` WHERE `id`=?", id); err != nil {
+		return errors.Wrapf(err, "failed to delete webhook(id=%s)", id)
+	}
+	return nil
+} //DelWebhook()
+
+//ListEventWebhooks returns the webhooks, with secrets, that subscribed to the event
+func ListEventWebhooks(groupID ID, t events.Type) ([]Webhook, error) {
+	var rows []webhookRow
+	if err := db.Select(&rows, "SELECT "+webhookColumns+" FROM `webhooks` WHERE `group_id`=? AND FIND_IN_SET(?,`events`)>0", groupID, t); err != nil {
+		return nil, errors.Wrapf(err, "failed to list group(id=%s) webhooks for %s", groupID, t)
+	}
+	list := make([]Webhook, len(rows))
+	for i, row := range rows {
+		list[i] = row.webhook()
+	}
+	return list, nil
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+type WebhookDelivery struct {
+	ID             ID                    `json:"id" db:"id" doc:"Sent in the Don8-Delivery header"`
+	WebhookID      ID                    `json:"webhook_id" db:"webhook_id"`
+	EventID        string                `json:"event_id" db:"event_id"`
+	EventType      events.Type           `json:"event_type" db:"event_type"`
+	Status         WebhookDeliveryStatus `json:"status" db:"status" doc:"pending until delivered, or failed after all attempts"`
+	Attempts       int                   `json:"attempts" db:"attempts"`
+	NextAttempt    *SqlTime              `json:"next_attempt,omitempty" db:"next_attempt" doc:"When a pending delivery will be retried"`
+	ResponseStatus *int                  `json:"response_status,omitempty" db:"response_status" doc:"HTTP status of the last attempt"`
+	Error          *string               `json:"error,omitempty" db:"error" doc:"Error of the last attempt"`
+	TimeCreated    SqlTime               `json:"time_created" db:"time_created"`
+	TimeUpdated    SqlTime               `json:"time_updated" db:"time_updated"`
+}
+
+const webhookDeliveryColumns = "d.`id`,d.`webhook_id`,d.`event_id`,d.`event_type`,d.`status`,d.`attempts`,d.`next_attempt`,d.`response_status`,d.`error`,d.`time_created`,d.`time_updated`"
+
+//AddWebhookDelivery queues the event for the webhook to be sent now
+//it returns false when the event was already queued, e.g. by another worker
+func AddWebhookDelivery(webhookID ID, e events.Event, payload []byte) (bool, error) {
+	now := SqlTime(time.Now())
+	result, err := db.Exec("INSERT IGNORE INTO `webhook_deliveries` SET `id`=?,`webhook_id`=?,`event_id`=?,`event_type`=?,`payload`=?,`status`=?,`attempts`=0,`next_attempt`=?,`time_created`=?,`time_updated`=?",
+		uuid.New().String(),
+		webhookID,
+		e.ID,
+		e.Type,
+		string(payload),
+		WebhookDeliveryPending,
+		now,
+		now,
+		now,
+	)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to add webhook(id=%s) delivery of event(id=%s)", webhookID, e.ID)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to add webhook(id=%s) delivery of event(id=%s)", webhookID, e.ID)
+	}
+	return n == 1, nil
+} //AddWebhookDelivery()
+
+//DueWebhookDelivery has what the worker needs to post it
+type DueWebhookDelivery struct {
+	WebhookDelivery
+	URL     string `db:"url"`
+	Secret  string `db:"secret"`
+	Payload string `db:"payload"`
+}
+
+//ClaimDueWebhookDeliveries returns up to limit pending deliveries that are due,
+//each claimed for the lease duration so other workers skip them until the result is recorded
+func ClaimDueWebhookDeliveries(now time.Time, limit int, lease time.Duration) ([]DueWebhookDelivery, error) {
+	var due []DueWebhookDelivery
+	if err := db.Select(&due,
+		"SELECT "+webhookDeliveryColumns+",d.`payload`,w.`url`,w.`secret` FROM `webhook_deliveries` AS d"+
+			" JOIN `webhooks` AS w ON w.`id`=d.`webhook_id`"+
+			" WHERE d.`status`=? AND d.`next_attempt`<=? ORDER BY d.`next_attempt` LIMIT ?",
+		WebhookDeliveryPending,
+		SqlTime(now),
+		limit,
+	); err != nil {
+		return nil, errors.Wrapf(err, "failed to list due webhook deliveries")
+	}
+	claimed := []DueWebhookDelivery{}
+	for _, d := range due {
+		//claim only if no other worker changed it since we selected it
+		result, err := db.Exec("UPDATE `webhook_deliveries` SET `next_attempt`=? WHERE `id`=? AND `status`=? AND `attempts`=? AND `next_attempt`=?",
+			SqlTime(now.Add(lease)),
+			d.ID,
+			WebhookDeliveryPending,
+			d.Attempts,
+			d.NextAttempt,
+		)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to claim webhook delivery(id=%s)", d.ID)
+		}
+		if n, _ := result.RowsAffected(); n == 1 {
+			claimed = append(claimed, d)
+		}
+	}
+	return claimed, nil
+} //ClaimDueWebhookDeliveries()
+
+//RecordWebhookAttempt updates a delivery after an attempt to post it
+//deliveryErr is nil when delivered, else the delivery is retried at retryAt or failed when retryAt is nil
+func RecordWebhookAttempt(id ID, responseStatus int, deliveryErr error, retryAt *time.Time) error {
+	status := WebhookDeliveryDelivered
+	var nextAttempt *SqlTime
+	var errorText *string
+	if deliveryErr != nil {
+		status = WebhookDeliveryFailed
+		errorText = nullString(truncate(deliveryErr.Error(), 255))
+		if retryAt != nil {
+			status = WebhookDeliveryPending
+			t := SqlTime(*retryAt)
+			nextAttempt = &t
+		}
+	}
+	var responseStatusValue *int
+	if responseStatus > 0 {
+		responseStatusValue = &responseStatus
+	}
+	if _, err := db.Exec("UPDATE `webhook_deliveries` SET `status`=?,`attempts`=`attempts`+1,`next_attempt`=?,`response_status`=?,`error`=?,`time_updated`=? WHERE `id`=?",
+		status,
+		nextAttempt,
+		responseStatusValue,
+		errorText,
+		SqlTime(time.Now()),
+		id,
+	); err != nil {
+		return errors.Wrapf(err, "failed to update webhook delivery(id=%s)", id)
+	}
+	return nil
+} //RecordWebhookAttempt()
+
+//WebhookDeliveryList is one page of ListWebhookDeliveries()
+type WebhookDeliveryList struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	Page
+}
+
+var WebhookDeliverySort = SortFields{
+	Default: "-time",
+	Columns: map[string]string{
+		"time":   "d.`time_created`",
+		"status": "d.`status`",
+		"event":  "d.`event_type`",
+	},
+	ID: "d.`id`",
+}
+
+//ListWebhookDeliveries of all webhooks in the group, or only one webhook, optionally with a status
+func ListWebhookDeliveries(groupID ID, webhookID ID, status WebhookDeliveryStatus, page PageRequest) (WebhookDeliveryList, error) {
+	from := "FROM `webhook_deliveries` AS d JOIN `webhooks` AS w ON w.`id`=d.`webhook_id` WHERE w.`group_id`=?"
+	args := []interface{}{groupID}
+	if webhookID != "" {
+		from += " AND d.`webhook_id`=?"
+		args = append(args, webhookID)
+	}
+	if status != "" {
+		from += " AND d.`status`=?"
+		args = append(args, status)
+	}
+	list := WebhookDeliveryList{Deliveries: []WebhookDelivery{}}
+	var err error
+	if list.Page, err = selectPage(&list.Deliveries, webhookDeliveryColumns, from, args, page, WebhookDeliverySort); err != nil {
+		return WebhookDeliveryList{}, errors.Wrapf(err, "failed to list webhook deliveries")
+	}
+	return list, nil
+} //ListWebhookDeliveries()
@@ -0,0 +1,76 @@
+package emails
+
+//data expected by each of the templates
+
+//ActivateData for "activate"
+type ActivateData struct {
+	Name string
+	Link string
+}
+
+//ResetData for "reset"
+type ResetData struct {
+	Name string
+	Link string
+}
+
+//InvitationData for "invitation"
+type InvitationData struct {
+	GroupTitle string
+	JoinLink   string
+	BlockLink  string
+}
+
+//PromiseReminderData for "promise-reminder"
+type PromiseReminderData struct {
+	Name       string
+	GroupTitle string
+	Promised   string //e.g. "2 kg Boerewors"
+	Due        string
+	DueToday   bool
+}
+
+//OverdueDigestData for "overdue-digest"
+type OverdueDigestData struct {
+	GroupTitle string
+	Promises   []OverduePromise
+}
+
+type OverduePromise struct {
+	Due      string
+	Name     string
+	Phone    string
+	Promised string
+}
+
+//SampleData returns example data for the named template to preview it
+func SampleData(name string, groupTitle string) (interface{}, bool) {
+	switch name {
+	case "activate":
+		return ActivateData{Name: "Jan Semmelink", Link: "https://don8.com/activate/sample"}, true
+	case "reset":
+		return ResetData{Name: "Jan Semmelink", Link: "https://don8.com/reset/sample"}, true
+	case "invitation":
+		return InvitationData{
+			GroupTitle: groupTitle,
+			JoinLink:   "https://don8.com/invitation/sample",
+			BlockLink:  "https://don8.com/invitation/sample/block",
+		}, true
+	case "promise-reminder":
+		return PromiseReminderData{
+			Name:       "Jan Semmelink",
+			GroupTitle: groupTitle,
+			Promised:   "2 dozen Scones",
+			Due:        "2022-08-13",
+		}, true
+	case "overdue-digest":
+		return OverdueDigestData{
+			GroupTitle: groupTitle,
+			Promises: []OverduePromise{
+				{Due: "2022-08-12", Name: "Jan Semmelink", Phone: "0821111111", Promised: "2 dozen Scones"},
+				{Due: "2022-08-12", Name: "Koos", Phone: "0821234567", Promised: "5 kg Boerewors"},
+			},
+		}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,162 @@
+package emails
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/go-msvc/errors"
+	"github.com/stewelarend/logger"
+)
+
+var log = logger.New().WithLevel(logger.LevelDebug)
+
+//go:embed templates
+var templateFiles embed.FS
+
+//DefaultLocale is used when the requested locale has no templates
+const DefaultLocale = "en"
+
+//Branding of a message, usually from the group that sends it
+type Branding struct {
+	FromName  string `json:"from_name,omitempty" doc:"Name shown as sender of the email"`
+	LogoURL   string `json:"logo_url,omitempty" doc:"URL of logo image shown at the top of the email"`
+	Signature string `json:"signature,omitempty" doc:"Text shown at the bottom of the email"`
+}
+
+//Message is a rendered email with HTML and plain-text alternatives
+type Message struct {
+	Locale  string `json:"locale"`
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+type templateSet struct {
+	html *htmltemplate.Template //for "html" part
+	text *texttemplate.Template //for "subject" and "text" parts
+}
+
+//templates[locale][name]
+var templates = map[string]map[string]templateSet{}
+
+func init() {
+	layout, err := templateFiles.ReadFile("templates/layout.tmpl")
+	if err != nil {
+		panic(errors.Wrapf(err, "missing email layout"))
+	}
+	localeDirs, err := templateFiles.ReadDir("templates")
+	if err != nil {
+		panic(errors.Wrapf(err, "cannot read email templates"))
+	}
+	for _, localeDir := range localeDirs {
+		if !localeDir.IsDir() {
+			continue
+		}
+		locale := localeDir.Name()
+		files, err := templateFiles.ReadDir(path.Join("templates", locale))
+		if err != nil {
+			panic(errors.Wrapf(err, "cannot read email templates(%s)", locale))
+		}
+		templates[locale] = map[string]templateSet{}
+		for _, f := range files {
+			if !strings.HasSuffix(f.Name(), ".tmpl") {
+				continue
+			}
+			name := strings.TrimSuffix(f.Name(), ".tmpl")
+			content, err := templateFiles.ReadFile(path.Join("templates", locale, f.Name()))
+			if err != nil {
+				panic(errors.Wrapf(err, "cannot read email template(%s/%s)", locale, name))
+			}
+			set := templateSet{}
+			if set.html, err = htmltemplate.New(name).Parse(string(layout) + string(content)); err != nil {
+				panic(errors.Wrapf(err, "invalid email template(%s/%s)", locale, name))
+			}
+			if set.text, err = texttemplate.New(name).Parse(string(layout) + string(content)); err != nil {
+				panic(errors.Wrapf(err, "invalid email template(%s/%s)", locale, name))
+			}
+			templates[locale][name] = set
+		}
+	}
+} //init()
+
+//Locales returns the list of locales with templates
+func Locales() []string {
+	list := []string{}
+	for locale := range templates {
+		list = append(list, locale)
+	}
+	sort.Strings(list)
+	return list
+}
+
+//Names returns the list of template names in the default locale
+func Names() []string {
+	list := []string{}
+	for name := range templates[DefaultLocale] {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+//Locale returns a supported locale for the requested locale,
+//e.g. "af" for "af-ZA" and the default for unsupported locales
+func Locale(locale string) string {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if _, ok := templates[locale]; ok {
+		return locale
+	}
+	if i := strings.IndexAny(locale, "-_"); i > 0 {
+		if _, ok := templates[locale[:i]]; ok {
+			return locale[:i]
+		}
+	}
+	return DefaultLocale
+}
+
+//Render the named message in the locale with the branding
+//and data being the template specific data, e.g. InvitationData for "invitation"
+func Render(name string, locale string, branding Branding, data interface{}) (Message, error) {
+	msg := Message{Locale: Locale(locale)}
+	set, ok := templates[msg.Locale][name]
+	if !ok {
+		if set, ok = templates[DefaultLocale][name]; !ok {
+			return Message{}, errors.Errorf("unknown email template(%s)", name)
+		}
+		msg.Locale = DefaultLocale
+	}
+	if branding.FromName == "" {
+		branding.FromName = "Don8"
+	}
+	values := struct {
+		Branding Branding
+		Data     interface{}
+	}{
+		Branding: branding,
+		Data:     data,
+	}
+
+	buf := bytes.NewBuffer(nil)
+	if err := set.text.ExecuteTemplate(buf, "subject", values); err != nil {
+		return Message{}, errors.Wrapf(err, "failed to render %s/%s subject", msg.Locale, name)
+	}
+	msg.Subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	if err := set.html.ExecuteTemplate(buf, "html", values); err != nil {
+		return Message{}, errors.Wrapf(err, "failed to render %s/%s html", msg.Locale, name)
+	}
+	msg.HTML = buf.String()
+
+	buf.Reset()
+	if err := set.text.ExecuteTemplate(buf, "text", values); err != nil {
+		return Message{}, errors.Wrapf(err, "failed to render %s/%s text", msg.Locale, name)
+	}
+	msg.Text = buf.String()
+	return msg, nil
+} //Render()
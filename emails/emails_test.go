@@ -0,0 +1,71 @@
+package emails_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jansemmelink/don8/emails"
+)
+
+func TestRenderAllSamples(t *testing.T) {
+	for _, locale := range emails.Locales() {
+		for _, name := range emails.Names() {
+			data, ok := emails.SampleData(name, "Afrikaans Hoër Seuns")
+			if !ok {
+				t.Fatalf("no sample data for %s", name)
+			}
+			msg, err := emails.Render(name, locale, emails.Branding{}, data)
+			if err != nil {
+				t.Fatalf("failed to render %s/%s: %+v", locale, name, err)
+			}
+			if msg.Locale != locale {
+				t.Fatalf("%s/%s rendered in %s", locale, name, msg.Locale)
+			}
+			if msg.Subject == "" || msg.HTML == "" || msg.Text == "" {
+				t.Fatalf("%s/%s incomplete: %+v", locale, name, msg)
+			}
+		}
+	}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	msg, err := emails.Render("invitation", "af-ZA",
+		emails.Branding{FromName: "AHS", Signature: "Die Hoof\nAHS"},
+		emails.InvitationData{
+			GroupTitle: "<b>Wildsfees</b>",
+			JoinLink:   "https://don8.com/invitation/1",
+			BlockLink:  "https://don8.com/invitation/1/block",
+		})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if msg.Locale != "af" {
+		t.Fatalf("locale %s != af", msg.Locale)
+	}
+	if strings.Contains(msg.HTML, "<b>Wildsfees</b>") {
+		t.Fatalf("title not escaped in html: %s", msg.HTML)
+	}
+	if !strings.Contains(msg.Text, "<b>Wildsfees</b>") {
+		t.Fatalf("title escaped in text: %s", msg.Text)
+	}
+	if !strings.Contains(msg.Subject, "<b>Wildsfees</b>") {
+		t.Fatalf("title escaped in subject: %s", msg.Subject)
+	}
+	if !strings.Contains(msg.Text, "Die Hoof") {
+		t.Fatalf("missing signature in text: %s", msg.Text)
+	}
+}
+
+func TestLocale(t *testing.T) {
+	for locale, expected := range map[string]string{
+		"af":    "af",
+		"AF-za": "af",
+		"en_GB": "en",
+		"zu":    emails.DefaultLocale,
+		"":      emails.DefaultLocale,
+	} {
+		if l := emails.Locale(locale); l != expected {
+			t.Fatalf("locale(%s) -> %s != %s", locale, l, expected)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package emails
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/google/uuid"
+)
+
+//Address of a sender or recipient
+type Address struct {
+	Addr string `json:"addr"`
+	Name string `json:"name,omitempty"`
+}
+
+func (a Address) String() string {
+	return (&mail.Address{Name: a.Name, Address: a.Addr}).String()
+}
+
+//Email to send, usually with Subject/HTML/Text from a rendered Message
+type Email struct {
+	From    Address   `json:"from"`
+	To      []Address `json:"to"`
+	Subject string    `json:"subject"`
+	HTML    string    `json:"html,omitempty"`
+	Text    string    `json:"text,omitempty"`
+	Ref     string    `json:"ref,omitempty" doc:"Reference to what the email is about, e.g. \"invitation:<id>\" or \"user:<id>\""`
+}
+
+//NewEmail from a rendered message
+func NewEmail(from Address, to []Address, msg Message, ref string) Email {
+	return Email{
+		From:    from,
+		To:      to,
+		Subject: msg.Subject,
+		HTML:    msg.HTML,
+		Text:    msg.Text,
+		Ref:     ref,
+	}
+}
+
+func (e Email) Validate() error {
+	if e.From.Addr == "" {
+		return errors.Errorf("missing from")
+	}
+	if len(e.To) == 0 {
+		return errors.Errorf("missing to")
+	}
+	for _, to := range e.To {
+		if _, err := Valid(to.Addr); err != nil {
+			return errors.Wrapf(err, "invalid to")
+		}
+	}
+	if e.Subject == "" {
+		return errors.Errorf("missing subject")
+	}
+	if e.HTML == "" && e.Text == "" {
+		return errors.Errorf("missing content")
+	}
+	return nil
+}
+
+//Mailer sends emails and returns the message id
+type Mailer interface {
+	Send(e Email) (messageID string, err error)
+}
+
+//Valid returns the address part of s if it is a valid email address
+func Valid(s string) (string, error) {
+	a, err := mail.ParseAddress(strings.TrimSpace(s))
+	if err != nil {
+		return "", errors.Errorf("invalid email address \"%s\"", s)
+	}
+	if !strings.Contains(a.Address[strings.LastIndex(a.Address, "@")+1:], ".") {
+		return "", errors.Errorf("invalid email address \"%s\" (domain without dot)", s)
+	}
+	return strings.ToLower(a.Address), nil
+}
+
+//PermanentError is returned by a mailer when the message can never be delivered
+//to a recipient (e.g. SMTP 5xx for RCPT), so that the recipient can be marked undeliverable
+type PermanentError struct {
+	Addr string
+	Err  error
+}
+
+func (e PermanentError) Error() string {
+	return fmt.Sprintf("undeliverable(%s): %v", e.Addr, e.Err)
+}
+
+//IsPermanent returns the PermanentError if err is/wraps one
+func IsPermanent(err error) (PermanentError, bool) {
+	for err != nil {
+		if pe, ok := err.(PermanentError); ok {
+			return pe, true
+		}
+		if ie, ok := err.(errors.IError); ok {
+			err = ie.Parent()
+			continue
+		}
+		break
+	}
+	return PermanentError{}, false
+}
+
+func newMessageID(from Address) string {
+	domain := "don8"
+	if i := strings.LastIndex(from.Addr, "@"); i >= 0 {
+		domain = from.Addr[i+1:]
+	}
+	return "<" + uuid.New().String() + "@" + domain + ">"
+}
+
+//Bytes returns the RFC 5322 message with text and html alternatives
+func (e Email) Bytes(messageID string) ([]byte, error) {
+	buf := bytes.NewBuffer(nil)
+	to := make([]string, len(e.To))
+	for i, a := range e.To {
+		to[i] = a.String()
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("From", e.From.String())
+	header.Set("To", strings.Join(to, ", "))
+	header.Set("Subject", mime.QEncoding.Encode("utf-8", e.Subject))
+	header.Set("Date", time.Now().Format(time.RFC1123Z))
+	header.Set("Message-ID", messageID)
+	header.Set("MIME-Version", "1.0")
+
+	mw := multipart.NewWriter(buf)
+	header.Set("Content-Type", "multipart/alternative; boundary="+strconv.Quote(mw.Boundary()))
+	hbuf := bytes.NewBuffer(nil)
+	for _, n := range []string{"From", "To", "Subject", "Date", "Message-ID", "MIME-Version", "Content-Type"} {
+		fmt.Fprintf(hbuf, "%s: %s\r\n", n, header.Get(n))
+	}
+	hbuf.WriteString("\r\n")
+
+	//plain text first, so clients prefer the last (html) alternative they can show
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", e.Text},
+		{"text/html; charset=utf-8", e.HTML},
+	} {
+		if part.content == "" {
+			continue
+		}
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create mime part")
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.content)); err != nil {
+			return nil, errors.Wrapf(err, "failed to write mime part")
+		}
+		qw.Close()
+	}
+	if err := mw.Close(); err != nil {
+		return nil, errors.Wrapf(err, "failed to close mime message")
+	}
+	return append(hbuf.Bytes(), buf.Bytes()...), nil
+} //Email.Bytes()
+
+//Config selects where emails are sent
+type Config struct {
+	Sink string     `json:"sink" env:"MAIL_SINK" doc:"file|smtp|memory (default file)"`
+	Dir  string     `json:"dir" env:"MAIL_DIR" doc:"Directory of the file sink (default ./mail)"`
+	SMTP SMTPConfig `json:"smtp"`
+}
+
+func (c *Config) Validate() error {
+	switch c.Sink {
+	case "":
+		c.Sink = "file"
+		fallthrough
+	case "file":
+		if c.Dir == "" {
+			c.Dir = "./mail"
+		}
+	case "smtp":
+		if err := c.SMTP.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid smtp config")
+		}
+	case "memory":
+	default:
+		return errors.Errorf("unknown sink \"%s\" (expecting file|smtp|memory)", c.Sink)
+	}
+	return nil
+} //Config.Validate()
+
+//NewMailer creates the mailer selected in the config
+func NewMailer(c Config) (Mailer, error) {
+	if err := c.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid mail config")
+	}
+	switch c.Sink {
+	case "smtp":
+		return NewSMTPMailer(c.SMTP)
+	case "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return NewFileMailer(c.Dir)
+	}
+} //NewMailer()
@@ -0,0 +1,259 @@
+package emails_test
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/emails"
+)
+
+func testEmail(to string) emails.Email {
+	msg, _ := emails.Render("invitation", "en", emails.Branding{}, emails.InvitationData{
+		GroupTitle: "Wildsfees 2022",
+		JoinLink:   "https://don8.com/invitation/1",
+		BlockLink:  "https://don8.com/invitation/1/block",
+	})
+	return emails.NewEmail(
+		emails.Address{Addr: "invitations@don8.com", Name: "Afrikaans Hoër Seuns"},
+		[]emails.Address{{Addr: to}},
+		msg,
+		"invitation:1",
+	)
+}
+
+type testRecorder struct {
+	queued        []emails.Email
+	sent          map[string]string
+	failed        map[string]error
+	undeliverable map[string]bool
+}
+
+func (r *testRecorder) Queued(e emails.Email) (string, error) {
+	r.queued = append(r.queued, e)
+	return e.Ref, nil
+}
+
+func (r *testRecorder) Sent(id, messageID string) error {
+	r.sent[id] = messageID
+	return nil
+}
+
+func (r *testRecorder) Failed(id string, err error) error {
+	r.failed[id] = err
+	if pe, ok := emails.IsPermanent(err); ok {
+		r.undeliverable[pe.Addr] = true
+	}
+	return nil
+}
+
+func (r *testRecorder) Undeliverable(addr string) (bool, error) {
+	return r.undeliverable[addr], nil
+}
+
+func TestRecordedMemoryMailer(t *testing.T) {
+	m := emails.NewMemoryMailer()
+	m.Undeliverable("nobody@example.com")
+	r := &testRecorder{sent: map[string]string{}, failed: map[string]error{}, undeliverable: map[string]bool{}}
+	mailer := emails.Recorded(m, r)
+
+	messageID, err := mailer.Send(testEmail("koos@example.com"))
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if r.sent["invitation:1"] != messageID {
+		t.Fatalf("sent not recorded: %+v", r)
+	}
+	if len(m.Sent()) != 1 {
+		t.Fatalf("sent %d != 1", len(m.Sent()))
+	}
+
+	_, err = mailer.Send(testEmail("nobody@example.com"))
+	if err == nil {
+		t.Fatalf("sent to undeliverable address")
+	}
+	if pe, ok := emails.IsPermanent(errors.Wrapf(err, "wrapped")); !ok || pe.Addr != "nobody@example.com" {
+		t.Fatalf("not permanent: %+v", err)
+	}
+	if r.failed["invitation:1"] == nil {
+		t.Fatalf("failure not recorded")
+	}
+	if len(r.queued) != 2 {
+		t.Fatalf("queued %d != 2", len(r.queued))
+	}
+
+	//not sent again once the address is known to be undeliverable
+	m.Reset()
+	r.undeliverable["koos@example.com"] = true
+	if _, err := mailer.Send(testEmail("koos@example.com")); err == nil {
+		t.Fatalf("sent to undeliverable address")
+	} else if _, ok := emails.IsPermanent(err); !ok {
+		t.Fatalf("not permanent: %+v", err)
+	}
+	if len(m.Sent()) != 0 {
+		t.Fatalf("sent %d != 0", len(m.Sent()))
+	}
+}
+
+//smtpServer accepts one connection and replies to each command with the reply for it, or 250
+func smtpServer(t *testing.T, replies map[string]string) emails.SMTPConfig {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %+v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tc := textproto.NewConn(conn)
+		tc.PrintfLine("220 test")
+		for {
+			line, err := tc.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch {
+			case replies[cmd] != "":
+				tc.PrintfLine("%s", replies[cmd])
+			case cmd == "EHLO":
+				tc.PrintfLine("250-test")
+				tc.PrintfLine("250 AUTH PLAIN")
+			case cmd == "DATA":
+				tc.PrintfLine("354 go ahead")
+				tc.ReadDotLines()
+				tc.PrintfLine("250 ok")
+			case cmd == "QUIT":
+				tc.PrintfLine("221 bye")
+				return
+			default:
+				tc.PrintfLine("250 ok")
+			}
+		}
+	}()
+	addr := l.Addr().(*net.TCPAddr)
+	return emails.SMTPConfig{Host: "localhost", Port: addr.Port}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	for name, tc := range map[string]struct {
+		replies   map[string]string
+		auth      bool
+		permanent bool
+	}{
+		"sent":            {},
+		"rcpt rejected":   {replies: map[string]string{"RCPT": "550 no such user"}, permanent: true},
+		"rcpt busy":       {replies: map[string]string{"RCPT": "451 try later"}},
+		"sender rejected": {replies: map[string]string{"MAIL": "554 relay denied"}},
+		"auth failed":     {replies: map[string]string{"AUTH": "535 invalid credentials"}, auth: true},
+		"data rejected":   {replies: map[string]string{"DATA": "554 rejected"}},
+	} {
+		c := smtpServer(t, tc.replies)
+		if tc.auth {
+			c.Username = "don8"
+			c.Password = "secret"
+		}
+		mailer, err := emails.NewSMTPMailer(c)
+		if err != nil {
+			t.Fatalf("%s: failed: %+v", name, err)
+		}
+		_, err = mailer.Send(testEmail("koos@example.com"))
+		if name == "sent" {
+			if err != nil {
+				t.Fatalf("%s: failed: %+v", name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("%s: sent", name)
+		}
+		pe, ok := emails.IsPermanent(err)
+		if ok != tc.permanent {
+			t.Fatalf("%s: permanent=%v: %+v", name, ok, err)
+		}
+		if ok && pe.Addr != "koos@example.com" {
+			t.Fatalf("%s: addr=%s", name, pe.Addr)
+		}
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := emails.NewFileMailer(dir)
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	messageID, err := mailer.Send(testEmail("koos@example.com"))
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("%d files != 1", len(files))
+	}
+	content, _ := os.ReadFile(path.Join(dir, files[0].Name()))
+	msg, err := mail.ReadMessage(bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("invalid eml: %+v", err)
+	}
+	if msg.Header.Get("Message-ID") != messageID {
+		t.Fatalf("message id %s != %s", msg.Header.Get("Message-ID"), messageID)
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "Invitation to join Wildsfees 2022" {
+		t.Fatalf("wrong subject: %s", subject)
+	}
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("invalid content type: %+v", err)
+	}
+	types := []string{}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid part: %+v", err)
+		}
+		types = append(types, strings.Split(p.Header.Get("Content-Type"), ";")[0])
+	}
+	if strings.Join(types, ",") != "text/plain,text/html" {
+		t.Fatalf("wrong parts: %v", types)
+	}
+}
+
+func TestValid(t *testing.T) {
+	for s, expected := range map[string]string{
+		"koos@gmail.com":          "koos@gmail.com",
+		" Koos@Gmail.com ":        "koos@gmail.com",
+		"Koos <koos@gmail.com>":   "koos@gmail.com",
+		"jan.1111111@gmail.co.za": "jan.1111111@gmail.co.za",
+	} {
+		v, err := emails.Valid(s)
+		if err != nil {
+			t.Fatalf("invalid %s: %+v", s, err)
+		}
+		if v != expected {
+			t.Fatalf("%s -> %s != %s", s, v, expected)
+		}
+	}
+	for _, s := range []string{"", "koos", "koos@localhost", "@gmail.com"} {
+		if _, err := emails.Valid(s); err == nil {
+			t.Fatalf("valid: %s", s)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package emails
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-msvc/errors"
+)
+
+//=====[ SMTP ]=====
+type SMTPConfig struct {
+	Host     string `json:"host" env:"SMTP_HOST"`
+	Port     int    `json:"port" env:"SMTP_PORT" doc:"Default 25"`
+	Username string `json:"username,omitempty" env:"SMTP_USERNAME" doc:"Optional for PLAIN auth"`
+	Password string `json:"password,omitempty" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+func (c *SMTPConfig) Validate() error {
+	if c.Host == "" {
+		return errors.Errorf("missing host")
+	}
+	if c.Port == 0 {
+		c.Port = 25
+	}
+	if c.Port < 0 {
+		return errors.Errorf("invalid port:%d", c.Port)
+	}
+	if c.Username != "" && c.Password == "" {
+		return errors.Errorf("missing password for username")
+	}
+	return nil
+}
+
+type smtpMailer struct {
+	config SMTPConfig
+	auth   smtp.Auth
+}
+
+func NewSMTPMailer(config SMTPConfig) (Mailer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid smtp config")
+	}
+	m := smtpMailer{config: config}
+	if config.Username != "" {
+		m.auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+	return m, nil
+}
+
+func (m smtpMailer) Send(e Email) (string, error) {
+	if err := e.Validate(); err != nil {
+		return "", errors.Wrapf(err, "cannot send invalid email")
+	}
+	messageID := newMessageID(e.From)
+	msg, err := e.Bytes(messageID)
+	if err != nil {
+		return "", err
+	}
+	to := make([]string, len(e.To))
+	for i, a := range e.To {
+		to[i] = a.Addr
+	}
+	if err := m.sendMail(e.From.Addr, to, msg); err != nil {
+		if _, ok := IsPermanent(err); ok {
+			return "", err
+		}
+		return "", errors.Wrapf(err, "failed to send email to %s", strings.Join(to, ","))
+	}
+	return messageID, nil
+}
+
+//sendMail does the same as smtp.SendMail(), but only returns a PermanentError when
+//the server rejects a recipient with 5xx, because 5xx for auth or the sender
+//is a problem with our config and not with the recipient
+func (m smtpMailer) sendMail(from string, to []string, msg []byte) error {
+	c, err := smtp.Dial(fmt.Sprintf("%s:%d", m.config.Host, m.config.Port))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+			return errors.Wrapf(err, "failed to start tls")
+		}
+	}
+	if m.auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.Errorf("server does not support AUTH")
+		}
+		if err := c.Auth(m.auth); err != nil {
+			return errors.Wrapf(err, "failed to authenticate")
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return errors.Wrapf(err, "sender %s rejected", from)
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			if te, ok := err.(*textproto.Error); ok && te.Code >= 500 {
+				return PermanentError{Addr: addr, Err: err}
+			}
+			return errors.Wrapf(err, "recipient %s rejected", addr)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return errors.Wrapf(err, "failed to start data")
+	}
+	if _, err := w.Write(msg); err != nil {
+		return errors.Wrapf(err, "failed to write data")
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrapf(err, "failed to end data")
+	}
+	return c.Quit()
+} //smtpMailer.sendMail()
+
+//=====[ FILE ]=====
+//fileMailer writes each email as a .eml file into a directory for development
+type fileMailer struct {
+	dir string
+}
+
+func NewFileMailer(dir string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0770); err != nil {
+		return nil, errors.Wrapf(err, "cannot create mail dir(%s)", dir)
+	}
+	return fileMailer{dir: dir}, nil
+}
+
+func (m fileMailer) Send(e Email) (string, error) {
+	if err := e.Validate(); err != nil {
+		return "", errors.Wrapf(err, "cannot send invalid email")
+	}
+	messageID := newMessageID(e.From)
+	msg, err := e.Bytes(messageID)
+	if err != nil {
+		return "", err
+	}
+	fn := path.Join(m.dir, time.Now().Format("20060102-150405")+"-"+strings.Trim(strings.Split(messageID, "@")[0], "<")+".eml")
+	if err := os.WriteFile(fn, msg, 0660); err != nil {
+		return "", errors.Wrapf(err, "failed to write %s", fn)
+	}
+	return messageID, nil
+}
+
+//=====[ MEMORY ]=====
+//MemoryMailer captures sent emails for tests
+type MemoryMailer struct {
+	sync.Mutex
+	sent          []Email
+	undeliverable map[string]bool
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{
+		sent:          []Email{},
+		undeliverable: map[string]bool{},
+	}
+}
+
+//Undeliverable makes Send fail with PermanentError for the address
+func (m *MemoryMailer) Undeliverable(addr string) {
+	m.Lock()
+	defer m.Unlock()
+	m.undeliverable[strings.ToLower(addr)] = true
+}
+
+func (m *MemoryMailer) Send(e Email) (string, error) {
+	if err := e.Validate(); err != nil {
+		return "", errors.Wrapf(err, "cannot send invalid email")
+	}
+	m.Lock()
+	defer m.Unlock()
+	for _, to := range e.To {
+		if m.undeliverable[strings.ToLower(to.Addr)] {
+			return "", PermanentError{Addr: to.Addr, Err: errors.Errorf("550 mailbox unavailable")}
+		}
+	}
+	m.sent = append(m.sent, e)
+	return newMessageID(e.From), nil
+}
+
+//Sent returns all emails sent so far
+func (m *MemoryMailer) Sent() []Email {
+	m.Lock()
+	defer m.Unlock()
+	list := make([]Email, len(m.sent))
+	copy(list, m.sent)
+	return list
+}
+
+//Reset clears the list of sent emails
+func (m *MemoryMailer) Reset() {
+	m.Lock()
+	defer m.Unlock()
+	m.sent = []Email{}
+}
+
+//=====[ RECORDER ]=====
+//Recorder keeps a delivery log of all emails sent through a recorded mailer
+type Recorder interface {
+	Queued(e Email) (id string, err error)
+	Sent(id string, messageID string) error
+	Failed(id string, err error) error
+	Undeliverable(addr string) (bool, error)
+}
+
+type recordedMailer struct {
+	mailer   Mailer
+	recorder Recorder
+}
+
+//Recorded returns a mailer that records every send with the recorder,
+//and does not send to addresses that the recorder knows are undeliverable
+func Recorded(mailer Mailer, recorder Recorder) Mailer {
+	return recordedMailer{mailer: mailer, recorder: recorder}
+}
+
+func (m recordedMailer) Send(e Email) (string, error) {
+	id, err := m.recorder.Queued(e)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to record email")
+	}
+	//do not send again to an address that failed permanently before
+	var sendErr error
+	for _, to := range e.To {
+		undeliverable, err := m.recorder.Undeliverable(to.Addr)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to check address")
+		}
+		if undeliverable {
+			sendErr = PermanentError{Addr: to.Addr, Err: errors.Errorf("address is undeliverable")}
+			break
+		}
+	}
+	messageID := ""
+	if sendErr == nil {
+		messageID, sendErr = m.mailer.Send(e)
+	}
+	if sendErr != nil {
+		if err := m.recorder.Failed(id, sendErr); err != nil {
+			log.Errorf("failed to record email(id:%s) failure: %+v", id, err)
+		}
+		return "", sendErr
+	}
+	if err := m.recorder.Sent(id, messageID); err != nil {
+		log.Errorf("failed to record email(id:%s) sent: %+v", id, err)
+	}
+	return messageID, nil
+}
@@ -0,0 +1,201 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/stewelarend/logger"
+)
+
+var log = logger.New().WithLevel(logger.LevelDebug)
+
+//Type of event
+type Type string
+
+const (
+	PromiseCreated    Type = "promise.created"
+	PromiseUpdated    Type = "promise.updated"
+	PromiseWithdrawn  Type = "promise.withdrawn"
+	DonationReceived  Type = "donation.received"
+	PaymentReceived   Type = "payment.received" //money for a money request
+	MemberJoined      Type = "member.joined"
+	InvitationCreated Type = "invitation.created"
+	RequestCreated    Type = "request.created"
+	RequestUpdated    Type = "request.updated"
+	RequestMet        Type = "request.met" //received the full quantity
+)
+
+//Event describes a change in a group
+type Event struct {
+	ID      string          `json:"id"`
+	Type    Type            `json:"type"`
+	GroupID string          `json:"group_id"`
+	Time    time.Time       `json:"time"`
+	Data    json.RawMessage `json:"data" doc:"The changed entity, e.g. the promise"`
+	Totals  json.RawMessage `json:"totals,omitempty" doc:"Updated progress of the request when the event changed it"`
+}
+
+//New event with data and optional totals
+func New(t Type, groupID string, data interface{}, totals interface{}) (Event, error) {
+	e := Event{
+		ID:      uuid.New().String(),
+		Type:    t,
+		GroupID: groupID,
+		Time:    time.Now(),
+	}
+	var err error
+	if e.Data, err = json.Marshal(data); err != nil {
+		return Event{}, errors.Wrapf(err, "cannot encode %s data", t)
+	}
+	if totals != nil {
+		if e.Totals, err = json.Marshal(totals); err != nil {
+			return Event{}, errors.Wrapf(err, "cannot encode %s totals", t)
+		}
+	}
+	return e, nil
+}
+
+//=====[ BUS ]=====
+//Bus delivers events to subscribers in this process
+type Bus struct {
+	sync.Mutex
+	subs map[*Subscription]bool
+}
+
+//Subscription receives events on C until Close() is called
+type Subscription struct {
+	C       <-chan Event
+	c       chan Event
+	groupID string
+	bus     *Bus
+}
+
+//subscriber buffer: when a slow subscriber's buffer is full, events to it are dropped
+const subscriptionBuffer = 100
+
+func NewBus() *Bus {
+	return &Bus{subs: map[*Subscription]bool{}}
+}
+
+//Subscribe to events of one group, or all groups when groupID is empty
+func (b *Bus) Subscribe(groupID string) *Subscription {
+	c := make(chan Event, subscriptionBuffer)
+	s := &Subscription{C: c, c: c, groupID: groupID, bus: b}
+	b.Lock()
+	defer b.Unlock()
+	b.subs[s] = true
+	return s
+}
+
+func (s *Subscription) Close() {
+	s.bus.Lock()
+	defer s.bus.Unlock()
+	if s.bus.subs[s] {
+		delete(s.bus.subs, s)
+		close(s.c)
+	}
+}
+
+//Deliver the event to all subscribers without blocking
+func (b *Bus) Deliver(e Event) {
+	b.Lock()
+	defer b.Unlock()
+	for s := range b.subs {
+		if s.groupID != "" && s.groupID != e.GroupID {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			log.Errorf("subscriber too slow: dropped event(%s:%s)", e.Type, e.ID)
+		}
+	}
+}
+
+//=====[ PUBLISH ]=====
+//Default bus in this process
+var Default = NewBus()
+
+const redisChannel = "E:group-events"
+
+var (
+	publishMutex sync.Mutex
+	redisClient  *redis.Client
+)
+
+//UseRedis makes Publish() send events to all instances through redis
+//each instance must call Relay() to receive them, including this one.
+func UseRedis(client *redis.Client) {
+	publishMutex.Lock()
+	defer publishMutex.Unlock()
+	redisClient = client
+}
+
+//Publish an event after a change was written
+//it only logs failures because the change is already done
+func Publish(t Type, groupID string, data interface{}, totals interface{}) {
+	e, err := New(t, groupID, data, totals)
+	if err != nil {
+		log.Errorf("failed to create event: %+v", err)
+		return
+	}
+	publishMutex.Lock()
+	client := redisClient
+	publishMutex.Unlock()
+	if client == nil {
+		Default.Deliver(e)
+		return
+	}
+	jsonEvent, _ := json.Marshal(e)
+	if err := client.Publish(context.Background(), redisChannel, string(jsonEvent)).Err(); err != nil {
+		log.Errorf("failed to publish event(%s:%s) to redis: %+v", e.Type, e.ID, err)
+	}
+}
+
+//Relay delivers events published in redis by any instance to the Default bus
+//until the context is cancelled
+func Relay(ctx context.Context, client *redis.Client) error {
+	pubSub := client.Subscribe(ctx, redisChannel)
+	defer pubSub.Close()
+	if _, err := pubSub.Receive(ctx); err != nil {
+		return errors.Wrapf(err, "failed to subscribe to %s", redisChannel)
+	}
+	log.Infof("Relaying events from redis(%s) ...", redisChannel)
+	c := pubSub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-c:
+			if !ok {
+				return errors.Errorf("redis channel closed")
+			}
+			var e Event
+			if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+				log.Errorf("discard invalid event from redis: %+v", err)
+				continue
+			}
+			Default.Deliver(e)
+		}
+	}
+} //Relay()
+
+//KeepRelaying calls Relay again after it failed, e.g. when redis restarted,
+//until the context is cancelled
+func KeepRelaying(ctx context.Context, client *redis.Client) {
+	retryInterval := 5 * time.Second
+	for ctx.Err() == nil {
+		if err := Relay(ctx, client); err != nil {
+			log.Errorf("event relay failed (retry in %s): %+v", retryInterval, err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(retryInterval):
+		}
+	}
+} //KeepRelaying()
@@ -0,0 +1,59 @@
+package events_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/jansemmelink/don8/events"
+)
+
+func TestBus(t *testing.T) {
+	bus := events.NewBus()
+	g1 := bus.Subscribe("g1")
+	all := bus.Subscribe("")
+	defer all.Close()
+
+	e1, err := events.New(events.PromiseCreated, "g1", map[string]int{"qty": 3}, map[string]int{"promised": 10})
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	e2, _ := events.New(events.MemberJoined, "g2", map[string]string{"user_id": "u1"}, nil)
+	bus.Deliver(e1)
+	bus.Deliver(e2)
+
+	for _, expected := range []struct {
+		sub *events.Subscription
+		ids []string
+	}{
+		{g1, []string{e1.ID}},
+		{all, []string{e1.ID, e2.ID}},
+	} {
+		for _, id := range expected.ids {
+			select {
+			case e := <-expected.sub.C:
+				if e.ID != id {
+					t.Fatalf("got event %s != %s", e.ID, id)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("event %s not delivered", id)
+			}
+		}
+		select {
+		case e := <-expected.sub.C:
+			t.Fatalf("unexpected event %+v", e)
+		default:
+		}
+	}
+
+	var totals map[string]int
+	if err := json.Unmarshal(e1.Totals, &totals); err != nil || totals["promised"] != 10 {
+		t.Fatalf("wrong totals: %s", e1.Totals)
+	}
+
+	g1.Close()
+	if _, ok := <-g1.C; ok {
+		t.Fatalf("channel not closed")
+	}
+	bus.Deliver(e1) //must not panic on closed subscription
+}
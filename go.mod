@@ -5,6 +5,7 @@ go 1.17
 require (
 	github.com/gchaincl/sqlhooks v1.3.0
 	github.com/go-msvc/errors v1.1.0
+	github.com/go-redis/redis/v8 v8.11.5
 	github.com/go-sql-driver/mysql v1.6.0
 	github.com/google/uuid v1.3.0
 	github.com/gorilla/mux v1.8.0
@@ -16,10 +17,5 @@ require (
 	github.com/cespare/xxhash/v2 v2.1.2 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/go-msvc/logger v0.0.0-20210121062433-1f3922644bec // indirect
-	github.com/go-redis/redis/v8 v8.11.5 // indirect
-	github.com/jansemmelink/events v0.0.0-20220728051720-04a5f123a117 // indirect
-	gopkg.in/alexcesaro/quotedprintable.v3 v3.0.0-20150716171945-2caba252f4dc // indirect
-	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df // indirect
 )
 
-replace github.com/jansemmelink/events => ../events
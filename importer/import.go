@@ -0,0 +1,248 @@
+package importer
+
+import (
+	"strconv"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/db"
+	"github.com/stewelarend/logger"
+)
+
+var log = logger.New().WithLevel(logger.LevelDebug)
+
+//Result of an import (or what would be done in a dry-run)
+type Result struct {
+	DryRun          bool       `json:"dry_run"`
+	NrRows          int        `json:"nr_rows"`
+	GroupsCreated   []string   `json:"groups_created" doc:"Titles of child groups created"`
+	GroupsUpdated   []string   `json:"groups_updated" doc:"Titles of child groups updated"`
+	RequestsCreated int        `json:"requests_created"`
+	RequestsUpdated int        `json:"requests_updated"`
+	Errors          []RowError `json:"errors,omitempty" doc:"Nothing is imported when rows have errors"`
+}
+
+//Store has the groups and requests to import into, implemented by db.Store
+type Store interface {
+	GetGroup(id db.ID) (db.Group, error)
+	GetChildGroupByTitle(parentGroupID db.ID, title string) (*db.Group, error)
+	AddGroup(user db.User, newGroup db.NewGroup) (db.Group, error)
+	UpdGroup(req db.UpdGroupRequest) error
+	GetRequestByTitle(groupID db.ID, title string) (*db.Request, error)
+	AddRequest(r db.Request) (db.Request, error)
+	UpdRequest(req db.UpdRequestRequest) error
+}
+
+type plannedGroup struct {
+	title       string
+	description string
+	existing    *db.Group
+}
+
+type plannedRequest struct {
+	line     int
+	group    *plannedGroup //nil for parent group
+	request  db.Request
+	existing *db.Request
+}
+
+//Import rows into child groups and requests under the parent group
+//matching existing groups on title in the parent and existing requests on title in the group.
+//All rows are validated first and nothing is written when there are errors or dryRun is true.
+//The changes are not written in one transaction, so when writing fails, the groups and requests
+//before the failure remain. Importing the same rows again then only writes the rest,
+//because existing groups and requests are matched and left as they are.
+func Import(store Store, user db.User, parentGroupID db.ID, rows []Row, dryRun bool) (Result, error) {
+	if _, err := store.GetGroup(parentGroupID); err != nil {
+		return Result{}, errors.Wrapf(err, "unknown parent group")
+	}
+	result := Result{
+		DryRun:        dryRun,
+		NrRows:        len(rows),
+		GroupsCreated: []string{},
+		GroupsUpdated: []string{},
+		Errors:        []RowError{},
+	}
+
+	//plan the changes and validate all rows
+	groups := map[string]*plannedGroup{}
+	groupOrder := []*plannedGroup{}
+	requests := []plannedRequest{}
+	requestLines := map[string]int{} //key is "<group>|<title>" to detect duplicates
+	for _, row := range rows {
+		var g *plannedGroup
+		if row.Group != "" {
+			if g = groups[row.Group]; g == nil {
+				existing, err := store.GetChildGroupByTitle(parentGroupID, row.Group)
+				if err != nil {
+					return Result{}, err
+				}
+				g = &plannedGroup{title: row.Group, existing: existing}
+				groups[row.Group] = g
+				groupOrder = append(groupOrder, g)
+			}
+			if row.GroupDescription != "" {
+				if g.description != "" && g.description != row.GroupDescription {
+					result.Errors = append(result.Errors, RowError{Line: row.Line, Column: "group_description", Error: "different description for the same group in an earlier row"})
+				}
+				g.description = row.GroupDescription
+			}
+		} else if row.GroupDescription != "" {
+			result.Errors = append(result.Errors, RowError{Line: row.Line, Column: "group_description", Error: "description without group"})
+		}
+
+		if row.Title == "" {
+			if row.Description != "" || row.Tags != "" || row.Units != "" || row.Qty != "" {
+				result.Errors = append(result.Errors, RowError{Line: row.Line, Column: "title", Error: "missing title"})
+			}
+			continue //group only row
+		}
+
+		key := row.Group + "|" + row.Title
+		if line, ok := requestLines[key]; ok {
+			result.Errors = append(result.Errors, RowError{Line: row.Line, Column: "title", Error: "duplicate of line " + strconv.Itoa(line)})
+			continue
+		}
+		requestLines[key] = row.Line
+
+		pr := plannedRequest{
+			line:  row.Line,
+			group: g,
+			request: db.Request{
+				GroupID: parentGroupID, //replaced when group is created
+				Title:   row.Title,
+			},
+		}
+		if row.Description != "" {
+			pr.request.Description = &row.Description
+		}
+		if row.Tags != "" {
+			pr.request.Tags = db.ParseTags(row.Tags)
+		}
+		if row.Units != "" {
+			pr.request.Units = &row.Units
+		}
+		qty, err := strconv.Atoi(row.Qty)
+		if err != nil || qty < 1 {
+			result.Errors = append(result.Errors, RowError{Line: row.Line, Column: "qty", Error: "qty \"" + row.Qty + "\" must be a number > 0"})
+			continue
+		}
+		pr.request.Qty = qty
+		if err := pr.request.Validate(); err != nil {
+			result.Errors = append(result.Errors, RowError{Line: row.Line, Error: err.Error()})
+			continue
+		}
+
+		//existing request?
+		groupID := parentGroupID
+		if g != nil {
+			groupID = ""
+			if g.existing != nil {
+				groupID = g.existing.ID
+			}
+		}
+		if groupID != "" {
+			if pr.existing, err = store.GetRequestByTitle(groupID, row.Title); err != nil {
+				return Result{}, err
+			}
+		}
+		requests = append(requests, pr)
+	} //for each row
+
+	//summarise the plan
+	for _, g := range groupOrder {
+		if g.existing == nil {
+			result.GroupsCreated = append(result.GroupsCreated, g.title)
+		} else if g.description != "" && optStr(g.existing.Description) != g.description {
+			result.GroupsUpdated = append(result.GroupsUpdated, g.title)
+		}
+	}
+	for _, pr := range requests {
+		if pr.existing == nil {
+			result.RequestsCreated++
+		} else if requestChanged(*pr.existing, pr.request) {
+			result.RequestsUpdated++
+		}
+	}
+	if len(result.Errors) > 0 || dryRun {
+		return result, nil
+	}
+
+	//apply the changes
+	for _, g := range groupOrder {
+		if g.existing == nil {
+			ng := db.NewGroup{
+				ParentGroupID: parentGroupID,
+				Title:         g.title,
+				UserRole:      "Coordinator",
+			}
+			if g.description != "" {
+				ng.Description = &g.description
+			}
+			if err := ng.Validate(); err != nil {
+				return result, errors.Wrapf(err, "invalid group(%s)", g.title)
+			}
+			newGroup, err := store.AddGroup(user, ng)
+			if err != nil {
+				return result, errors.Wrapf(err, "failed to create group(%s)", g.title)
+			}
+			g.existing = &newGroup
+		} else if g.description != "" && optStr(g.existing.Description) != g.description {
+			if err := store.UpdGroup(db.UpdGroupRequest{ID: g.existing.ID, Description: &g.description}); err != nil {
+				return result, errors.Wrapf(err, "failed to update group(%s)", g.title)
+			}
+		}
+	}
+	for _, pr := range requests {
+		if pr.group != nil {
+			pr.request.GroupID = pr.group.existing.ID
+		}
+		if pr.existing == nil {
+			if _, err := store.AddRequest(pr.request); err != nil {
+				return result, errors.Wrapf(err, "line %d: failed to create request(%s)", pr.line, pr.request.Title)
+			}
+			continue
+		}
+		if !requestChanged(*pr.existing, pr.request) {
+			continue
+		}
+		upd := db.UpdRequestRequest{
+			ID:          pr.existing.ID,
+			Description: pr.request.Description,
+			Units:       pr.request.Units,
+			Qty:         &pr.request.Qty,
+		}
+		if len(pr.request.Tags) > 0 {
+			upd.Tags = &pr.request.Tags
+		}
+		if err := upd.Validate(); err != nil {
+			return result, errors.Wrapf(err, "line %d: invalid update of request(%s)", pr.line, pr.request.Title)
+		}
+		if err := store.UpdRequest(upd); err != nil {
+			return result, errors.Wrapf(err, "line %d: failed to update request(%s)", pr.line, pr.request.Title)
+		}
+	}
+	log.Infof("Imported %d rows into group(%s): %d groups created, %d updated, %d requests created, %d updated",
+		len(rows), parentGroupID, len(result.GroupsCreated), len(result.GroupsUpdated), result.RequestsCreated, result.RequestsUpdated)
+	return result, nil
+} //Import()
+
+//requestChanged compares only the values set in the import
+func requestChanged(existing db.Request, imported db.Request) bool {
+	if imported.Description != nil && optStr(existing.Description) != *imported.Description {
+		return true
+	}
+	if len(imported.Tags) > 0 && !existing.Tags.Equal(imported.Tags) {
+		return true
+	}
+	if imported.Units != nil && existing.Unit() != imported.Unit() {
+		return true
+	}
+	return existing.Qty != imported.Qty
+}
+
+func optStr(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,219 @@
+package importer_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/importer"
+)
+
+//importStore keeps groups and requests in memory for Import()
+type importStore struct {
+	nextID   int
+	groups   map[db.ID]db.Group
+	requests map[db.ID]db.Request
+	failAdd  string //title of a request that fails once to add
+}
+
+func newImportStore() *importStore {
+	return &importStore{
+		groups:   map[db.ID]db.Group{},
+		requests: map[db.ID]db.Request{},
+	}
+}
+
+func (s *importStore) id(prefix string) db.ID {
+	s.nextID++
+	return db.ID(fmt.Sprintf("%s%d", prefix, s.nextID))
+}
+
+func (s *importStore) group(parentID db.ID, title string) db.Group {
+	g := db.Group{ID: s.id("group"), ParentGroupID: parentID, Title: title}
+	s.groups[g.ID] = g
+	return g
+}
+
+func (s *importStore) request(groupID db.ID, title string, qty int) db.Request {
+	r := db.Request{ID: s.id("request"), GroupID: groupID, Title: title, Qty: qty}
+	s.requests[r.ID] = r
+	return r
+}
+
+func (s *importStore) GetGroup(id db.ID) (db.Group, error) {
+	g, ok := s.groups[id]
+	if !ok {
+		return db.Group{}, errors.Errorf("unknown group")
+	}
+	return g, nil
+}
+
+func (s *importStore) GetChildGroupByTitle(parentGroupID db.ID, title string) (*db.Group, error) {
+	for _, g := range s.groups {
+		if g.ParentGroupID == parentGroupID && g.Title == title {
+			return &g, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *importStore) AddGroup(user db.User, ng db.NewGroup) (db.Group, error) {
+	g := s.group(ng.ParentGroupID, ng.Title)
+	g.Description = ng.Description
+	s.groups[g.ID] = g
+	return g, nil
+}
+
+func (s *importStore) UpdGroup(req db.UpdGroupRequest) error {
+	g := s.groups[req.ID]
+	g.Description = req.Description
+	s.groups[req.ID] = g
+	return nil
+}
+
+func (s *importStore) GetRequestByTitle(groupID db.ID, title string) (*db.Request, error) {
+	for _, r := range s.requests {
+		if r.GroupID == groupID && r.Title == title {
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *importStore) AddRequest(r db.Request) (db.Request, error) {
+	if r.Title == s.failAdd {
+		s.failAdd = ""
+		return db.Request{}, errors.Errorf("connection lost")
+	}
+	r.ID = s.id("request")
+	s.requests[r.ID] = r
+	return r, nil
+}
+
+func (s *importStore) UpdRequest(req db.UpdRequestRequest) error {
+	r := s.requests[req.ID]
+	r.Qty = *req.Qty
+	s.requests[req.ID] = r
+	return nil
+}
+
+func TestImport(t *testing.T) {
+	s := newImportStore()
+	school := s.group("", "School")
+	stall := s.group(school.ID, "Koeksisters")
+	other := s.group(s.group("", "Other School").ID, "Koeksisters")
+	flour := s.request(stall.ID, "Flour", 10)
+	s.request(other.ID, "Oil", 1)
+	s.request(school.ID, "Tables", 5)
+
+	rows := []importer.Row{
+		{Line: 2, Group: "Koeksisters", GroupDescription: "Koeksisters and tea", Title: "Flour", Qty: "20"},
+		{Line: 3, Group: "Koeksisters", Title: "Oil", Units: "L", Qty: "4"},
+		{Line: 4, Group: "Pannekoek", Title: "Flour", Units: "kg", Qty: "3"},
+		{Line: 5, Title: "Tables", Qty: "5"},
+	}
+	//dry run reports the changes without making them
+	result, err := importer.Import(s, db.User{ID: "user1"}, school.ID, rows, true)
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if len(result.Errors) != 0 || fmt.Sprint(result.GroupsCreated) != "[Pannekoek]" || fmt.Sprint(result.GroupsUpdated) != "[Koeksisters]" ||
+		result.RequestsCreated != 2 || result.RequestsUpdated != 1 {
+		t.Fatalf("wrong dry run: %+v", result)
+	}
+	if len(s.groups) != 4 || len(s.requests) != 3 || s.requests[flour.ID].Qty != 10 {
+		t.Fatalf("dry run changed the store: %+v %+v", s.groups, s.requests)
+	}
+
+	//then import matching groups on (parent,title) and requests on (group,title)
+	if _, err := importer.Import(s, db.User{ID: "user1"}, school.ID, rows, false); err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if len(s.groups) != 5 || len(s.requests) != 5 {
+		t.Fatalf("wrong nr of groups %d or requests %d", len(s.groups), len(s.requests))
+	}
+	if s.requests[flour.ID].Qty != 20 || s.groups[stall.ID].Description == nil {
+		t.Fatalf("not updated: %+v %+v", s.requests[flour.ID], s.groups[stall.ID])
+	}
+	if oil, _ := s.GetRequestByTitle(stall.ID, "Oil"); oil == nil || oil.Qty != 4 {
+		t.Fatalf("oil not created in the school's stall: %+v", oil)
+	}
+	if pannekoek, _ := s.GetChildGroupByTitle(school.ID, "Pannekoek"); pannekoek == nil {
+		t.Fatalf("pannekoek not created")
+	} else if r, _ := s.GetRequestByTitle(pannekoek.ID, "Flour"); r == nil || r.Qty != 3 {
+		t.Fatalf("flour not created in pannekoek: %+v", r)
+	}
+
+	//importing again changes nothing
+	result, err = importer.Import(s, db.User{ID: "user1"}, school.ID, rows, false)
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if len(result.GroupsCreated)+len(result.GroupsUpdated)+result.RequestsCreated+result.RequestsUpdated != 0 || len(s.requests) != 5 {
+		t.Fatalf("changed again: %+v", result)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	s := newImportStore()
+	school := s.group("", "School")
+	result, err := importer.Import(s, db.User{ID: "user1"}, school.ID, []importer.Row{
+		{Line: 2, Group: "Koeksisters", GroupDescription: "Koeksisters", Title: "Flour", Qty: "10"},
+		{Line: 3, Group: "Koeksisters", GroupDescription: "Tea", Title: "Oil", Qty: "x"},
+		{Line: 4, Group: "Koeksisters", Title: "Flour", Qty: "1"},
+		{Line: 5, GroupDescription: "Stall", Title: "Tables", Qty: "1"},
+		{Line: 6, Group: "Pannekoek", Qty: "1"},
+		{Line: 7, Title: "Chairs", Qty: "0"},
+	}, false)
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	expected := []importer.RowError{
+		{Line: 3, Column: "group_description"},
+		{Line: 3, Column: "qty"},
+		{Line: 4, Column: "title"},
+		{Line: 5, Column: "group_description"},
+		{Line: 6, Column: "title"},
+		{Line: 7, Column: "qty"},
+	}
+	if len(result.Errors) != len(expected) {
+		t.Fatalf("errors %+v != %+v", result.Errors, expected)
+	}
+	for i, e := range expected {
+		if result.Errors[i].Line != e.Line || result.Errors[i].Column != e.Column {
+			t.Fatalf("error[%d] %+v != %+v", i, result.Errors[i], e)
+		}
+	}
+	if len(s.groups) != 1 || len(s.requests) != 0 {
+		t.Fatalf("imported with errors: %+v %+v", s.groups, s.requests)
+	}
+
+	if _, err := importer.Import(s, db.User{ID: "user1"}, "unknown", nil, true); err == nil {
+		t.Fatalf("imported into unknown group")
+	}
+}
+
+func TestImportAgainAfterFailure(t *testing.T) {
+	s := newImportStore()
+	school := s.group("", "School")
+	rows := []importer.Row{
+		{Line: 2, Group: "Koeksisters", Title: "Flour", Qty: "10"},
+		{Line: 3, Group: "Koeksisters", Title: "Oil", Qty: "4"},
+		{Line: 4, Group: "Koeksisters", Title: "Sugar", Qty: "2"},
+	}
+	s.failAdd = "Oil"
+	if _, err := importer.Import(s, db.User{ID: "user1"}, school.ID, rows, false); err == nil {
+		t.Fatalf("did not fail")
+	}
+	if len(s.requests) != 1 {
+		t.Fatalf("%d requests != 1 before the failure", len(s.requests))
+	}
+	result, err := importer.Import(s, db.User{ID: "user1"}, school.ID, rows, false)
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if len(result.GroupsCreated) != 0 || result.RequestsCreated != 2 || len(s.groups) != 2 || len(s.requests) != 3 {
+		t.Fatalf("wrong result %+v with %d groups and %d requests", result, len(s.groups), len(s.requests))
+	}
+}
@@ -0,0 +1,256 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-msvc/errors"
+)
+
+//Row is one line of the spreadsheet:
+//a request (title) in a child group (group) of the parent group the import is done for,
+//or just a group when title is empty, or a request in the parent group when group is empty.
+type Row struct {
+	Line             int    `json:"line" doc:"Line nr in the file, 2 for the first row after the header"`
+	Group            string `json:"group,omitempty" doc:"Title of the child group, e.g. a stall, or empty for the parent group"`
+	GroupDescription string `json:"group_description,omitempty"`
+	Title            string `json:"title,omitempty" doc:"Title of the request, or empty to only create/update the group"`
+	Description      string `json:"description,omitempty"`
+	Tags             string `json:"tags,omitempty"`
+	Units            string `json:"units,omitempty"`
+	Qty              string `json:"qty,omitempty"`
+}
+
+//RowError describes a problem with a row in the file
+type RowError struct {
+	Line   int    `json:"line"`
+	Column string `json:"column,omitempty"`
+	Error  string `json:"error"`
+}
+
+//column names (and aliases) in the header row
+var columns = map[string]string{
+	"group":             "group",
+	"stall":             "group",
+	"group_title":       "group",
+	"group_description": "group_description",
+	"stall_description": "group_description",
+	"title":             "title",
+	"item":              "title",
+	"request":           "title",
+	"description":       "description",
+	"tags":              "tags",
+	"units":             "units",
+	"unit":              "units",
+	"qty":               "qty",
+	"quantity":          "qty",
+}
+
+//rowsFromRecords uses the first record as header to map columns
+func rowsFromRecords(records [][]string) ([]Row, error) {
+	if len(records) < 1 {
+		return nil, errors.Errorf("missing header row")
+	}
+	colIndex := map[string]int{}
+	for i, h := range records[0] {
+		n := strings.ToLower(strings.TrimSpace(h))
+		n = strings.ReplaceAll(n, " ", "_")
+		if n == "" {
+			continue
+		}
+		name, ok := columns[n]
+		if !ok {
+			return nil, errors.Errorf("unknown column \"%s\" in header", h)
+		}
+		if _, ok := colIndex[name]; ok {
+			return nil, errors.Errorf("duplicate column \"%s\" in header", h)
+		}
+		colIndex[name] = i
+	}
+	if _, ok := colIndex["title"]; !ok {
+		if _, ok := colIndex["group"]; !ok {
+			return nil, errors.Errorf("header must have at least a title or group column")
+		}
+	}
+
+	value := func(record []string, name string) string {
+		if i, ok := colIndex[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	rows := []Row{}
+	for i, record := range records[1:] {
+		row := Row{
+			Line:             i + 2,
+			Group:            value(record, "group"),
+			GroupDescription: value(record, "group_description"),
+			Title:            value(record, "title"),
+			Description:      value(record, "description"),
+			Tags:             value(record, "tags"),
+			Units:            value(record, "units"),
+			Qty:              value(record, "qty"),
+		}
+		if row == (Row{Line: row.Line}) {
+			continue //skip empty lines
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+} //rowsFromRecords()
+
+//ReadCSV reads rows from CSV with a header row
+//comma or semicolon separated as exported by spreadsheets in different locales
+func ReadCSV(r io.Reader) ([]Row, error) {
+	records, err := readCSVRecords(r)
+	if err != nil {
+		return nil, err
+	}
+	return rowsFromRecords(records)
+}
+
+//readCSVRecords reads comma or semicolon separated records
+func readCSVRecords(r io.Reader) ([][]string, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read CSV")
+	}
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")) //excel UTF-8 BOM
+	cr := csv.NewReader(bytes.NewReader(content))
+	firstLine := strings.SplitN(string(content), "\n", 2)[0]
+	if strings.Count(firstLine, ";") > strings.Count(firstLine, ",") {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid CSV")
+	}
+	return records, nil
+} //readCSVRecords()
+
+//ReadXLSX reads rows from the first sheet of an Excel workbook with a header row
+func ReadXLSX(content []byte) ([]Row, error) {
+	zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid XLSX file")
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	sharedStrings := []string{}
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		var sst struct {
+			Items []struct {
+				T    string `xml:"t"`
+				Runs []struct {
+					T string `xml:"t"`
+				} `xml:"r"`
+			} `xml:"si"`
+		}
+		if err := readXML(f, &sst); err != nil {
+			return nil, errors.Wrapf(err, "invalid XLSX shared strings")
+		}
+		for _, si := range sst.Items {
+			s := si.T
+			for _, r := range si.Runs {
+				s += r.T
+			}
+			sharedStrings = append(sharedStrings, s)
+		}
+	}
+
+	f, ok := files["xl/worksheets/sheet1.xml"]
+	if !ok {
+		return nil, errors.Errorf("XLSX file has no sheet1")
+	}
+	var sheet struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				R  string `xml:"r,attr"`
+				T  string `xml:"t,attr"`
+				V  string `xml:"v"`
+				IS struct {
+					T string `xml:"t"`
+				} `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := readXML(f, &sheet); err != nil {
+		return nil, errors.Wrapf(err, "invalid XLSX sheet")
+	}
+
+	records := [][]string{}
+	for _, row := range sheet.Rows {
+		//keep line numbers the same as in the spreadsheet by adding empty rows
+		for row.R > len(records)+1 {
+			records = append(records, []string{})
+		}
+		record := []string{}
+		for _, c := range row.Cells {
+			col := columnIndex(c.R)
+			if col < 0 {
+				col = len(record)
+			}
+			for len(record) <= col {
+				record = append(record, "")
+			}
+			switch c.T {
+			case "s":
+				i, err := strconv.Atoi(c.V)
+				if err != nil || i < 0 || i >= len(sharedStrings) {
+					return nil, errors.Errorf("cell %s has invalid shared string index(%s)", c.R, c.V)
+				}
+				record[col] = sharedStrings[i]
+			case "inlineStr":
+				record[col] = c.IS.T
+			default:
+				record[col] = c.V
+			}
+		}
+		records = append(records, record)
+	}
+	return rowsFromRecords(records)
+} //ReadXLSX()
+
+func readXML(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+//columnIndex returns 0 for "A1", 1 for "B7", 26 for "AA3", or -1 if invalid
+func columnIndex(ref string) int {
+	col := 0
+	n := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+		n++
+	}
+	if n == 0 {
+		return -1
+	}
+	return col - 1
+}
+
+func (e RowError) String() string {
+	if e.Column != "" {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Column, e.Error)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Error)
+}
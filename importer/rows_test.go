@@ -0,0 +1,58 @@
+package importer_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jansemmelink/don8/importer"
+)
+
+func TestReadCSV(t *testing.T) {
+	for _, content := range []string{
+		"Stall,Item,Units,Quantity\nKoeksisters,Flour,kg,10\n,,,\nKoeksisters,Oil,L,4\n",
+		"\xef\xbb\xbfstall;title;units;qty\nKoeksisters;Flour;kg;10\n;;;\nKoeksisters;Oil;L;4\n",
+	} {
+		rows, err := importer.ReadCSV(strings.NewReader(content))
+		if err != nil {
+			t.Fatalf("failed: %+v", err)
+		}
+		if len(rows) != 2 {
+			t.Fatalf("%d rows != 2: %+v", len(rows), rows)
+		}
+		if rows[0] != (importer.Row{Line: 2, Group: "Koeksisters", Title: "Flour", Units: "kg", Qty: "10"}) {
+			t.Fatalf("wrong row: %+v", rows[0])
+		}
+		if rows[1].Line != 4 || rows[1].Title != "Oil" {
+			t.Fatalf("wrong row: %+v", rows[1])
+		}
+	}
+	if _, err := importer.ReadCSV(strings.NewReader("colour,qty\nred,1\n")); err == nil {
+		t.Fatalf("accepted unknown column")
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	zw := zip.NewWriter(buf)
+	for name, content := range map[string]string{
+		"xl/sharedStrings.xml": `<sst><si><t>group</t></si><si><t>title</t></si><si><t>qty</t></si><si><r><t>Pan</t></r><r><t>cakes</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c></row>` +
+			`<row r="3"><c r="A3" t="s"><v>3</v></c><c r="B3" t="inlineStr"><is><t>Eggs</t></is></c><c r="C3"><v>24</v></c></row>` +
+			`</sheetData></worksheet>`,
+	} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+
+	rows, err := importer.ReadXLSX(buf.Bytes())
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if len(rows) != 1 || rows[0] != (importer.Row{Line: 3, Group: "Pancakes", Title: "Eggs", Qty: "24"}) {
+		t.Fatalf("wrong rows: %+v", rows)
+	}
+}
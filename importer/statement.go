@@ -0,0 +1,134 @@
+package importer
+
+import (
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/model"
+)
+
+//statementColumns are the names (and aliases) of columns in bank statement exports,
+//other columns such as the balance are ignored
+var statementColumns = map[string]string{
+	"date":                    "date",
+	"transaction_date":        "date",
+	"value_date":              "date",
+	"posting_date":            "date",
+	"description":             "description",
+	"details":                 "description",
+	"narrative":               "description",
+	"transaction_description": "description",
+	"memo":                    "description",
+	"reference":               "reference",
+	"ref":                     "reference",
+	"payment_reference":       "reference",
+	"beneficiary_reference":   "reference",
+	"amount":                  "amount",
+	"value":                   "amount",
+	"transaction_amount":      "amount",
+	"credit":                  "credit",
+	"credit_amount":           "credit",
+	"money_in":                "credit",
+	"debit":                   "debit",
+	"debit_amount":            "debit",
+	"money_out":               "debit",
+}
+
+//statementDateLayouts are tried in order to read statement dates
+var statementDateLayouts = []string{"2006-01-02", "2006/01/02", "02/01/2006", "2 Jan 2006", "02 Jan 2006", "20060102"}
+
+//ReadStatementCSV reads the transactions of a bank statement exported as CSV.
+//The header is the first line with an amount or credit column, so account details above it are skipped.
+//Amounts are in minor units of the currency, with debits negative.
+func ReadStatementCSV(r io.Reader, currency model.CurrencyDef) ([]db.StatementLine, error) {
+	records, err := readCSVRecords(r)
+	if err != nil {
+		return nil, err
+	}
+	header := -1
+	colIndex := map[string]int{}
+	for i, record := range records {
+		colIndex = map[string]int{}
+		for c, h := range record {
+			n := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(h)), " ", "_")
+			if name, ok := statementColumns[n]; ok {
+				if _, ok := colIndex[name]; !ok {
+					colIndex[name] = c
+				}
+			}
+		}
+		_, amount := colIndex["amount"]
+		_, credit := colIndex["credit"]
+		if amount || credit {
+			header = i
+			break
+		}
+	}
+	if header < 0 {
+		return nil, errors.Errorf("missing header row with an amount or credit column")
+	}
+	_, description := colIndex["description"]
+	_, reference := colIndex["reference"]
+	if !description && !reference {
+		return nil, errors.Errorf("header must have a description or reference column")
+	}
+
+	value := func(record []string, name string) string {
+		if i, ok := colIndex[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	amount := func(line int, record []string, name string) (int, error) {
+		s := value(record, name)
+		if s == "" {
+			return 0, nil
+		}
+		a, err := currency.ParseAmount(s)
+		if err != nil {
+			return 0, errors.Wrapf(err, "line %d: invalid %s", line, name)
+		}
+		return a, nil
+	}
+	lines := []db.StatementLine{}
+	for i, record := range records[header+1:] {
+		line := db.StatementLine{
+			Line:        header + i + 2,
+			Date:        value(record, "date"),
+			Description: value(record, "description"),
+			Reference:   value(record, "reference"),
+		}
+		if _, ok := colIndex["amount"]; ok {
+			if line.Amount, err = amount(line.Line, record, "amount"); err != nil {
+				return nil, err
+			}
+		} else {
+			credit, err := amount(line.Line, record, "credit")
+			if err != nil {
+				return nil, err
+			}
+			debit, err := amount(line.Line, record, "debit")
+			if err != nil {
+				return nil, err
+			}
+			if debit > 0 {
+				debit = -debit
+			}
+			line.Amount = credit + debit
+		}
+		if line.Amount == 0 && line.Description == "" && line.Reference == "" {
+			continue //skip empty lines
+		}
+		for _, layout := range statementDateLayouts {
+			if t, err := time.Parse(layout, line.Date); err == nil {
+				line.Date = t.Format("2006-01-02")
+				break
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+} //ReadStatementCSV()
@@ -0,0 +1,37 @@
+package importer_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jansemmelink/don8/importer"
+	"github.com/jansemmelink/don8/model"
+)
+
+func TestReadStatementCSV(t *testing.T) {
+	zar, _ := model.ParseCurrency("ZAR")
+	for _, content := range []string{
+		"Account,62000000000\n\nDate,Description,Reference,Amount,Balance\n2030/03/01,EFT CREDIT,D8K7M3P9QX,\"1,500.00\",\"2,000.00\"\n2030/03/02,BANK FEES,,-12.50,\"1,987.50\"\n",
+		"Transaction Date;Details;Money In;Money Out\n01 Mar 2030;EFT CREDIT D8K7M3P9QX;1500,00;\n02 Mar 2030;BANK FEES;;12,50\n",
+	} {
+		lines, err := importer.ReadStatementCSV(strings.NewReader(content), zar)
+		if err != nil {
+			t.Fatalf("failed: %+v", err)
+		}
+		if len(lines) != 2 || lines[0].Date != "2030-03-01" || lines[0].Amount != 150000 || lines[1].Amount != -1250 {
+			t.Fatalf("lines: %+v", lines)
+		}
+		if !strings.Contains(lines[0].Reference+lines[0].Description, "D8K7M3P9QX") {
+			t.Fatalf("reference: %+v", lines[0])
+		}
+	}
+	for _, content := range []string{
+		"Date,Description\n2030-03-01,EFT\n",
+		"Date,Balance,Amount\n2030-03-01,0,1.00\n",
+		"Description,Amount\nEFT,abc\n",
+	} {
+		if _, err := importer.ReadStatementCSV(strings.NewReader(content), zar); err == nil {
+			t.Fatalf("accepted invalid statement: %s", content)
+		}
+	}
+}
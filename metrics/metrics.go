@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//DefaultBuckets are latency buckets in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//Registry of metrics written in the Prometheus text format
+type Registry struct {
+	sync.Mutex
+	metrics map[string]metric
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+//Default registry served at /metrics
+var Default = NewRegistry()
+
+func (r *Registry) register(name string, m metric) {
+	r.Lock()
+	defer r.Unlock()
+	if _, ok := r.metrics[name]; ok {
+		panic(fmt.Sprintf("metric %s registered twice", name))
+	}
+	r.metrics[name] = m
+}
+
+//ServeHTTP writes all metrics for a Prometheus scrape
+func (r *Registry) ServeHTTP(httpRes http.ResponseWriter, httpReq *http.Request) {
+	r.Lock()
+	names := make([]string, 0, len(r.metrics))
+	for n := range r.metrics {
+		names = append(names, n)
+	}
+	metrics := r.metrics
+	r.Unlock()
+	sort.Strings(names)
+
+	httpRes.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w := bufio.NewWriter(httpRes)
+	for _, n := range names {
+		metrics[n].write(w)
+	}
+	w.Flush()
+}
+
+//=====[ COUNTER ]=====
+//Counter is a total that only goes up, per combination of label values
+type Counter struct {
+	sync.Mutex
+	name   string
+	help   string
+	labels []string
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labelValues []string
+	value       float64
+}
+
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, series: map[string]*counterSeries{}}
+	r.register(name, c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	c.Lock()
+	defer c.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &counterSeries{labelValues: labelValues}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.Lock()
+	defer c.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, escapeHelp(c.help), c.name)
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labels(c.labels, s.labelValues, "", ""), formatFloat(s.value))
+	}
+}
+
+//=====[ HISTOGRAM ]=====
+//Histogram counts observations in buckets, per combination of label values
+type Histogram struct {
+	sync.Mutex
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64 //per bucket, not cumulative
+	count       uint64
+	sum         float64
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	b := append([]float64{}, buckets...)
+	sort.Float64s(b)
+	h := &Histogram{name: name, help: help, labels: labels, buckets: b, series: map[string]*histogramSeries{}}
+	r.register(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+	h.Lock()
+	defer h.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{labelValues: labelValues, counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.Lock()
+	defer h.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, escapeHelp(h.help), h.name)
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, le := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels(h.labels, s.labelValues, "le", formatFloat(le)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labels(h.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labels(h.labels, s.labelValues, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels(h.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+//=====[ TEXT FORMAT ]=====
+func labels(names []string, values []string, extraName, extraValue string) string {
+	parts := []string{}
+	for i, n := range names {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		parts = append(parts, n+"=\""+escapeLabel(v)+"\"")
+	}
+	if extraName != "" {
+		parts = append(parts, extraName+"=\""+extraValue+"\"")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+var helpEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n")
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	switch t := m.(type) {
+	case map[string]*counterSeries:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	case map[string]*histogramSeries:
+		for k := range t {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
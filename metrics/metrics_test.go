@@ -0,0 +1,51 @@
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jansemmelink/don8/metrics"
+)
+
+func TestHistogram(t *testing.T) {
+	r := metrics.NewRegistry()
+	h := r.Histogram("test_duration_seconds", "Test latency", []float64{0.1, 1}, "route")
+	h.Observe(0.05, "/groups/{id}")
+	h.Observe(0.5, "/groups/{id}")
+	h.Observe(5, "/groups/{id}")
+	c := r.Counter("test_total", "Test \"count\"", "code")
+	c.Inc("200")
+	c.Add(2, "200")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	expected := `# HELP test_duration_seconds Test latency
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{route="/groups/{id}",le="0.1"} 1
+test_duration_seconds_bucket{route="/groups/{id}",le="1"} 2
+test_duration_seconds_bucket{route="/groups/{id}",le="+Inf"} 3
+test_duration_seconds_sum{route="/groups/{id}"} 5.55
+test_duration_seconds_count{route="/groups/{id}"} 3
+# HELP test_total Test "count"
+# TYPE test_total counter
+test_total{code="200"} 3
+`
+	if out := w.Body.String(); out != expected {
+		t.Fatalf("got:\n%s\nexpected:\n%s", out, expected)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Fatalf("content type %s", ct)
+	}
+}
+
+func TestLabelEscaping(t *testing.T) {
+	r := metrics.NewRegistry()
+	c := r.Counter("sql_total", "SQL", "statement")
+	c.Inc("SELECT `a` FROM t WHERE b=\"x\"\n")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `sql_total{statement="SELECT `+"`a`"+` FROM t WHERE b=\"x\"\n"} 1`) {
+		t.Fatalf("got:\n%s", w.Body.String())
+	}
+}
@@ -12,4 +12,4 @@ type Coordinates string //<lat>;<lon> both as decimal values
 
 type StringList string //<string>|<string>|... used for tags etc
 
-type Unit string //enum e.g. Kg, Dozen, L, units (just counted items), ...
+//Unit is defined in unit.go with the registry of known units
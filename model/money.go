@@ -0,0 +1,151 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-msvc/errors"
+)
+
+//Currency is the ISO 4217 code of a currency, e.g. "ZAR"
+//Money amounts are integers in the minor unit of the currency, e.g. cents.
+type Currency string
+
+//DefaultCurrency is assumed when a money request does not specify the currency
+const DefaultCurrency Currency = "ZAR"
+
+//CurrencyDef describes a known currency
+type CurrencyDef struct {
+	Code        Currency `json:"code"`
+	Symbol      string   `json:"symbol"`
+	MinorDigits int      `json:"minor_digits" doc:"Nr of decimals in the minor unit, e.g. 2 for cents"`
+}
+
+var currencyByCode = map[Currency]CurrencyDef{}
+
+func init() {
+	for _, def := range []CurrencyDef{
+		{Code: "ZAR", Symbol: "R", MinorDigits: 2},
+		{Code: "BWP", Symbol: "P", MinorDigits: 2},
+		{Code: "NAD", Symbol: "N$", MinorDigits: 2},
+		{Code: "USD", Symbol: "$", MinorDigits: 2},
+		{Code: "EUR", Symbol: "€", MinorDigits: 2},
+		{Code: "GBP", Symbol: "£", MinorDigits: 2},
+	} {
+		currencyByCode[def.Code] = def
+	}
+}
+
+//Currencies returns all known currencies sorted by code
+func Currencies() []CurrencyDef {
+	list := []CurrencyDef{}
+	for _, def := range currencyByCode {
+		list = append(list, def)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+//ParseCurrency returns the definition of the currency code (case insensitive),
+//empty s is the default currency
+func ParseCurrency(s string) (CurrencyDef, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "" {
+		s = string(DefaultCurrency)
+	}
+	def, ok := currencyByCode[Currency(s)]
+	if !ok {
+		return CurrencyDef{}, errors.Errorf("unknown currency \"%s\"", s)
+	}
+	return def, nil
+}
+
+//Def returns the definition of the currency
+func (c Currency) Def() (CurrencyDef, error) {
+	return ParseCurrency(string(c))
+}
+
+//Format an amount in minor units, e.g. 123450 -> "R1234.50"
+func (def CurrencyDef) Format(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	if def.MinorDigits == 0 {
+		return fmt.Sprintf("%s%s%d", sign, def.Symbol, amount)
+	}
+	scale := 1
+	for i := 0; i < def.MinorDigits; i++ {
+		scale *= 10
+	}
+	return fmt.Sprintf("%s%s%d.%0*d", sign, def.Symbol, amount/scale, def.MinorDigits, amount%scale)
+}
+
+//ParseAmount parses a decimal amount as written in statements and spreadsheets
+//into minor units, e.g. "R 1 234,50", "1,234.50" or "(12.00)" for -1200
+func (def CurrencyDef) ParseAmount(s string) (int, error) {
+	text := s
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+	s = strings.TrimPrefix(strings.ToUpper(s), string(def.Code))
+	for _, remove := range []string{def.Symbol, " ", "\u00a0", "'"} {
+		s = strings.ReplaceAll(s, remove, "")
+	}
+	if strings.HasPrefix(s, "-") {
+		negative = !negative
+		s = s[1:]
+	} else if strings.HasSuffix(s, "-") {
+		negative = !negative
+		s = s[:len(s)-1]
+	}
+
+	//the last of "." or "," is the decimal separator if both are used,
+	//a single "," followed by up to MinorDigits digits is a decimal comma,
+	//else "," is a thousands separator
+	dot, comma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case dot >= 0 && comma > dot:
+		s = strings.ReplaceAll(s[:comma], ".", "") + "." + s[comma+1:]
+	case dot >= 0:
+		s = strings.ReplaceAll(s, ",", "")
+	case comma >= 0 && strings.Count(s, ",") == 1 && len(s)-comma-1 <= def.MinorDigits:
+		s = s[:comma] + "." + s[comma+1:]
+	default:
+		s = strings.ReplaceAll(s, ",", "")
+	}
+
+	if s == "" {
+		return 0, errors.Errorf("missing amount")
+	}
+	whole, frac := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if len(frac) > def.MinorDigits {
+		return 0, errors.Errorf("amount \"%s\" has more than %d decimals", text, def.MinorDigits)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	frac += strings.Repeat("0", def.MinorDigits-len(frac))
+	for _, c := range whole + frac {
+		if c < '0' || c > '9' {
+			return 0, errors.Errorf("invalid amount \"%s\"", text)
+		}
+	}
+	amount, err := strconv.Atoi(whole + frac)
+	if err != nil {
+		return 0, errors.Errorf("invalid amount \"%s\"", text)
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+} //CurrencyDef.ParseAmount()
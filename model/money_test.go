@@ -0,0 +1,50 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/jansemmelink/don8/model"
+)
+
+func TestParseAmount(t *testing.T) {
+	zar, err := model.ParseCurrency("zar")
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	for s, expected := range map[string]int{
+		"150":        15000,
+		"150.5":      15050,
+		"R 1 234,50": 123450,
+		"1,234.50":   123450,
+		"1.234,50":   123450,
+		"1,234":      123400,
+		"ZAR 12.00":  1200,
+		"-12.00":     -1200,
+		"(12.00)":    -1200,
+		"12.00-":     -1200,
+		"0,05":       5,
+		"R1 000":     100000,
+	} {
+		amount, err := zar.ParseAmount(s)
+		if err != nil {
+			t.Fatalf("failed to parse \"%s\": %+v", s, err)
+		}
+		if amount != expected {
+			t.Fatalf("\"%s\" -> %d != %d", s, amount, expected)
+		}
+	}
+	for _, s := range []string{"", "abc", "1.234", "12.3.4"} {
+		if _, err := zar.ParseAmount(s); err == nil {
+			t.Fatalf("parsed invalid amount \"%s\"", s)
+		}
+	}
+	if s := zar.Format(123405); s != "R1234.05" {
+		t.Fatalf("format: %s", s)
+	}
+	if _, err := model.ParseCurrency("XYZ"); err == nil {
+		t.Fatalf("parsed unknown currency")
+	}
+	if total, err := model.Sum("ZAR", model.Quantity{Qty: 100, Unit: "ZAR"}); err != nil || total != 100 {
+		t.Fatalf("sum in currency: %v %+v", total, err)
+	}
+}
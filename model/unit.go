@@ -0,0 +1,187 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-msvc/errors"
+)
+
+//Unit of measure e.g. "kg", "L", "dozen", "items" (just counted items) or "pack of 6"
+//Only units in the registry (or "pack of N") are valid.
+type Unit string
+
+//Dimension of a unit: only units in the same dimension can be converted/summed
+type Dimension string
+
+const (
+	DimensionMass   Dimension = "mass"   //base unit "g"
+	DimensionVolume Dimension = "volume" //base unit "ml"
+	DimensionCount  Dimension = "count"  //base unit "items"
+)
+
+//UnitDef describes a unit in the registry
+type UnitDef struct {
+	Name      Unit      `json:"name" doc:"Canonical name of the unit"`
+	Dimension Dimension `json:"dimension" doc:"mass|volume|count"`
+	Factor    float64   `json:"factor" doc:"Nr of base units in one of this unit, e.g. 1000 for kg (base unit g)"`
+	Aliases   []string  `json:"aliases,omitempty" doc:"Other names accepted for this unit"`
+}
+
+//DefaultUnit is assumed when a request does not specify units
+const DefaultUnit Unit = "items"
+
+var (
+	unitsMutex sync.Mutex
+	unitByName = map[string]UnitDef{}
+	unitList   = []UnitDef{}
+)
+
+func init() {
+	for _, def := range []UnitDef{
+		{Name: "g", Dimension: DimensionMass, Factor: 1, Aliases: []string{"gram", "grams", "gr"}},
+		{Name: "kg", Dimension: DimensionMass, Factor: 1000, Aliases: []string{"kilogram", "kilograms", "kgs", "kilo", "kilos"}},
+		{Name: "ml", Dimension: DimensionVolume, Factor: 1, Aliases: []string{"millilitre", "milliliter", "millilitres", "milliliters"}},
+		{Name: "L", Dimension: DimensionVolume, Factor: 1000, Aliases: []string{"l", "litre", "liter", "litres", "liters"}},
+		{Name: "items", Dimension: DimensionCount, Factor: 1, Aliases: []string{"item", "units", "unit", "each", "ea", "pcs", "pieces", "piece"}},
+		{Name: "dozen", Dimension: DimensionCount, Factor: 12, Aliases: []string{"doz", "dozens"}},
+	} {
+		if err := RegisterUnit(def); err != nil {
+			panic(fmt.Sprintf("invalid unit(%s): %+v", def.Name, err))
+		}
+	}
+}
+
+//RegisterUnit adds a unit to the registry
+func RegisterUnit(def UnitDef) error {
+	if def.Name == "" {
+		return errors.Errorf("missing name")
+	}
+	switch def.Dimension {
+	case DimensionMass, DimensionVolume, DimensionCount:
+	default:
+		return errors.Errorf("unknown dimension(%s)", def.Dimension)
+	}
+	if def.Factor <= 0 {
+		return errors.Errorf("invalid factor(%v)", def.Factor)
+	}
+	unitsMutex.Lock()
+	defer unitsMutex.Unlock()
+	names := append([]string{string(def.Name)}, def.Aliases...)
+	for _, n := range names {
+		if existing, ok := unitByName[strings.ToLower(n)]; ok {
+			return errors.Errorf("name(%s) already used by unit(%s)", n, existing.Name)
+		}
+	}
+	for _, n := range names {
+		unitByName[strings.ToLower(n)] = def
+	}
+	unitList = append(unitList, def)
+	return nil
+} //RegisterUnit()
+
+//Units return all registered units (excluding the dynamic "pack of N" units)
+func Units() []UnitDef {
+	unitsMutex.Lock()
+	defer unitsMutex.Unlock()
+	list := make([]UnitDef, len(unitList))
+	copy(list, unitList)
+	return list
+}
+
+//"pack of 6", "pack 6", "6-pack", "6 pack"
+var (
+	packOfRegex = regexp.MustCompile(`^pack(?:\s*of)?\s*([0-9]+)$`)
+	nPackRegex  = regexp.MustCompile(`^([0-9]+)\s*-?\s*pack$`)
+)
+
+//ParseUnit returns the unit definition for s (case insensitive),
+//using the canonical name for aliases and "pack of N" for packs of N items.
+//Empty s is the default unit.
+func ParseUnit(s string) (UnitDef, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	if s == "" {
+		s = string(DefaultUnit)
+	}
+	unitsMutex.Lock()
+	def, ok := unitByName[s]
+	unitsMutex.Unlock()
+	if ok {
+		return def, nil
+	}
+
+	var m []string
+	if m = packOfRegex.FindStringSubmatch(s); m == nil {
+		m = nPackRegex.FindStringSubmatch(s)
+	}
+	if m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 {
+			return UnitDef{}, errors.Errorf("invalid pack size in unit \"%s\"", s)
+		}
+		return UnitDef{
+			Name:      Unit(fmt.Sprintf("pack of %d", n)),
+			Dimension: DimensionCount,
+			Factor:    float64(n),
+		}, nil
+	}
+	return UnitDef{}, errors.Errorf("unknown unit \"%s\"", s)
+} //ParseUnit()
+
+//Def returns the definition of the unit
+func (u Unit) Def() (UnitDef, error) {
+	return ParseUnit(string(u))
+}
+
+//Compatible returns nil if quantities in u can be converted to other
+func (u Unit) Compatible(other Unit) error {
+	from, err := u.Def()
+	if err != nil {
+		return err
+	}
+	to, err := other.Def()
+	if err != nil {
+		return err
+	}
+	if from.Dimension != to.Dimension {
+		return errors.Errorf("unit \"%s\" (%s) is not compatible with \"%s\" (%s)", from.Name, from.Dimension, to.Name, to.Dimension)
+	}
+	return nil
+}
+
+//Convert qty from one unit to another in the same dimension,
+//or to the same unit, which need not be registered, e.g. a currency
+func Convert(qty float64, from, to Unit) (float64, error) {
+	if from == to {
+		return qty, nil
+	}
+	if err := from.Compatible(to); err != nil {
+		return 0, err
+	}
+	fromDef, _ := from.Def()
+	toDef, _ := to.Def()
+	return qty * fromDef.Factor / toDef.Factor, nil
+}
+
+//Quantity is an amount in some unit
+type Quantity struct {
+	Qty  float64 `json:"qty"`
+	Unit Unit    `json:"unit"`
+}
+
+//Sum adds all quantities normalised into the specified unit
+//and fails if any of them is not compatible with that unit
+func Sum(unit Unit, quantities ...Quantity) (float64, error) {
+	total := 0.0
+	for _, q := range quantities {
+		v, err := Convert(q.Qty, q.Unit, unit)
+		if err != nil {
+			return 0, err
+		}
+		total += v
+	}
+	return total, nil
+}
@@ -0,0 +1,76 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/jansemmelink/don8/model"
+)
+
+func TestParseUnit(t *testing.T) {
+	for s, expected := range map[string]model.Unit{
+		"":          "items",
+		"KG":        "kg",
+		"Kilograms": "kg",
+		"litre":     "L",
+		"Dozen":     "dozen",
+		"pack of 6": "pack of 6",
+		"Pack 12":   "pack of 12",
+		"6-pack":    "pack of 6",
+	} {
+		def, err := model.ParseUnit(s)
+		if err != nil {
+			t.Fatalf("failed to parse \"%s\": %+v", s, err)
+		}
+		if def.Name != expected {
+			t.Fatalf("\"%s\" -> %s != %s", s, def.Name, expected)
+		}
+	}
+	for _, s := range []string{"bags", "pack of 0", "kg2"} {
+		if _, err := model.ParseUnit(s); err == nil {
+			t.Fatalf("parsed invalid unit \"%s\"", s)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	for _, test := range []struct {
+		qty      float64
+		from     model.Unit
+		to       model.Unit
+		expected float64
+	}{
+		{2000, "g", "kg", 2},
+		{2, "kg", "g", 2000},
+		{1.5, "L", "ml", 1500},
+		{3, "dozen", "items", 36},
+		{2, "pack of 6", "dozen", 1},
+	} {
+		v, err := model.Convert(test.qty, test.from, test.to)
+		if err != nil {
+			t.Fatalf("failed to convert %v %s to %s: %+v", test.qty, test.from, test.to, err)
+		}
+		if v != test.expected {
+			t.Fatalf("%v %s -> %v %s != %v", test.qty, test.from, v, test.to, test.expected)
+		}
+	}
+	if _, err := model.Convert(1, "kg", "L"); err == nil {
+		t.Fatalf("converted kg to L")
+	}
+}
+
+func TestSum(t *testing.T) {
+	total, err := model.Sum("kg",
+		model.Quantity{Qty: 2, Unit: "kg"},
+		model.Quantity{Qty: 2000, Unit: "g"},
+		model.Quantity{Qty: 500, Unit: "grams"},
+	)
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	if total != 4.5 {
+		t.Fatalf("total %v != 4.5", total)
+	}
+	if _, err := model.Sum("kg", model.Quantity{Qty: 1, Unit: "dozen"}); err == nil {
+		t.Fatalf("summed dozen into kg")
+	}
+}
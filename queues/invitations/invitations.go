@@ -0,0 +1,153 @@
+package invitations
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/go-msvc/errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/jansemmelink/don8/config"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/emails"
+	"github.com/jansemmelink/don8/events"
+	"github.com/stewelarend/logger"
+)
+
+var log = logger.New().WithLevel(logger.LevelDebug)
+
+//Queue in redis where the server publishes invitations to send
+const Queue = "Q:group-invitations"
+
+var (
+	appURL string
+	mailer emails.Mailer
+)
+
+//Run subscribes to the redis queue and sends group invites until ctx is done,
+//then returns after the current invitation was sent
+func Run(ctx context.Context, c config.Config) error {
+	if err := c.ConnectDB(ctx); err != nil {
+		return errors.Wrapf(err, "cannot connect to the database")
+	}
+	defer db.Close()
+	appURL = c.HTTP.AppURL
+
+	m, err := emails.NewMailer(c.Mail)
+	if err != nil {
+		return errors.Wrapf(err, "cannot create mailer")
+	}
+	mailer = emails.Recorded(m, db.DeliveryLog{})
+
+	redisClient := c.Redis.NewClient()
+	defer redisClient.Close()
+	events.UseRedis(redisClient) //so that the server can stream invitation and member events
+
+	log.Infof("Subscribing on queue(%s) ...", Queue)
+	redisPubSub := redisClient.Subscribe(ctx, Queue)
+	defer func() {
+		log.Infof("Unsubscribing from queue(%s).", Queue)
+		redisPubSub.Close()
+	}()
+
+	//the channel reconnects when the redis connection is lost
+	log.Infof("Waiting for messages on queue(%s) ...", Queue)
+	msgs := redisPubSub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("Stopped.")
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return errors.Errorf("queue(%s) closed", Queue)
+			}
+			if err := process(msg); err != nil {
+				log.Errorf("process failed: %+v", err)
+			}
+		}
+	}
+} //Run()
+
+//process one message, not cancelled when stopping so that the invitation is not half sent
+func process(msg *redis.Message) error {
+	var req db.Invitation
+	if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+		return errors.Wrapf(err, "%s: invalid JSON", msg.Channel)
+	}
+	if err := req.Validate(); err != nil {
+		return errors.Wrapf(err, "%s: invalid request", msg.Channel)
+	}
+
+	//group must exist
+	group, err := db.GetGroup(req.GroupID)
+	if err != nil {
+		return errors.Wrapf(err, "%s: failed to get group(id:%s)", msg.Channel, req.GroupID)
+	}
+
+	//do not send if already joined
+	member, err := db.GetMemberByEmail(req.GroupID, req.Email)
+	if err != nil {
+		return errors.Wrapf(err, "%s: failed to get member(email:%s)", msg.Channel, req.Email)
+	}
+	if member != nil {
+		return errors.Wrapf(err, "%s: group(id:%s).member(id:%s,email:%s) already exists", msg.Channel, req.GroupID, member.ID, req.Email)
+	}
+
+	//do not invite if already invited
+	inv, err := db.GetInvitationByEmail(req.GroupID, req.Email)
+	if err != nil {
+		return errors.Wrapf(err, "%s: failed to get invitation(email:%s)", msg.Channel, req.Email)
+	}
+	if inv != nil {
+		//todo: add option to request to resent existing invites...
+		return errors.Wrapf(err, "%s: group(id:%s).invitation(id:%s,email:%s,cre:%s,upd:%s) already exists", msg.Channel, req.GroupID, inv.ID, req.Email, inv.TimeCreated, inv.TimeUpdated)
+	}
+
+	//not yet member, nor invited, so create new invitation
+	inv, err = db.AddInvitation(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s: failed to create invitation", msg.Channel)
+	}
+	log.Debugf("Created invitation: %+v", inv)
+
+	//new invitation status is "sent", but if send fails,
+	//we delete if with this defer function
+	//(unless undeliverable, then it is kept to not invite again)
+	sent := false
+	undeliverable := false
+	defer func() {
+		if !sent && !undeliverable {
+			if err := db.DelInviation(inv.ID); err != nil {
+				log.Errorf("failed to delete invitation(id:%s) after fail to send: %+v", inv.ID, err)
+			} else {
+				log.Errorf("deleted invitation(id:%s) after fail to send", inv.ID)
+			}
+		}
+	}()
+
+	//send invitation by email with the group's branding
+	branding, err := db.GetGroupBranding(req.GroupID)
+	if err != nil {
+		return errors.Wrapf(err, "%s: failed to get group(id:%s) branding", msg.Channel, req.GroupID)
+	}
+	message, err := emails.Render("invitation", branding.Locale, branding.Branding, emails.InvitationData{
+		GroupTitle: group.Title,
+		JoinLink:   appURL + "/invitation/" + string(inv.ID),
+		BlockLink:  appURL + "/invitation/" + string(inv.ID) + "/block",
+	})
+	if err != nil {
+		return errors.Wrapf(err, "%s: failed to render invitation", msg.Channel)
+	}
+	if _, err := mailer.Send(emails.NewEmail(
+		emails.Address{Addr: "invitations@don8.com", Name: branding.FromName},
+		[]emails.Address{{Addr: req.Email}},
+		message,
+		"invitation:"+string(inv.ID),
+	)); err != nil {
+		_, undeliverable = emails.IsPermanent(err) //recorder marked the invitation undeliverable
+		return errors.Wrapf(err, "%s: failed to send invitation", msg.Channel)
+	}
+	sent = true //set this not to delete in the defer func above
+	log.Debugf("Sent invitation")
+	return nil
+}
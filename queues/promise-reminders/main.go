@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/config"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/emails"
+	"github.com/stewelarend/logger"
+)
+
+var log = logger.New().WithLevel(logger.LevelDebug)
+
+var mailer emails.Mailer
+
+//periodically sends promise reminders to users and digests of overdue promises to coordinators
+//everything sent is recorded in the db so that a restart does not send duplicates
+func main() {
+	intervalPtr := flag.Duration("interval", time.Minute*15, "Interval between checks for due promises")
+	loader := config.NewLoader(flag.CommandLine)
+	flag.Parse()
+	c, err := loader.Load()
+	if err != nil {
+		panic(errors.Wrapf(err, "cannot load config"))
+	}
+	//stop on SIGINT (ctrl-C) or SIGTERM (docker stop or kubernetes)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := c.ConnectDB(ctx); err != nil {
+		log.Errorf("cannot connect to the database: %+v", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	m, err := emails.NewMailer(c.Mail)
+	if err != nil {
+		panic(errors.Wrapf(err, "cannot create mailer"))
+	}
+	mailer = emails.Recorded(m, db.DeliveryLog{})
+
+	log.Infof("Checking promises every %s ...", *intervalPtr)
+	for ctx.Err() == nil {
+		if err := process(time.Now()); err != nil {
+			log.Errorf("process failed: %+v", err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(*intervalPtr):
+		}
+	}
+	log.Infof("Stopped.")
+} //main()
+
+func process(now time.Time) error {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if err := sendReminders(today); err != nil {
+		return errors.Wrapf(err, "failed to send reminders")
+	}
+	if err := sendOverdueDigests(today); err != nil {
+		return errors.Wrapf(err, "failed to send overdue digests")
+	}
+	return nil
+} //process()
+
+func sendReminders(today time.Time) error {
+	due, err := db.ListPromisesDue(today, today.AddDate(0, 0, db.MaxReminderDaysBefore+1))
+	if err != nil {
+		return err
+	}
+
+	groupReminders := map[db.ID]db.GroupReminders{}
+	for _, p := range due {
+		gr, ok := groupReminders[p.GroupID]
+		if !ok {
+			if gr, err = db.GetGroupReminders(p.GroupID); err != nil {
+				log.Errorf("failed to get group(id:%s) reminders: %+v", p.GroupID, err)
+				continue
+			}
+			groupReminders[p.GroupID] = gr
+		}
+
+		dueDate := time.Time(p.Date)
+		dueDay := time.Date(dueDate.Year(), dueDate.Month(), dueDate.Day(), 0, 0, 0, 0, today.Location())
+		daysLeft := int(dueDay.Sub(today).Hours()+12) / 24 //+12 to round over daylight saving changes
+
+		//all reminders from daysLeft days before are due, also those missed while
+		//this service was not running, but only the latest is sent and the rest skipped
+		due := []int{}
+		for _, d := range gr.DaysBefore {
+			if d >= daysLeft && !p.ReminderSent(db.ReminderKind(d)) {
+				due = append(due, d)
+			}
+		}
+		if len(due) == 0 {
+			continue
+		}
+		sort.Ints(due)
+		if err := sendReminder(p, due[0], daysLeft); err != nil {
+			log.Errorf("failed to send promise(id:%s) reminder: %+v", p.PromiseID, err)
+			continue
+		}
+		for _, d := range due[1:] {
+			if _, err := db.ClaimPromiseReminder(p.PromiseID, db.ReminderKind(d)); err != nil {
+				log.Errorf("failed to skip promise(id:%s) reminder(%s): %+v", p.PromiseID, db.ReminderKind(d), err)
+			}
+		}
+	}
+	return nil
+} //sendReminders()
+
+func sendReminder(p db.PromiseReminder, daysBefore int, daysLeft int) error {
+	kind := db.ReminderKind(daysBefore)
+	claimed, err := db.ClaimPromiseReminder(p.PromiseID, kind)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		log.Debugf("promise(id:%s) reminder(%s) already sent", p.PromiseID, kind)
+		return nil
+	}
+
+	//release the claim if failed to send, so it is retried on the next run
+	sent := false
+	defer func() {
+		if !sent {
+			if err := db.ReleasePromiseReminder(p.PromiseID, kind); err != nil {
+				log.Errorf("failed to release promise(id:%s) reminder(%s): %+v", p.PromiseID, kind, err)
+			}
+		}
+	}()
+
+	branding, err := db.GetGroupBranding(p.GroupID)
+	if err != nil {
+		return err
+	}
+	message, err := emails.Render("promise-reminder", branding.Locale, branding.Branding, emails.PromiseReminderData{
+		Name:       p.UserName,
+		GroupTitle: p.GroupTitle,
+		Promised:   promiseQty(p),
+		Due:        time.Time(p.Date).Format("2006-01-02"),
+		DueToday:   daysLeft == 0,
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to render reminder")
+	}
+	if _, err := mailer.Send(emails.NewEmail(
+		emails.Address{Addr: "reminders@don8.com", Name: branding.FromName},
+		[]emails.Address{{Addr: p.UserEmail, Name: p.UserName}},
+		message,
+		"promise:"+string(p.PromiseID),
+	)); err != nil {
+		return errors.Wrapf(err, "failed to send email")
+	}
+	sent = true
+	log.Debugf("Sent promise(id:%s) reminder(%s) to %s", p.PromiseID, kind, p.UserEmail)
+	return nil
+} //sendReminder()
+
+func sendOverdueDigests(today time.Time) error {
+	n, err := db.MarkPromisesOverdue(today)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		log.Infof("Marked %d promises overdue", n)
+	}
+
+	overdue, err := db.ListOverduePromises(today.AddDate(0, 0, -db.MaxOverdueDays))
+	if err != nil {
+		return err
+	}
+	overdueByGroup := map[db.ID][]db.PromiseReminder{}
+	for _, p := range overdue {
+		overdueByGroup[p.GroupID] = append(overdueByGroup[p.GroupID], p)
+	}
+	for groupID, list := range overdueByGroup {
+		if err := sendOverdueDigest(groupID, today, list); err != nil {
+			log.Errorf("failed to send group(id:%s) overdue digest: %+v", groupID, err)
+		}
+	}
+	return nil
+} //sendOverdueDigests()
+
+func sendOverdueDigest(groupID db.ID, today time.Time, list []db.PromiseReminder) error {
+	gr, err := db.GetGroupReminders(groupID)
+	if err != nil {
+		return err
+	}
+	if !gr.OverdueDigest {
+		return nil
+	}
+	coordinators, err := db.ListGroupCoordinators(groupID)
+	if err != nil {
+		return err
+	}
+	if len(coordinators) == 0 {
+		return errors.Errorf("group has no coordinators")
+	}
+
+	claimed, err := db.ClaimOverdueDigest(groupID, today)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		log.Debugf("group(id:%s) overdue digest already sent today", groupID)
+		return nil
+	}
+	sent := false
+	defer func() {
+		if !sent {
+			if err := db.ReleaseOverdueDigest(groupID, today); err != nil {
+				log.Errorf("failed to release group(id:%s) overdue digest: %+v", groupID, err)
+			}
+		}
+	}()
+
+	to := []emails.Address{}
+	for _, c := range coordinators {
+		to = append(to, emails.Address{Addr: c.Email, Name: c.Name})
+	}
+	data := emails.OverdueDigestData{
+		GroupTitle: list[0].GroupTitle,
+		Promises:   []emails.OverduePromise{},
+	}
+	for _, p := range list {
+		data.Promises = append(data.Promises, emails.OverduePromise{
+			Due:      time.Time(p.Date).Format("2006-01-02"),
+			Name:     p.UserName,
+			Phone:    p.UserPhone,
+			Promised: promiseQty(p),
+		})
+	}
+	branding, err := db.GetGroupBranding(groupID)
+	if err != nil {
+		return err
+	}
+	message, err := emails.Render("overdue-digest", branding.Locale, branding.Branding, data)
+	if err != nil {
+		return errors.Wrapf(err, "failed to render digest")
+	}
+	if _, err := mailer.Send(emails.NewEmail(
+		emails.Address{Addr: "reminders@don8.com", Name: branding.FromName},
+		to,
+		message,
+		"group:"+string(groupID),
+	)); err != nil {
+		return errors.Wrapf(err, "failed to send email")
+	}
+	sent = true
+	log.Debugf("Sent group(id:%s) digest of %d overdue promises to %d coordinators", groupID, len(list), len(to))
+	return nil
+} //sendOverdueDigest()
+
+//promiseQty e.g. "2 kg Boerewors" or "R150.00 Building fund"
+func promiseQty(p db.PromiseReminder) string {
+	if p.Type == db.RequestTypeMoney {
+		if def, err := p.Currency.Def(); err == nil {
+			return def.Format(p.Qty) + " " + p.RequestTitle
+		}
+	}
+	units := ""
+	if p.Units != nil && *p.Units != "" {
+		units = *p.Units + " "
+	}
+	return fmt.Sprintf("%d %s%s", p.Qty, units, p.RequestTitle)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/jansemmelink/don8/config"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/events"
+	"github.com/jansemmelink/don8/webhooks"
+	"github.com/stewelarend/logger"
+)
+
+var log = logger.New().WithLevel(logger.LevelDebug)
+
+//max nr of deliveries claimed in one check
+const batchSize = 20
+
+//receives group events from redis and posts them to the webhooks that subscribed to them
+//deliveries are stored before they are posted, so retries survive a restart
+//and more than one instance can run without posting an event twice
+func main() {
+	intervalPtr := flag.Duration("interval", 5*time.Second, "Interval between checks for due deliveries")
+	timeoutPtr := flag.Duration("timeout", 10*time.Second, "HTTP timeout of each delivery")
+	loader := config.NewLoader(flag.CommandLine)
+	flag.Parse()
+	c, err := loader.Load()
+	if err != nil {
+		panic(errors.Wrapf(err, "cannot load config"))
+	}
+	//stop on SIGINT (ctrl-C) or SIGTERM (docker stop or kubernetes)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := c.ConnectDB(ctx); err != nil {
+		log.Errorf("cannot connect to the database: %+v", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	redisClient := c.Redis.NewClient()
+
+	sub := events.Default.Subscribe("") //all groups
+	go events.KeepRelaying(ctx, redisClient)
+	queued := make(chan bool)
+	go func() {
+		//until sub.Close() and all received events are queued
+		for e := range sub.C {
+			if err := queue(e); err != nil {
+				log.Errorf("failed to queue event(%s:%s) webhooks: %+v", e.Type, e.ID, err)
+			}
+		}
+		close(queued)
+	}()
+
+	//only posts to public addresses, also when a webhook name resolves to an internal one
+	client := webhooks.NewClient(*timeoutPtr)
+	lease := time.Duration(batchSize+1) * *timeoutPtr //long enough to post the whole batch
+	log.Infof("Delivering webhooks every %s ...", *intervalPtr)
+	for ctx.Err() == nil {
+		if err := deliverDue(client, lease); err != nil {
+			log.Errorf("failed to deliver webhooks: %+v", err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(*intervalPtr):
+		}
+	}
+
+	//deliveries not yet posted are retried by the next instance
+	sub.Close()
+	<-queued
+	log.Infof("Stopped.")
+} //main()
+
+//queue a delivery of the event for each webhook that subscribed to it
+func queue(e events.Event) error {
+	hooks, err := db.ListEventWebhooks(db.ID(e.GroupID), e.Type)
+	if err != nil {
+		return err
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	for _, w := range hooks {
+		added, err := db.AddWebhookDelivery(w.ID, e, payload)
+		if err != nil {
+			log.Errorf("failed to queue event(%s:%s) for webhook(id=%s): %+v", e.Type, e.ID, w.ID, err)
+			continue
+		}
+		if added {
+			log.Debugf("queued event(%s:%s) for webhook(id=%s)", e.Type, e.ID, w.ID)
+		}
+	}
+	return nil
+} //queue()
+
+func deliverDue(client *http.Client, lease time.Duration) error {
+	due, err := db.ClaimDueWebhookDeliveries(time.Now(), batchSize, lease)
+	if err != nil {
+		return err
+	}
+	for _, d := range due {
+		deliver(client, d)
+	}
+	return nil
+}
+
+func deliver(client *http.Client, d db.DueWebhookDelivery) {
+	status, err := webhooks.Deliver(client, webhooks.Delivery{
+		ID:        string(d.ID),
+		URL:       d.URL,
+		Secret:    d.Secret,
+		EventType: string(d.EventType),
+		Body:      []byte(d.Payload),
+	})
+	var retryAt *time.Time
+	if err != nil {
+		attempt := d.Attempts + 1
+		if attempt < webhooks.MaxAttempts {
+			t := time.Now().Add(webhooks.Backoff(attempt))
+			retryAt = &t
+			log.Errorf("webhook delivery(id=%s) attempt %d failed (retry at %s): %+v", d.ID, attempt, t.Format("15:04:05"), err)
+		} else {
+			log.Errorf("webhook delivery(id=%s) failed after %d attempts: %+v", d.ID, attempt, err)
+		}
+	} else {
+		log.Debugf("webhook delivery(id=%s) %s to %s: HTTP %d", d.ID, d.EventType, d.URL, status)
+	}
+	if err := db.RecordWebhookAttempt(d.ID, status, err, retryAt); err != nil {
+		log.Errorf("failed to record webhook delivery(id=%s): %+v", d.ID, err)
+	}
+} //deliver()
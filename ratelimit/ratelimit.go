@@ -0,0 +1,171 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/go-redis/redis/v8"
+)
+
+//Store keeps counters that expire at the end of their window
+type Store interface {
+	//Add n to the counter of key, starting a new window if it expired,
+	//and return the new count with the time left in the window
+	Add(key string, n int, window time.Duration) (int, time.Duration, error)
+	//Get the count and time left in the window without changing it
+	Get(key string) (int, time.Duration, error)
+	//Reset the counter, e.g. after a successful login
+	Reset(key string) error
+}
+
+//Limit allows Max events in each Window
+type Limit struct {
+	Max    int
+	Window time.Duration
+}
+
+//Allow counts one event and returns false with the time to wait if the limit is exceeded
+func Allow(s Store, key string, limit Limit) (bool, time.Duration, error) {
+	return AllowN(s, key, 1, limit)
+}
+
+//AllowN counts n events, e.g. n invitations in one request
+//when the limit is exceeded they are not counted, so a smaller n may still be allowed
+func AllowN(s Store, key string, n int, limit Limit) (bool, time.Duration, error) {
+	count, ttl, err := s.Add(key, n, limit.Window)
+	if err != nil {
+		return false, 0, err
+	}
+	if count <= limit.Max {
+		return true, 0, nil
+	}
+	if _, _, err := s.Add(key, -n, limit.Window); err != nil {
+		return false, 0, err
+	}
+	return false, ttl, nil
+}
+
+//=====[ MEMORY STORE ]=====
+//memoryStore is used when running a single instance, e.g. in development
+type memoryStore struct {
+	sync.Mutex
+	counters  map[string]*counter
+	lastSweep time.Time
+}
+
+type counter struct {
+	count   int
+	expires time.Time
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{counters: map[string]*counter{}, lastSweep: time.Now()}
+}
+
+func (s *memoryStore) Add(key string, n int, window time.Duration) (int, time.Duration, error) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.expires) {
+		c = &counter{expires: now.Add(window)}
+		s.counters[key] = c
+	}
+	c.count += n
+	return c.count, c.expires.Sub(now), nil
+}
+
+func (s *memoryStore) Get(key string) (int, time.Duration, error) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	c, ok := s.counters[key]
+	if !ok || !now.Before(c.expires) {
+		return 0, 0, nil
+	}
+	return c.count, c.expires.Sub(now), nil
+}
+
+func (s *memoryStore) Reset(key string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.counters, key)
+	return nil
+}
+
+//sweep removes expired counters once a minute so the map does not grow forever
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	for key, c := range s.counters {
+		if !now.Before(c.expires) {
+			delete(s.counters, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+//=====[ REDIS STORE ]=====
+//redisStore shares the counters between all instances
+type redisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client) Store {
+	return redisStore{client: client, prefix: "RL:"}
+}
+
+func (s redisStore) Add(key string, n int, window time.Duration) (int, time.Duration, error) {
+	ctx := context.Background()
+	key = s.prefix + key
+	var incr *redis.IntCmd
+	var pttl *redis.DurationCmd
+	if _, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.IncrBy(ctx, key, int64(n))
+		pttl = pipe.PTTL(ctx, key)
+		return nil
+	}); err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to count %s", key)
+	}
+	ttl := pttl.Val()
+	if ttl < 0 {
+		//new counter (or one that lost its expiry): start the window
+		if err := s.client.PExpire(ctx, key, window).Err(); err != nil {
+			return 0, 0, errors.Wrapf(err, "failed to expire %s", key)
+		}
+		ttl = window
+	}
+	return int(incr.Val()), ttl, nil
+}
+
+func (s redisStore) Get(key string) (int, time.Duration, error) {
+	ctx := context.Background()
+	key = s.prefix + key
+	count, err := s.client.Get(ctx, key).Int()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, 0, nil
+		}
+		return 0, 0, errors.Wrapf(err, "failed to get %s", key)
+	}
+	ttl, err := s.client.PTTL(ctx, key).Result()
+	if err != nil {
+		return 0, 0, errors.Wrapf(err, "failed to get %s ttl", key)
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	return count, ttl, nil
+}
+
+func (s redisStore) Reset(key string) error {
+	if err := s.client.Del(context.Background(), s.prefix+key).Err(); err != nil {
+		return errors.Wrapf(err, "failed to reset %s", key)
+	}
+	return nil
+}
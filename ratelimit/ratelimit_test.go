@@ -0,0 +1,67 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jansemmelink/don8/ratelimit"
+)
+
+func TestAllow(t *testing.T) {
+	s := ratelimit.NewMemoryStore()
+	limit := ratelimit.Limit{Max: 3, Window: time.Hour}
+	for i := 0; i < 3; i++ {
+		if ok, _, err := ratelimit.Allow(s, "ip:1.2.3.4", limit); err != nil || !ok {
+			t.Fatalf("event %d not allowed: %+v", i+1, err)
+		}
+	}
+	ok, retryAfter, err := ratelimit.Allow(s, "ip:1.2.3.4", limit)
+	if err != nil || ok {
+		t.Fatalf("event 4 allowed")
+	}
+	if retryAfter <= 0 || retryAfter > time.Hour {
+		t.Fatalf("retry after %s, expected up to 1h", retryAfter)
+	}
+	if ok, _, _ := ratelimit.Allow(s, "ip:5.6.7.8", limit); !ok {
+		t.Fatalf("other key not allowed")
+	}
+	if err := s.Reset("ip:1.2.3.4"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _, _ := ratelimit.Allow(s, "ip:1.2.3.4", limit); !ok {
+		t.Fatalf("not allowed after reset")
+	}
+}
+
+func TestAllowN(t *testing.T) {
+	s := ratelimit.NewMemoryStore()
+	limit := ratelimit.Limit{Max: 10, Window: time.Hour}
+	if ok, _, _ := ratelimit.AllowN(s, "group:1", 8, limit); !ok {
+		t.Fatalf("8 not allowed")
+	}
+	if ok, _, _ := ratelimit.AllowN(s, "group:1", 5, limit); ok {
+		t.Fatalf("8+5 allowed")
+	}
+	//rejected events are not counted
+	if count, _, _ := s.Get("group:1"); count != 8 {
+		t.Fatalf("count=%d, expected 8", count)
+	}
+	if ok, _, _ := ratelimit.AllowN(s, "group:1", 2, limit); !ok {
+		t.Fatalf("8+2 not allowed")
+	}
+}
+
+func TestWindowExpiry(t *testing.T) {
+	s := ratelimit.NewMemoryStore()
+	limit := ratelimit.Limit{Max: 1, Window: 20 * time.Millisecond}
+	if ok, _, _ := ratelimit.Allow(s, "k", limit); !ok {
+		t.Fatalf("first not allowed")
+	}
+	if ok, _, _ := ratelimit.Allow(s, "k", limit); ok {
+		t.Fatalf("second allowed in same window")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if ok, _, _ := ratelimit.Allow(s, "k", limit); !ok {
+		t.Fatalf("not allowed in next window")
+	}
+}
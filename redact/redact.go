@@ -0,0 +1,154 @@
+package redact
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+//Mask replaces sensitive values in logs
+const Mask = "***"
+
+//Defaults are redacted unless Configure() is called:
+//fields are JSON field names, query parameters and SQL columns (optionally as table.column)
+var (
+	DefaultFields  = []string{"pwd", "tpw", "pwd_hash", "password", "secret", "sid", "sessions.id"}
+	DefaultHeaders = []string{"Don8-Auth-Sid", "Authorization", "Cookie", "Set-Cookie"}
+)
+
+var (
+	mutex   sync.Mutex
+	fields  = set(DefaultFields)
+	headers = set(DefaultHeaders)
+)
+
+func set(names []string) map[string]bool {
+	s := map[string]bool{}
+	for _, n := range names {
+		if n = strings.ToLower(strings.TrimSpace(n)); n != "" {
+			s[n] = true
+		}
+	}
+	return s
+}
+
+//Configure the names of fields and headers to redact
+func Configure(fieldNames []string, headerNames []string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	fields = set(fieldNames)
+	headers = set(headerNames)
+}
+
+//Field is true when values of the named field must not be logged
+func Field(name string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return fields[strings.ToLower(name)]
+}
+
+func header(name string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return headers[strings.ToLower(name)]
+}
+
+//JSON returns the document with sensitive fields masked at any depth
+//anything that is not JSON is returned as is
+func JSON(doc []byte) []byte {
+	var v interface{}
+	if err := json.Unmarshal(doc, &v); err != nil {
+		return doc
+	}
+	redacted, err := json.Marshal(value(v))
+	if err != nil {
+		return doc
+	}
+	return redacted
+}
+
+//Value returns v as JSON with sensitive fields masked, e.g. to log a request struct
+func Value(v interface{}) string {
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return Mask
+	}
+	return string(JSON(doc))
+}
+
+func value(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for n, fv := range t {
+			if Field(n) {
+				t[n] = Mask
+			} else {
+				t[n] = value(fv)
+			}
+		}
+	case []interface{}:
+		for i, iv := range t {
+			t[i] = value(iv)
+		}
+	}
+	return v
+}
+
+//Header returns a copy of the header with sensitive values masked
+func Header(h http.Header) http.Header {
+	c := http.Header{}
+	for n, values := range h {
+		if header(n) {
+			c[n] = []string{Mask}
+		} else {
+			c[n] = values
+		}
+	}
+	return c
+}
+
+//URL returns the path and query with sensitive query parameters masked, e.g. ?sid=***
+func URL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+	q := u.Query()
+	for n := range q {
+		if Field(n) {
+			q[n] = []string{Mask}
+		}
+	}
+	return u.Path + "?" + q.Encode()
+}
+
+var (
+	sqlTablePattern  = regexp.MustCompile("(?i)\\b(?:from|into|update)\\s+`?(\\w+)`?")
+	sqlColumnPattern = regexp.MustCompile("`?(\\w+)`?\\s*(?:=|<>|!=|<=|>=|<|>|(?i:like))\\s*\\?")
+)
+
+//SQLArgs masks the args of placeholders compared to or assigned to sensitive columns,
+//e.g. "UPDATE `users` SET `pwd_hash`=? WHERE `id`=?" masks only the first arg.
+//Columns may be configured as "table.column" for the first table in the statement.
+func SQLArgs(query string, args []interface{}) []interface{} {
+	table := ""
+	if m := sqlTablePattern.FindStringSubmatch(query); m != nil {
+		table = strings.ToLower(m[1])
+	}
+	redacted := make([]interface{}, len(args))
+	copy(redacted, args)
+	for _, m := range sqlColumnPattern.FindAllStringSubmatchIndex(query, -1) {
+		column := strings.ToLower(query[m[2]:m[3]])
+		if !Field(column) && !Field(table+"."+column) {
+			continue
+		}
+		//the placeholder ends the match: its index is the nr of placeholders before it
+		i := strings.Count(query[:m[1]], "?") - 1
+		if i >= 0 && i < len(redacted) {
+			redacted[i] = Mask
+		}
+	}
+	return redacted
+} //SQLArgs()
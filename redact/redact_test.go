@@ -0,0 +1,61 @@
+package redact_test
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+
+	"github.com/jansemmelink/don8/redact"
+)
+
+func TestJSON(t *testing.T) {
+	in := `{"email":"a@b.c","password":"p","user":{"pwd_hash":"h","tpw":"t","name":"n"},"list":[{"pwd":"x"}]}`
+	expected := `{"email":"a@b.c","list":[{"pwd":"***"}],"password":"***","user":{"name":"n","pwd_hash":"***","tpw":"***"}}`
+	if out := string(redact.JSON([]byte(in))); out != expected {
+		t.Fatalf("got %s", out)
+	}
+	if out := string(redact.JSON([]byte("not json"))); out != "not json" {
+		t.Fatalf("got %s", out)
+	}
+	if out := redact.Value(struct {
+		Email string `json:"email"`
+		Pwd   string `json:"pwd"`
+	}{"a@b.c", "secret"}); out != `{"email":"a@b.c","pwd":"***"}` {
+		t.Fatalf("got %s", out)
+	}
+}
+
+func TestHeaderAndURL(t *testing.T) {
+	h := http.Header{}
+	h.Set("Don8-Auth-Sid", "123")
+	h.Set("Content-Type", "application/json")
+	r := redact.Header(h)
+	if r.Get("Don8-Auth-Sid") != redact.Mask || r.Get("Content-Type") != "application/json" {
+		t.Fatalf("got %+v", r)
+	}
+	if h.Get("Don8-Auth-Sid") != "123" {
+		t.Fatalf("original header changed")
+	}
+	u, _ := url.Parse("/groups/1/events?sid=123&x=1")
+	if s := redact.URL(u); s != "/groups/1/events?sid=%2A%2A%2A&x=1" {
+		t.Fatalf("got %s", s)
+	}
+}
+
+func TestSQLArgs(t *testing.T) {
+	for _, test := range []struct {
+		query    string
+		args     []interface{}
+		expected []interface{}
+	}{
+		{"UPDATE `users` SET `pwd_hash`=?,tpw=? WHERE `id`=?", []interface{}{"h", "t", "u1"}, []interface{}{redact.Mask, redact.Mask, "u1"}},
+		{"SELECT s.`id` FROM `sessions` AS s WHERE s.`id`=? LIMIT ?", []interface{}{"sid", 1}, []interface{}{redact.Mask, 1}},
+		{"SELECT `id` FROM `groups` WHERE `id`=?", []interface{}{"g1"}, []interface{}{"g1"}},
+		{"INSERT INTO `sessions` SET `id`=?,`user_id`=?", []interface{}{"sid", "u1"}, []interface{}{redact.Mask, "u1"}},
+	} {
+		if out := redact.SQLArgs(test.query, test.args); !reflect.DeepEqual(out, test.expected) {
+			t.Errorf("%s: %v -> %v, expected %v", test.query, test.args, out, test.expected)
+		}
+	}
+}
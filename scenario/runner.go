@@ -0,0 +1,202 @@
+package scenario
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+)
+
+//SessionHeader is sent with the session ID after a step with "session"
+const SessionHeader = "Don8-Auth-Sid"
+
+//Runner calls the API for each step, either on a running server at BaseURL
+//or directly in the Handler when it is set, e.g. for tests without a network
+type Runner struct {
+	BaseURL       string
+	Client        *http.Client //default is http.DefaultClient
+	Handler       http.Handler
+	Vars          Vars
+	StopOnFailure bool
+	Log           io.Writer //optional, one line per step as it completes
+	session       string
+}
+
+//Result of one step
+type Result struct {
+	Step     Step          `json:"step"`
+	Status   int           `json:"status,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+	Skipped  bool          `json:"skipped,omitempty"`
+}
+
+func (r Result) Passed() bool {
+	return r.Error == "" && !r.Skipped
+}
+
+//Summary of all steps in a run
+type Summary struct {
+	Results []Result `json:"results"`
+	Passed  int      `json:"passed"`
+	Failed  int      `json:"failed"`
+	Skipped int      `json:"skipped"`
+}
+
+func (s Summary) OK() bool {
+	return s.Failed == 0 && s.Skipped == 0
+}
+
+func (s Summary) String() string {
+	return fmt.Sprintf("%d passed, %d failed, %d skipped", s.Passed, s.Failed, s.Skipped)
+}
+
+//Run all steps in order, capturing variables and the session from responses
+func (r *Runner) Run(ctx context.Context, steps []Step) Summary {
+	if r.Vars == nil {
+		r.Vars = Vars{}
+	}
+	if _, ok := r.Vars["run"]; !ok {
+		r.Vars["run"] = strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 36)
+	}
+	summary := Summary{}
+	for i, step := range steps {
+		if ctx.Err() != nil || (r.StopOnFailure && summary.Failed > 0) {
+			summary.Results = append(summary.Results, Result{Step: step, Skipped: true})
+			summary.Skipped++
+			continue
+		}
+		result := r.run(ctx, step)
+		summary.Results = append(summary.Results, result)
+		if result.Passed() {
+			summary.Passed++
+		} else {
+			summary.Failed++
+		}
+		if r.Log != nil {
+			if result.Passed() {
+				fmt.Fprintf(r.Log, "PASS %3d %s -> %d (%s)\n", i+1, step, result.Status, result.Duration)
+			} else {
+				fmt.Fprintf(r.Log, "FAIL %3d %s -> %d: %s\n", i+1, step, result.Status, result.Error)
+			}
+		}
+	}
+	return summary
+} //Runner.Run()
+
+func (r *Runner) run(ctx context.Context, step Step) Result {
+	result := Result{Step: step}
+	start := time.Now()
+	status, body, err := r.call(ctx, step)
+	result.Status = status
+	result.Duration = time.Since(start)
+	if err == nil {
+		err = r.check(step, status, body)
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+func (r *Runner) call(ctx context.Context, step Step) (int, []byte, error) {
+	url, err := r.Vars.expand(step.URL, false)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "cannot expand url")
+	}
+	var reqBody io.Reader
+	if len(step.Body) > 0 {
+		body, err := r.Vars.expand(string(step.Body), true)
+		if err != nil {
+			return 0, nil, errors.Wrapf(err, "cannot expand body")
+		}
+		reqBody = strings.NewReader(body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, step.Method, strings.TrimSuffix(r.BaseURL, "/")+url, reqBody)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "cannot create request")
+	}
+	if reqBody != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if r.session != "" {
+		httpReq.Header.Set(SessionHeader, r.session)
+	}
+	for n, v := range step.Headers {
+		if v, err = r.Vars.expand(v, false); err != nil {
+			return 0, nil, errors.Wrapf(err, "cannot expand header %s", n)
+		}
+		httpReq.Header.Set(n, v)
+	}
+
+	if r.Handler != nil {
+		httpRes := httptest.NewRecorder()
+		r.Handler.ServeHTTP(httpRes, httpReq)
+		return httpRes.Code, httpRes.Body.Bytes(), nil
+	}
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	httpRes, err := client.Do(httpReq)
+	if err != nil {
+		return 0, nil, errors.Wrapf(err, "request failed")
+	}
+	defer httpRes.Body.Close()
+	resBody, err := io.ReadAll(httpRes.Body)
+	if err != nil {
+		return httpRes.StatusCode, nil, errors.Wrapf(err, "cannot read response")
+	}
+	return httpRes.StatusCode, resBody, nil
+} //Runner.call()
+
+//check the status then capture values from the response
+func (r *Runner) check(step Step, status int, body []byte) error {
+	if (step.Status == 0 && (status < 200 || status > 299)) ||
+		(step.Status != 0 && status != step.Status) {
+		expected := "2xx"
+		if step.Status != 0 {
+			expected = strconv.Itoa(step.Status)
+		}
+		return errors.Errorf("expected status %s: %s", expected, brief(body))
+	}
+	if len(step.Capture) == 0 && step.Session == "" {
+		return nil
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return errors.Errorf("cannot capture from response that is not JSON: %s", brief(body))
+	}
+	for name, path := range step.Capture {
+		v, err := value(doc, path)
+		if err != nil {
+			return errors.Wrapf(err, "cannot capture <%s>", name)
+		}
+		r.Vars[name] = v
+	}
+	if step.Session != "" {
+		sid, err := value(doc, step.Session)
+		if err != nil {
+			return errors.Wrapf(err, "cannot get session")
+		}
+		r.session = sid
+	}
+	return nil
+} //Runner.check()
+
+//brief response body for errors
+func brief(body []byte) string {
+	s := string(bytes.TrimSpace(body))
+	if len(s) > 200 {
+		s = s[:200] + "..."
+	}
+	return s
+}
@@ -0,0 +1,169 @@
+package scenario
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-msvc/errors"
+)
+
+//Step is one API call in a scenario file, e.g.:
+//
+//	{"name":"login", "method":"POST", "url":"/auth/login",
+//	 "body":{"email":"jan+<run>@example.com", "password":"secret"},
+//	 "status":200, "session":"id", "capture":{"user id":"user.id"}}
+//
+//The files in model/use_cases.json only have method, url and body.
+//Placeholders like <user id> in the url, headers and body are replaced
+//with values captured from earlier responses, and <run> is unique per run
+//so that emails and titles do not conflict with those of the last run.
+type Step struct {
+	Name    string            `json:"name,omitempty" doc:"Shown in the results, default is the method and url"`
+	Method  string            `json:"method"`
+	URL     string            `json:"url" doc:"Path on the server, e.g. /groups/<group id>"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Status  int               `json:"status,omitempty" doc:"Expected HTTP status, default is any 2xx"`
+	Capture map[string]string `json:"capture,omitempty" doc:"Variable names with the path of the value in the response, e.g. \"items.0.id\""`
+	Session string            `json:"session,omitempty" doc:"Path of the session ID in the response to send in the next steps, e.g. \"id\" after login"`
+}
+
+func (s Step) Validate() error {
+	if s.Method == "" {
+		return errors.Errorf("missing method")
+	}
+	if !strings.HasPrefix(s.URL, "/") {
+		return errors.Errorf("url \"%s\" must start with /", s.URL)
+	}
+	if s.Status != 0 && (s.Status < 100 || s.Status > 599) {
+		return errors.Errorf("invalid status:%d", s.Status)
+	}
+	return nil
+}
+
+func (s Step) String() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return s.Method + " " + s.URL
+}
+
+//Load reads steps from a file with a JSON list of steps,
+//or from a JSON lines file with one step per line
+func Load(filename string) ([]Step, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "cannot read scenario file")
+	}
+	steps, err := Parse(content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid scenario file %s", filename)
+	}
+	return steps, nil
+}
+
+//Parse steps from a JSON list or JSON lines
+func Parse(content []byte) ([]Step, error) {
+	var steps []Step
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &steps); err != nil {
+			return nil, errors.Wrapf(err, "invalid JSON list of steps")
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(nil, 1024*1024)
+		lineNr := 0
+		for scanner.Scan() {
+			lineNr++
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			var s Step
+			if err := json.Unmarshal(line, &s); err != nil {
+				return nil, errors.Wrapf(err, "invalid step on line %d", lineNr)
+			}
+			steps = append(steps, s)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, errors.Wrapf(err, "cannot read lines")
+		}
+	}
+	//empty steps like the {} at the end of model/use_cases.json are ignored
+	valid := []Step{}
+	for i, s := range steps {
+		if s.Method == "" && s.URL == "" {
+			continue
+		}
+		if err := s.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid step %d", i+1)
+		}
+		valid = append(valid, s)
+	}
+	return valid, nil
+} //Parse()
+
+//Vars are the values of placeholders
+type Vars map[string]string
+
+var placeholderPattern = regexp.MustCompile(`<([^<>"\\]+)>`)
+
+//expand replaces placeholders in s,
+//escaping the values when s is JSON
+func (vars Vars) expand(s string, isJSON bool) (string, error) {
+	var err error
+	result := placeholderPattern.ReplaceAllStringFunc(s, func(p string) string {
+		name := p[1 : len(p)-1]
+		v, ok := vars[name]
+		if !ok {
+			if err == nil {
+				err = errors.Errorf("undefined %s", p)
+			}
+			return p
+		}
+		if isJSON {
+			quoted, _ := json.Marshal(v)
+			return string(quoted[1 : len(quoted)-1])
+		}
+		return v
+	})
+	return result, err
+}
+
+//value at the path in a JSON document, e.g. "user.id" or "items.0.id"
+func value(doc interface{}, path string) (string, error) {
+	v := doc
+	for _, name := range strings.Split(path, ".") {
+		switch container := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = container[name]; !ok {
+				return "", errors.Errorf("no \"%s\" in %s", name, path)
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(name)
+			if err != nil || i < 0 || i >= len(container) {
+				return "", errors.Errorf("no item \"%s\" in %s (%d items)", name, path, len(container))
+			}
+			v = container[i]
+		default:
+			return "", errors.Errorf("cannot get \"%s\" in %s from a value", name, path)
+		}
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case nil:
+		return "", errors.Errorf("%s is null", path)
+	case map[string]interface{}, []interface{}:
+		return "", errors.Errorf("%s is not a value", path)
+	default:
+		jsonValue, _ := json.Marshal(v)
+		return string(jsonValue), nil
+	}
+} //value()
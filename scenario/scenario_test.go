@@ -0,0 +1,124 @@
+package scenario_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jansemmelink/don8/scenario"
+)
+
+func TestParse(t *testing.T) {
+	list := `[
+		{"method":"POST", "url":"/charities", "body":{"name":"Pretoria Boys"}},
+		{"method":"GET", "url":"/charities/<id>", "status":404}
+	]`
+	lines := `{"method":"POST", "url":"/charities", "body":{"name":"Pretoria Boys"}}
+
+{"method":"GET", "url":"/charities/<id>", "status":404}
+`
+	for _, content := range []string{list, lines} {
+		steps, err := scenario.Parse([]byte(content))
+		if err != nil {
+			t.Fatalf("failed: %+v", err)
+		}
+		if len(steps) != 2 || steps[1].Status != 404 || steps[1].String() != "GET /charities/<id>" {
+			t.Fatalf("wrong steps: %+v", steps)
+		}
+	}
+	if steps, err := scenario.Parse([]byte(`[{"method":"GET", "url":"/units"}, {}]`)); err != nil || len(steps) != 1 {
+		t.Fatalf("empty step not ignored: %+v", err)
+	}
+	if _, err := scenario.Parse([]byte(`{"method":"GET", "url":"charities"}`)); err == nil {
+		t.Fatalf("relative url accepted")
+	}
+	if _, err := scenario.Parse([]byte(`{"url":"/charities"}`)); err == nil {
+		t.Fatalf("missing method accepted")
+	}
+}
+
+//fakeAPI logs in with any password and echoes the session and body of other calls
+func fakeAPI() http.Handler {
+	return http.HandlerFunc(func(httpRes http.ResponseWriter, httpReq *http.Request) {
+		httpRes.Header().Set("Content-Type", "application/json")
+		if httpReq.URL.Path == "/auth/login" {
+			json.NewEncoder(httpRes).Encode(map[string]interface{}{"id": "s1", "user": map[string]interface{}{"id": "u1"}})
+			return
+		}
+		if httpReq.Header.Get(scenario.SessionHeader) != "s1" {
+			httpRes.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(httpRes).Encode(map[string]interface{}{"message": "missing session"})
+			return
+		}
+		var body interface{}
+		if httpReq.Body != nil {
+			json.NewDecoder(httpReq.Body).Decode(&body)
+		}
+		json.NewEncoder(httpRes).Encode(map[string]interface{}{
+			"path":  httpReq.URL.Path,
+			"body":  body,
+			"items": []interface{}{map[string]interface{}{"id": "i1", "quantity": 5}},
+		})
+	})
+}
+
+func TestRun(t *testing.T) {
+	steps, err := scenario.Parse([]byte(`[
+		{"method":"GET", "url":"/groups/", "status":401},
+		{"name":"login", "method":"POST", "url":"/auth/login", "body":{}, "session":"id", "capture":{"user id":"user.id"}},
+		{"method":"POST", "url":"/groups/", "body":{"title":"Fees \"<run>\" for <user id>"}, "capture":{"item id":"items.0.id", "qty":"items.0.quantity", "title":"body.title"}},
+		{"method":"GET", "url":"/items/<item id>/<qty>", "capture":{"path":"path"}}
+	]`))
+	if err != nil {
+		t.Fatalf("failed: %+v", err)
+	}
+	r := scenario.Runner{Handler: fakeAPI(), Vars: scenario.Vars{"run": "r1"}}
+	summary := r.Run(context.Background(), steps)
+	if !summary.OK() || summary.Passed != 4 {
+		t.Fatalf("failed: %s: %+v", summary, summary.Results)
+	}
+	if r.Vars["title"] != `Fees "r1" for u1` {
+		t.Fatalf("title=%s", r.Vars["title"])
+	}
+	if r.Vars["path"] != "/items/i1/5" {
+		t.Fatalf("path=%s", r.Vars["path"])
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	steps, _ := scenario.Parse([]byte(`[
+		{"method":"GET", "url":"/groups/"},
+		{"method":"GET", "url":"/groups/<group id>"},
+		{"method":"POST", "url":"/auth/login", "capture":{"x":"missing"}}
+	]`))
+	r := scenario.Runner{Handler: fakeAPI()}
+	summary := r.Run(context.Background(), steps)
+	if summary.Failed != 3 {
+		t.Fatalf("wrong summary %s: %+v", summary, summary.Results)
+	}
+	for i, expected := range []string{"expected status 2xx", "undefined <group id>", "cannot capture <x>"} {
+		if !strings.Contains(summary.Results[i].Error, expected) {
+			t.Fatalf("step %d error \"%s\" does not contain \"%s\"", i+1, summary.Results[i].Error, expected)
+		}
+	}
+
+	r = scenario.Runner{Handler: fakeAPI(), StopOnFailure: true}
+	summary = r.Run(context.Background(), steps)
+	if summary.Failed != 1 || summary.Skipped != 2 || summary.OK() {
+		t.Fatalf("wrong summary with stop on failure: %s", summary)
+	}
+}
+
+func TestRunServer(t *testing.T) {
+	srv := httptest.NewServer(fakeAPI())
+	defer srv.Close()
+	steps, _ := scenario.Parse([]byte(`{"method":"POST", "url":"/auth/login", "session":"id"}
+{"method":"DELETE", "url":"/groups/1"}`))
+	r := scenario.Runner{BaseURL: srv.URL + "/"}
+	if summary := r.Run(context.Background(), steps); !summary.OK() {
+		t.Fatalf("failed: %+v", summary.Results)
+	}
+}
@@ -0,0 +1,136 @@
+package search
+
+import (
+	"strings"
+	"sync"
+)
+
+//Doc is an entity in the memory index
+type Doc struct {
+	Kind    Kind
+	ID      string
+	GroupID string
+	Title   string
+	Text    string //e.g. the description
+	Tags    []string
+}
+
+//MemoryIndex is used by tests instead of the FULLTEXT indexes in the database
+type MemoryIndex struct {
+	sync.Mutex
+	docs map[string]memoryDoc
+}
+
+type memoryDoc struct {
+	Doc
+	title []string
+	text  []string
+	tags  []string
+}
+
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{docs: map[string]memoryDoc{}}
+}
+
+//Put adds the doc or replaces the doc with the same kind and id
+func (idx *MemoryIndex) Put(d Doc) {
+	idx.Lock()
+	defer idx.Unlock()
+	idx.docs[string(d.Kind)+":"+d.ID] = memoryDoc{
+		Doc:   d,
+		title: Terms(d.Title),
+		text:  Terms(d.Text),
+		tags:  Terms(strings.Join(d.Tags, " ")),
+	}
+}
+
+func (idx *MemoryIndex) Delete(kind Kind, id string) {
+	idx.Lock()
+	defer idx.Unlock()
+	delete(idx.docs, string(kind)+":"+id)
+}
+
+//weights of the fields when a term matches a whole word,
+//and half of it when it matches the start of a word
+const (
+	titleWeight = 3
+	tagWeight   = 2
+	textWeight  = 1
+)
+
+func (idx *MemoryIndex) Search(q Query) (Result, error) {
+	if err := q.Validate(); err != nil {
+		return Result{}, err
+	}
+	groups := map[string]bool{}
+	for _, id := range q.GroupIDs {
+		groups[id] = true
+	}
+	terms := Terms(q.Text)
+
+	idx.Lock()
+	defer idx.Unlock()
+	hits := []Hit{}
+	for _, d := range idx.docs {
+		if !groups[d.GroupID] || !q.Want(d.Kind) || !hasTags(d.Tags, q.Tags) {
+			continue
+		}
+		score := 0.0
+		for _, term := range terms {
+			s := matchWeight(term, d.title, titleWeight)
+			if t := matchWeight(term, d.tags, tagWeight); t > s {
+				s = t
+			}
+			if t := matchWeight(term, d.text, textWeight); t > s {
+				s = t
+			}
+			if s == 0 {
+				score = 0
+				break
+			}
+			score += s
+		}
+		if score == 0 && len(terms) > 0 {
+			continue
+		}
+		hits = append(hits, Hit{
+			Kind:    d.Kind,
+			ID:      d.ID,
+			GroupID: d.GroupID,
+			Title:   d.Title,
+			Tags:    d.Tags,
+			Score:   score,
+		})
+	}
+	return NewResult(hits, q), nil
+} //MemoryIndex.Search()
+
+func matchWeight(term string, words []string, weight float64) float64 {
+	best := 0.0
+	for _, w := range words {
+		if w == term {
+			return weight
+		}
+		if strings.HasPrefix(w, term) {
+			best = weight / 2
+		}
+	}
+	return best
+}
+
+//hasTags is true if have includes all of want, ignoring case
+func hasTags(have []string, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if strings.EqualFold(h, w) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
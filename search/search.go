@@ -0,0 +1,183 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/go-msvc/errors"
+)
+
+//Kind of entity found by a search
+type Kind string
+
+const (
+	KindGroup   Kind = "group"
+	KindRequest Kind = "request"
+	KindMember  Kind = "member"
+)
+
+var kinds = []Kind{KindGroup, KindRequest, KindMember}
+
+func ParseKind(s string) (Kind, error) {
+	for _, k := range kinds {
+		if string(k) == s {
+			return k, nil
+		}
+	}
+	return "", errors.Errorf("unknown kind \"%s\" expecting group|request|member", s)
+}
+
+//Index finds entities in the groups of the query
+//implemented in memory for tests and with FULLTEXT indexes in package db
+type Index interface {
+	Search(q Query) (Result, error)
+}
+
+//Query to search with, where all terms must match a word in the entity
+//either the full word or the start of it, after folding the diacritics,
+//so "hoer koek" finds "Hoërskool koekverkoping"
+type Query struct {
+	Text     string   `doc:"Words to find"`
+	Kinds    []Kind   `doc:"Only these kinds of entities (default all)"`
+	Tags     []string `doc:"Only requests with all these tags"`
+	GroupIDs []string `doc:"Only entities in these groups, i.e. the groups the caller may see"`
+	Limit    int      `doc:"Max nr of hits to return (default 20)"`
+}
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+func (q Query) Validate() error {
+	if len(Terms(q.Text)) == 0 && len(q.Tags) == 0 {
+		return errors.Errorf("missing text or tags to search for")
+	}
+	if q.Limit < 0 || q.Limit > MaxLimit {
+		return errors.Errorf("limit:%d must be 1..%d", q.Limit, MaxLimit)
+	}
+	return nil
+}
+
+//Want is true if the query includes the kind of entity
+func (q Query) Want(kind Kind) bool {
+	if len(q.Kinds) == 0 {
+		return true
+	}
+	for _, k := range q.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+//Hit is an entity that matched the query
+type Hit struct {
+	Kind    Kind     `json:"kind"`
+	ID      string   `json:"id"`
+	GroupID string   `json:"group_id" doc:"Group of the entity, or the group itself for kind=group"`
+	Title   string   `json:"title"`
+	Tags    []string `json:"tags,omitempty"`
+	Score   float64  `json:"score" doc:"Higher is a better match, only comparable within the same result"`
+}
+
+//Result of a search
+type Result struct {
+	Hits   []Hit          `json:"hits"`
+	Total  int            `json:"total" doc:"Nr of hits before applying the limit"`
+	Facets map[string]int `json:"facets" doc:"Nr of matching requests with each tag"`
+}
+
+//NewResult ranks all the hits by score, counts the tags of
+//the requests and keeps the best q.Limit hits
+func NewResult(hits []Hit, q Query) Result {
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		if hits[i].Title != hits[j].Title {
+			return hits[i].Title < hits[j].Title
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	res := Result{Hits: hits, Total: len(hits), Facets: map[string]int{}}
+	for _, h := range hits {
+		for _, t := range h.Tags {
+			res.Facets[t]++
+		}
+	}
+	limit := q.Limit
+	if limit == 0 {
+		limit = DefaultLimit
+	}
+	if len(res.Hits) > limit {
+		res.Hits = res.Hits[:limit]
+	}
+	if res.Hits == nil {
+		res.Hits = []Hit{}
+	}
+	return res
+}
+
+//Terms are the distinct folded words in the text
+func Terms(text string) []string {
+	terms := []string{}
+	seen := map[string]bool{}
+	for _, word := range strings.FieldsFunc(Fold(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[word] {
+			seen[word] = true
+			terms = append(terms, word)
+		}
+	}
+	return terms
+}
+
+//Fold returns lowercase text without diacritics, e.g. "Hoër" -> "hoer"
+func Fold(text string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(text) {
+		if s, ok := folded[r]; ok {
+			b.WriteString(s)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+var folded = map[rune]string{}
+
+func init() {
+	for base, runes := range map[string]string{
+		"a":  "àáâãäåāăą",
+		"c":  "çćĉċč",
+		"d":  "ďđ",
+		"e":  "èéêëēĕėęě",
+		"g":  "ĝğġģ",
+		"h":  "ĥħ",
+		"i":  "ìíîïĩīĭįı",
+		"j":  "ĵ",
+		"k":  "ķ",
+		"l":  "ĺļľŀł",
+		"n":  "ñńņňŉ",
+		"o":  "òóôõöøōŏő",
+		"r":  "ŕŗř",
+		"s":  "śŝşš",
+		"t":  "ţťŧ",
+		"u":  "ùúûüũūŭůűų",
+		"w":  "ŵ",
+		"y":  "ýÿŷ",
+		"z":  "źżž",
+		"ae": "æ",
+		"oe": "œ",
+		"ss": "ß",
+	} {
+		for _, r := range runes {
+			folded[r] = base
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package search_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jansemmelink/don8/search"
+)
+
+func TestTerms(t *testing.T) {
+	for text, expected := range map[string][]string{
+		"Hoërskool":                {"hoerskool"},
+		"  Crème brûlée, CRÈME! ":  {"creme", "brulee"},
+		"Straße/Æble-tært 2x":      {"strasse", "aeble", "taert", "2x"},
+		"Łódź naïve façade señor":  {"lodz", "naive", "facade", "senor"},
+		"...":                      {},
+		"pack of 6 (pack of 6)":    {"pack", "of", "6"},
+		"Koek-en-pannekoekverkoop": {"koek", "en", "pannekoekverkoop"},
+	} {
+		if terms := search.Terms(text); !reflect.DeepEqual(terms, expected) {
+			t.Errorf("Terms(%q)=%q, expected %q", text, terms, expected)
+		}
+	}
+}
+
+func newIndex() *search.MemoryIndex {
+	idx := search.NewMemoryIndex()
+	for _, d := range []search.Doc{
+		{Kind: search.KindGroup, ID: "g1", GroupID: "g1", Title: "Hoërskool Waterkloof", Text: "Ouers en onderwysers"},
+		{Kind: search.KindGroup, ID: "g2", GroupID: "g2", Title: "Koekverkoping", Text: "Hoërskool fondsinsameling"},
+		{Kind: search.KindRequest, ID: "r1", GroupID: "g2", Title: "Koeke", Tags: []string{"bak", "kos"}},
+		{Kind: search.KindRequest, ID: "r2", GroupID: "g2", Title: "Koeldrank", Tags: []string{"drink"}},
+		{Kind: search.KindRequest, ID: "r3", GroupID: "g2", Title: "Melktert", Text: "Koek of tert", Tags: []string{"bak"}},
+		{Kind: search.KindMember, ID: "m1", GroupID: "g1", Title: "Anél Koekemoer"},
+		{Kind: search.KindRequest, ID: "r4", GroupID: "g3", Title: "Koeke vir ander skool", Tags: []string{"bak"}},
+	} {
+		idx.Put(d)
+	}
+	return idx
+}
+
+func ids(res search.Result) []string {
+	list := []string{}
+	for _, h := range res.Hits {
+		list = append(list, h.ID)
+	}
+	return list
+}
+
+func TestMemoryIndex(t *testing.T) {
+	idx := newIndex()
+	visible := []string{"g1", "g2"}
+	for _, test := range []struct {
+		query    search.Query
+		expected []string
+	}{
+		//folding and prefix match, ranked by field and whole words before the start of words,
+		//then by title
+		{search.Query{Text: "hoer"}, []string{"g1", "g2"}},
+		{search.Query{Text: "HOËRSKOOL"}, []string{"g1", "g2"}},
+		{search.Query{Text: "koek"}, []string{"m1", "r1", "g2", "r3"}},
+		{search.Query{Text: "koeke"}, []string{"r1", "m1"}},
+		//all terms must match
+		{search.Query{Text: "koek ane"}, []string{"m1"}},
+		{search.Query{Text: "koek xyz"}, []string{}},
+		{search.Query{Text: "koe", Kinds: []search.Kind{search.KindRequest}}, []string{"r1", "r2", "r3"}},
+		{search.Query{Text: "koe", Tags: []string{"BAK"}}, []string{"r1", "r3"}},
+		{search.Query{Tags: []string{"drink"}}, []string{"r2"}},
+		{search.Query{Text: "koe", Limit: 2}, []string{"m1", "r1"}},
+	} {
+		q := test.query
+		q.GroupIDs = visible
+		res, err := idx.Search(q)
+		if err != nil {
+			t.Fatalf("%+v: %+v", q, err)
+		}
+		if got := ids(res); !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%+v -> %v, expected %v", test.query, got, test.expected)
+		}
+	}
+
+	//facets count all matching requests, not only the hits within the limit
+	res, _ := idx.Search(search.Query{Text: "koe", Limit: 1, GroupIDs: visible})
+	if res.Total != 5 || !reflect.DeepEqual(res.Facets, map[string]int{"bak": 2, "kos": 1, "drink": 1}) {
+		t.Errorf("total:%d facets:%v", res.Total, res.Facets)
+	}
+
+	//only the groups in the query are searched
+	res, _ = idx.Search(search.Query{Text: "koeke", GroupIDs: []string{"g3"}})
+	if got := ids(res); !reflect.DeepEqual(got, []string{"r4"}) {
+		t.Errorf("g3 -> %v", got)
+	}
+	res, _ = idx.Search(search.Query{Text: "koeke"})
+	if res.Total != 0 {
+		t.Errorf("found %v without groups", ids(res))
+	}
+
+	idx.Delete(search.KindRequest, "r1")
+	res, _ = idx.Search(search.Query{Text: "koeke", Kinds: []search.Kind{search.KindRequest}, GroupIDs: visible})
+	if res.Total != 0 {
+		t.Errorf("found deleted %v", ids(res))
+	}
+
+	if _, err := idx.Search(search.Query{Text: " - "}); err == nil {
+		t.Errorf("searched without terms or tags")
+	}
+}
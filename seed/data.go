@@ -0,0 +1,55 @@
+package seed
+
+//names used to generate realistic demo data
+
+var schoolNames = []string{
+	"Hoërskool Waterkloof",
+	"Pretoria Boys High",
+	"Affies",
+	"Menlopark Primary",
+	"Midrand High",
+}
+
+var eventNames = []string{
+	"Wildsfees",
+	"Sports Day",
+	"Christmas Market",
+	"Spring Fair",
+	"Matric Farewell",
+	"Family Braai",
+}
+
+var firstNames = []string{
+	"Anna", "Pieter", "Johan", "Marietjie", "Sipho", "Thandi", "Lerato", "Thabo",
+	"Elize", "Willem", "Karin", "Riaan", "Nomsa", "Bongani", "Sarah", "David",
+	"Liezl", "Hennie", "Zanele", "Mpho", "Charlene", "Gerhard", "Annelie", "Kagiso",
+}
+
+var lastNames = []string{
+	"Botha", "van der Merwe", "Nkosi", "Pretorius", "Dlamini", "Venter", "Mokoena", "Smit",
+	"Naidoo", "du Plessis", "Khumalo", "Joubert", "Steyn", "Mahlangu", "Coetzee", "Ndlovu",
+}
+
+type item struct {
+	title string
+	units string
+	tags  string
+	qty   int
+}
+
+var items = []item{
+	{"Flour", "kg", "baking,food", 50},
+	{"Sugar", "kg", "baking,food", 30},
+	{"Eggs", "dozen", "baking,food", 40},
+	{"Cooking oil", "L", "food", 20},
+	{"Boerewors", "kg", "braai,food", 80},
+	{"Bread rolls", "pack of 6", "braai,food", 100},
+	{"Charcoal", "items", "braai", 25},
+	{"Cooldrinks", "pack of 6", "drinks", 60},
+	{"Bottled water", "L", "drinks", 120},
+	{"Paper plates", "pack of 50", "packaging", 20},
+	{"Serviettes", "pack of 100", "packaging", 15},
+	{"Prizes for games", "items", "games,prizes", 40},
+	{"Cake tins", "items", "baking,equipment", 10},
+	{"Gazebos", "items", "equipment", 6},
+}
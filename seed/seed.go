@@ -0,0 +1,341 @@
+package seed
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/google/uuid"
+	"github.com/jansemmelink/don8/db"
+)
+
+//Domain of all seeded email addresses, so they cannot reach real people
+//and only they can be impersonated in dev
+const Domain = "demo.don8.test"
+
+//Password of all seeded users
+const Password = "Demo-1234"
+
+//Options of the generated school
+type Options struct {
+	Seed         int64 `json:"seed" doc:"Same seed gives the same data with the same IDs"`
+	Events       int   `json:"events" doc:"Nr of event groups in the school"`
+	Parents      int   `json:"parents"`
+	Coordinators int   `json:"coordinators" doc:"Nr of coordinators per event"`
+	Requests     int   `json:"requests" doc:"Nr of requests per event"`
+	Invitations  int   `json:"invitations" doc:"Nr of pending invitations to the school"`
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Seed:         1,
+		Events:       3,
+		Parents:      300,
+		Coordinators: 2,
+		Requests:     8,
+		Invitations:  50,
+	}
+}
+
+func (o Options) Validate() error {
+	if o.Events < 1 || o.Events > len(eventNames) {
+		return errors.Errorf("events:%d must be 1..%d", o.Events, len(eventNames))
+	}
+	if o.Parents < 1 || o.Parents > 100000 {
+		return errors.Errorf("parents:%d must be 1..100000", o.Parents)
+	}
+	if o.Coordinators < 1 || o.Coordinators*o.Events >= o.Parents {
+		return errors.Errorf("coordinators:%d must be 1 or more with coordinators*events < parents", o.Coordinators)
+	}
+	if o.Requests < 1 || o.Requests > len(items) {
+		return errors.Errorf("requests:%d must be 1..%d", o.Requests, len(items))
+	}
+	if o.Invitations < 0 {
+		return errors.Errorf("negative invitations:%d", o.Invitations)
+	}
+	return nil
+}
+
+//User is a seeded user who can login with Password
+type User struct {
+	db.User
+	Role string `json:"role"`
+}
+
+//Member is a seeded membership with permissions, e.g. "*" for coordinators
+type Member struct {
+	db.Member
+	Permissions []db.Permission `json:"permissions,omitempty"`
+}
+
+//Fixture is the generated data, written to the database by Apply()
+type Fixture struct {
+	Options     Options         `json:"options"`
+	Users       []User          `json:"users"`
+	Groups      []db.Group      `json:"groups"`
+	Members     []Member        `json:"members"`
+	Locations   []db.Location   `json:"locations"`
+	Requests    []db.Request    `json:"requests"`
+	Promises    []db.Promise    `json:"promises"`
+	Donations   []db.Donation   `json:"donations"`
+	Invitations []db.Invitation `json:"invitations"`
+}
+
+//Generate a school with events, coordinators, parents, requests, promises,
+//donations and invitations. The same options give the same fixture.
+//Dates are relative to the start of the year of now.
+func Generate(o Options, now time.Time) (Fixture, error) {
+	if err := o.Validate(); err != nil {
+		return Fixture{}, errors.Wrapf(err, "invalid seed options")
+	}
+	g := generator{
+		Fixture: Fixture{Options: o},
+		rand:    rand.New(rand.NewSource(o.Seed)),
+		year:    time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, time.Local),
+	}
+	g.generate()
+	return g.Fixture, nil
+}
+
+type generator struct {
+	Fixture
+	rand *rand.Rand
+	year time.Time
+}
+
+//id is the same for the same seed, kind and index
+func (g *generator) id(kind string, i int) db.ID {
+	return db.ID(uuid.NewSHA1(uuid.NameSpaceOID, []byte(fmt.Sprintf("don8/seed/%d/%s/%d", g.Options.Seed, kind, i))).String())
+}
+
+func (g *generator) pick(list []string) string {
+	return list[g.rand.Intn(len(list))]
+}
+
+func (g *generator) generate() {
+	o := g.Options
+	school := db.Group{
+		ID:          g.id("group", 0),
+		Title:       fmt.Sprintf("%s %d", g.pick(schoolNames), o.Seed),
+		Description: str("Demo school generated by don8 seed"),
+	}
+	g.Groups = append(g.Groups, school)
+
+	for i := 0; i < o.Parents; i++ {
+		first, last := g.pick(firstNames), g.pick(lastNames)
+		g.Users = append(g.Users, User{
+			User: db.User{
+				ID:    g.id("user", i),
+				Name:  first + " " + last,
+				Phone: fmt.Sprintf("08%08d", (o.Seed%100)*1000000+int64(i)),
+				Email: fmt.Sprintf("%s.%s.%d@s%d.%s", strings.ToLower(first), strings.ToLower(strings.ReplaceAll(last, " ", "")), i, o.Seed, Domain),
+			},
+			Role: "Parent",
+		})
+		g.Members = append(g.Members, Member{Member: db.Member{
+			ID:      g.id("member", i),
+			GroupID: school.ID,
+			UserID:  g.Users[i].ID,
+			Role:    "Parent",
+		}})
+	}
+	//first parents are the coordinators of the school and events
+	g.Members[0].Role = "Principal"
+	g.Members[0].Permissions = []db.Permission{"*"}
+	g.Users[0].Role = "Principal"
+
+	promiseNr, donationNr := 0, 0
+	for e := 0; e < o.Events; e++ {
+		start := g.year.AddDate(0, 2+e*3, g.rand.Intn(28)).Add(8 * time.Hour)
+		end := start.Add(10 * time.Hour)
+		event := db.Group{
+			ID:            g.id("group", e+1),
+			ParentGroupID: school.ID,
+			Title:         eventNames[e],
+			Description:   str(fmt.Sprintf("%s at %s", eventNames[e], school.Title)),
+			Start:         sqlTime(start),
+			End:           sqlTime(end),
+		}
+		g.Groups = append(g.Groups, event)
+		for c := 0; c < o.Coordinators; c++ {
+			u := &g.Users[1+e*o.Coordinators+c]
+			u.Role = "Coordinator"
+			g.Members = append(g.Members, Member{
+				Member: db.Member{
+					ID:      g.id("coordinator", e*o.Coordinators+c),
+					GroupID: event.ID,
+					UserID:  u.ID,
+					Role:    "Coordinator",
+				},
+				Permissions: []db.Permission{"*"},
+			})
+		}
+
+		hall := db.Location{ID: g.id("location", e*2), GroupID: event.ID, Title: "School hall", FinalDestination: true}
+		gate := db.Location{ID: g.id("location", e*2+1), GroupID: event.ID, Title: "Main gate", Description: str("Drop off before school")}
+		g.Locations = append(g.Locations, hall, gate)
+
+		for r, i := range g.rand.Perm(len(items))[:o.Requests] {
+			item := items[i]
+			request := db.Request{
+				ID:      g.id("request", e*len(items)+r),
+				GroupID: event.ID,
+				Title:   item.title,
+				Tags:    db.ParseTags(item.tags),
+				Units:   str(item.units),
+				Qty:     item.qty,
+			}
+			g.Requests = append(g.Requests, request)
+
+			//parents promise up to about the requested qty, some already delivered
+			promised := 0
+			for promised < request.Qty*4/5 {
+				qty := 1 + g.rand.Intn(max(1, request.Qty/5))
+				user := g.Users[g.rand.Intn(o.Parents)]
+				location := gate.ID
+				if g.rand.Intn(2) == 0 {
+					location = hall.ID
+				}
+				p := db.Promise{
+					ID:         g.id("promise", promiseNr),
+					RequestID:  request.ID,
+					UserID:     user.ID,
+					LocationID: &location,
+					Qty:        qty,
+					Date:       db.SqlTime(start.AddDate(0, 0, -1-g.rand.Intn(14))),
+				}
+				promiseNr++
+				if g.rand.Intn(3) == 0 {
+					p.Status = db.PromiseStatusDelivered
+					requestID, promiseID := request.ID, p.ID
+					g.Donations = append(g.Donations, db.Donation{
+						ID:         g.id("donation", donationNr),
+						LocationID: location,
+						RequestID:  &requestID,
+						PromiseID:  &promiseID,
+						Title:      request.Title,
+						Unit:       item.units,
+						Qty:        qty,
+					})
+					donationNr++
+				}
+				g.Promises = append(g.Promises, p)
+				promised += qty
+			}
+		}
+
+		//ad hoc donation without a request
+		g.Donations = append(g.Donations, db.Donation{
+			ID:         g.id("donation", donationNr),
+			LocationID: gate.ID,
+			Title:      "Second hand books",
+			Unit:       "items",
+			Qty:        5 + g.rand.Intn(20),
+		})
+		donationNr++
+	}
+
+	created := db.SqlTime(g.year)
+	for i := 0; i < o.Invitations; i++ {
+		g.Invitations = append(g.Invitations, db.Invitation{
+			ID:          g.id("invitation", i),
+			GroupID:     school.ID,
+			Email:       fmt.Sprintf("invited.%d@s%d.%s", i, o.Seed, Domain),
+			TimeCreated: created,
+			TimeUpdated: created,
+		})
+	}
+} //generator.generate()
+
+//Counts of rows in the fixture, or inserted by Apply()
+type Counts map[string]int
+
+//Apply writes the fixture to the database, skipping rows that already exist,
+//and returns the nr of rows inserted
+func Apply(f Fixture) (Counts, error) {
+	inserted := Counts{}
+	for name := range f.Counts() {
+		inserted[name] = 0
+	}
+	counter := func(name string) func(bool, error) error {
+		return func(ok bool, err error) error {
+			if ok {
+				inserted[name]++
+			}
+			return err
+		}
+	}
+	for _, u := range f.Users {
+		if err := counter("users")(db.SeedUser(u.User, Password)); err != nil {
+			return inserted, err
+		}
+	}
+	for _, g := range f.Groups {
+		if err := counter("groups")(db.SeedGroup(g)); err != nil {
+			return inserted, err
+		}
+	}
+	for _, m := range f.Members {
+		if err := counter("members")(db.SeedMember(m.Member, m.Permissions)); err != nil {
+			return inserted, err
+		}
+	}
+	for _, l := range f.Locations {
+		if err := counter("locations")(db.SeedLocation(l)); err != nil {
+			return inserted, err
+		}
+	}
+	for _, r := range f.Requests {
+		if err := counter("requests")(db.SeedRequest(r)); err != nil {
+			return inserted, err
+		}
+	}
+	for _, p := range f.Promises {
+		if err := counter("promises")(db.SeedPromise(p)); err != nil {
+			return inserted, err
+		}
+	}
+	for _, d := range f.Donations {
+		if err := counter("donations")(db.SeedDonation(d)); err != nil {
+			return inserted, err
+		}
+	}
+	for _, inv := range f.Invitations {
+		if err := counter("invitations")(db.SeedInvitation(inv)); err != nil {
+			return inserted, err
+		}
+	}
+	return inserted, nil
+} //Apply()
+
+//Counts of rows in the fixture
+func (f Fixture) Counts() Counts {
+	return Counts{
+		"users":       len(f.Users),
+		"groups":      len(f.Groups),
+		"members":     len(f.Members),
+		"locations":   len(f.Locations),
+		"requests":    len(f.Requests),
+		"promises":    len(f.Promises),
+		"donations":   len(f.Donations),
+		"invitations": len(f.Invitations),
+	}
+}
+
+func str(s string) *string {
+	return &s
+}
+
+func sqlTime(t time.Time) *db.SqlTime {
+	st := db.SqlTime(t)
+	return &st
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,139 @@
+package seed_test
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/model"
+	"github.com/jansemmelink/don8/seed"
+)
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	now := time.Date(2023, 6, 1, 0, 0, 0, 0, time.Local)
+	f1, err := seed.Generate(seed.DefaultOptions(), now)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	f2, _ := seed.Generate(seed.DefaultOptions(), now)
+	j1, _ := json.Marshal(f1)
+	j2, _ := json.Marshal(f2)
+	if string(j1) != string(j2) {
+		t.Fatalf("same seed gave different fixtures")
+	}
+
+	o := seed.DefaultOptions()
+	o.Seed = 2
+	f3, _ := seed.Generate(o, now)
+	if f3.Users[0].ID == f1.Users[0].ID || f3.Users[0].Email == f1.Users[0].Email || f3.Users[0].Phone == f1.Users[0].Phone {
+		t.Fatalf("other seed gave the same user: %+v", f3.Users[0])
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	o := seed.DefaultOptions()
+	f, err := seed.Generate(o, time.Now())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	counts := f.Counts()
+	if counts["users"] != o.Parents || counts["groups"] != 1+o.Events || counts["requests"] != o.Events*o.Requests ||
+		counts["invitations"] != o.Invitations || counts["members"] != o.Parents+o.Events*o.Coordinators {
+		t.Fatalf("wrong counts: %+v", counts)
+	}
+	if counts["promises"] < counts["requests"] || counts["donations"] < o.Events {
+		t.Fatalf("too few promises or donations: %+v", counts)
+	}
+
+	//unique IDs and valid references
+	ids := map[db.ID]string{}
+	add := func(kind string, id db.ID) {
+		if other, ok := ids[id]; ok {
+			t.Fatalf("%s id %s also used for %s", kind, id, other)
+		}
+		ids[id] = kind
+	}
+	ref := func(kind string, id db.ID) {
+		if ids[id] != kind {
+			t.Fatalf("reference to unknown %s %s", kind, id)
+		}
+	}
+	phonePattern := regexp.MustCompile(`^0[0-9]{9}$`)
+	emails := map[string]bool{}
+	for _, u := range f.Users {
+		add("user", u.ID)
+		if !phonePattern.MatchString(u.Phone) || !strings.HasSuffix(u.Email, "."+seed.Domain) || emails[u.Email] {
+			t.Fatalf("invalid user %+v", u)
+		}
+		emails[u.Email] = true
+		if err := u.User.Validate(); err != nil {
+			t.Fatalf("invalid user %+v: %+v", u, err)
+		}
+	}
+	for _, g := range f.Groups {
+		add("group", g.ID)
+		if g.ParentGroupID != "" {
+			ref("group", g.ParentGroupID)
+		}
+	}
+	coordinators := 0
+	for _, m := range f.Members {
+		add("member", m.ID)
+		ref("group", m.GroupID)
+		ref("user", m.UserID)
+		if len(m.Permissions) > 0 {
+			coordinators++
+		}
+	}
+	if coordinators != 1+o.Events*o.Coordinators {
+		t.Fatalf("%d coordinators", coordinators)
+	}
+	for _, l := range f.Locations {
+		add("location", l.ID)
+		ref("group", l.GroupID)
+	}
+	for _, r := range f.Requests {
+		add("request", r.ID)
+		ref("group", r.GroupID)
+		if _, err := model.ParseUnit(*r.Units); err != nil {
+			t.Fatalf("request %s: %+v", r.Title, err)
+		}
+		if err := r.Validate(); err != nil || len(r.Tags) == 0 {
+			t.Fatalf("invalid request %+v: %+v", r, err)
+		}
+	}
+	for _, p := range f.Promises {
+		add("promise", p.ID)
+		ref("request", p.RequestID)
+		ref("user", p.UserID)
+		ref("location", *p.LocationID)
+	}
+	for _, d := range f.Donations {
+		add("donation", d.ID)
+		ref("location", d.LocationID)
+		if d.PromiseID != nil {
+			ref("promise", *d.PromiseID)
+			ref("request", *d.RequestID)
+		}
+	}
+	for _, inv := range f.Invitations {
+		add("invitation", inv.ID)
+		ref("group", inv.GroupID)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	o := seed.DefaultOptions()
+	o.Coordinators = 100
+	if _, err := seed.Generate(o, time.Now()); err == nil {
+		t.Fatalf("more coordinators than parents accepted")
+	}
+	o = seed.DefaultOptions()
+	o.Events = 100
+	if _, err := seed.Generate(o, time.Now()); err == nil {
+		t.Fatalf("too many events accepted")
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/seed"
+)
+
+//devRoutes are only added in the dev environment
+func (a *api) devRoutes(r *mux.Router) {
+	r.Handle("/impersonate", a.hdlr(a.impersonate, authNone)).Methods(http.MethodPost)
+}
+
+type impersonateRequest struct {
+	Email string `json:"email" doc:"Email of a user created by \"don8 seed\""`
+}
+
+func (req impersonateRequest) Validate() error {
+	if !strings.HasSuffix(strings.ToLower(req.Email), "."+seed.Domain) {
+		return apierr.Invalid("email", "only seeded users with emails @...%s can be impersonated", seed.Domain)
+	}
+	return nil
+}
+
+//impersonate starts a session for a seeded user without a password,
+//so that developers can switch between users in the app
+func (a *api) impersonate(ctx context.Context, req impersonateRequest) (db.Session, error) {
+	u, err := a.store.GetUserByEmail(req.Email)
+	if err != nil {
+		return db.Session{}, apierr.Wrapf(err, apierr.NotFound, "unknown user")
+	}
+	if u.Disabled {
+		return db.Session{}, apierr.Errorf(apierr.Forbidden, "account disabled")
+	}
+	log.Infof("impersonating user(id:%s,email:%s)", u.ID, u.Email)
+	return a.store.NewSession(u)
+}
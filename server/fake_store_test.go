@@ -0,0 +1,859 @@
+package server_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/model"
+	"github.com/jansemmelink/don8/search"
+	"github.com/jansemmelink/don8/server"
+)
+
+//fakeStore keeps the data used in the tests in memory
+//the embedded interface is nil, so other methods panic when called
+type fakeStore struct {
+	server.Store
+	sync.Mutex
+	nextID   int
+	users    map[db.ID]db.User
+	pwds     map[db.ID]string
+	sessions map[db.ID]db.Session
+	groups   map[db.ID]db.Group
+	members  map[db.ID][]db.Member
+	requests map[db.ID]db.Request
+	promises map[db.ID]db.Promise
+	//promise ids in the order they were made
+	promiseIDs []db.ID
+	index      *search.MemoryIndex
+	tags       map[db.ID]db.Tag
+	//tag ids of each request
+	requestTags map[db.ID][]db.ID
+	payments    []db.Payment
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		users:       map[db.ID]db.User{},
+		pwds:        map[db.ID]string{},
+		sessions:    map[db.ID]db.Session{},
+		groups:      map[db.ID]db.Group{},
+		members:     map[db.ID][]db.Member{},
+		requests:    map[db.ID]db.Request{},
+		promises:    map[db.ID]db.Promise{},
+		index:       search.NewMemoryIndex(),
+		tags:        map[db.ID]db.Tag{},
+		requestTags: map[db.ID][]db.ID{},
+	}
+}
+
+func (s *fakeStore) id(prefix string) db.ID {
+	s.nextID++
+	return db.ID(fmt.Sprintf("%s%d", prefix, s.nextID))
+}
+
+func (s *fakeStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *fakeStore) AddUser(u db.User) (db.User, error) {
+	if err := u.Validate(); err != nil {
+		return db.User{}, apierr.Validation(err)
+	}
+	s.Lock()
+	defer s.Unlock()
+	for _, existing := range s.users {
+		if existing.Email == u.Email {
+			return db.User{}, apierr.Errorf(apierr.Conflict, "email already registered")
+		}
+	}
+	u.ID = s.id("user")
+	tpw := "tpw-" + string(u.ID)
+	u.Tpw = &tpw
+	s.users[u.ID] = u
+	return u, nil
+}
+
+func (s *fakeStore) Activate(req db.ActivateRequest) (db.Session, error) {
+	s.Lock()
+	defer s.Unlock()
+	for id, u := range s.users {
+		if u.Tpw != nil && *u.Tpw == req.Tpw {
+			u.Tpw = nil
+			s.users[id] = u
+			s.pwds[id] = req.Pwd
+			return s.newSession(u), nil
+		}
+	}
+	return db.Session{}, apierr.Errorf(apierr.NotFound, "failed to activate")
+}
+
+func (s *fakeStore) Login(req db.LoginRequest) (db.Session, error) {
+	s.Lock()
+	defer s.Unlock()
+	for id, u := range s.users {
+		if u.Email == req.Email && s.pwds[id] != "" && s.pwds[id] == req.Password {
+			return s.newSession(u), nil
+		}
+	}
+	return db.Session{}, apierr.Errorf(apierr.Unauthorized, "wrong email or password")
+}
+
+func (s *fakeStore) GetUserByEmail(email string) (db.User, error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return db.User{}, apierr.Errorf(apierr.NotFound, "unknown user")
+}
+
+func (s *fakeStore) NewSession(u db.User) (db.Session, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.newSession(u), nil
+}
+
+//newSession is like db.NewSession() and db.GetSession() that only set the User, not UserID
+func (s *fakeStore) newSession(u db.User) db.Session {
+	sess := db.Session{
+		ID:         s.id("session"),
+		User:       &u,
+		StartTime:  db.SqlTime(time.Now()),
+		ExpiryTime: db.SqlTime(time.Now().Add(time.Hour)),
+	}
+	s.sessions[sess.ID] = sess
+	return sess
+}
+
+func (s *fakeStore) GetSession(sid db.ID) (db.Session, error) {
+	s.Lock()
+	defer s.Unlock()
+	sess, ok := s.sessions[sid]
+	if !ok {
+		return db.Session{}, apierr.Errorf(apierr.Unauthorized, "unknown session")
+	}
+	return sess, nil
+}
+
+func (s *fakeStore) Logout(sid db.ID) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.sessions, sid)
+	return nil
+}
+
+func (s *fakeStore) AddGroup(u db.User, ng db.NewGroup) (db.Group, error) {
+	s.Lock()
+	defer s.Unlock()
+	g := db.Group{
+		ID:            s.id("group"),
+		ParentGroupID: ng.ParentGroupID,
+		Title:         ng.Title,
+		Description:   ng.Description,
+	}
+	s.groups[g.ID] = g
+	m := db.Member{ID: s.id("member"), GroupID: g.ID, UserID: u.ID, Role: ng.UserRole}
+	s.members[g.ID] = append(s.members[g.ID], m)
+	s.index.Put(search.Doc{Kind: search.KindGroup, ID: string(g.ID), GroupID: string(g.ID), Title: g.Title, Text: optStr(g.Description)})
+	s.index.Put(search.Doc{Kind: search.KindMember, ID: string(m.ID), GroupID: string(g.ID), Title: s.users[u.ID].Name})
+	return g, nil
+}
+
+func (s *fakeStore) GetGroup(id db.ID) (db.Group, error) {
+	s.Lock()
+	defer s.Unlock()
+	g, ok := s.groups[id]
+	if !ok {
+		return db.Group{}, apierr.Errorf(apierr.NotFound, "unknown group")
+	}
+	return g, nil
+}
+
+func (s *fakeStore) GetFullGroup(id db.ID) (db.FullGroup, error) {
+	g, err := s.GetGroup(id)
+	if err != nil {
+		return db.FullGroup{}, err
+	}
+	return db.FullGroup{Group: g}, nil
+}
+
+func (s *fakeStore) GetChildGroupByTitle(parentGroupID db.ID, title string) (*db.Group, error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, g := range s.groups {
+		if g.ParentGroupID == parentGroupID && g.Title == title {
+			return &g, nil
+		}
+	}
+	return nil, nil
+}
+
+//UpdGroup moves the group unless it would make a cycle, like the db does
+func (s *fakeStore) UpdGroup(req db.UpdGroupRequest) error {
+	s.Lock()
+	defer s.Unlock()
+	g, ok := s.groups[req.ID]
+	if !ok {
+		return apierr.Errorf(apierr.NotFound, "unknown group")
+	}
+	if req.ParentGroupID != nil {
+		if *req.ParentGroupID != "" {
+			if _, ok := s.groups[*req.ParentGroupID]; !ok {
+				return apierr.Invalid("parent_group_id", "unknown parent group")
+			}
+		}
+		for id := *req.ParentGroupID; id != ""; id = s.groups[id].ParentGroupID {
+			if id == req.ID {
+				return apierr.Invalid("parent_group_id", "cannot move a group under itself or its own sub-group")
+			}
+		}
+		g.ParentGroupID = *req.ParentGroupID
+	}
+	if req.Title != nil {
+		g.Title = *req.Title
+	}
+	if req.Description != nil {
+		g.Description = req.Description
+	}
+	s.groups[g.ID] = g
+	return nil
+}
+
+//GetGroupTree builds the tree from the same data as the db, without receives
+func (s *fakeStore) GetGroupTree(id db.ID, maxDepth int) (db.GroupNode, error) {
+	s.Lock()
+	defer s.Unlock()
+	g, ok := s.groups[id]
+	if !ok {
+		return db.GroupNode{}, apierr.Errorf(apierr.NotFound, "unknown group")
+	}
+	data := db.GroupTreeData{}
+	var add func(g db.Group, depth int)
+	add = func(g db.Group, depth int) {
+		data.Groups = append(data.Groups, db.GroupTreeEntry{ID: g.ID, ParentGroupID: g.ParentGroupID, Title: g.Title, Depth: depth})
+		for _, m := range s.members[g.ID] {
+			data.Members = append(data.Members, db.GroupTreeMember{GroupID: g.ID, UserID: m.UserID})
+		}
+		for _, r := range s.requests {
+			if r.GroupID != g.ID {
+				continue
+			}
+			data.Requests = append(data.Requests, db.GroupTreeRequest{ID: r.ID, GroupID: r.GroupID, Type: r.Type, Currency: r.Currency, Units: r.Units, Qty: r.Qty, Status: r.Status, Promised: s.promised(r.ID)})
+		}
+		children := []db.Group{}
+		for _, c := range s.groups {
+			if c.ParentGroupID == g.ID {
+				children = append(children, c)
+			}
+		}
+		sort.Slice(children, func(i, j int) bool { return children[i].Title < children[j].Title })
+		for _, c := range children {
+			add(c, depth+1)
+		}
+	}
+	add(g, 0)
+	return data.Build(maxDepth)
+}
+
+func (s *fakeStore) MyGroups(u db.User, filter string, fromTime *time.Time, toTime *time.Time, page db.PageRequest) (db.MyGroupList, error) {
+	s.Lock()
+	defer s.Unlock()
+	list := db.MyGroupList{Groups: []db.MyGroup{}}
+	for groupID, members := range s.members {
+		for _, m := range members {
+			if m.UserID == u.ID {
+				g := s.groups[groupID]
+				list.Groups = append(list.Groups, db.MyGroup{ID: g.ID, ParentID: g.ParentGroupID, Title: g.Title, Role: m.Role})
+			}
+		}
+	}
+	list.Total = len(list.Groups)
+	return list, nil
+}
+
+//GetMemberByEmail includes members of the parent groups
+func (s *fakeStore) GetMemberByEmail(groupID db.ID, email string) (*db.Member, error) {
+	s.Lock()
+	defer s.Unlock()
+	for id := groupID; id != ""; id = s.groups[id].ParentGroupID {
+		for _, m := range s.members[id] {
+			if s.users[m.UserID].Email == email {
+				return &m, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+//IsGroupCoordinator is true for the members who created the group
+func (s *fakeStore) IsGroupCoordinator(groupID db.ID, userID db.ID) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.isMember(groupID, userID), nil
+}
+
+func (s *fakeStore) AddRequest(r db.Request) (db.Request, error) {
+	if err := r.Validate(); err != nil {
+		return db.Request{}, apierr.Validation(err)
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.groups[r.GroupID]; !ok {
+		return db.Request{}, apierr.Errorf(apierr.NotFound, "unknown group")
+	}
+	r.ID = s.id("request")
+	for _, name := range r.Tags {
+		s.requestTags[r.ID] = append(s.requestTags[r.ID], s.tagID(r.GroupID, name))
+	}
+	s.requests[r.ID] = r
+	s.index.Put(search.Doc{Kind: search.KindRequest, ID: string(r.ID), GroupID: string(r.GroupID), Title: r.Title, Text: optStr(r.Description), Tags: r.Tags})
+	return s.withTags(r), nil
+}
+
+func (s *fakeStore) UpdRequest(req db.UpdRequestRequest) error {
+	s.Lock()
+	defer s.Unlock()
+	r, ok := s.requests[req.ID]
+	if !ok {
+		return apierr.Errorf(apierr.NotFound, "unknown request")
+	}
+	if req.Title != nil {
+		r.Title = *req.Title
+	}
+	if req.Qty != nil {
+		r.Qty = *req.Qty
+	}
+	if req.NeededBy != nil {
+		r.NeededBy = req.NeededBy
+	}
+	if req.Priority != nil {
+		r.Priority = *req.Priority
+	}
+	if req.MinPerDonor != nil {
+		r.MinPerDonor = *req.MinPerDonor
+	}
+	if req.MaxPerDonor != nil {
+		r.MaxPerDonor = *req.MaxPerDonor
+	}
+	if req.OverflowPct != nil {
+		r.OverflowPct = *req.OverflowPct
+	}
+	if req.Waitlist != nil {
+		r.Waitlist = *req.Waitlist
+	}
+	if req.Status != nil && *req.Status != r.Status {
+		if err := r.Status.CanChangeTo(*req.Status); err != nil {
+			return err
+		}
+		r.Status = *req.Status
+	}
+	if req.Tags != nil {
+		s.requestTags[r.ID] = nil
+		for _, name := range *req.Tags {
+			s.requestTags[r.ID] = append(s.requestTags[r.ID], s.tagID(r.GroupID, name))
+		}
+	}
+	s.requests[r.ID] = r
+	s.promoteWaitlist(r)
+	return nil
+}
+
+//tagID finds or adds the tag in the group
+func (s *fakeStore) tagID(groupID db.ID, name string) db.ID {
+	for id, t := range s.tags {
+		if t.GroupID == groupID && strings.EqualFold(t.Name, name) {
+			return id
+		}
+	}
+	t := db.Tag{ID: s.id("tag"), GroupID: groupID, Name: name}
+	s.tags[t.ID] = t
+	return t.ID
+}
+
+//withTags sets the names of the request tags
+func (s *fakeStore) withTags(r db.Request) db.Request {
+	r.Tags = db.TagList{}
+	for _, id := range s.requestTags[r.ID] {
+		r.Tags = append(r.Tags, s.tags[id].Name)
+	}
+	return r
+}
+
+func (s *fakeStore) GetRequest(id db.ID) (db.Request, error) {
+	s.Lock()
+	defer s.Unlock()
+	r, ok := s.requests[id]
+	if !ok {
+		return db.Request{}, apierr.Errorf(apierr.NotFound, "unknown request")
+	}
+	return s.withTags(r), nil
+}
+
+func (s *fakeStore) GetRequestByTitle(groupID db.ID, title string) (*db.Request, error) {
+	s.Lock()
+	defer s.Unlock()
+	for _, r := range s.requests {
+		if r.GroupID == groupID && r.Title == title {
+			r = s.withTags(r)
+			return &r, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeStore) GetFullRequest(id db.ID) (db.FullRequest, error) {
+	r, err := s.GetRequest(id)
+	if err != nil {
+		return db.FullRequest{}, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	fr := db.FullRequest{Group: s.groups[r.GroupID], Request: r}
+	fr.Progress.Qty = r.Qty
+	for _, p := range s.promises {
+		if p.RequestID == id {
+			fr.Promises = append(fr.Promises, p)
+		}
+	}
+	fr.Progress.Promised = float64(s.promised(id))
+	fr.Progress.Waitlisted = float64(s.promisedWith(id, db.PromiseStatusWaitlisted))
+	for _, p := range s.payments {
+		if p.RequestID == id {
+			fr.Progress.Received += float64(p.Amount)
+		}
+	}
+	return fr, nil
+}
+
+//FindRequests filters like the db, sorted on title or -priority
+func (s *fakeStore) FindRequests(groupID db.ID, filter db.RequestFilter, page db.PageRequest) (db.RequestList, error) {
+	s.Lock()
+	defer s.Unlock()
+	list := db.RequestList{Requests: []db.Request{}}
+	for _, r := range s.requests {
+		r = s.withTags(r)
+		if r.GroupID != groupID || r.Priority < filter.MinPriority {
+			continue
+		}
+		if filter.NeededBefore != nil && (r.NeededBy == nil || !time.Time(*r.NeededBy).Before(*filter.NeededBefore)) {
+			continue
+		}
+		found := len(filter.Statuses) == 0
+		for _, status := range filter.Statuses {
+			found = found || r.Status == status
+		}
+		for _, tag := range filter.Tags {
+			found = found && r.Tags.Has(tag)
+		}
+		if found {
+			list.Requests = append(list.Requests, r)
+		}
+	}
+	sort.Slice(list.Requests, func(i, j int) bool {
+		if a, b := list.Requests[i], list.Requests[j]; page.Sort == "-priority" && a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return list.Requests[i].Title < list.Requests[j].Title
+	})
+	list.Total = len(list.Requests)
+	return list, nil
+}
+
+func (s *fakeStore) ListTags(groupID db.ID, prefix string, limit int) ([]db.Tag, error) {
+	s.Lock()
+	defer s.Unlock()
+	list := []db.Tag{}
+	for id, t := range s.tags {
+		if t.GroupID == groupID && strings.HasPrefix(strings.ToLower(t.Name), strings.ToLower(prefix)) {
+			list = append(list, s.tag(id))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Requests != list[j].Requests {
+			return list[i].Requests > list[j].Requests
+		}
+		return list[i].Name < list[j].Name
+	})
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, nil
+}
+
+//tag with the nr of requests
+func (s *fakeStore) tag(id db.ID) db.Tag {
+	t := s.tags[id]
+	t.Requests = len(s.tagRequests(id))
+	return t
+}
+
+func (s *fakeStore) tagRequests(tagID db.ID) []db.ID {
+	ids := []db.ID{}
+	for requestID, tagIDs := range s.requestTags {
+		for _, id := range tagIDs {
+			if id == tagID {
+				ids = append(ids, requestID)
+			}
+		}
+	}
+	return ids
+}
+
+func (s *fakeStore) AddTag(t db.Tag) (db.Tag, error) {
+	if err := t.Validate(); err != nil {
+		return db.Tag{}, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	for _, existing := range s.tags {
+		if existing.GroupID == t.GroupID && strings.EqualFold(existing.Name, t.Name) {
+			return db.Tag{}, apierr.Errorf(apierr.Conflict, "tag already exists")
+		}
+	}
+	t.ID = s.id("tag")
+	s.tags[t.ID] = t
+	return t, nil
+}
+
+func (s *fakeStore) GetTag(id db.ID) (db.Tag, error) {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.tags[id]; !ok {
+		return db.Tag{}, apierr.Errorf(apierr.NotFound, "unknown tag")
+	}
+	return s.tag(id), nil
+}
+
+func (s *fakeStore) UpdTag(req db.UpdTagRequest) (db.Tag, error) {
+	t, err := s.GetTag(req.ID)
+	if err != nil {
+		return db.Tag{}, err
+	}
+	if req.Name != nil {
+		t.Name = *req.Name
+	}
+	if req.Colour != nil {
+		t.Colour = *req.Colour
+	}
+	if err := t.Validate(); err != nil {
+		return db.Tag{}, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	for id, other := range s.tags {
+		if id != t.ID && other.GroupID == t.GroupID && strings.EqualFold(other.Name, t.Name) {
+			return db.Tag{}, apierr.Errorf(apierr.Conflict, "tag \"%s\" already exists, merge into it instead", t.Name)
+		}
+	}
+	s.tags[t.ID] = t
+	return s.tag(t.ID), nil
+}
+
+func (s *fakeStore) MergeTags(fromID db.ID, intoID db.ID) (db.Tag, error) {
+	s.Lock()
+	defer s.Unlock()
+	from, into := s.tags[fromID], s.tags[intoID]
+	if into.ID == "" || from.GroupID != into.GroupID || fromID == intoID {
+		return db.Tag{}, apierr.Errorf(apierr.ValidationFailed, "cannot merge")
+	}
+	for _, requestID := range s.tagRequests(fromID) {
+		s.removeRequestTag(requestID, fromID)
+		s.removeRequestTag(requestID, intoID)
+		s.requestTags[requestID] = append(s.requestTags[requestID], intoID)
+	}
+	delete(s.tags, fromID)
+	return s.tag(intoID), nil
+}
+
+func (s *fakeStore) removeRequestTag(requestID db.ID, tagID db.ID) {
+	ids := []db.ID{}
+	for _, id := range s.requestTags[requestID] {
+		if id != tagID {
+			ids = append(ids, id)
+		}
+	}
+	s.requestTags[requestID] = ids
+}
+
+func (s *fakeStore) DelTag(id db.ID) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, requestID := range s.tagRequests(id) {
+		s.removeRequestTag(requestID, id)
+	}
+	delete(s.tags, id)
+	return nil
+}
+
+//GetTagStats only totals the requested and promised qty
+func (s *fakeStore) GetTagStats(groupID db.ID) ([]db.TagStats, error) {
+	s.Lock()
+	defer s.Unlock()
+	list := []db.TagStats{}
+	for id, t := range s.tags {
+		if t.GroupID != groupID {
+			continue
+		}
+		stats := db.TagStats{TagID: id, Name: t.Name, Colour: t.Colour}
+		for _, requestID := range s.tagRequests(id) {
+			r := s.requests[requestID]
+			stats.Unit = r.Unit()
+			stats.Requests++
+			stats.Requested += float64(r.Qty)
+			stats.Promised += float64(s.promised(requestID))
+		}
+		list = append(list, stats)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (s *fakeStore) AddPromise(p db.Promise) (db.Promise, error) {
+	s.Lock()
+	defer s.Unlock()
+	userPromised := 0
+	for _, existing := range s.promises {
+		if existing.RequestID == p.RequestID && existing.UserID == p.UserID && existing.Status != db.PromiseStatusWithdrawn {
+			userPromised += existing.Qty
+		}
+	}
+	r := s.requests[p.RequestID]
+	if err := r.CanPromise(p.Qty, userPromised); err != nil {
+		return db.Promise{}, err
+	}
+	var err error
+	if p.Status, err = r.ReservePromise(p.Qty, s.promised(r.ID)); err != nil {
+		return db.Promise{}, err
+	}
+	p.ID = s.id("promise")
+	if r.Type == db.RequestTypeMoney {
+		//pledge references only use the characters of db references
+		ref := strings.NewReplacer("0", "Z", "1", "Y").Replace(fmt.Sprintf("D8FAKE%04d", s.nextID))
+		p.Reference = &ref
+	}
+	s.promises[p.ID] = p
+	s.promiseIDs = append(s.promiseIDs, p.ID)
+	return p, nil
+}
+
+func (s *fakeStore) GetPromise(id db.ID) (db.Promise, error) {
+	s.Lock()
+	defer s.Unlock()
+	p, ok := s.promises[id]
+	if !ok {
+		return db.Promise{}, apierr.Errorf(apierr.NotFound, "unknown promise")
+	}
+	return p, nil
+}
+
+func (s *fakeStore) WithdrawPromise(id db.ID) (db.Promise, error) {
+	s.Lock()
+	defer s.Unlock()
+	p := s.promises[id]
+	p.Status = db.PromiseStatusWithdrawn
+	s.promises[id] = p
+	s.promoteWaitlist(s.requests[p.RequestID])
+	return p, nil
+}
+
+//promised is the total not withdrawn or waitlisted
+func (s *fakeStore) promised(requestID db.ID) int {
+	return s.promisedWith(requestID, db.PromiseStatusOpen) + s.promisedWith(requestID, db.PromiseStatusDelivered)
+}
+
+func (s *fakeStore) promisedWith(requestID db.ID, status db.PromiseStatus) int {
+	total := 0
+	for _, p := range s.promises {
+		if p.RequestID == requestID && p.Status == status {
+			total += p.Qty
+		}
+	}
+	return total
+}
+
+func (s *fakeStore) promoteWaitlist(r db.Request) {
+	waitlisted := []db.Promise{}
+	for _, id := range s.promiseIDs {
+		if p := s.promises[id]; p.RequestID == r.ID && p.Status == db.PromiseStatusWaitlisted {
+			waitlisted = append(waitlisted, p)
+		}
+	}
+	for _, p := range r.PromoteWaitlisted(s.promised(r.ID), waitlisted) {
+		s.promises[p.ID] = p
+	}
+}
+
+func (s *fakeStore) GetPromises(groupID string, userID string, requestID string, locationID string, beforeDate *time.Time, page db.PageRequest) (db.PromiseList, error) {
+	s.Lock()
+	defer s.Unlock()
+	list := db.PromiseList{Promises: []db.PromiseListEntry{}}
+	for _, p := range s.promises {
+		r := s.requests[p.RequestID]
+		if string(r.GroupID) != groupID || (userID != "" && string(p.UserID) != userID) || (requestID != "" && string(p.RequestID) != requestID) {
+			continue
+		}
+		list.Promises = append(list.Promises, db.PromiseListEntry{
+			ID:           p.ID,
+			GroupID:      r.GroupID,
+			UserID:       p.UserID,
+			UserName:     s.users[p.UserID].Name,
+			RequestID:    r.ID,
+			RequestTitle: r.Title,
+			RequestQty:   r.Qty,
+			Qty:          p.Qty,
+			Date:         p.Date,
+		})
+	}
+	list.Total = len(list.Promises)
+	return list, nil
+}
+
+//Search the memory index in the groups of the user and their descendants
+func (s *fakeStore) Search(userID db.ID, q search.Query) (search.Result, error) {
+	s.Lock()
+	q.GroupIDs = nil
+	for id := range s.groups {
+		for parent := id; parent != ""; parent = s.groups[parent].ParentGroupID {
+			if s.isMember(parent, userID) {
+				q.GroupIDs = append(q.GroupIDs, string(id))
+				break
+			}
+		}
+	}
+	s.Unlock()
+	return s.index.Search(q)
+}
+
+func (s *fakeStore) isMember(groupID db.ID, userID db.ID) bool {
+	for _, m := range s.members[groupID] {
+		if m.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func optStr(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func (s *fakeStore) AddPayment(p db.Payment) (db.Payment, error) {
+	if err := p.Validate(); err != nil {
+		return db.Payment{}, apierr.Validation(err)
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.addPayment(p)
+}
+
+func (s *fakeStore) addPayment(p db.Payment) (db.Payment, error) {
+	r, ok := s.requests[p.RequestID]
+	if !ok {
+		return db.Payment{}, apierr.Errorf(apierr.NotFound, "unknown request")
+	}
+	if r.Type != db.RequestTypeMoney {
+		return db.Payment{}, apierr.Invalid("request_id", "payments are only for money requests")
+	}
+	p.Currency = r.Currency
+	if p.PromiseID != nil {
+		pledge, ok := s.promises[*p.PromiseID]
+		if !ok || pledge.RequestID != r.ID {
+			return db.Payment{}, apierr.Invalid("promise_id", "unknown pledge for this request")
+		}
+		p.UserID = &pledge.UserID
+		if s.paid(pledge.ID)+p.Amount >= pledge.Qty {
+			pledge.Status = db.PromiseStatusDelivered
+			s.promises[pledge.ID] = pledge
+		}
+	}
+	p.ID = s.id("payment")
+	s.payments = append(s.payments, p)
+	return p, nil
+}
+
+//paid is the total paid on a pledge
+func (s *fakeStore) paid(promiseID db.ID) int {
+	total := 0
+	for _, p := range s.payments {
+		if p.PromiseID != nil && *p.PromiseID == promiseID {
+			total += p.Amount
+		}
+	}
+	return total
+}
+
+//GetGroupMoney sums the amounts of the group and its direct sub-groups
+func (s *fakeStore) GetGroupMoney(id db.ID) (db.MoneyReport, error) {
+	s.Lock()
+	defer s.Unlock()
+	g, ok := s.groups[id]
+	if !ok {
+		return db.MoneyReport{}, apierr.Errorf(apierr.NotFound, "unknown group")
+	}
+	groups := []db.GroupTreeEntry{{ID: g.ID, Title: g.Title}}
+	for _, c := range s.groups {
+		if c.ParentGroupID == id {
+			groups = append(groups, db.GroupTreeEntry{ID: c.ID, ParentGroupID: id, Title: c.Title, Depth: 1})
+		}
+	}
+	inReport := map[db.ID]bool{}
+	for _, e := range groups {
+		inReport[e.ID] = true
+	}
+	amounts := []db.MoneyAmount{}
+	for _, r := range s.requests {
+		if r.Type == db.RequestTypeMoney && inReport[r.GroupID] {
+			amounts = append(amounts, db.MoneyAmount{GroupID: r.GroupID, Currency: r.Currency, Requested: r.Qty, Pledged: s.promised(r.ID)})
+		}
+	}
+	for _, p := range s.payments {
+		if r := s.requests[p.RequestID]; inReport[r.GroupID] {
+			amounts = append(amounts, db.MoneyAmount{GroupID: r.GroupID, Currency: p.Currency, Method: p.Method, Paid: p.Amount})
+		}
+	}
+	return db.SumMoney(groups, amounts), nil
+}
+
+func (s *fakeStore) ReconcileStatement(groupID db.ID, currency model.Currency, lines []db.StatementLine, record bool, recordedBy db.ID) (db.Reconciliation, error) {
+	s.Lock()
+	defer s.Unlock()
+	pledges := []db.Pledge{}
+	for _, id := range s.promiseIDs {
+		p := s.promises[id]
+		r := s.requests[p.RequestID]
+		if r.GroupID != groupID || r.Currency != currency || p.Reference == nil || p.Status == db.PromiseStatusWithdrawn {
+			continue
+		}
+		pledges = append(pledges, db.Pledge{PromiseID: p.ID, RequestID: r.ID, UserID: p.UserID, Reference: *p.Reference, Amount: p.Qty, Paid: s.paid(p.ID)})
+	}
+	rec := db.MatchStatement(lines, pledges)
+	rec.Currency = currency
+	for i, rl := range rec.Lines {
+		if !record || rl.Status != db.ReconcileMatched {
+			continue
+		}
+		p, err := s.addPayment(db.Payment{RequestID: rl.Pledge.RequestID, PromiseID: &rl.Pledge.PromiseID, Amount: rl.Amount, Method: db.PaymentMethodEFT, Reference: &rl.Reference, RecordedBy: recordedBy})
+		if err != nil {
+			return db.Reconciliation{}, err
+		}
+		rec.Lines[i].Payment = &p
+		rec.Recorded++
+	}
+	return rec, nil
+}
+
+//ListOutboundMessages has nothing, the fake mailer does not record deliveries
+func (s *fakeStore) ListOutboundMessages(ref string, addr string, limit int) ([]db.OutboundMessage, error) {
+	return []db.OutboundMessage{}, nil
+}
@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+//Readiness is set once the server started and cleared when shutting down
+//so that the load balancer stops sending requests before the server stops
+type Readiness struct {
+	ready int32
+}
+
+func (r *Readiness) Set(ready bool) {
+	if ready {
+		atomic.StoreInt32(&r.ready, 1)
+	} else {
+		atomic.StoreInt32(&r.ready, 0)
+	}
+}
+
+func (r *Readiness) Ready() bool {
+	return atomic.LoadInt32(&r.ready) == 1
+}
+
+type HealthResponse struct {
+	Status string            `json:"status" doc:"ok or unavailable"`
+	Checks map[string]string `json:"checks,omitempty" doc:"Status per dependency"`
+}
+
+//healthz is ok while the process can serve requests, used as liveness probe
+func healthz(httpRes http.ResponseWriter, httpReq *http.Request) {
+	writeHealth(httpRes, HealthResponse{Status: "ok"})
+}
+
+//readyz is ok when the server can handle requests, used as readiness probe
+func (a *api) readyz(httpRes http.ResponseWriter, httpReq *http.Request) {
+	ctx, cancel := context.WithTimeout(httpReq.Context(), 2*time.Second)
+	defer cancel()
+
+	res := HealthResponse{Status: "ok", Checks: map[string]string{}}
+	check := func(name string, err error) {
+		if err != nil {
+			log.Errorf("[%s] not ready: %s: %+v", requestIDOf(httpReq), name, err)
+			res.Status = "unavailable"
+			res.Checks[name] = "unavailable"
+		} else {
+			res.Checks[name] = "ok"
+		}
+	}
+	if !a.ready.Ready() {
+		res.Status = "unavailable"
+		res.Checks["server"] = "starting or shutting down"
+	} else {
+		res.Checks["server"] = "ok"
+	}
+	check("db", a.store.Ping(ctx))
+	if a.redis != nil {
+		check("redis", a.redis.Ping(ctx).Err())
+	}
+	writeHealth(httpRes, res)
+} //api.readyz()
+
+func writeHealth(httpRes http.ResponseWriter, res HealthResponse) {
+	httpRes.Header().Set("Content-Type", "application/json")
+	httpRes.Header().Set("Cache-Control", "no-store")
+	if res.Status != "ok" {
+		httpRes.WriteHeader(http.StatusServiceUnavailable)
+	}
+	jsonRes, _ := json.Marshal(res)
+	httpRes.Write(jsonRes)
+}
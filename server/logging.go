@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/jansemmelink/don8/metrics"
+	"github.com/jansemmelink/don8/redact"
+	"github.com/stewelarend/logger"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+var requestIDPattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,64}$`)
+
+//requestIDOf returns the caller's request id (e.g. from a proxy)
+//or sets a new one in the request so all handlers log the same id
+func requestIDOf(httpReq *http.Request) string {
+	requestID := httpReq.Header.Get(requestIDHeader)
+	if !requestIDPattern.MatchString(requestID) {
+		requestID = uuid.New().String()
+		httpReq.Header.Set(requestIDHeader, requestID)
+	}
+	return requestID
+}
+
+var (
+	httpDuration = metrics.Default.Histogram("don8_http_request_duration_seconds", "Duration of HTTP requests per route", metrics.DefaultBuckets, "route", "method", "status")
+	httpRequests = metrics.Default.Counter("don8_http_requests_total", "Nr of HTTP requests per route", "route", "method", "status")
+)
+
+//Log writes one line per request with its id, status and duration
+//and observes the latency per route for /metrics.
+//It is router middleware so that the route template is known, e.g. "/groups/{id}"
+func (a *api) Log(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(httpRes http.ResponseWriter, httpReq *http.Request) {
+		start := time.Now()
+		requestID := requestIDOf(httpReq)
+		httpRes.Header().Set(requestIDHeader, requestID)
+		route := "unmatched"
+		if r := mux.CurrentRoute(httpReq); r != nil {
+			if tmpl, err := r.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+		log.With("request_id", requestID).Debugf("HTTP %s %s headers:%v", httpReq.Method, redact.URL(httpReq.URL), redact.Header(httpReq.Header))
+
+		sw := &statusWriter{ResponseWriter: httpRes}
+		h.ServeHTTP(sw, httpReq)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		d := time.Since(start)
+		status := strconv.Itoa(sw.status)
+		httpDuration.Observe(d.Seconds(), route, httpReq.Method, status)
+		httpRequests.Inc(route, httpReq.Method, status)
+		log.
+			With("request_id", requestID).
+			With("method", httpReq.Method).
+			With("route", route).
+			With("status", sw.status).
+			With("duration_ms", d.Milliseconds()).
+			With("bytes", sw.bytes).
+			With("client_ip", a.clientIP(httpReq)).
+			Infof("HTTP %s %s -> %d (%s)", httpReq.Method, redact.URL(httpReq.URL), sw.status, d)
+	})
+} //api.Log()
+
+//statusWriter records the response status and size
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
+
+//Flush is needed for server-sent events
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+//jsonLogWriter writes one JSON object per log record for log collectors
+type jsonLogWriter struct{}
+
+func (jsonLogWriter) Write(r logger.Record) {
+	record := map[string]interface{}{}
+	for n, v := range r.Data {
+		record[n] = v
+	}
+	record["time"] = r.Timestamp.Format(time.RFC3339Nano)
+	record["level"] = r.Level.String()
+	record["caller"] = fmt.Sprintf("%s", r.Caller)
+	record["msg"] = r.Message
+	jsonRecord, err := json.Marshal(record)
+	if err != nil {
+		jsonRecord, _ = json.Marshal(map[string]interface{}{"time": record["time"], "level": record["level"], "msg": r.Message})
+	}
+	os.Stderr.Write(append(jsonRecord, '\n'))
+}
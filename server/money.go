@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/importer"
+	"github.com/jansemmelink/don8/model"
+)
+
+//listCurrencies so the app can offer the currencies of money requests
+func listCurrencies(ctx context.Context) ([]model.CurrencyDef, error) {
+	return model.Currencies(), nil
+}
+
+type addPaymentRequest struct {
+	PromiseID *db.ID           `json:"promise_id,omitempty" doc:"The pledge that is paid, if any"`
+	Amount    int              `json:"amount" doc:"Amount in minor units of the request currency, e.g. cents"`
+	Method    db.PaymentMethod `json:"method" doc:"cash|eft|card"`
+	Reference *string          `json:"reference,omitempty" doc:"EFT reference or card slip reference, required for eft"`
+	Date      string           `json:"date,omitempty" doc:"Date when paid CCYY-MM-DD (default today)"`
+	date      time.Time
+}
+
+func (req *addPaymentRequest) Validate() error {
+	if req.Amount <= 0 {
+		return apierr.Invalid("amount", "amount must be positive")
+	}
+	req.date = time.Now()
+	if req.Date != "" {
+		var err error
+		if req.date, err = time.ParseInLocation("2006-01-02", req.Date, time.Local); err != nil {
+			return apierr.Invalid("date", "invalid date \"%s\" expecting CCYY-MM-DD", req.Date)
+		}
+	}
+	return nil
+}
+
+//addPayment is recorded by a coordinator of the request's group, e.g. POST /requests/{id}/payments
+func (a *api) addPayment(ctx context.Context, req addPaymentRequest) (db.Payment, error) {
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	params := ctx.Value(CtxParams{}).(params)
+	r, err := a.store.GetRequest(db.ID(params.String("id", "")))
+	if err != nil {
+		return db.Payment{}, apierr.Wrapf(err, apierr.NotFound, "unknown request")
+	}
+	ok, err := a.store.IsGroupCoordinator(r.GroupID, s.User.ID)
+	if err != nil {
+		return db.Payment{}, err
+	}
+	if !ok {
+		return db.Payment{}, apierr.Errorf(apierr.Forbidden, "only group coordinators can record payments")
+	}
+	return a.store.AddPayment(db.Payment{
+		RequestID:  r.ID,
+		PromiseID:  req.PromiseID,
+		Amount:     req.Amount,
+		Method:     req.Method,
+		Reference:  req.Reference,
+		Date:       db.SqlTime(req.date),
+		RecordedBy: s.User.ID,
+	})
+}
+
+func (a *api) listPayments(ctx context.Context) (db.PaymentList, error) {
+	groupID, err := a.groupCoordinator(ctx)
+	if err != nil {
+		return db.PaymentList{}, err
+	}
+	params := ctx.Value(CtxParams{}).(params)
+	page, err := params.Page(db.PaymentSort)
+	if err != nil {
+		return db.PaymentList{}, err
+	}
+	return a.store.ListPayments(
+		groupID,
+		db.ID(params.String("request_id", "")),
+		db.PaymentMethod(params.String("method", "")),
+		page)
+}
+
+//getGroupMoney reports the money totals of the group and its sub-groups
+func (a *api) getGroupMoney(ctx context.Context) (db.MoneyReport, error) {
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return db.MoneyReport{}, err
+	}
+	return a.store.GetGroupMoney(groupID)
+}
+
+type reconcileRequest struct {
+	Currency model.Currency `json:"currency,omitempty" doc:"Currency of the bank account (default ZAR)"`
+	Content  string         `json:"content" doc:"CSV export of the bank statement with columns date, description and/or reference, and amount or credit and debit"`
+	Record   bool           `json:"record" doc:"Record matched lines as EFT payments, else only report the matches"`
+	currency model.CurrencyDef
+}
+
+func (req *reconcileRequest) Validate() error {
+	var err error
+	if req.currency, err = req.Currency.Def(); err != nil {
+		return apierr.Invalid("currency", "%s", err)
+	}
+	if req.Content == "" {
+		return apierr.Invalid("content", "missing content")
+	}
+	return nil
+}
+
+//reconcileStatement matches bank statement lines to pledges in the group by their reference
+func (a *api) reconcileStatement(ctx context.Context, req reconcileRequest) (db.Reconciliation, error) {
+	groupID, err := a.groupCoordinator(ctx)
+	if err != nil {
+		return db.Reconciliation{}, err
+	}
+	lines, err := importer.ReadStatementCSV(strings.NewReader(req.Content), req.currency)
+	if err != nil {
+		return db.Reconciliation{}, apierr.Validation(err)
+	}
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	return a.store.ReconcileStatement(groupID, req.currency.Code, lines, req.Record, s.User.ID)
+}
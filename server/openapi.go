@@ -0,0 +1,331 @@
+package server
+
+import (
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+//OpenAPI 3 document generated from the routes registered with hdlr()
+//so the app can generate a typed client
+type openAPI struct {
+	OpenAPI    string                         `json:"openapi"`
+	Info       openAPIInfo                    `json:"info"`
+	Paths      map[string]map[string]*apiOper `json:"paths"`
+	Components apiComponents                  `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type apiOper struct {
+	OperationID string                 `json:"operationId"`
+	Tags        []string               `json:"tags,omitempty"`
+	Parameters  []apiParam             `json:"parameters,omitempty"`
+	RequestBody *apiBody               `json:"requestBody,omitempty"`
+	Responses   map[string]apiResponse `json:"responses"`
+	Security    []map[string][]string  `json:"security,omitempty"`
+}
+
+type apiParam struct {
+	Name        string     `json:"name"`
+	In          string     `json:"in"`
+	Description string     `json:"description,omitempty"`
+	Required    bool       `json:"required,omitempty"`
+	Schema      *apiSchema `json:"schema"`
+}
+
+type apiBody struct {
+	Required bool                    `json:"required,omitempty"`
+	Content  map[string]apiMediaType `json:"content"`
+}
+
+type apiResponse struct {
+	Description string                  `json:"description"`
+	Content     map[string]apiMediaType `json:"content,omitempty"`
+}
+
+type apiMediaType struct {
+	Schema *apiSchema `json:"schema"`
+}
+
+type apiSchema struct {
+	Ref                  string                `json:"$ref,omitempty"`
+	Type                 string                `json:"type,omitempty"`
+	Format               string                `json:"format,omitempty"`
+	Description          string                `json:"description,omitempty"`
+	Nullable             bool                  `json:"nullable,omitempty"`
+	Items                *apiSchema            `json:"items,omitempty"`
+	Properties           map[string]*apiSchema `json:"properties,omitempty"`
+	AdditionalProperties *apiSchema            `json:"additionalProperties,omitempty"`
+}
+
+type apiComponents struct {
+	Schemas         map[string]*apiSchema        `json:"schemas"`
+	SecuritySchemes map[string]apiSecurityScheme `json:"securitySchemes"`
+}
+
+type apiSecurityScheme struct {
+	Type        string `json:"type"`
+	In          string `json:"in"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+const sessionSecurityScheme = "session"
+
+//openAPIHandler serves the spec for all hdlr() routes in the router
+func openAPIHandler(r *mux.Router) http.HandlerFunc {
+	return func(httpRes http.ResponseWriter, httpReq *http.Request) {
+		doc, err := newOpenAPI(r)
+		if err != nil {
+			log.Errorf("Failed to generate OpenAPI: %+v", err)
+			http.Error(httpRes, "failed to generate OpenAPI document", http.StatusInternalServerError)
+			return
+		}
+		jsonDoc, _ := json.MarshalIndent(doc, "", "  ")
+		httpRes.Header().Set("Content-Type", "application/json")
+		httpRes.Write(jsonDoc)
+	}
+}
+
+var pathVarPattern = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+func newOpenAPI(r *mux.Router) (openAPI, error) {
+	doc := openAPI{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:       "Don8",
+			Description: "Manage donations to an organisation",
+			Version:     "1.0",
+		},
+		Paths: map[string]map[string]*apiOper{},
+		Components: apiComponents{
+			Schemas: map[string]*apiSchema{},
+			SecuritySchemes: map[string]apiSecurityScheme{
+				sessionSecurityScheme: {
+					Type:        "apiKey",
+					In:          "header",
+					Name:        "Don8-Auth-Sid",
+					Description: "Session id returned by login or activate",
+				},
+			},
+		},
+	}
+	errorSchema := doc.schema(reflect.TypeOf(ErrorResponse{}))
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		h, ok := route.GetHandler().(handler)
+		if !ok {
+			return nil //not an API handler, e.g. /openapi.json itself
+		}
+		tmpl, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return err
+		}
+		//remove regex from vars: "/{id:[0-9]+}" -> "/{id}"
+		p := pathVarPattern.ReplaceAllString(tmpl, "{$1}")
+		for _, method := range methods {
+			op := doc.operation(h, method, p)
+			op.Responses["default"] = apiResponse{
+				Description: "Error",
+				Content:     map[string]apiMediaType{"application/json": {Schema: errorSchema}},
+			}
+			if doc.Paths[p] == nil {
+				doc.Paths[p] = map[string]*apiOper{}
+			}
+			doc.Paths[p][strings.ToLower(method)] = op
+		}
+		return nil
+	})
+	return doc, err
+} //newOpenAPI()
+
+func (doc *openAPI) operation(h handler, method string, p string) *apiOper {
+	op := &apiOper{
+		OperationID: h.name,
+		Parameters:  []apiParam{},
+		Responses:   map[string]apiResponse{},
+	}
+	if parts := strings.SplitN(strings.Trim(p, "/"), "/", 2); parts[0] != "" {
+		op.Tags = []string{parts[0]}
+	}
+	if h.auth != authNone {
+		op.Security = []map[string][]string{{sessionSecurityScheme: {}}}
+	}
+	for _, m := range pathVarPattern.FindAllStringSubmatch(p, -1) {
+		op.Parameters = append(op.Parameters, apiParam{
+			Name:     m[1],
+			In:       "path",
+			Required: true,
+			Schema:   &apiSchema{Type: "string"},
+		})
+	}
+	for _, q := range h.query {
+		op.Parameters = append(op.Parameters, apiParam{
+			Name:        q.name,
+			In:          "query",
+			Description: q.doc,
+			Schema:      &apiSchema{Type: "string"},
+		})
+	}
+	if h.reqType != nil {
+		op.RequestBody = &apiBody{
+			Required: true,
+			Content:  map[string]apiMediaType{"application/json": {Schema: doc.schema(h.reqType)}},
+		}
+	}
+
+	//same status codes as set in handler.ServeHTTP()
+	status := "200"
+	switch method {
+	case http.MethodPost, http.MethodPut:
+		status = "202"
+	case http.MethodDelete:
+		status = "204"
+	}
+	if h.resType != nil && status != "204" {
+		op.Responses[status] = apiResponse{
+			Description: "Success",
+			Content:     map[string]apiMediaType{"application/json": {Schema: doc.schema(h.resType)}},
+		}
+	} else {
+		op.Responses[status] = apiResponse{Description: "Success"}
+	}
+	return op
+} //openAPI.operation()
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+//schema returns the schema for a type, adding named structs to the components
+//and referring to them so that each struct is described only once
+func (doc *openAPI) schema(t reflect.Type) *apiSchema {
+	if t.Kind() == reflect.Ptr {
+		s := doc.schema(t.Elem())
+		if s.Ref != "" {
+			return s //$ref cannot have siblings in OpenAPI 3.0
+		}
+		s.Nullable = true
+		return s
+	}
+	switch {
+	case t == timeType:
+		return &apiSchema{Type: "string", Format: "date-time"}
+	case t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonUnmarshalerType):
+		//custom JSON: see what the zero value looks like, e.g. db.SqlTime is a quoted string
+		if jsonValue, err := json.Marshal(reflect.Zero(t).Interface()); err == nil && len(jsonValue) > 0 {
+			switch jsonValue[0] {
+			case '"':
+				return &apiSchema{Type: "string"}
+			case '[':
+				return &apiSchema{Type: "array", Items: &apiSchema{}}
+			case '{':
+				return &apiSchema{Type: "object"}
+			case 't', 'f':
+				return &apiSchema{Type: "boolean"}
+			case 'n':
+				return &apiSchema{}
+			default:
+				return &apiSchema{Type: "number"}
+			}
+		}
+		return &apiSchema{}
+	case t.Implements(textMarshalerType):
+		return &apiSchema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &apiSchema{Type: "string"}
+	case reflect.Bool:
+		return &apiSchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s := &apiSchema{Type: "integer"}
+		if t.Kind() == reflect.Int64 || t.Kind() == reflect.Uint64 {
+			s.Format = "int64"
+		}
+		return s
+	case reflect.Float32, reflect.Float64:
+		return &apiSchema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &apiSchema{Type: "string", Format: "byte"}
+		}
+		return &apiSchema{Type: "array", Items: doc.schema(t.Elem())}
+	case reflect.Map:
+		return &apiSchema{Type: "object", AdditionalProperties: doc.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return doc.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			doc.Components.Schemas[name] = &apiSchema{} //placeholder for recursive types
+			doc.Components.Schemas[name] = doc.structSchema(t)
+		}
+		return &apiSchema{Ref: "#/components/schemas/" + name}
+	}
+	return &apiSchema{} //any value, e.g. interface{}
+} //openAPI.schema()
+
+func (doc *openAPI) structSchema(t reflect.Type) *apiSchema {
+	s := &apiSchema{Type: "object", Properties: map[string]*apiSchema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			//embedded struct fields are written inline in JSON
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for n, p := range doc.structSchema(ft).Properties {
+					if _, ok := s.Properties[n]; !ok {
+						s.Properties[n] = p
+					}
+				}
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		p := doc.schema(f.Type)
+		if d := f.Tag.Get("doc"); d != "" && p.Ref == "" { //$ref cannot have a description in OpenAPI 3.0
+			p.Description = d
+		}
+		s.Properties[name] = p
+	}
+	return s
+} //openAPI.structSchema()
+
+//schemaName is the package and type name, e.g. "db.Request" or "main.invitesRequest"
+func schemaName(t reflect.Type) string {
+	return path.Base(t.PkgPath()) + "." + t.Name()
+}
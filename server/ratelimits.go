@@ -0,0 +1,131 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/ratelimit"
+)
+
+//limitKey returns what to count a request against, or "" to not count it
+type limitKey func(httpReq *http.Request, s *db.Session, req interface{}) string
+
+func (a *api) perIP(httpReq *http.Request, s *db.Session, req interface{}) string {
+	return "ip:" + a.clientIP(httpReq)
+}
+
+func perSession(httpReq *http.Request, s *db.Session, req interface{}) string {
+	if s == nil || s.User == nil {
+		return ""
+	}
+	return "user:" + string(s.User.ID)
+}
+
+//perEmail counts requests against the email address in the request body
+//so that one address cannot be flooded with registration or reset emails
+func perEmail(httpReq *http.Request, s *db.Session, req interface{}) string {
+	v := reflect.ValueOf(req)
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	f := v.FieldByName("Email")
+	if !f.IsValid() || f.Kind() != reflect.String {
+		return ""
+	}
+	if email := strings.ToLower(strings.TrimSpace(f.String())); email != "" {
+		return "email:" + email
+	}
+	return ""
+}
+
+func (a *api) clientIP(httpReq *http.Request) string {
+	if a.trustProxy {
+		if fwd := httpReq.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.SplitN(fwd, ",", 2)[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(httpReq.RemoteAddr)
+	if err != nil {
+		return httpReq.RemoteAddr
+	}
+	return host
+}
+
+type routeLimit struct {
+	key   limitKey
+	limit ratelimit.Limit
+}
+
+//Limit the rate of requests to the handler counted per key, e.g.
+//hdlr(login, authNone).Limit(perIP, ratelimit.Limit{Max: 30, Window: 15 * time.Minute})
+func (h handler) Limit(key limitKey, limit ratelimit.Limit) handler {
+	h.limits = append(h.limits[:len(h.limits):len(h.limits)], routeLimit{key: key, limit: limit})
+	return h
+}
+
+//checkLimits counts the request against all limits of the handler
+func (h handler) checkLimits(httpReq *http.Request, s *db.Session, req interface{}) error {
+	for _, l := range h.limits {
+		k := l.key(httpReq, s, req)
+		if k == "" {
+			continue
+		}
+		ok, retryAfter, err := ratelimit.Allow(h.api.limits, h.name+":"+k, l.limit)
+		if err != nil {
+			//rather serve the request than fail when the store is down
+			log.Errorf("rate limit %s:%s not checked: %+v", h.name, k, err)
+			continue
+		}
+		if !ok {
+			return apierr.Limited(retryAfter, "too many requests, try again in %s", retryAfter.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+//account lockout after repeated failed logins
+const (
+	maxFailedLogins = 5
+	lockoutWindow   = 15 * time.Minute
+)
+
+func failedLoginsKey(email string) string {
+	return "login-failed:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+//lockedOut returns an error while the account is locked
+func (a *api) lockedOut(email string) error {
+	n, ttl, err := a.limits.Get(failedLoginsKey(email))
+	if err != nil {
+		log.Errorf("failed login count not checked: %+v", err)
+		return nil
+	}
+	if n >= maxFailedLogins {
+		return apierr.Limited(ttl, "too many failed logins, try again in %s", ttl.Round(time.Second))
+	}
+	return nil
+}
+
+//loginFailed counts a failed login, the window starts at the first failure
+func (a *api) loginFailed(email string) {
+	if _, _, err := a.limits.Add(failedLoginsKey(email), 1, lockoutWindow); err != nil {
+		log.Errorf("failed login not counted: %+v", err)
+	}
+}
+
+func (a *api) loginSucceeded(email string) {
+	if err := a.limits.Reset(failedLoginsKey(email)); err != nil {
+		log.Errorf("failed login count not reset: %+v", err)
+	}
+}
+
+//invitations that may be sent per group per day, and in one request
+var (
+	defaultInviteQuota   = ratelimit.Limit{Max: 500, Window: 24 * time.Hour}
+	maxInvitesPerRequest = 100
+)
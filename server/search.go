@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/search"
+)
+
+//searchAll finds groups, requests and members in the groups of the user
+//and in the descendants of those groups
+func (a *api) searchAll(ctx context.Context) (search.Result, error) {
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	params := ctx.Value(CtxParams{}).(params)
+	q := search.Query{
+		Text:  params.String("q", ""),
+		Tags:  db.ParseTags(params.String("tags", "")),
+		Limit: params.Int("limit", search.DefaultLimit, 1, search.MaxLimit),
+	}
+	for _, name := range strings.Split(params.String("kinds", ""), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		kind, err := search.ParseKind(name)
+		if err != nil {
+			return search.Result{}, apierr.Invalid("kinds", "%s", err.Error())
+		}
+		q.Kinds = append(q.Kinds, kind)
+	}
+	if err := q.Validate(); err != nil {
+		return search.Result{}, apierr.Validation(err)
+	}
+	return a.store.Search(s.User.ID, q)
+}
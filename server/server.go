@@ -0,0 +1,1303 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+	"github.com/gorilla/mux"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/config"
+	"github.com/jansemmelink/don8/cors"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/emails"
+	"github.com/jansemmelink/don8/events"
+	"github.com/jansemmelink/don8/importer"
+	"github.com/jansemmelink/don8/metrics"
+	"github.com/jansemmelink/don8/model"
+	"github.com/jansemmelink/don8/queues/invitations"
+	"github.com/jansemmelink/don8/ratelimit"
+	"github.com/jansemmelink/don8/redact"
+	"github.com/stewelarend/logger"
+)
+
+var log = logger.New().WithLevel(logger.LevelDebug)
+
+//Options of the server that are not in the config
+type Options struct {
+	Events        string
+	Limits        string
+	InviteQuota   int
+	LogFormat     string
+	RedactFields  string
+	RedactHeaders string
+	ready         *Readiness //set by Run
+}
+
+//Flags defines the options in fs with their defaults
+func (o *Options) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Events, "events", "redis", "Live events between server instances and workers: redis|local")
+	fs.StringVar(&o.Limits, "limits", "redis", "Rate limit counters shared by server instances in redis, or in memory for a single instance: redis|memory")
+	fs.IntVar(&o.InviteQuota, "invite-quota", defaultInviteQuota.Max, "Max invitations per group per day")
+	fs.StringVar(&o.LogFormat, "log-format", "text", "Log format: text|json")
+	fs.StringVar(&o.RedactFields, "redact-fields", strings.Join(redact.DefaultFields, ","), "JSON fields, query parameters and SQL columns (or table.column) to mask in logs")
+	fs.StringVar(&o.RedactHeaders, "redact-headers", strings.Join(redact.DefaultHeaders, ","), "HTTP headers to mask in logs")
+}
+
+//Run the server until ctx is done, e.g. on SIGTERM,
+//then finish the requests in progress before it returns
+func Run(ctx context.Context, c config.Config, o Options) error {
+	ready := &Readiness{}
+	o.ready = ready
+	h, closeHandler, err := NewHandler(ctx, c, o)
+	if err != nil {
+		return err
+	}
+	defer closeHandler()
+
+	//requests use this context so that event streams end when shutting down
+	streamsCtx, endStreams := context.WithCancel(context.Background())
+	srv := &http.Server{
+		Addr:        c.HTTP.Addr,
+		Handler:     h,
+		BaseContext: func(net.Listener) context.Context { return streamsCtx },
+	}
+	srv.RegisterOnShutdown(endStreams)
+
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Infof("Listening on %s ...", c.HTTP.Addr)
+		serverErr <- srv.ListenAndServe()
+	}()
+	ready.Set(true)
+
+	select {
+	case err := <-serverErr:
+		return errors.Wrapf(err, "HTTP server failed")
+	case <-ctx.Done():
+	}
+	ready.Set(false)
+
+	log.Infof("Shutting down: finishing requests in progress (max %s) ...", c.HTTP.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(c.HTTP.ShutdownTimeout))
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Errorf("requests still in progress were stopped: %+v", err)
+	}
+	log.Infof("Stopped.")
+	return nil
+} //Run()
+
+//NewHandler connects to the database and redis and returns the API handler,
+//used by Run and to call the API in process, e.g. "don8 replay -in-process".
+//Call the returned func to close the connections when done.
+func NewHandler(ctx context.Context, c config.Config, o Options) (http.Handler, func(), error) {
+	switch o.LogFormat {
+	case "text":
+	case "json":
+		logger.SetGlobalWriter(jsonLogWriter{})
+	default:
+		return nil, nil, errors.Errorf("invalid log format \"%s\", expecting text|json", o.LogFormat)
+	}
+	redact.Configure(strings.Split(o.RedactFields, ","), strings.Split(o.RedactHeaders, ","))
+
+	switch o.Limits {
+	case "redis", "memory":
+	default:
+		return nil, nil, errors.Errorf("invalid limits \"%s\", expecting redis|memory", o.Limits)
+	}
+	switch o.Events {
+	case "redis", "local":
+	default:
+		return nil, nil, errors.Errorf("invalid events \"%s\", expecting redis|local", o.Events)
+	}
+	m, err := emails.NewMailer(c.Mail)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot create mailer")
+	}
+	corsPolicy, err := cors.Load(c.HTTP.CORS, c.HTTP.CORSFile)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot load CORS policy")
+	}
+	log.Infof("CORS(%s) allowed origins: %v", c.HTTP.CORS, corsPolicy.AllowedOrigins)
+
+	if err := c.ConnectDB(ctx); err != nil {
+		return nil, nil, errors.Wrapf(err, "cannot connect to the database")
+	}
+	redisClient := c.Redis.NewClient()
+	d := Deps{
+		Store:       db.Store{},
+		Mailer:      emails.Recorded(m, db.DeliveryLog{}),
+		Queue:       redisQueue{client: redisClient},
+		Redis:       redisClient,
+		TrustProxy:  c.HTTP.TrustProxy,
+		InviteQuota: o.InviteQuota,
+		Dev:         c.DevRoutes,
+		Admins:      splitEmails(c.Admins),
+		Ready:       o.ready,
+	}
+	if o.Limits == "redis" {
+		d.Limits = ratelimit.NewRedisStore(redisClient)
+	}
+	if o.Events == "redis" {
+		events.UseRedis(redisClient)
+		go events.KeepRelaying(ctx, redisClient)
+	}
+	return corsPolicy.Handler(NewRouter(d)), func() {
+		redisClient.Close()
+		db.Close()
+	}, nil
+} //NewHandler()
+
+func (a *api) newRouter() *mux.Router {
+	r := mux.NewRouter()
+	a.authRoutes(r.PathPrefix("/auth/").Subrouter())
+	a.groupRoutes(r.PathPrefix("/groups/").Subrouter())
+	a.requestRoutes(r.PathPrefix("/requests/").Subrouter())
+	a.promiseRoutes(r.PathPrefix("/promises/").Subrouter())
+	a.invitationRoutes(r.PathPrefix("/invitations/").Subrouter())
+	a.outboundRoutes(r.PathPrefix("/outbound/").Subrouter())
+	r.Handle("/search", a.hdlr(a.searchAll, authSession).
+		Query("q", "Words to find, also matching the start of longer words and ignoring accents").
+		Query("kinds", "Comma separated kinds to find: group,request,member (default all)").
+		Query("tags", "Comma separated tags the requests must have").
+		Query("limit", "Max nr of hits to return 1..100 (default 20)")).Methods(http.MethodGet)
+	r.Handle("/units", a.hdlr(listUnits, authNone)).Methods(http.MethodGet)
+	r.Handle("/currencies", a.hdlr(listCurrencies, authNone)).Methods(http.MethodGet)
+	r.HandleFunc("/openapi.json", openAPIHandler(r)).Methods(http.MethodGet)
+	r.Handle("/metrics", metrics.Default).Methods(http.MethodGet)
+	r.HandleFunc("/healthz", healthz).Methods(http.MethodGet)
+	r.HandleFunc("/readyz", a.readyz).Methods(http.MethodGet)
+	r.Use(a.Log)
+	//not matched by any route, so not wrapped by r.Use()
+	r.NotFoundHandler = a.Log(http.HandlerFunc(notFound))
+	r.MethodNotAllowedHandler = a.Log(http.HandlerFunc(methodNotAllowed))
+	return r
+}
+
+func (a *api) authRoutes(r *mux.Router) {
+	r.Handle("/register", a.hdlr(a.register, authNone).
+		Limit(a.perIP, ratelimit.Limit{Max: 10, Window: time.Hour}).
+		Limit(perEmail, ratelimit.Limit{Max: 3, Window: time.Hour})).Methods(http.MethodPost)
+	r.Handle("/activate", a.hdlr(a.activate, authNone).
+		Limit(a.perIP, ratelimit.Limit{Max: 20, Window: 15 * time.Minute})).Methods(http.MethodPost)
+	r.Handle("/reset", a.hdlr(a.reset, authNone).
+		Limit(a.perIP, ratelimit.Limit{Max: 10, Window: time.Hour}).
+		Limit(perEmail, ratelimit.Limit{Max: 3, Window: time.Hour})).Methods(http.MethodPost)
+	r.Handle("/login", a.hdlr(a.login, authNone).
+		Limit(a.perIP, ratelimit.Limit{Max: 30, Window: 15 * time.Minute})).Methods(http.MethodPost)
+	r.Handle("/logout", a.hdlr(a.logout, authSession)).Methods(http.MethodPost)
+}
+
+func (a *api) groupRoutes(r *mux.Router) {
+	r.Handle("/", a.hdlr(a.listGroups, authSession).
+		Query("filter", "Text to find in the group title").
+		Paged(db.MyGroupSort)).Methods(http.MethodGet)
+	r.Handle("/", a.hdlr(a.addGroup, authSession)).Methods(http.MethodPost)
+	r.Handle("/{id}", a.hdlr(a.getGroup, authSession)).Methods(http.MethodGet)
+	r.Handle("/{id}", a.hdlr(a.updGroup, authSession)).Methods(http.MethodPut)
+	r.Handle("/{id}/tree", a.hdlr(a.getGroupTree, authSession).
+		Query("depth", "Levels of sub-groups to list 0..20 (default 5)")).Methods(http.MethodGet)
+	r.Handle("/{id}/reminders", a.hdlr(a.getGroupReminders, authSession)).Methods(http.MethodGet)
+	r.Handle("/{id}/reminders", a.hdlr(a.updGroupReminders, authSession)).Methods(http.MethodPut)
+	r.Handle("/{id}/branding", a.hdlr(a.getGroupBranding, authSession)).Methods(http.MethodGet)
+	r.Handle("/{id}/branding", a.hdlr(a.updGroupBranding, authSession)).Methods(http.MethodPut)
+	r.Handle("/{id}/emails/{name}", a.hdlr(a.previewGroupEmail, authSession).
+		Query("locale", "Language of the email, e.g. \"af\" or \"en\" (default is the group locale)")).Methods(http.MethodGet)
+	r.Handle("/{id}/import", a.hdlr(a.importGroup, authSession)).Methods(http.MethodPost)
+	r.HandleFunc("/{id}/events", a.groupEvents).Methods(http.MethodGet)
+	r.Handle("/{id}/members", a.hdlr(a.listGroupMembers, authSession).Paged(db.MemberSort)).Methods(http.MethodGet)
+	r.Handle("/{id}/invitations", a.hdlr(a.listGroupInvitations, authSession).Paged(db.InvitationSort)).Methods(http.MethodGet)
+	r.Handle("/{id}/locations", a.hdlr(a.listGroupLocations, authSession).Paged(db.LocationSort)).Methods(http.MethodGet)
+	r.Handle("/{id}/promises", a.hdlr(a.listGroupPromises, authSession).
+		Query("user_id", "Only promises by this user").
+		Query("request_id", "Only promises for this request").
+		Query("location_id", "Only promises to deliver at this location").
+		Query("before", "Only promises due before this date CCYY-MM-DD").
+		Paged(db.PromiseSort)).Methods(http.MethodGet)
+	r.Handle("/{id}/tags", a.hdlr(a.listTags, authSession).
+		Query("prefix", "Only tags with a word starting with this text").
+		Query("limit", "Max nr of tags to return 1..100 (default 10)")).Methods(http.MethodGet)
+	r.Handle("/{id}/tags", a.hdlr(a.addTag, authSession)).Methods(http.MethodPost)
+	r.Handle("/{id}/tags/stats", a.hdlr(a.tagStats, authSession)).Methods(http.MethodGet)
+	r.Handle("/{id}/tags/{tag_id}", a.hdlr(a.updTag, authSession)).Methods(http.MethodPut)
+	r.Handle("/{id}/tags/{tag_id}", a.hdlr(a.delTag, authSession)).Methods(http.MethodDelete)
+	r.Handle("/{id}/tags/{tag_id}/merge", a.hdlr(a.mergeTags, authSession)).Methods(http.MethodPost)
+	r.Handle("/{id}/money", a.hdlr(a.getGroupMoney, authSession)).Methods(http.MethodGet)
+	r.Handle("/{id}/payments", a.hdlr(a.listPayments, authSession).
+		Query("request_id", "Only payments for this request").
+		Query("method", "Only payments made with cash|eft|card").
+		Paged(db.PaymentSort)).Methods(http.MethodGet)
+	r.Handle("/{id}/reconcile", a.hdlr(a.reconcileStatement, authSession)).Methods(http.MethodPost)
+	r.Handle("/{id}/webhooks", a.hdlr(a.listWebhooks, authSession)).Methods(http.MethodGet)
+	r.Handle("/{id}/webhooks", a.hdlr(a.addWebhook, authSession)).Methods(http.MethodPost)
+	r.Handle("/{id}/webhooks/deliveries", a.hdlr(a.listWebhookDeliveries, authSession).
+		Query("webhook_id", "Only deliveries to this webhook").
+		Query("status", "Only deliveries with this status: pending|delivered|failed").
+		Paged(db.WebhookDeliverySort)).Methods(http.MethodGet)
+	r.Handle("/{id}/webhooks/{webhook_id}", a.hdlr(a.delWebhook, authSession)).Methods(http.MethodDelete)
+}
+
+func (a *api) promiseRoutes(r *mux.Router) {
+	r.Handle("/{id}/withdraw", a.hdlr(a.withdrawPromise, authSession)).Methods(http.MethodPost)
+}
+
+func (a *api) requestRoutes(r *mux.Router) {
+	r.Handle("/", a.hdlr(a.listRequests, authSession).
+		Query("id", "Group ID (required)").
+		Query("filter", "Text to find in the request title").
+		Query("tags", "Comma separated tags the requests must have").
+		Query("status", "Comma separated statuses: draft,open,fulfilled,closed,cancelled (default all)").
+		Query("type", "Only goods or money requests (default both)").
+		Query("needed_before", "Only requests needed before this date CCYY-MM-DD").
+		Query("min_priority", "Only requests with at least this priority 0..9").
+		Paged(db.RequestSort)).Methods(http.MethodGet)
+	r.Handle("/", a.hdlr(a.addRequest, authSession)).Methods(http.MethodPost)
+	r.Handle("/{id}", a.hdlr(a.getRequest, authSession)).Methods(http.MethodGet)
+	r.Handle("/{id}", a.hdlr(a.updRequest, authSession)).Methods(http.MethodPut)
+	r.Handle("/{id}/promises", a.hdlr(a.addPromise, authSession)).Methods(http.MethodPost)
+	r.Handle("/{id}/payments", a.hdlr(a.addPayment, authSession)).Methods(http.MethodPost)
+}
+
+func (a *api) invitationRoutes(r *mux.Router) {
+	r.Handle("/{id}", a.hdlr(a.sendInvites, authSession).
+		Limit(perSession, ratelimit.Limit{Max: 20, Window: time.Hour})).Methods(http.MethodPost)
+}
+
+func (a *api) outboundRoutes(r *mux.Router) {
+	r.Handle("/", a.hdlr(a.listOutbound, authSession).
+		Query("ref", "Only messages about this reference, e.g. \"invitation:<id>\"").
+		Query("email", "Only messages sent to this address").
+		Query("limit", "Max nr of messages to return 1..100 (default 10)")).Methods(http.MethodGet)
+	r.Handle("/bounces", a.hdlr(a.bounceOutbound, authSession)).Methods(http.MethodPost)
+}
+
+type authRequirment int
+
+const (
+	authNone    authRequirment = iota
+	authSession                //must be logged in user has a session and can call this api
+	authGroup                  //must be logged in and in the same group (URL path must include group_id)
+	authUser                   //must be logged in and in the same user (URL path must include user_id)
+)
+
+// type CtxAuthUser struct{}
+type CtxAuthSession struct{}
+type CtxParams struct{}
+type CtxRequestID struct{}
+
+type ErrorResponse struct {
+	Error      string              `json:"error" doc:"Message that can be shown to the user"`
+	Code       apierr.Code         `json:"code" doc:"Stable error code: validation_failed|unauthorized|forbidden|not_found|conflict|rate_limited|internal"`
+	Fields     []apierr.FieldError `json:"fields,omitempty" doc:"Invalid request fields when code is validation_failed"`
+	RetryAfter int                 `json:"retry_after,omitempty" doc:"Seconds to wait before trying again when code is rate_limited, also in the Retry-After header"`
+	RequestID  string              `json:"request_id" doc:"Correlation ID, also in the X-Request-ID header, to find the request in the logs"`
+}
+
+//errorResponse describes the error without internal details
+func errorResponse(err error, requestID string) (int, ErrorResponse) {
+	e := apierr.From(err)
+	res := ErrorResponse{
+		Error:     e.Message,
+		Code:      e.Code,
+		Fields:    e.Fields,
+		RequestID: requestID,
+	}
+	if e.RetryAfter > 0 {
+		res.RetryAfter = int((e.RetryAfter + time.Second - 1) / time.Second) //round up
+	}
+	return e.Code.Status(), res
+}
+
+//writeError writes the error response for handlers that do not use hdlr()
+func writeError(httpRes http.ResponseWriter, httpReq *http.Request, err error) {
+	requestID := requestIDOf(httpReq)
+	log.Errorf("[%s] HTTP %s %s failed: %+v", requestID, httpReq.Method, httpReq.URL.Path, err)
+	status, res := errorResponse(err, requestID)
+	jsonRes, _ := json.Marshal(res)
+	httpRes.Header().Set("Content-Type", "application/json")
+	httpRes.WriteHeader(status)
+	httpRes.Write(jsonRes)
+}
+
+func notFound(httpRes http.ResponseWriter, httpReq *http.Request) {
+	writeError(httpRes, httpReq, apierr.Errorf(apierr.NotFound, "no route for %s", httpReq.URL.Path))
+}
+
+func methodNotAllowed(httpRes http.ResponseWriter, httpReq *http.Request) {
+	http.Error(httpRes, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+const authSidHeader = "Don8-Auth-Sid"
+
+//requestSession gets the session of the logged in user from the request header
+func (a *api) requestSession(httpReq *http.Request) (db.Session, error) {
+	sid := httpReq.Header.Get(authSidHeader)
+	if sid == "" {
+		return db.Session{}, apierr.Errorf(apierr.Unauthorized, "missing header %s", authSidHeader)
+	}
+	s, err := a.store.GetSession(db.ID(sid))
+	if err != nil {
+		return db.Session{}, apierr.Wrapf(err, apierr.Unauthorized, "invalid or expired session in %s header", authSidHeader)
+	}
+	return s, nil
+}
+
+//handler calls a func(ctx) error or func(ctx, req) error or func(ctx) (res, error) or func(ctx, req) (res, error)
+//where req is parsed from the JSON body and res is written as the JSON response
+type handler struct {
+	name     string
+	fncType  reflect.Type
+	fncValue reflect.Value
+	reqType  reflect.Type //nil if no request body
+	resType  reflect.Type //nil if no response body
+	auth     authRequirment
+	query    []queryParam
+	limits   []routeLimit
+	api      *api
+}
+
+//queryParam documents a URL query parameter read by the handler
+type queryParam struct {
+	name string
+	doc  string
+}
+
+func (a *api) hdlr(fnc interface{}, auth authRequirment) handler {
+	h := handler{
+		name:     runtime.FuncForPC(reflect.ValueOf(fnc).Pointer()).Name(),
+		fncType:  reflect.TypeOf(fnc),
+		fncValue: reflect.ValueOf(fnc),
+		auth:     auth,
+		api:      a,
+	}
+	if i := strings.LastIndex(h.name, "."); i >= 0 {
+		h.name = h.name[i+1:]
+	}
+	h.name = strings.TrimSuffix(h.name, "-fm") //method values, e.g. "(*api).login-fm"
+	if h.fncType.NumIn() > 1 {
+		h.reqType = h.fncType.In(1)
+	}
+	if h.fncType.NumOut() > 1 {
+		h.resType = h.fncType.Out(0)
+	}
+	return h
+}
+
+//Paged documents the pagination query parameters of a list handler that uses params.Page()
+func (h handler) Paged(sortFields db.SortFields) handler {
+	return h.
+		Query("cursor", "next_cursor from the previous page, or empty for the first page").
+		Query("limit", fmt.Sprintf("Nr of items per page 1..%d (default %d)", db.MaxPageSize, db.DefaultPageSize)).
+		Query("sort", fmt.Sprintf("Sort on %s, prefixed with - for descending order (default %s)", strings.Join(sortFields.Names(), "|"), sortFields.Default))
+}
+
+//Query documents a URL query parameter used by the handler
+func (h handler) Query(name, doc string) handler {
+	h.query = append(h.query[:len(h.query):len(h.query)], queryParam{name: name, doc: doc})
+	return h
+}
+
+func (h handler) ServeHTTP(httpRes http.ResponseWriter, httpReq *http.Request) {
+	requestID := requestIDOf(httpReq)
+	httpRes.Header().Set(requestIDHeader, requestID)
+	ctx := context.WithValue(context.Background(), CtxRequestID{}, requestID)
+
+	var status int = http.StatusInternalServerError
+	var err error
+	var res interface{}
+	defer func() {
+		if err != nil {
+			//log full error but only return the safe part of it
+			log.Errorf("[%s] HTTP %s %s failed: %+v", requestID, httpReq.Method, httpReq.URL.Path, err)
+			var e ErrorResponse
+			status, e = errorResponse(err, requestID)
+			if e.RetryAfter > 0 {
+				httpRes.Header().Set("Retry-After", strconv.Itoa(e.RetryAfter))
+			}
+			res = e
+		}
+		httpRes.Header().Set("Content-Type", "application/json")
+		httpRes.WriteHeader(status)
+		if res != nil {
+			jsonRes, _ := json.Marshal(res)
+			httpRes.Write(jsonRes)
+			logged := jsonRes
+			if s, ok := res.(db.Session); ok {
+				//the session id in login, activate and impersonate responses is the user's credential
+				s.ID = redact.Mask
+				logged, _ = json.Marshal(s)
+			}
+			log.Debugf("[%s] -> %s", requestID, redact.JSON(logged))
+		}
+	}()
+
+	params := newParams()
+	for n, v := range httpReq.URL.Query() {
+		params = params.With(n, strings.Join(v, ","))
+	}
+	vars := mux.Vars(httpReq)
+	for n, v := range vars {
+		params = params.With(n, v)
+	}
+	ctx = context.WithValue(ctx, CtxParams{}, params)
+
+	var session *db.Session
+	switch h.auth {
+	case authNone: //do nothing
+
+	case authSession: //get session id for logged in user
+		var s db.Session
+		if s, err = h.api.requestSession(httpReq); err != nil {
+			return
+		}
+		log.Debugf("[%s] HTTP %s %s user(id:%s)", requestID, httpReq.Method, httpReq.URL.Path, s.User.ID)
+		ctx = context.WithValue(ctx, CtxAuthSession{}, s)
+		session = &s
+	default:
+		err = errors.Errorf("invalid auth specification")
+		return
+	} //switch(auth)
+
+	//prepare fnc arguments
+	args := []reflect.Value{reflect.ValueOf(ctx)}
+	var req interface{}
+
+	if h.fncType.NumIn() > 1 {
+		ct := httpReq.Header.Get("Content-Type")
+		if ct != "" && ct != "application/json" {
+			err = apierr.Errorf(apierr.ValidationFailed, "invalid Content-Type: %s, expecting application/json", ct)
+			return
+		}
+
+		reqValuePtr := reflect.New(h.reqType)
+		if err = json.NewDecoder(httpReq.Body).Decode(reqValuePtr.Interface()); err != nil {
+			err = apierr.Wrapf(err, apierr.ValidationFailed, "cannot parse JSON body: %s", err)
+			return
+		}
+
+		if validator, ok := reqValuePtr.Interface().(Validator); ok {
+			if err = validator.Validate(); err != nil {
+				log.Errorf("[%s] Invalid (%T): %+v:  %s", requestID, reqValuePtr.Interface(), err, redact.Value(reqValuePtr.Interface()))
+				err = apierr.Validation(err)
+				return
+			}
+			log.Debugf("[%s] Validated (%T) %s", requestID, reqValuePtr.Interface(), redact.Value(reqValuePtr.Interface()))
+		} else {
+			log.Debugf("[%s] Not Validating (%T) %s", requestID, reqValuePtr.Interface(), redact.Value(reqValuePtr.Interface()))
+		}
+		args = append(args, reqValuePtr.Elem())
+		req = reqValuePtr.Elem().Interface()
+	}
+
+	//count valid requests only, after the body is known for limits per email
+	if err = h.checkLimits(httpReq, session, req); err != nil {
+		return
+	}
+
+	results := h.fncValue.Call(args)
+
+	errValue := results[len(results)-1] //last result is error
+	if !errValue.IsNil() {
+		err = errors.Wrapf(errValue.Interface().(error), "handler failed")
+		return
+	}
+
+	if h.fncType.NumOut() > 1 {
+		if results[0].IsValid() {
+			if results[0].Type().Kind() == reflect.Ptr && !results[0].IsNil() {
+				res = results[0].Elem().Interface() //dereference the pointer
+			} else {
+				res = results[0].Interface()
+			}
+		}
+	}
+
+	//success: set status code
+	switch httpReq.Method {
+	case http.MethodPost, http.MethodPut:
+		status = http.StatusAccepted
+	case http.MethodGet:
+		status = http.StatusOK
+	case http.MethodDelete:
+		status = http.StatusNoContent
+		res = nil
+	}
+} //handler.ServeHTTP()
+
+type RegisterRequest struct {
+	db.User
+	ActivateLink string `json:"activate_link" doc:"Activation link to send to user in email"`
+	Locale       string `json:"locale,omitempty" doc:"Language of the email, e.g. \"af\" or \"en\" (default)"`
+}
+
+func (req RegisterRequest) Validate() error {
+	if err := req.User.Validate(); err != nil {
+		return err
+	}
+	if req.ActivateLink == "" {
+		return apierr.Invalid("activate_link", "missing activate_link")
+	}
+	return nil
+}
+
+func (a *api) register(ctx context.Context, req RegisterRequest) (db.User, error) {
+	user, err := a.store.AddUser(req.User)
+	if err != nil {
+		return db.User{}, err
+	}
+	//send email to user
+	msg, err := emails.Render("activate", req.Locale, emails.Branding{FromName: "Don8 Accounts"}, emails.ActivateData{
+		Name: user.Name,
+		Link: req.ActivateLink + "/" + string(*user.Tpw),
+	})
+	if err != nil {
+		log.Errorf("failed to render activation email: %+v", err)
+		return db.User{}, apierr.Errorf(apierr.Internal, "failed to send activation link to your email address")
+	}
+	if _, err := a.mailer.Send(emails.NewEmail(
+		emails.Address{Addr: "accounts@don8.com", Name: "Don8 Accounts"},
+		[]emails.Address{{Addr: user.Email, Name: user.Name}},
+		msg,
+		"user:"+string(user.ID),
+	)); err != nil {
+		log.Errorf("failed to send activation email: %+v", err)
+		return db.User{}, apierr.Errorf(apierr.Internal, "failed to send activation link to your email address")
+	}
+	return user, nil
+}
+
+func (a *api) activate(ctx context.Context, req db.ActivateRequest) (db.Session, error) {
+	return a.store.Activate(req)
+}
+
+type ResetRequest struct {
+	db.ResetRequest
+	ResetLink string `json:"reset_link"`
+	Locale    string `json:"locale,omitempty" doc:"Language of the email, e.g. \"af\" or \"en\" (default)"`
+}
+
+func (req ResetRequest) Validate() error {
+	if err := req.ResetRequest.Validate(); err != nil {
+		return err
+	}
+	if req.ResetLink == "" {
+		return apierr.Invalid("reset_link", "missing reset_link")
+	}
+	return nil
+}
+
+func (a *api) reset(ctx context.Context, req ResetRequest) error {
+	user, err := a.store.Reset(req.ResetRequest)
+	if err != nil {
+		return err
+	}
+	//send email to user
+	msg, err := emails.Render("reset", req.Locale, emails.Branding{FromName: "Don8 Accounts"}, emails.ResetData{
+		Name: user.Name,
+		Link: req.ResetLink + "/" + string(*user.Tpw),
+	})
+	if err != nil {
+		log.Errorf("failed to render reset email: %+v", err)
+		return apierr.Errorf(apierr.Internal, "failed to send password reset link to your email address")
+	}
+	if _, err := a.mailer.Send(emails.NewEmail(
+		emails.Address{Addr: "accounts@don8.com", Name: "Don8 Accounts"},
+		[]emails.Address{{Addr: user.Email, Name: user.Name}},
+		msg,
+		"user:"+string(user.ID),
+	)); err != nil {
+		log.Errorf("failed to send reset email: %+v", err)
+		return apierr.Errorf(apierr.Internal, "failed to send password reset link to your email address")
+	}
+	return nil
+}
+
+func (a *api) login(ctx context.Context, req db.LoginRequest) (db.Session, error) {
+	if err := a.lockedOut(req.Email); err != nil {
+		return db.Session{}, err
+	}
+	s, err := a.store.Login(req)
+	if err != nil {
+		if apierr.From(err).Code == apierr.Unauthorized {
+			a.loginFailed(req.Email)
+		}
+		return db.Session{}, err
+	}
+	a.loginSucceeded(req.Email)
+	return s, nil
+}
+
+func (a *api) logout(ctx context.Context) error {
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	return a.store.Logout(s.ID)
+}
+
+func (a *api) addGroup(ctx context.Context, req db.NewGroup) (db.Group, error) {
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	g, err := a.store.AddGroup(*s.User, req)
+	if err != nil {
+		return db.Group{}, err
+	}
+	return g, nil
+}
+
+func (a *api) listGroups(ctx context.Context) (db.MyGroupList, error) {
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	params := ctx.Value(CtxParams{}).(params)
+	page, err := params.Page(db.MyGroupSort)
+	if err != nil {
+		return db.MyGroupList{}, err
+	}
+	filter := params.String("filter", "")
+	return a.store.MyGroups(*s.User, filter, nil, nil, page)
+}
+
+//getGroup gives the app a good view of the group, including parent description and immediate child list
+func (a *api) getGroup(ctx context.Context) (db.FullGroup, error) {
+	params := ctx.Value(CtxParams{}).(params)
+	log.Infof("params: %+v", params)
+	id := params.String("id", "")
+	if id == "" {
+		return db.FullGroup{}, apierr.Errorf(apierr.ValidationFailed, "missing URL param id")
+	}
+	fg, err := a.store.GetFullGroup(db.ID(id))
+	if err != nil {
+		return db.FullGroup{}, apierr.Errorf(apierr.NotFound, "unknown group")
+	}
+
+	//load first page of requests (can also filter on params)
+	if requests, err := a.listRequests(ctx); err != nil {
+		log.Errorf("failed to load group requests")
+	} else {
+		fg.Requests = requests.Requests
+	}
+	return fg, nil
+}
+
+//getGroupTree returns the group and its sub-groups with totals rolled up from all levels below each group
+func (a *api) getGroupTree(ctx context.Context) (db.GroupNode, error) {
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return db.GroupNode{}, err
+	}
+	params := ctx.Value(CtxParams{}).(params)
+	return a.store.GetGroupTree(groupID, params.Int("depth", 5, 0, db.MaxGroupDepth))
+}
+
+func (a *api) updGroup(ctx context.Context, req db.UpdGroupRequest) (db.FullGroup, error) {
+	//todo: check permission on this group
+	if _, err := a.store.GetGroup(req.ID); err != nil {
+		return db.FullGroup{}, apierr.Wrapf(err, apierr.NotFound, "unknown group")
+	}
+	if req.ParentGroupID != nil {
+		//moving a group needs coordinators of the group and of its new parent
+		s := ctx.Value(CtxAuthSession{}).(db.Session)
+		for _, id := range []db.ID{req.ID, *req.ParentGroupID} {
+			if id == "" {
+				continue
+			}
+			ok, err := a.store.IsGroupCoordinator(id, s.User.ID)
+			if err != nil {
+				return db.FullGroup{}, err
+			}
+			if !ok {
+				return db.FullGroup{}, apierr.Errorf(apierr.Forbidden, "only coordinators of the group and its new parent can move it")
+			}
+		}
+	}
+	if err := a.store.UpdGroup(req); err != nil {
+		return db.FullGroup{}, errors.Wrapf(err, "failed to update group")
+	}
+	fg, err := a.store.GetFullGroup(req.ID)
+	if err != nil {
+		return db.FullGroup{}, errors.Wrapf(err, "failed to get group after update")
+	}
+	return fg, nil
+}
+
+func (a *api) getGroupReminders(ctx context.Context) (db.GroupReminders, error) {
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return db.GroupReminders{}, err
+	}
+	return a.store.GetGroupReminders(groupID)
+}
+
+type updGroupRemindersRequest struct {
+	DaysBefore    []int `json:"days_before" doc:"Send promise reminders this many days before the due date, 0 for on the due date"`
+	OverdueDigest bool  `json:"overdue_digest" doc:"Send daily digest of overdue promises to group coordinators"`
+}
+
+func (a *api) updGroupReminders(ctx context.Context, req updGroupRemindersRequest) (db.GroupReminders, error) {
+	groupID, err := a.groupCoordinator(ctx)
+	if err != nil {
+		return db.GroupReminders{}, err
+	}
+	gr := db.GroupReminders{
+		GroupID:       groupID,
+		DaysBefore:    req.DaysBefore,
+		OverdueDigest: req.OverdueDigest,
+	}
+	if err := a.store.SetGroupReminders(gr); err != nil {
+		return db.GroupReminders{}, apierr.Validation(err)
+	}
+	return a.store.GetGroupReminders(groupID)
+}
+
+func (a *api) getGroupBranding(ctx context.Context) (db.GroupBranding, error) {
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return db.GroupBranding{}, err
+	}
+	b, err := a.store.GetGroupBranding(groupID)
+	if err != nil {
+		return db.GroupBranding{}, apierr.Errorf(apierr.NotFound, "unknown group")
+	}
+	return b, nil
+}
+
+type updGroupBrandingRequest struct {
+	emails.Branding
+	Locale string `json:"locale,omitempty" doc:"Default locale for emails from this group, e.g. \"af\" or \"en\""`
+}
+
+func (a *api) updGroupBranding(ctx context.Context, req updGroupBrandingRequest) (db.GroupBranding, error) {
+	groupID, err := a.groupCoordinator(ctx)
+	if err != nil {
+		return db.GroupBranding{}, err
+	}
+	if err := a.store.SetGroupBranding(db.GroupBranding{
+		GroupID:  groupID,
+		Branding: req.Branding,
+		Locale:   req.Locale,
+	}); err != nil {
+		return db.GroupBranding{}, apierr.Validation(err)
+	}
+	return a.store.GetGroupBranding(groupID)
+}
+
+//previewGroupEmail renders an email with sample data and the group's branding
+//so coordinators can see the result before sending, e.g. GET /groups/{id}/emails/invitation?locale=af
+func (a *api) previewGroupEmail(ctx context.Context) (emails.Message, error) {
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return emails.Message{}, err
+	}
+	g, err := a.store.GetGroup(groupID)
+	if err != nil {
+		return emails.Message{}, apierr.Errorf(apierr.NotFound, "unknown group")
+	}
+	b, err := a.store.GetGroupBranding(groupID)
+	if err != nil {
+		return emails.Message{}, err
+	}
+	params := ctx.Value(CtxParams{}).(params)
+	name := params.String("name", "")
+	data, ok := emails.SampleData(name, g.Title)
+	if !ok {
+		return emails.Message{}, apierr.Errorf(apierr.NotFound, "unknown email \"%s\" (expecting one of %s)", name, strings.Join(emails.Names(), "|"))
+	}
+	return emails.Render(name, params.String("locale", b.Locale), b.Branding, data)
+}
+
+type importRequest struct {
+	Format  string `json:"format" doc:"csv (default) or xlsx"`
+	Content string `json:"content" doc:"CSV text, or base64 encoded XLSX file, with a header row of columns group,group_description,title,description,tags,units,qty"`
+	DryRun  bool   `json:"dry_run" doc:"Only validate and report what would be done"`
+}
+
+func (req *importRequest) Validate() error {
+	if req.Format == "" {
+		req.Format = "csv"
+	}
+	if req.Format != "csv" && req.Format != "xlsx" {
+		return apierr.Invalid("format", "invalid format \"%s\" expecting csv|xlsx", req.Format)
+	}
+	if req.Content == "" {
+		return apierr.Invalid("content", "missing content")
+	}
+	return nil
+}
+
+//importGroup creates/updates child groups and requests from a spreadsheet, only by coordinators of the group, also for a dry run
+func (a *api) importGroup(ctx context.Context, req importRequest) (importer.Result, error) {
+	groupID, err := a.groupCoordinator(ctx)
+	if err != nil {
+		return importer.Result{}, err
+	}
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	var rows []importer.Row
+	switch req.Format {
+	case "xlsx":
+		var content []byte
+		if content, err = base64.StdEncoding.DecodeString(req.Content); err != nil {
+			return importer.Result{}, apierr.Errorf(apierr.ValidationFailed, "xlsx content is not base64 encoded")
+		}
+		rows, err = importer.ReadXLSX(content)
+	default:
+		rows, err = importer.ReadCSV(strings.NewReader(req.Content))
+	}
+	if err != nil {
+		return importer.Result{}, apierr.Validation(err)
+	}
+	return importer.Import(a.store, *s.User, groupID, rows, req.DryRun)
+}
+
+//groupMember checks that the session user is a member of the group in the URL
+func (a *api) groupMember(ctx context.Context) (db.ID, error) {
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	params := ctx.Value(CtxParams{}).(params)
+	groupID := db.ID(params.String("id", ""))
+	m, err := a.store.GetMemberByEmail(groupID, s.User.Email)
+	if err != nil {
+		return "", err
+	}
+	if m == nil {
+		return "", apierr.Errorf(apierr.Forbidden, "not a member of this group")
+	}
+	return groupID, nil
+}
+
+func (a *api) listGroupMembers(ctx context.Context) (db.MemberList, error) {
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return db.MemberList{}, err
+	}
+	page, err := ctx.Value(CtxParams{}).(params).Page(db.MemberSort)
+	if err != nil {
+		return db.MemberList{}, err
+	}
+	return a.store.ListGroupMembers(groupID, page)
+}
+
+func (a *api) listGroupInvitations(ctx context.Context) (db.InvitationList, error) {
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return db.InvitationList{}, err
+	}
+	page, err := ctx.Value(CtxParams{}).(params).Page(db.InvitationSort)
+	if err != nil {
+		return db.InvitationList{}, err
+	}
+	return a.store.ListGroupInvitations(groupID, page)
+}
+
+func (a *api) listGroupLocations(ctx context.Context) (db.LocationList, error) {
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return db.LocationList{}, err
+	}
+	page, err := ctx.Value(CtxParams{}).(params).Page(db.LocationSort)
+	if err != nil {
+		return db.LocationList{}, err
+	}
+	return a.store.ListGroupLocations(groupID, page)
+}
+
+func (a *api) listGroupPromises(ctx context.Context) (db.PromiseList, error) {
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return db.PromiseList{}, err
+	}
+	params := ctx.Value(CtxParams{}).(params)
+	page, err := params.Page(db.PromiseSort)
+	if err != nil {
+		return db.PromiseList{}, err
+	}
+	var before *time.Time
+	if s := params.String("before", ""); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			return db.PromiseList{}, apierr.Errorf(apierr.ValidationFailed, "invalid before=\"%s\" expecting CCYY-MM-DD", s)
+		}
+		before = &t
+	}
+	return a.store.GetPromises(
+		string(groupID),
+		params.String("user_id", ""),
+		params.String("request_id", ""),
+		params.String("location_id", ""),
+		before,
+		page)
+}
+
+type addPromiseRequest struct {
+	LocationID *db.ID `json:"location_id,omitempty" doc:"Location where user intend to make the donation"`
+	Qty        int    `json:"qty" doc:"Quantity that user promise to donate, or amount pledged in minor units for money requests"`
+	Date       string `json:"date" doc:"Date by when user promise to make the donation CCYY-MM-DD"`
+	date       time.Time
+}
+
+func (req *addPromiseRequest) Validate() error {
+	if req.Qty <= 0 {
+		return apierr.Invalid("qty", "qty must be positive")
+	}
+	var err error
+	if req.date, err = time.ParseInLocation("2006-01-02", req.Date, time.Local); err != nil {
+		return apierr.Invalid("date", "invalid date \"%s\" expecting CCYY-MM-DD", req.Date)
+	}
+	return nil
+}
+
+//addPromise by a member of the request's group, e.g. POST /requests/{id}/promises
+func (a *api) addPromise(ctx context.Context, req addPromiseRequest) (db.Promise, error) {
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	params := ctx.Value(CtxParams{}).(params)
+	r, err := a.store.GetRequest(db.ID(params.String("id", "")))
+	if err != nil {
+		return db.Promise{}, apierr.Wrapf(err, apierr.NotFound, "unknown request")
+	}
+	m, err := a.store.GetMemberByEmail(r.GroupID, s.User.Email)
+	if err != nil {
+		return db.Promise{}, err
+	}
+	if m == nil {
+		return db.Promise{}, apierr.Errorf(apierr.Forbidden, "only members of the group can promise")
+	}
+	return a.store.AddPromise(db.Promise{
+		RequestID:  r.ID,
+		UserID:     s.User.ID,
+		LocationID: req.LocationID,
+		Qty:        req.Qty,
+		Date:       db.SqlTime(req.date),
+	})
+}
+
+//withdrawPromise by the user who made it, or a group coordinator
+func (a *api) withdrawPromise(ctx context.Context) (db.Promise, error) {
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	params := ctx.Value(CtxParams{}).(params)
+	p, err := a.store.GetPromise(db.ID(params.String("id", "")))
+	if err != nil {
+		return db.Promise{}, err
+	}
+	if p.UserID != s.User.ID {
+		r, err := a.store.GetRequest(p.RequestID)
+		if err != nil {
+			return db.Promise{}, err
+		}
+		ok, err := a.store.IsGroupCoordinator(r.GroupID, s.User.ID)
+		if err != nil {
+			return db.Promise{}, err
+		}
+		if !ok {
+			return db.Promise{}, apierr.Errorf(apierr.Forbidden, "only the user who made the promise or a group coordinator can withdraw it")
+		}
+	}
+	return a.store.WithdrawPromise(p.ID)
+}
+
+func (a *api) addRequest(ctx context.Context, req db.Request) (db.Request, error) {
+	return a.store.AddRequest(req)
+}
+
+func (a *api) listRequests(ctx context.Context) (db.RequestList, error) {
+	params := ctx.Value(CtxParams{}).(params)
+	if params.String("id", "") == "" {
+		return db.RequestList{}, apierr.Errorf(apierr.ValidationFailed, "missing param id")
+	}
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return db.RequestList{}, err
+	}
+	page, err := params.Page(db.RequestSort)
+	if err != nil {
+		return db.RequestList{}, err
+	}
+	filter := db.RequestFilter{
+		Text:        params.String("filter", ""),
+		Tags:        db.ParseTags(params.String("tags", "")),
+		MinPriority: params.Int("min_priority", 0, 0, db.MaxRequestPriority),
+		Type:        db.RequestType(params.String("type", "")),
+	}
+	if filter.Type != "" && filter.Type != db.RequestTypeGoods && filter.Type != db.RequestTypeMoney {
+		return db.RequestList{}, apierr.Invalid("type", "invalid type \"%s\" expecting goods|money", filter.Type)
+	}
+	for _, s := range strings.Split(params.String("status", ""), ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		status := db.RequestStatus(s)
+		if err := status.Validate(); err != nil {
+			return db.RequestList{}, apierr.Invalid("status", "%s", err)
+		}
+		filter.Statuses = append(filter.Statuses, status)
+	}
+	if s := params.String("needed_before", ""); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, time.Local)
+		if err != nil {
+			return db.RequestList{}, apierr.Errorf(apierr.ValidationFailed, "invalid needed_before=\"%s\" expecting CCYY-MM-DD", s)
+		}
+		filter.NeededBefore = &t
+	}
+	return a.store.FindRequests(groupID, filter, page)
+}
+
+//getRequest including group title and summary of receives and promises etc...
+func (a *api) getRequest(ctx context.Context) (db.FullRequest, error) {
+	params := ctx.Value(CtxParams{}).(params)
+	log.Infof("params: %+v", params)
+	id := params.String("id", "")
+	if id == "" {
+		return db.FullRequest{}, apierr.Errorf(apierr.ValidationFailed, "missing URL param id")
+	}
+	fr, err := a.store.GetFullRequest(db.ID(id))
+	if err != nil {
+		log.Errorf("failed to get full request(%s): %+v", id, err)
+		return db.FullRequest{}, apierr.Errorf(apierr.NotFound, "unknown request")
+	}
+	return fr, nil
+}
+
+func (a *api) updRequest(ctx context.Context, req db.UpdRequestRequest) (db.FullRequest, error) {
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	r, err := a.store.GetRequest(req.ID)
+	if err != nil {
+		return db.FullRequest{}, apierr.Wrapf(err, apierr.NotFound, "unknown request")
+	}
+	ok, err := a.store.IsGroupCoordinator(r.GroupID, s.User.ID)
+	if err != nil {
+		return db.FullRequest{}, err
+	}
+	if !ok {
+		return db.FullRequest{}, apierr.Errorf(apierr.Forbidden, "only group coordinators can update requests")
+	}
+	if err := a.store.UpdRequest(req); err != nil {
+		return db.FullRequest{}, errors.Wrapf(err, "failed to update request")
+	}
+	fr, err := a.store.GetFullRequest(req.ID)
+	if err != nil {
+		return db.FullRequest{}, errors.Wrapf(err, "failed to get request after update")
+	}
+	return fr, nil
+}
+
+//listUnits so the app can offer a list of known units when creating requests and donations
+func listUnits(ctx context.Context) ([]model.UnitDef, error) {
+	return model.Units(), nil
+}
+
+//systemAdmin checks that the session user is one of the configured system admins
+func (a *api) systemAdmin(ctx context.Context) error {
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	for _, email := range a.admins {
+		if strings.EqualFold(email, s.User.Email) {
+			return nil
+		}
+	}
+	return apierr.Errorf(apierr.Forbidden, "only system admins can do this")
+}
+
+func (a *api) listOutbound(ctx context.Context) ([]db.OutboundMessage, error) {
+	if err := a.systemAdmin(ctx); err != nil {
+		return nil, err
+	}
+	params := ctx.Value(CtxParams{}).(params)
+	return a.store.ListOutboundMessages(
+		params.String("ref", ""),
+		params.String("email", ""),
+		params.Int("limit", 10, 1, 100),
+	)
+}
+
+type bounceRequest struct {
+	MessageID string `json:"message_id" doc:"Message-ID of the bounced email"`
+	Email     string `json:"email,omitempty" doc:"Optional recipient that bounced, else all recipients of the message"`
+	Reason    string `json:"reason"`
+}
+
+func (req bounceRequest) Validate() error {
+	if req.MessageID == "" {
+		return apierr.Invalid("message_id", "missing message_id")
+	}
+	if req.Reason == "" {
+		return apierr.Invalid("reason", "missing reason")
+	}
+	return nil
+}
+
+//bounceOutbound is called by the mail bounce processor, logged in as a system admin, to mark the recipient undeliverable
+func (a *api) bounceOutbound(ctx context.Context, req bounceRequest) (db.OutboundMessage, error) {
+	if err := a.systemAdmin(ctx); err != nil {
+		return db.OutboundMessage{}, err
+	}
+	m, err := a.store.BounceOutboundMessage(req.MessageID, req.Email, req.Reason)
+	if err != nil {
+		return db.OutboundMessage{}, err
+	}
+	return m, nil
+}
+
+type invitesRequest struct {
+	From    string `json:"from"`
+	Emails  string `json:"emails" doc:"Email addresses could be space, new-line or comma separated, at most 100 per request"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
+
+func (req *invitesRequest) Validate() error {
+	var err error
+	if req.From == "" {
+		return apierr.Invalid("from", "missing from")
+	}
+	if req.From, err = emails.Valid(req.From); err != nil {
+		return apierr.Invalid("from", "invalid from(%s)", req.From)
+	}
+	if req.Subject == "" {
+		return apierr.Invalid("subject", "missing subject")
+	}
+	if req.Body == "" {
+		return apierr.Invalid("body", "missing body")
+	}
+	if n := len(splitEmails(req.Emails)); n > maxInvitesPerRequest {
+		return apierr.Invalid("emails", "too many emails (%d), send at most %d per request", n, maxInvitesPerRequest)
+	}
+	return nil
+}
+
+//splitEmails splits a list of email addresses separated by space, new-line, comma, semi-colon or |
+func splitEmails(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ',' || r == ';' || r == '|' || r == '\n' || r == '\r' || r == '\t'
+	})
+}
+
+type invitesResponse struct {
+	NrQueued      int      `json:"nr_queued" doc:"Nr of email addresses queued for processing"`
+	InvalidEmails []string `json:"invalid_emails" doc:"List of email addresses not queued for processing"`
+}
+
+func (a *api) sendInvites(ctx context.Context, req invitesRequest) (invitesResponse, error) {
+	params := ctx.Value(CtxParams{}).(params)
+
+	groupID := db.ID(params.String("id", ""))
+	g, err := a.store.GetGroup(groupID)
+	if err != nil {
+		return invitesResponse{}, apierr.Wrapf(err, apierr.NotFound, "unknown group")
+	}
+	log.Debugf("group: %+v", g)
+	//check before the quota is charged, so others cannot use up the group's quota
+	if _, err := a.groupCoordinator(ctx); err != nil {
+		return invitesResponse{}, err
+	}
+
+	res := invitesResponse{
+		NrQueued:      0,
+		InvalidEmails: []string{},
+	}
+	valid := []string{}
+	for _, s := range splitEmails(req.Emails) {
+		validEmail, err := emails.Valid(s)
+		if err != nil {
+			log.Debugf("group(id:%s) ignore invalid invited email(%s)", groupID, s)
+			res.InvalidEmails = append(res.InvalidEmails, s)
+			continue
+		}
+		valid = append(valid, validEmail)
+	}
+	if len(valid) == 0 && len(res.InvalidEmails) == 0 {
+		return invitesResponse{}, apierr.Errorf(apierr.ValidationFailed, "no emails=\"...\" to invite")
+	}
+
+	//daily quota applies to the group, regardless of who sends the invitations
+	if len(valid) > 0 {
+		ok, retryAfter, err := ratelimit.AllowN(a.limits, "invites:"+string(groupID), len(valid), a.inviteQuota)
+		if err != nil {
+			log.Errorf("group(id:%s) invitation quota not checked: %+v", groupID, err)
+		} else if !ok {
+			return invitesResponse{}, apierr.Limited(retryAfter, "group may send %d invitations per day, try again in %s", a.inviteQuota.Max, retryAfter.Round(time.Minute))
+		}
+	}
+
+	//publish the invitations into redis for processing asynchronously
+	log.Debugf("Got %d emails to process...", len(valid))
+	for _, validEmail := range valid {
+		inv := db.Invitation{
+			GroupID: groupID,
+			Email:   validEmail,
+		}
+		jsonInvitation, _ := json.Marshal(inv)
+		if err := a.queue.Publish(ctx, invitations.Queue, jsonInvitation); err != nil {
+			log.Errorf("failed to queue email(%s) for processing: %+v", validEmail, err)
+			return res, errors.Wrapf(err, "failed to queue invitations")
+		}
+		res.NrQueued++
+		log.Debugf("Queued email(%s) ...", validEmail)
+	}
+	return res, nil
+} //api.sendInvites()
+
+type Validator interface {
+	Validate() error
+}
+
+type params struct {
+	value map[string]string
+}
+
+func newParams() params {
+	return params{
+		value: map[string]string{},
+	}
+}
+
+func (p params) With(n, v string) params {
+	p.value[n] = v
+	return p
+}
+
+func (p params) String(n, defaultValue string) string {
+	if s, ok := p.value[n]; !ok {
+		return defaultValue
+	} else {
+		return s
+	}
+}
+
+//Page gets the cursor, limit and sort params for a list
+//and fails on invalid values rather than clamping them like Int()
+func (p params) Page(sortFields db.SortFields) (db.PageRequest, error) {
+	page := db.PageRequest{
+		Cursor: p.String("cursor", ""),
+		Sort:   p.String("sort", ""),
+	}
+	if s := p.String("limit", ""); s != "" {
+		var err error
+		if page.Size, err = strconv.Atoi(s); err != nil || page.Size < 1 {
+			return db.PageRequest{}, apierr.Errorf(apierr.ValidationFailed, "invalid limit=\"%s\" expecting 1..%d", s, db.MaxPageSize)
+		}
+	}
+	if err := page.Validate(sortFields); err != nil {
+		return db.PageRequest{}, apierr.Validation(err)
+	}
+	return page, nil
+}
+
+func (p params) Int(n string, defaultValue, minValue, maxValue int) int {
+	s, ok := p.value[n]
+	if !ok {
+		return defaultValue
+	}
+	i64, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return defaultValue
+	}
+	if int(i64) < minValue {
+		return minValue
+	}
+	if int(i64) > maxValue {
+		return maxValue
+	}
+	return int(i64)
+}
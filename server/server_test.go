@@ -0,0 +1,739 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/emails"
+	"github.com/jansemmelink/don8/queues/invitations"
+	"github.com/jansemmelink/don8/scenario"
+	"github.com/jansemmelink/don8/seed"
+	"github.com/jansemmelink/don8/server"
+)
+
+//fakeQueue keeps published messages per queue
+type fakeQueue struct {
+	sync.Mutex
+	messages map[string][]string
+}
+
+func (q *fakeQueue) Publish(ctx context.Context, queue string, message []byte) error {
+	q.Lock()
+	defer q.Unlock()
+	q.messages[queue] = append(q.messages[queue], string(message))
+	return nil
+}
+
+type harness struct {
+	t       *testing.T
+	handler http.Handler
+	store   *fakeStore
+	mailer  *emails.MemoryMailer
+	queue   *fakeQueue
+	sid     string
+}
+
+func newHarness(t *testing.T) *harness {
+	h := &harness{
+		t:      t,
+		store:  newFakeStore(),
+		mailer: emails.NewMemoryMailer(),
+		queue:  &fakeQueue{messages: map[string][]string{}},
+	}
+	h.handler = server.NewRouter(server.Deps{Store: h.store, Mailer: h.mailer, Queue: h.queue})
+	return h
+}
+
+//call the API with the session of the last login and decode the JSON response into res
+func (h *harness) call(method, url string, req interface{}, expectedStatus int, res interface{}) {
+	h.t.Helper()
+	httpRes := h.do(method, url, req)
+	if httpRes.Code != expectedStatus {
+		h.t.Fatalf("%s %s -> %d, expected %d: %s", method, url, httpRes.Code, expectedStatus, httpRes.Body.String())
+	}
+	if res != nil {
+		if err := json.Unmarshal(httpRes.Body.Bytes(), res); err != nil {
+			h.t.Fatalf("%s %s -> invalid JSON response %s: %+v", method, url, httpRes.Body.String(), err)
+		}
+	}
+}
+
+//do calls the API with the session of the last login, also from other goroutines
+func (h *harness) do(method, url string, req interface{}) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	if req != nil {
+		json.NewEncoder(&body).Encode(req)
+	}
+	httpReq := httptest.NewRequest(method, url, &body)
+	httpReq.Header.Set("Content-Type", "application/json")
+	if h.sid != "" {
+		httpReq.Header.Set(scenario.SessionHeader, h.sid)
+	}
+	httpRes := httptest.NewRecorder()
+	h.handler.ServeHTTP(httpRes, httpReq)
+	return httpRes
+}
+
+//register and activate with the link in the email, then login
+func (h *harness) signup(name, email, pwd string) (userID string) {
+	h.t.Helper()
+	h.sid = ""
+	h.mailer.Reset()
+	var user struct{ ID string }
+	h.call(http.MethodPost, "/auth/register", map[string]interface{}{
+		"name":          name,
+		"phone":         "0821234567",
+		"email":         email,
+		"activate_link": "http://app/activate",
+	}, http.StatusAccepted, &user)
+	sent := h.mailer.Sent()
+	if len(sent) != 1 || sent[0].To[0].Addr != email {
+		h.t.Fatalf("activation email not sent: %+v", sent)
+	}
+	i := strings.Index(sent[0].Text, "http://app/activate/")
+	if i < 0 {
+		h.t.Fatalf("no activation link in email: %s", sent[0].Text)
+	}
+	tpw := strings.Fields(sent[0].Text[i+len("http://app/activate/"):])[0]
+	h.call(http.MethodPost, "/auth/activate", map[string]interface{}{"tpw": tpw, "pwd": pwd}, http.StatusAccepted, nil)
+
+	var session struct{ ID string }
+	h.call(http.MethodPost, "/auth/login", map[string]interface{}{"email": email, "password": pwd}, http.StatusAccepted, &session)
+	h.sid = session.ID
+	return user.ID
+}
+
+func TestDonationFlow(t *testing.T) {
+	h := newHarness(t)
+	h.call(http.MethodPost, "/auth/login", map[string]interface{}{"email": "org@example.com", "password": "x"}, http.StatusUnauthorized, nil)
+	h.call(http.MethodGet, "/groups/", nil, http.StatusUnauthorized, nil)
+	h.signup("Organiser", "org@example.com", "Org-pwd1")
+
+	var group struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"title": "Wildsfees", "user_role": "Organiser"}, http.StatusAccepted, &group)
+	var stall struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"parent_group_id": group.ID, "title": "Pannekoek stal", "user_role": "Organiser"}, http.StatusAccepted, &stall)
+	var myGroups struct {
+		Groups []struct{ Title string }
+		Total  int
+	}
+	h.call(http.MethodGet, "/groups/", nil, http.StatusOK, &myGroups)
+	if myGroups.Total != 2 {
+		t.Fatalf("my groups: %+v", myGroups)
+	}
+
+	var request struct{ ID string }
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": stall.ID, "title": "Flour", "units": "kg", "qty": 20}, http.StatusAccepted, &request)
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": stall.ID, "qty": 20}, http.StatusBadRequest, nil)
+
+	//organiser is a member of the parent group, so may promise
+	var promise struct {
+		ID     string
+		UserID string `json:"user_id"`
+		Qty    int
+	}
+	h.call(http.MethodPost, "/requests/"+request.ID+"/promises", map[string]interface{}{"qty": 5, "date": "2030-01-31"}, http.StatusAccepted, &promise)
+	if promise.ID == "" || promise.Qty != 5 {
+		t.Fatalf("promise: %+v", promise)
+	}
+	h.call(http.MethodPost, "/requests/"+request.ID+"/promises", map[string]interface{}{"qty": 0, "date": "2030-01-31"}, http.StatusBadRequest, nil)
+	h.call(http.MethodPost, "/requests/"+request.ID+"/promises", map[string]interface{}{"qty": 1, "date": "31/1/2030"}, http.StatusBadRequest, nil)
+	h.call(http.MethodPost, "/requests/unknown/promises", map[string]interface{}{"qty": 1, "date": "2030-01-31"}, http.StatusNotFound, nil)
+
+	var fullRequest struct {
+		Progress struct {
+			Qty      int
+			Promised float64
+		}
+	}
+	h.call(http.MethodGet, "/requests/"+request.ID, nil, http.StatusOK, &fullRequest)
+	if fullRequest.Progress.Qty != 20 || fullRequest.Progress.Promised != 5 {
+		t.Fatalf("progress: %+v", fullRequest.Progress)
+	}
+	var promises struct {
+		Promises []struct {
+			RequestTitle string `json:"request_title"`
+			Qty          int
+		}
+	}
+	h.call(http.MethodGet, "/groups/"+stall.ID+"/promises", nil, http.StatusOK, &promises)
+	if len(promises.Promises) != 1 || promises.Promises[0].RequestTitle != "Flour" {
+		t.Fatalf("promises: %+v", promises)
+	}
+
+	//other users must be members to promise
+	h.signup("Donor", "donor@example.com", "Donor-pwd1")
+	h.call(http.MethodPost, "/requests/"+request.ID+"/promises", map[string]interface{}{"qty": 1, "date": "2030-01-31"}, http.StatusForbidden, nil)
+	h.call(http.MethodGet, "/groups/"+stall.ID+"/promises", nil, http.StatusForbidden, nil)
+
+	h.call(http.MethodPost, "/auth/logout", nil, http.StatusAccepted, nil)
+	h.call(http.MethodGet, "/groups/", nil, http.StatusUnauthorized, nil)
+}
+
+func TestInvitationsQueued(t *testing.T) {
+	h := newHarness(t)
+	h.signup("Organiser", "org@example.com", "Org-pwd1")
+	var group struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"title": "Wildsfees", "user_role": "Organiser"}, http.StatusAccepted, &group)
+	var res struct {
+		NrQueued      int      `json:"nr_queued"`
+		InvalidEmails []string `json:"invalid_emails"`
+	}
+	h.call(http.MethodPost, "/invitations/"+group.ID, map[string]interface{}{
+		"from":    "org@example.com",
+		"emails":  "a@example.com, b@example.com, not-an-email",
+		"subject": "Help with Wildsfees",
+		"body":    "Please join",
+	}, http.StatusAccepted, &res)
+	if res.NrQueued != 2 || len(res.InvalidEmails) != 1 {
+		t.Fatalf("response: %+v", res)
+	}
+	if queued := h.queue.messages[invitations.Queue]; len(queued) != 2 || !strings.Contains(queued[1], "b@example.com") {
+		t.Fatalf("queued: %v", queued)
+	}
+}
+
+func TestInviteQuota(t *testing.T) {
+	h := newHarness(t)
+	h.handler = server.NewRouter(server.Deps{Store: h.store, Mailer: h.mailer, Queue: h.queue, InviteQuota: 2})
+	h.signup("Organiser", "org@example.com", "Org-pwd1")
+	orgSid := h.sid
+	var group struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"title": "Wildsfees", "user_role": "Organiser"}, http.StatusAccepted, &group)
+	invite := func(emails string, status int) {
+		t.Helper()
+		h.call(http.MethodPost, "/invitations/"+group.ID, map[string]interface{}{"from": "org@example.com", "emails": emails, "subject": "Help", "body": "Please join"}, status, nil)
+	}
+
+	//others cannot invite, nor use the quota of the group
+	h.signup("Other", "other@example.com", "Other-pwd1")
+	for i := 0; i < 2; i++ {
+		invite("a@example.com,b@example.com", http.StatusForbidden)
+	}
+	h.sid = orgSid
+	invite("a@example.com,b@example.com", http.StatusAccepted)
+	invite("c@example.com", http.StatusTooManyRequests)
+}
+
+func TestRoutes(t *testing.T) {
+	h := newHarness(t)
+	h.call(http.MethodGet, "/no/such/route", nil, http.StatusNotFound, nil)
+	h.call(http.MethodDelete, "/auth/login", nil, http.StatusMethodNotAllowed, nil)
+	h.call(http.MethodGet, "/healthz", nil, http.StatusOK, nil)
+	var doc struct {
+		Paths map[string]map[string]interface{}
+	}
+	h.call(http.MethodGet, "/openapi.json", nil, http.StatusOK, &doc)
+	for path, method := range map[string]string{
+		"/auth/register":          "post",
+		"/groups/{id}":            "get",
+		"/requests/{id}/promises": "post",
+		"/promises/{id}/withdraw": "post",
+		"/search":                 "get",
+		"/groups/{id}/tree":       "get",
+		"/groups/{id}/reconcile":  "post",
+	} {
+		if _, ok := doc.Paths[path][method]; !ok {
+			t.Errorf("openapi.json has no %s %s", method, path)
+		}
+	}
+	if op, _ := doc.Paths["/auth/login"]["post"].(map[string]interface{}); op["operationId"] != "login" {
+		t.Errorf("login operation: %+v", op)
+	}
+}
+
+//TestRouters checks that each router uses its own dependencies
+func TestRouters(t *testing.T) {
+	first, second := newHarness(t), newHarness(t)
+	first.signup("Organiser", "org@example.com", "Org-pwd1")
+	if len(first.store.users) != 1 || len(second.store.users) != 0 {
+		t.Fatalf("users in first %d, in second %d", len(first.store.users), len(second.store.users))
+	}
+	second.sid = first.sid
+	second.call(http.MethodGet, "/groups/", nil, http.StatusUnauthorized, nil)
+}
+
+func TestSearch(t *testing.T) {
+	h := newHarness(t)
+	h.signup("Other", "other@example.com", "Other-pwd1")
+	var other struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"title": "Ander Hoërskool", "user_role": "Organiser"}, http.StatusAccepted, &other)
+
+	h.signup("Anél Koekemoer", "org@example.com", "Org-pwd1")
+	var school, fees struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"title": "Hoërskool Waterkloof", "user_role": "Organiser"}, http.StatusAccepted, &school)
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"parent_group_id": school.ID, "title": "Koekverkoping", "user_role": "Organiser"}, http.StatusAccepted, &fees)
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": fees.ID, "title": "Koeke", "tags": "bak,kos", "qty": 20}, http.StatusAccepted, nil)
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": fees.ID, "title": "Koeldrank", "tags": "drink", "qty": 20}, http.StatusAccepted, nil)
+
+	type result struct {
+		Hits []struct {
+			Kind  string
+			Title string
+		}
+		Total  int
+		Facets map[string]int
+	}
+	var res result
+	h.call(http.MethodGet, "/search?q=hoer", nil, http.StatusOK, &res)
+	if res.Total != 1 || res.Hits[0].Title != "Hoërskool Waterkloof" {
+		t.Fatalf("other user's group found: %+v", res)
+	}
+	res = result{}
+	h.call(http.MethodGet, "/search?q=koe", nil, http.StatusOK, &res)
+	//the organiser is a member of both groups
+	if res.Total != 5 || res.Facets["bak"] != 1 || res.Facets["drink"] != 1 {
+		t.Fatalf("koe: %+v", res)
+	}
+	res = result{}
+	h.call(http.MethodGet, "/search?q=koe&kinds=request&tags=bak", nil, http.StatusOK, &res)
+	if res.Total != 1 || res.Hits[0].Kind != "request" || res.Hits[0].Title != "Koeke" {
+		t.Fatalf("bak: %+v", res)
+	}
+	h.call(http.MethodGet, "/search?q=koe&kinds=donation", nil, http.StatusBadRequest, nil)
+	h.call(http.MethodGet, "/search?q=", nil, http.StatusBadRequest, nil)
+	h.sid = ""
+	h.call(http.MethodGet, "/search?q=koe", nil, http.StatusUnauthorized, nil)
+}
+
+func TestGroupTree(t *testing.T) {
+	h := newHarness(t)
+	h.signup("Other", "other@example.com", "Other-pwd1")
+	var other struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"title": "Ander skool", "user_role": "Organiser"}, http.StatusAccepted, &other)
+	otherSid := h.sid
+
+	h.signup("Organiser", "org@example.com", "Org-pwd1")
+	var school, fete, concert, stall struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"title": "Hoërskool", "user_role": "Organiser"}, http.StatusAccepted, &school)
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"parent_group_id": school.ID, "title": "Kermis", "user_role": "Organiser"}, http.StatusAccepted, &fete)
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"parent_group_id": school.ID, "title": "Konsert", "user_role": "Organiser"}, http.StatusAccepted, &concert)
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"parent_group_id": fete.ID, "title": "Pannekoek stal", "user_role": "Organiser"}, http.StatusAccepted, &stall)
+	var flour struct{ ID string }
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": stall.ID, "title": "Flour", "units": "kg", "qty": 20}, http.StatusAccepted, &flour)
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": fete.ID, "title": "Tables", "qty": 10}, http.StatusAccepted, nil)
+	h.call(http.MethodPost, "/requests/"+flour.ID+"/promises", map[string]interface{}{"qty": 5, "date": "2030-01-31"}, http.StatusAccepted, nil)
+
+	type totals struct {
+		Members      int
+		Requests     int
+		OpenRequests int `json:"open_requests"`
+		Quantities   []struct {
+			Unit      string
+			Requested float64
+			Promised  float64
+		}
+	}
+	type node struct {
+		ID        string
+		Title     string
+		Depth     int
+		Totals    totals
+		RollUp    totals `json:"roll_up"`
+		Truncated bool
+		Children  []node
+	}
+	var tree node
+	h.call(http.MethodGet, "/groups/"+school.ID+"/tree", nil, http.StatusOK, &tree)
+	if len(tree.Children) != 2 || tree.Children[0].Title != "Kermis" || len(tree.Children[0].Children) != 1 || tree.Children[0].Children[0].Depth != 2 {
+		t.Fatalf("tree: %+v", tree)
+	}
+	//the organiser is a member of all the groups, but counted once
+	if tree.Totals.Requests != 0 || tree.RollUp.Members != 1 || tree.RollUp.Requests != 2 || tree.RollUp.OpenRequests != 2 ||
+		len(tree.RollUp.Quantities) != 2 || tree.RollUp.Quantities[1].Unit != "kg" || tree.RollUp.Quantities[1].Promised != 5 {
+		t.Fatalf("roll-up: %+v", tree.RollUp)
+	}
+
+	tree = node{}
+	h.call(http.MethodGet, "/groups/"+school.ID+"/tree?depth=1", nil, http.StatusOK, &tree)
+	if fete := tree.Children[0]; len(fete.Children) != 0 || !fete.Truncated || fete.RollUp.Requests != 2 || fete.Totals.Requests != 1 {
+		t.Fatalf("depth 1: %+v", tree)
+	}
+
+	//move the stall to the concert, but not the school under its own sub-group
+	h.call(http.MethodPut, "/groups/"+school.ID, map[string]interface{}{"id": school.ID, "parent_group_id": stall.ID}, http.StatusBadRequest, nil)
+	h.call(http.MethodPut, "/groups/"+stall.ID, map[string]interface{}{"id": stall.ID, "parent_group_id": stall.ID}, http.StatusBadRequest, nil)
+	h.call(http.MethodPut, "/groups/"+stall.ID, map[string]interface{}{"id": stall.ID, "parent_group_id": concert.ID}, http.StatusAccepted, nil)
+	tree = node{}
+	h.call(http.MethodGet, "/groups/"+school.ID+"/tree", nil, http.StatusOK, &tree)
+	if len(tree.Children[0].Children) != 0 || len(tree.Children[1].Children) != 1 || tree.Children[1].RollUp.Requests != 1 {
+		t.Fatalf("moved: %+v", tree)
+	}
+
+	//others may not see the tree or move their groups into it
+	h.sid = otherSid
+	h.call(http.MethodGet, "/groups/"+school.ID+"/tree", nil, http.StatusForbidden, nil)
+	h.call(http.MethodPut, "/groups/"+other.ID, map[string]interface{}{"id": other.ID, "parent_group_id": school.ID}, http.StatusForbidden, nil)
+}
+
+func TestRequestLifecycle(t *testing.T) {
+	h := newHarness(t)
+	h.signup("Organiser", "org@example.com", "Org-pwd1")
+	var group struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"title": "Wildsfees", "user_role": "Organiser"}, http.StatusAccepted, &group)
+	type request struct {
+		ID          string
+		Status      string
+		NeededBy    string `json:"needed_by"`
+		Priority    int
+		MaxPerDonor int `json:"max_per_donor"`
+	}
+	var flour, eggs request
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Flour", "qty": 20, "max_per_donor": 5, "needed_by": "2030-01-31"}, http.StatusAccepted, &flour)
+	if flour.Status != "open" || flour.NeededBy != "2030-01-31 00:00:00" || flour.MaxPerDonor != 5 {
+		t.Fatalf("flour: %+v", flour)
+	}
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Eggs", "qty": 24, "priority": 3, "status": "draft"}, http.StatusAccepted, &eggs)
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Sugar", "qty": 2, "status": "fulfilled"}, http.StatusBadRequest, nil)
+
+	//draft requests and more than max_per_donor cannot be promised
+	h.call(http.MethodPost, "/requests/"+eggs.ID+"/promises", map[string]interface{}{"qty": 1, "date": "2030-01-31"}, http.StatusConflict, nil)
+	h.call(http.MethodPost, "/requests/"+flour.ID+"/promises", map[string]interface{}{"qty": 6, "date": "2030-01-31"}, http.StatusBadRequest, nil)
+	h.call(http.MethodPost, "/requests/"+flour.ID+"/promises", map[string]interface{}{"qty": 5, "date": "2030-01-31"}, http.StatusAccepted, nil)
+	h.call(http.MethodPost, "/requests/"+flour.ID+"/promises", map[string]interface{}{"qty": 1, "date": "2030-01-31"}, http.StatusBadRequest, nil)
+
+	h.call(http.MethodPut, "/requests/"+flour.ID, map[string]interface{}{"id": flour.ID, "status": "fulfilled"}, http.StatusConflict, nil)
+	h.call(http.MethodPut, "/requests/"+flour.ID, map[string]interface{}{"id": flour.ID, "status": "closed"}, http.StatusAccepted, &flour)
+	if flour.Status != "closed" {
+		t.Fatalf("closed: %+v", flour)
+	}
+	h.call(http.MethodPut, "/requests/"+flour.ID, map[string]interface{}{"id": flour.ID, "max_per_donor": 10}, http.StatusAccepted, nil)
+	h.call(http.MethodPost, "/requests/"+flour.ID+"/promises", map[string]interface{}{"qty": 1, "date": "2030-01-31"}, http.StatusConflict, nil)
+
+	var list struct {
+		Requests []request
+		Total    int
+	}
+	h.call(http.MethodGet, "/requests/?id="+group.ID+"&status=open,draft&sort=-priority", nil, http.StatusOK, &list)
+	if list.Total != 1 || list.Requests[0].ID != eggs.ID {
+		t.Fatalf("open: %+v", list)
+	}
+	list.Requests = nil
+	h.call(http.MethodGet, "/requests/?id="+group.ID+"&needed_before=2030-02-01", nil, http.StatusOK, &list)
+	if list.Total != 1 || list.Requests[0].ID != flour.ID {
+		t.Fatalf("needed before: %+v", list)
+	}
+	h.call(http.MethodGet, "/requests/?id="+group.ID+"&status=paused", nil, http.StatusBadRequest, nil)
+}
+
+func TestPromiseLimits(t *testing.T) {
+	h := newHarness(t)
+	h.signup("Organiser", "org@example.com", "Org-pwd1")
+	var group struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"title": "Wildsfees", "user_role": "Organiser"}, http.StatusAccepted, &group)
+	var scones, koeksisters struct{ ID string }
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Scones", "qty": 20, "overflow_pct": 10}, http.StatusAccepted, &scones)
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Koeksisters", "qty": 10, "waitlist": true}, http.StatusAccepted, &koeksisters)
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Melktert", "qty": 10, "overflow_pct": 101}, http.StatusBadRequest, nil)
+
+	//promise concurrently, 2 at a time, with only 20+10% for scones and 10 for koeksisters
+	type promise struct {
+		ID     string
+		Status string
+	}
+	promiseAll := func(requestID string, n int) (promises []promise, refused int) {
+		var wg sync.WaitGroup
+		var mutex sync.Mutex
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res := h.do(http.MethodPost, "/requests/"+requestID+"/promises", map[string]interface{}{"qty": 2, "date": "2030-01-31"})
+				mutex.Lock()
+				defer mutex.Unlock()
+				switch res.Code {
+				case http.StatusAccepted:
+					var p promise
+					json.Unmarshal(res.Body.Bytes(), &p)
+					promises = append(promises, p)
+				case http.StatusConflict:
+					refused++
+				default:
+					t.Errorf("promise -> %d: %s", res.Code, res.Body.String())
+				}
+			}()
+		}
+		wg.Wait()
+		return promises, refused
+	}
+	if promises, refused := promiseAll(scones.ID, 50); len(promises) != 11 || refused != 39 {
+		t.Fatalf("scones: %d promises and %d refused", len(promises), refused)
+	}
+	promises, refused := promiseAll(koeksisters.ID, 50)
+	waitlisted := []promise{}
+	for _, p := range promises {
+		if p.Status == "waitlisted" {
+			waitlisted = append(waitlisted, p)
+		}
+	}
+	if refused != 0 || len(waitlisted) != 45 {
+		t.Fatalf("koeksisters: %d waitlisted and %d refused", len(waitlisted), refused)
+	}
+
+	//withdrawing an open promise opens the first waitlisted promise
+	var withdrawn promise
+	for _, p := range promises {
+		if p.Status == "" {
+			h.call(http.MethodPost, "/promises/"+p.ID+"/withdraw", nil, http.StatusAccepted, &withdrawn)
+			break
+		}
+	}
+	type progress struct {
+		Progress struct{ Promised, Waitlisted float64 }
+	}
+	var r progress
+	h.call(http.MethodGet, "/requests/"+koeksisters.ID, nil, http.StatusOK, &r)
+	if withdrawn.Status != "withdrawn" || r.Progress.Promised != 10 || r.Progress.Waitlisted != 88 {
+		t.Fatalf("withdraw: %+v %+v", withdrawn, r)
+	}
+	//and more qty opens more of them
+	h.call(http.MethodPut, "/requests/"+koeksisters.ID, map[string]interface{}{"id": koeksisters.ID, "qty": 15}, http.StatusAccepted, &r)
+	if r.Progress.Promised != 14 || r.Progress.Waitlisted != 84 {
+		t.Fatalf("more qty: %+v", r)
+	}
+}
+
+func TestMoneyRequests(t *testing.T) {
+	h := newHarness(t)
+	h.signup("Organiser", "org@example.com", "Org-pwd1")
+	var group struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"title": "Wildsfees", "user_role": "Organiser"}, http.StatusAccepted, &group)
+	var fund struct {
+		ID       string
+		Type     string
+		Currency string
+	}
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Building fund", "type": "money", "qty": 100000}, http.StatusAccepted, &fund)
+	if fund.Type != "money" || fund.Currency != "ZAR" {
+		t.Fatalf("fund: %+v", fund)
+	}
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Tombola", "type": "money", "qty": 100, "units": "kg"}, http.StatusBadRequest, nil)
+	var flour struct{ ID string }
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Flour", "qty": 10}, http.StatusAccepted, &flour)
+
+	//pledges get a reference to pay with
+	var pledge, other struct {
+		ID        string
+		Reference string
+	}
+	h.call(http.MethodPost, "/requests/"+fund.ID+"/promises", map[string]interface{}{"qty": 50000, "date": "2030-03-31"}, http.StatusAccepted, &pledge)
+	h.call(http.MethodPost, "/requests/"+fund.ID+"/promises", map[string]interface{}{"qty": 20000, "date": "2030-03-31"}, http.StatusAccepted, &other)
+	if pledge.Reference == "" {
+		t.Fatalf("pledge without reference: %+v", pledge)
+	}
+
+	h.call(http.MethodPost, "/requests/"+fund.ID+"/payments", map[string]interface{}{"amount": 2500, "method": "cash"}, http.StatusAccepted, nil)
+	h.call(http.MethodPost, "/requests/"+fund.ID+"/payments", map[string]interface{}{"amount": 2500, "method": "eft"}, http.StatusBadRequest, nil)
+	h.call(http.MethodPost, "/requests/"+flour.ID+"/payments", map[string]interface{}{"amount": 2500, "method": "cash"}, http.StatusBadRequest, nil)
+
+	statement := "Date,Description,Reference,Amount\n" +
+		"2030/03/01,EFT CREDIT,\"" + pledge.Reference + "\",\"500.00\"\n" +
+		"2030/03/02,EFT CREDIT " + other.Reference + ",,150.00\n" +
+		"2030/03/02,BANK FEES,,-12.50\n"
+	var rec struct {
+		Matched, Mismatched, Recorded int
+		Lines                         []struct{ Status string }
+	}
+	h.call(http.MethodPost, "/groups/"+group.ID+"/reconcile", map[string]interface{}{"content": statement, "record": true}, http.StatusAccepted, &rec)
+	if rec.Matched != 1 || rec.Mismatched != 1 || rec.Recorded != 1 || len(rec.Lines) != 3 || rec.Lines[2].Status != "skipped" {
+		t.Fatalf("reconcile: %+v", rec)
+	}
+
+	var r struct {
+		Progress struct{ Promised, Received float64 }
+	}
+	h.call(http.MethodGet, "/requests/"+fund.ID, nil, http.StatusOK, &r)
+	if r.Progress.Promised != 70000 || r.Progress.Received != 52500 {
+		t.Fatalf("progress: %+v", r)
+	}
+	var report struct {
+		Totals []struct {
+			Currency                 string
+			Requested, Pledged, Paid int
+			ByMethod                 map[string]int `json:"by_method"`
+		}
+	}
+	h.call(http.MethodGet, "/groups/"+group.ID+"/money", nil, http.StatusOK, &report)
+	if len(report.Totals) != 1 || report.Totals[0].Requested != 100000 || report.Totals[0].Paid != 52500 || report.Totals[0].ByMethod["eft"] != 50000 {
+		t.Fatalf("report: %+v", report)
+	}
+}
+
+func TestTags(t *testing.T) {
+	h := newHarness(t)
+	h.signup("Organiser", "org@example.com", "Org-pwd1")
+	var group struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"title": "Wildsfees", "user_role": "Organiser"}, http.StatusAccepted, &group)
+	type request struct {
+		ID   string
+		Tags []string
+	}
+	var flour, cake request
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Flour", "tags": "Baked goods, food", "qty": 20}, http.StatusAccepted, &flour)
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Cake", "tags": []string{"baked  goods", "bake"}, "qty": 5}, http.StatusAccepted, &cake)
+	if len(flour.Tags) != 2 || flour.Tags[0] != "Baked goods" || len(cake.Tags) != 2 || cake.Tags[0] != "Baked goods" {
+		t.Fatalf("tags: %+v %+v", flour, cake)
+	}
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Bad", "tags": []string{"a|b"}, "qty": 5}, http.StatusBadRequest, nil)
+
+	type tag struct {
+		ID       string
+		Name     string
+		Colour   string
+		Requests int
+	}
+	var tags []tag
+	h.call(http.MethodGet, "/groups/"+group.ID+"/tags?prefix=bak", nil, http.StatusOK, &tags)
+	if len(tags) != 2 || tags[0].Name != "Baked goods" || tags[0].Requests != 2 || tags[1].Name != "bake" {
+		t.Fatalf("autocomplete: %+v", tags)
+	}
+	bakedGoods, bake := tags[0], tags[1]
+
+	var requests struct{ Requests []request }
+	h.call(http.MethodGet, "/requests/?id="+group.ID+"&tags=baked%20goods,bake", nil, http.StatusOK, &requests)
+	if len(requests.Requests) != 1 || requests.Requests[0].ID != cake.ID {
+		t.Fatalf("requests with tags: %+v", requests)
+	}
+
+	//rename, but not to an existing name, then merge
+	h.call(http.MethodPut, "/groups/"+group.ID+"/tags/"+bake.ID, map[string]interface{}{"name": "BAKED GOODS"}, http.StatusConflict, nil)
+	var renamed tag
+	h.call(http.MethodPut, "/groups/"+group.ID+"/tags/"+bakedGoods.ID, map[string]interface{}{"name": "Baking", "colour": "#e8a33d"}, http.StatusAccepted, &renamed)
+	if renamed.Name != "Baking" || renamed.Colour != "#e8a33d" {
+		t.Fatalf("renamed: %+v", renamed)
+	}
+	h.call(http.MethodPut, "/groups/"+group.ID+"/tags/"+bake.ID, map[string]interface{}{"colour": "red"}, http.StatusBadRequest, nil)
+	var merged tag
+	h.call(http.MethodPost, "/groups/"+group.ID+"/tags/"+bake.ID+"/merge", map[string]interface{}{"into_id": bakedGoods.ID}, http.StatusAccepted, &merged)
+	if merged.Name != "Baking" || merged.Requests != 2 {
+		t.Fatalf("merged: %+v", merged)
+	}
+	var fullCake request
+	h.call(http.MethodGet, "/requests/"+cake.ID, nil, http.StatusOK, &fullCake)
+	if len(fullCake.Tags) != 1 || fullCake.Tags[0] != "Baking" {
+		t.Fatalf("cake tags: %+v", fullCake)
+	}
+	h.call(http.MethodPut, "/requests/"+cake.ID, map[string]interface{}{"id": cake.ID, "tags": []string{}}, http.StatusAccepted, &fullCake)
+	if len(fullCake.Tags) != 0 {
+		t.Fatalf("cake tags not removed: %+v", fullCake)
+	}
+
+	var stats []struct {
+		Name      string
+		Unit      string
+		Requests  int
+		Requested float64
+	}
+	h.call(http.MethodGet, "/groups/"+group.ID+"/tags/stats", nil, http.StatusOK, &stats)
+	if len(stats) != 2 || stats[0].Name != "Baking" || stats[0].Requests != 1 || stats[0].Requested != 20 {
+		t.Fatalf("stats: %+v", stats)
+	}
+
+	var food tag
+	h.call(http.MethodPost, "/groups/"+group.ID+"/tags", map[string]interface{}{"name": "Drinks"}, http.StatusAccepted, &food)
+	h.call(http.MethodPost, "/groups/"+group.ID+"/tags", map[string]interface{}{"name": "drinks"}, http.StatusConflict, nil)
+	h.call(http.MethodDelete, "/groups/"+group.ID+"/tags/"+food.ID, nil, http.StatusNoContent, nil)
+
+	//only coordinators manage tags
+	h.signup("Donor", "donor@example.com", "Donor-pwd1")
+	h.call(http.MethodGet, "/groups/"+group.ID+"/tags", nil, http.StatusForbidden, nil)
+	h.call(http.MethodDelete, "/groups/"+group.ID+"/tags/"+bakedGoods.ID, nil, http.StatusForbidden, nil)
+}
+
+//TestGroupSettings checks that only members see and only coordinators change the settings of a group
+func TestGroupSettings(t *testing.T) {
+	h := newHarness(t)
+	h.signup("Organiser", "org@example.com", "Org-pwd1")
+	var group struct{ ID string }
+	h.call(http.MethodPost, "/groups/", map[string]interface{}{"title": "Wildsfees", "user_role": "Organiser"}, http.StatusAccepted, &group)
+	var request struct{ ID string }
+	h.call(http.MethodPost, "/requests/", map[string]interface{}{"group_id": group.ID, "title": "Flour", "qty": 20}, http.StatusAccepted, &request)
+
+	h.signup("Other", "other@example.com", "Other-pwd1")
+	h.call(http.MethodGet, "/requests/?id="+group.ID, nil, http.StatusForbidden, nil)
+	h.call(http.MethodPut, "/requests/"+request.ID, map[string]interface{}{"id": request.ID, "status": "cancelled"}, http.StatusForbidden, nil)
+	h.call(http.MethodPut, "/requests/"+request.ID, map[string]interface{}{"id": request.ID, "overflow_pct": 100}, http.StatusForbidden, nil)
+	h.call(http.MethodGet, "/groups/"+group.ID+"/reminders", nil, http.StatusForbidden, nil)
+	h.call(http.MethodPut, "/groups/"+group.ID+"/reminders", map[string]interface{}{"days_before": []int{1}}, http.StatusForbidden, nil)
+	h.call(http.MethodGet, "/groups/"+group.ID+"/branding", nil, http.StatusForbidden, nil)
+	h.call(http.MethodPut, "/groups/"+group.ID+"/branding", map[string]interface{}{"from_name": "Not them"}, http.StatusForbidden, nil)
+	h.call(http.MethodGet, "/groups/"+group.ID+"/emails/invitation", nil, http.StatusForbidden, nil)
+	h.call(http.MethodPost, "/groups/"+group.ID+"/import", map[string]interface{}{"content": "group,title,qty\nStal,Flour,1\n", "dry_run": true}, http.StatusForbidden, nil)
+}
+
+func TestReadiness(t *testing.T) {
+	h := newHarness(t)
+	h.call(http.MethodGet, "/readyz", nil, http.StatusOK, nil)
+
+	//each router reports its own readiness
+	ready := &server.Readiness{}
+	other := newHarness(t)
+	other.handler = server.NewRouter(server.Deps{Store: other.store, Mailer: other.mailer, Queue: other.queue, Ready: ready})
+	other.call(http.MethodGet, "/readyz", nil, http.StatusServiceUnavailable, nil)
+	ready.Set(true)
+	other.call(http.MethodGet, "/readyz", nil, http.StatusOK, nil)
+	ready.Set(false)
+	other.call(http.MethodGet, "/readyz", nil, http.StatusServiceUnavailable, nil)
+	h.call(http.MethodGet, "/readyz", nil, http.StatusOK, nil)
+}
+
+func TestOutboundAdmins(t *testing.T) {
+	h := newHarness(t)
+	h.signup("User", "user@example.com", "User-pwd1")
+	h.call(http.MethodGet, "/outbound/", nil, http.StatusForbidden, nil)
+	h.call(http.MethodPost, "/outbound/bounces", map[string]interface{}{"message_id": "<1@don8>", "reason": "no such user"}, http.StatusForbidden, nil)
+
+	h.handler = server.NewRouter(server.Deps{Store: h.store, Mailer: h.mailer, Queue: h.queue, Admins: []string{"Admin@example.com"}})
+	h.signup("Admin", "admin@example.com", "Admin-pwd1")
+	var messages []struct{ Subject string }
+	h.call(http.MethodGet, "/outbound/", nil, http.StatusOK, &messages)
+}
+
+func TestImpersonate(t *testing.T) {
+	h := newHarness(t)
+	seeded, _ := h.store.AddUser(db.User{Name: "Anna Botha", Phone: "0800000001", Email: "anna.botha.1@s1." + seed.Domain})
+	h.store.AddUser(db.User{Name: "Real User", Phone: "0821234567", Email: "real@example.com"})
+	h.call(http.MethodPost, "/dev/impersonate", map[string]interface{}{"email": seeded.Email}, http.StatusNotFound, nil)
+
+	h.handler = server.NewRouter(server.Deps{Store: h.store, Mailer: h.mailer, Queue: h.queue, Dev: true})
+	h.call(http.MethodPost, "/dev/impersonate", map[string]interface{}{"email": "real@example.com"}, http.StatusBadRequest, nil)
+	h.call(http.MethodPost, "/dev/impersonate", map[string]interface{}{"email": "nobody@s1." + seed.Domain}, http.StatusNotFound, nil)
+	var session struct {
+		ID   string
+		User struct{ ID string }
+	}
+	h.call(http.MethodPost, "/dev/impersonate", map[string]interface{}{"email": seeded.Email}, http.StatusAccepted, &session)
+	if session.User.ID != string(seeded.ID) {
+		t.Fatalf("session of wrong user: %+v", session)
+	}
+	h.sid = session.ID
+	h.call(http.MethodGet, "/groups/", nil, http.StatusOK, nil)
+}
+
+//TestScenarios replays the scenario files against the fakes
+func TestScenarios(t *testing.T) {
+	files, _ := filepath.Glob("../conf/scenarios/*.json")
+	if len(files) == 0 {
+		t.Fatalf("no scenario files")
+	}
+	for _, f := range files {
+		steps, err := scenario.Load(f)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		r := scenario.Runner{Handler: newHarness(t).handler}
+		for _, result := range r.Run(context.Background(), steps).Results {
+			if !result.Passed() {
+				t.Errorf("%s: %s: %s", filepath.Base(f), result.Step, result.Error)
+			}
+		}
+	}
+}
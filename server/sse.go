@@ -0,0 +1,81 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/events"
+)
+
+//time between keep-alive comments so proxies do not close an idle stream
+const ssePingInterval = 25 * time.Second
+
+//groupEvents streams live events of a group to members with server-sent events.
+//Browsers cannot set headers on an EventSource, so the session may also be given as ?sid=...
+func (a *api) groupEvents(httpRes http.ResponseWriter, httpReq *http.Request) {
+	requestID := requestIDOf(httpReq)
+	httpRes.Header().Set(requestIDHeader, requestID)
+	fail := func(err error) {
+		writeError(httpRes, httpReq, err)
+	}
+
+	if httpReq.Header.Get(authSidHeader) == "" {
+		httpReq.Header.Set(authSidHeader, httpReq.URL.Query().Get("sid"))
+	}
+	s, err := a.requestSession(httpReq)
+	if err != nil {
+		fail(err)
+		return
+	}
+	groupID := db.ID(mux.Vars(httpReq)["id"])
+	m, err := a.store.GetMemberByEmail(groupID, s.User.Email)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if m == nil {
+		fail(apierr.Errorf(apierr.Forbidden, "not a member of this group"))
+		return
+	}
+	flusher, ok := httpRes.(http.Flusher)
+	if !ok {
+		fail(apierr.Errorf(apierr.Internal, "streaming not supported"))
+		return
+	}
+
+	sub := events.Default.Subscribe(string(groupID))
+	defer sub.Close()
+	log.Infof("[%s] user(%s) watching group(%s) events", requestID, s.User.ID, groupID)
+
+	httpRes.Header().Set("Content-Type", "text/event-stream")
+	httpRes.Header().Set("Cache-Control", "no-cache")
+	httpRes.Header().Set("X-Accel-Buffering", "no") //do not buffer in nginx
+	httpRes.WriteHeader(http.StatusOK)
+	fmt.Fprintf(httpRes, ": watching group %s\n\n", groupID)
+	flusher.Flush()
+
+	ping := time.NewTicker(ssePingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-httpReq.Context().Done():
+			log.Infof("[%s] user(%s) stopped watching group(%s) events", requestID, s.User.ID, groupID)
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			jsonEvent, _ := json.Marshal(e)
+			fmt.Fprintf(httpRes, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, jsonEvent)
+			flusher.Flush()
+		case <-ping.C:
+			fmt.Fprintf(httpRes, ": ping\n\n")
+			flusher.Flush()
+		}
+	}
+} //api.groupEvents()
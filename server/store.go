@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/emails"
+	"github.com/jansemmelink/don8/model"
+	"github.com/jansemmelink/don8/ratelimit"
+	"github.com/jansemmelink/don8/search"
+)
+
+//Store is the data used by the API handlers,
+//implemented by db.Store and by fakes in tests
+type Store interface {
+	//users and sessions
+	Activate(req db.ActivateRequest) (db.Session, error)
+	AddUser(newUser db.User) (db.User, error)
+	Login(req db.LoginRequest) (db.Session, error)
+	Logout(sid db.ID) error
+	GetSession(sid db.ID) (db.Session, error)
+	Reset(req db.ResetRequest) (db.User, error)
+	GetUserByEmail(email string) (db.User, error)
+	NewSession(user db.User) (db.Session, error)
+
+	//groups
+	AddGroup(user db.User, newGroup db.NewGroup) (db.Group, error)
+	GetGroup(id db.ID) (db.Group, error)
+	GetFullGroup(id db.ID) (db.FullGroup, error)
+	GetGroupTree(id db.ID, maxDepth int) (db.GroupNode, error)
+	UpdGroup(req db.UpdGroupRequest) error
+	GetChildGroupByTitle(parentGroupID db.ID, title string) (*db.Group, error)
+	MyGroups(user db.User, filter string, fromTime *time.Time, toTime *time.Time, page db.PageRequest) (db.MyGroupList, error)
+	IsGroupCoordinator(groupID db.ID, userID db.ID) (bool, error)
+	GetMemberByEmail(groupID db.ID, email string) (*db.Member, error)
+	ListGroupMembers(groupID db.ID, page db.PageRequest) (db.MemberList, error)
+	ListGroupInvitations(groupID db.ID, page db.PageRequest) (db.InvitationList, error)
+	ListGroupLocations(groupID db.ID, page db.PageRequest) (db.LocationList, error)
+	GetGroupBranding(groupID db.ID) (db.GroupBranding, error)
+	SetGroupBranding(b db.GroupBranding) error
+	GetGroupReminders(groupID db.ID) (db.GroupReminders, error)
+	SetGroupReminders(gr db.GroupReminders) error
+
+	//requests
+	AddRequest(r db.Request) (db.Request, error)
+	GetRequest(id db.ID) (db.Request, error)
+	GetFullRequest(id db.ID) (db.FullRequest, error)
+	GetRequestByTitle(groupID db.ID, title string) (*db.Request, error)
+	UpdRequest(req db.UpdRequestRequest) error
+	FindRequests(groupID db.ID, filter db.RequestFilter, page db.PageRequest) (db.RequestList, error)
+
+	//tags
+	ListTags(groupID db.ID, prefix string, limit int) ([]db.Tag, error)
+	AddTag(t db.Tag) (db.Tag, error)
+	GetTag(id db.ID) (db.Tag, error)
+	UpdTag(req db.UpdTagRequest) (db.Tag, error)
+	MergeTags(fromID db.ID, intoID db.ID) (db.Tag, error)
+	DelTag(id db.ID) error
+	GetTagStats(groupID db.ID) ([]db.TagStats, error)
+
+	//promises
+	AddPromise(p db.Promise) (db.Promise, error)
+	GetPromise(id db.ID) (db.Promise, error)
+	GetPromises(groupID string, userID string, requestID string, locationID string, beforeDate *time.Time, page db.PageRequest) (db.PromiseList, error)
+	WithdrawPromise(id db.ID) (db.Promise, error)
+
+	//money
+	AddPayment(p db.Payment) (db.Payment, error)
+	ListPayments(groupID db.ID, requestID db.ID, method db.PaymentMethod, page db.PageRequest) (db.PaymentList, error)
+	GetGroupMoney(id db.ID) (db.MoneyReport, error)
+	ReconcileStatement(groupID db.ID, currency model.Currency, lines []db.StatementLine, record bool, recordedBy db.ID) (db.Reconciliation, error)
+
+	//webhooks
+	AddWebhook(w db.Webhook) (db.Webhook, error)
+	ListWebhooks(groupID db.ID) ([]db.Webhook, error)
+	DelWebhook(groupID db.ID, id db.ID) error
+	ListWebhookDeliveries(groupID db.ID, webhookID db.ID, status db.WebhookDeliveryStatus, page db.PageRequest) (db.WebhookDeliveryList, error)
+
+	//outbound messages
+	ListOutboundMessages(ref string, addr string, limit int) ([]db.OutboundMessage, error)
+	BounceOutboundMessage(messageID string, addr string, reason string) (db.OutboundMessage, error)
+
+	//Search the groups the user may see
+	Search(userID db.ID, q search.Query) (search.Result, error)
+
+	Ping(ctx context.Context) error
+}
+
+//Queue delivers messages to workers, e.g. invitations.Queue
+type Queue interface {
+	Publish(ctx context.Context, queue string, message []byte) error
+}
+
+type redisQueue struct {
+	client *redis.Client
+}
+
+func (q redisQueue) Publish(ctx context.Context, queue string, message []byte) error {
+	return q.client.Publish(ctx, queue, message).Err()
+}
+
+//Deps are the dependencies of the API handlers
+type Deps struct {
+	Store       Store
+	Mailer      emails.Mailer
+	Queue       Queue
+	Limits      ratelimit.Store //default is in memory
+	Redis       *redis.Client   //optional, checked by /readyz
+	TrustProxy  bool            //use X-Forwarded-For as the client IP, only when behind a proxy that sets it
+	InviteQuota int             //max invitations per group per day (default 500)
+	Dev         bool            //adds /dev/ routes, e.g. to impersonate seeded users
+	Admins      []string        //emails of system admins
+	Ready       *Readiness      //reported by /readyz (default always ready)
+}
+
+//api has the dependencies of the handlers, which are its methods,
+//so that each router from NewRouter() uses its own
+type api struct {
+	store       Store
+	mailer      emails.Mailer
+	queue       Queue
+	limits      ratelimit.Store
+	redis       *redis.Client
+	ready       *Readiness
+	trustProxy  bool
+	inviteQuota ratelimit.Limit
+	admins      []string
+}
+
+//NewRouter returns the API handler using the dependencies,
+//without CORS which NewHandler adds for the server.
+func NewRouter(d Deps) http.Handler {
+	a := &api{
+		store:       d.Store,
+		mailer:      d.Mailer,
+		queue:       d.Queue,
+		limits:      d.Limits,
+		redis:       d.Redis,
+		ready:       d.Ready,
+		trustProxy:  d.TrustProxy,
+		inviteQuota: defaultInviteQuota,
+		admins:      d.Admins,
+	}
+	if a.limits == nil {
+		a.limits = ratelimit.NewMemoryStore()
+	}
+	if a.ready == nil {
+		a.ready = &Readiness{}
+		a.ready.Set(true)
+	}
+	if d.InviteQuota > 0 {
+		a.inviteQuota.Max = d.InviteQuota
+	}
+	r := a.newRouter()
+	if d.Dev {
+		a.devRoutes(r.PathPrefix("/dev/").Subrouter())
+	}
+	return r
+}
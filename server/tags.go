@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/db"
+)
+
+//listTags to autocomplete tags when editing requests, most used first
+func (a *api) listTags(ctx context.Context) ([]db.Tag, error) {
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return nil, err
+	}
+	params := ctx.Value(CtxParams{}).(params)
+	return a.store.ListTags(groupID, params.String("prefix", ""), params.Int("limit", 10, 1, 100))
+}
+
+type addTagRequest struct {
+	Name        string  `json:"name"`
+	Colour      string  `json:"colour,omitempty" doc:"Colour to show the tag in, as \"#rrggbb\""`
+	Description *string `json:"description,omitempty"`
+}
+
+func (a *api) addTag(ctx context.Context, req addTagRequest) (db.Tag, error) {
+	groupID, err := a.groupCoordinator(ctx)
+	if err != nil {
+		return db.Tag{}, err
+	}
+	return a.store.AddTag(db.Tag{
+		GroupID:     groupID,
+		Name:        req.Name,
+		Colour:      req.Colour,
+		Description: req.Description,
+	})
+}
+
+//groupTag gets the tag in the URL, which must be in the group coordinated by the session user
+func (a *api) groupTag(ctx context.Context, name string) (db.Tag, error) {
+	groupID, err := a.groupCoordinator(ctx)
+	if err != nil {
+		return db.Tag{}, err
+	}
+	params := ctx.Value(CtxParams{}).(params)
+	t, err := a.store.GetTag(db.ID(params.String(name, "")))
+	if err != nil {
+		return db.Tag{}, err
+	}
+	if t.GroupID != groupID {
+		return db.Tag{}, apierr.Errorf(apierr.NotFound, "unknown tag in this group")
+	}
+	return t, nil
+}
+
+//updTag changes the colour or description, or renames the tag on all its requests
+func (a *api) updTag(ctx context.Context, req db.UpdTagRequest) (db.Tag, error) {
+	t, err := a.groupTag(ctx, "tag_id")
+	if err != nil {
+		return db.Tag{}, err
+	}
+	req.ID = t.ID
+	return a.store.UpdTag(req)
+}
+
+type mergeTagRequest struct {
+	IntoID db.ID `json:"into_id" doc:"Tag that gets the requests of the tag in the URL, which is then deleted"`
+}
+
+func (req mergeTagRequest) Validate() error {
+	if req.IntoID == "" {
+		return apierr.Invalid("into_id", "missing into_id")
+	}
+	return nil
+}
+
+func (a *api) mergeTags(ctx context.Context, req mergeTagRequest) (db.Tag, error) {
+	t, err := a.groupTag(ctx, "tag_id")
+	if err != nil {
+		return db.Tag{}, err
+	}
+	return a.store.MergeTags(t.ID, req.IntoID)
+}
+
+func (a *api) delTag(ctx context.Context) error {
+	t, err := a.groupTag(ctx, "tag_id")
+	if err != nil {
+		return err
+	}
+	return a.store.DelTag(t.ID)
+}
+
+//tagStats are the requested, promised and received totals per tag for dashboards
+func (a *api) tagStats(ctx context.Context) ([]db.TagStats, error) {
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.store.GetTagStats(groupID)
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+
+	"github.com/jansemmelink/don8/apierr"
+	"github.com/jansemmelink/don8/db"
+	"github.com/jansemmelink/don8/events"
+)
+
+//groupCoordinator checks that the session user coordinates the group in the URL
+func (a *api) groupCoordinator(ctx context.Context) (db.ID, error) {
+	groupID, err := a.groupMember(ctx)
+	if err != nil {
+		return "", err
+	}
+	s := ctx.Value(CtxAuthSession{}).(db.Session)
+	ok, err := a.store.IsGroupCoordinator(groupID, s.User.ID)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", apierr.Errorf(apierr.Forbidden, "only group coordinators can do this")
+	}
+	return groupID, nil
+}
+
+func (a *api) listWebhooks(ctx context.Context) ([]db.Webhook, error) {
+	groupID, err := a.groupCoordinator(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return a.store.ListWebhooks(groupID)
+}
+
+type addWebhookRequest struct {
+	URL    string        `json:"url" doc:"https URL that events are posted to"`
+	Events []events.Type `json:"events" doc:"Event types to post: promise.created|promise.updated|promise.withdrawn|donation.received|payment.received|member.joined|request.updated|request.met"`
+}
+
+//addWebhook returns the secret used to sign deliveries only in this response
+func (a *api) addWebhook(ctx context.Context, req addWebhookRequest) (db.Webhook, error) {
+	groupID, err := a.groupCoordinator(ctx)
+	if err != nil {
+		return db.Webhook{}, err
+	}
+	return a.store.AddWebhook(db.Webhook{
+		GroupID: groupID,
+		URL:     req.URL,
+		Events:  req.Events,
+	})
+}
+
+func (a *api) delWebhook(ctx context.Context) error {
+	groupID, err := a.groupCoordinator(ctx)
+	if err != nil {
+		return err
+	}
+	params := ctx.Value(CtxParams{}).(params)
+	return a.store.DelWebhook(groupID, db.ID(params.String("webhook_id", "")))
+}
+
+func (a *api) listWebhookDeliveries(ctx context.Context) (db.WebhookDeliveryList, error) {
+	groupID, err := a.groupCoordinator(ctx)
+	if err != nil {
+		return db.WebhookDeliveryList{}, err
+	}
+	params := ctx.Value(CtxParams{}).(params)
+	page, err := params.Page(db.WebhookDeliverySort)
+	if err != nil {
+		return db.WebhookDeliveryList{}, err
+	}
+	status := db.WebhookDeliveryStatus(params.String("status", ""))
+	switch status {
+	case "", db.WebhookDeliveryPending, db.WebhookDeliveryDelivered, db.WebhookDeliveryFailed:
+	default:
+		return db.WebhookDeliveryList{}, apierr.Errorf(apierr.ValidationFailed, "invalid status=\"%s\" expecting pending|delivered|failed", status)
+	}
+	return a.store.ListWebhookDeliveries(groupID, db.ID(params.String("webhook_id", "")), status, page)
+}
@@ -0,0 +1,92 @@
+package webhooks
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-msvc/errors"
+)
+
+//blockedNets are not covered by the net.IP methods used in blockedIP(),
+//e.g. carrier grade NAT and NAT64 that can also reach internal services
+var blockedNets = func() []*net.IPNet {
+	list := []*net.IPNet{}
+	for _, cidr := range []string{"0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "64:ff9b::/96"} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		list = append(list, n)
+	}
+	return list
+}()
+
+//blockedIP is true for addresses that are not public, such as loopback, private and link-local,
+//so that webhooks cannot be used to post to internal services or cloud metadata
+func blockedIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//CheckURL returns an error unless the URL is https to a host that could be public.
+//Names are only resolved when posting, so NewClient() checks the address again.
+func CheckURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" || u.Scheme != "https" {
+		return errors.Errorf("invalid url \"%s\" expecting https://...", s)
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errors.Errorf("url host %s is not public", u.Hostname())
+	}
+	if ip := net.ParseIP(host); ip != nil && blockedIP(ip) {
+		return errors.Errorf("url host %s is not public", u.Hostname())
+	}
+	return nil
+}
+
+//dialControl checks the address after the name was resolved,
+//so a name that resolves to an internal address (e.g. by DNS rebinding) is refused
+func dialControl(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "invalid address %s", address)
+	}
+	if ip := net.ParseIP(host); ip == nil || blockedIP(ip) {
+		return errors.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
+
+//NewClient returns a client to post deliveries with, that only connects to public addresses
+//and only follows redirects to https URLs
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: dialControl}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			//no proxy, else the proxy address is checked instead of the webhook's
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConnsPerHost: 2,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.Errorf("too many redirects")
+			}
+			return CheckURL(req.URL.String())
+		},
+	}
+}
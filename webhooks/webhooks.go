@@ -0,0 +1,133 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-msvc/errors"
+)
+
+//HTTP headers sent with each delivery
+const (
+	SignatureHeader = "Don8-Signature" //"t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>">"
+	EventHeader     = "Don8-Event"     //event type, e.g. "promise.created"
+	DeliveryHeader  = "Don8-Delivery"  //delivery id, the same for retries of one event
+)
+
+//DefaultTolerance is how old a signature may be before Verify() rejects it
+const DefaultTolerance = 5 * time.Minute
+
+//NewSecret returns a random key for signing deliveries to a webhook
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrapf(err, "failed to generate secret")
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+//Sign returns the signature header value for a body sent at time t
+//the time is part of the signature so that old deliveries cannot be replayed
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + mac(secret, ts, body)
+}
+
+func mac(secret string, ts string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(ts))
+	m.Write([]byte("."))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+//Verify checks the signature header of a received delivery
+//as receivers should do, and as we do in tests
+func Verify(secret string, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var ts string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			signatures = append(signatures, kv[1])
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.Errorf("missing timestamp in signature")
+	}
+	if age := now.Sub(time.Unix(sec, 0)); age > tolerance || age < -tolerance {
+		return errors.Errorf("signature timestamp is %s from now", age)
+	}
+	expected := mac(secret, ts, body)
+	for _, s := range signatures {
+		if hmac.Equal([]byte(s), []byte(expected)) {
+			return nil
+		}
+	}
+	return errors.Errorf("signature mismatch")
+} //Verify()
+
+//MaxAttempts before a delivery is failed permanently
+const MaxAttempts = 10
+
+//Backoff is the delay before retrying after the nth failed attempt (1..)
+//doubling from 30s up to 6h, so with MaxAttempts the retries span about 4h
+func Backoff(attempt int) time.Duration {
+	d := 30 * time.Second
+	for i := 1; i < attempt && d < 6*time.Hour; i++ {
+		d *= 2
+	}
+	if d > 6*time.Hour {
+		d = 6 * time.Hour
+	}
+	return d
+}
+
+//Delivery is one event to post to one webhook
+type Delivery struct {
+	ID        string
+	URL       string
+	Secret    string
+	EventType string
+	Body      []byte
+}
+
+//Deliver posts the signed body to the webhook URL
+//and returns the HTTP status code (0 when no response) with an error unless the status is 2xx
+func Deliver(client *http.Client, d Delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Body))
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid webhook request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "don8-webhooks/1.0")
+	req.Header.Set(EventHeader, d.EventType)
+	req.Header.Set(DeliveryHeader, d.ID)
+	req.Header.Set(SignatureHeader, Sign(d.Secret, time.Now(), d.Body))
+	res, err := client.Do(req)
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to post to webhook")
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 64*1024)) //so the connection can be reused
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, errors.Errorf("webhook responded with HTTP %s", res.Status)
+	}
+	return res.StatusCode, nil
+} //Deliver()
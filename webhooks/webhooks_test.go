@@ -0,0 +1,112 @@
+package webhooks_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jansemmelink/don8/webhooks"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"type":"promise.created"}`)
+	sig := webhooks.Sign("secret", now, body)
+	if err := webhooks.Verify("secret", sig, body, webhooks.DefaultTolerance, now); err != nil {
+		t.Fatalf("valid signature failed: %+v", err)
+	}
+	if err := webhooks.Verify("other", sig, body, webhooks.DefaultTolerance, now); err == nil {
+		t.Fatalf("wrong secret verified")
+	}
+	if err := webhooks.Verify("secret", sig, []byte(`{"type":"promise.withdrawn"}`), webhooks.DefaultTolerance, now); err == nil {
+		t.Fatalf("changed body verified")
+	}
+	if err := webhooks.Verify("secret", sig, body, webhooks.DefaultTolerance, now.Add(time.Hour)); err == nil {
+		t.Fatalf("old signature verified")
+	}
+	if err := webhooks.Verify("secret", "v1=abc", body, webhooks.DefaultTolerance, now); err == nil {
+		t.Fatalf("signature without timestamp verified")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		10: 512 * 30 * time.Second,
+		11: 6 * time.Hour,
+		50: 6 * time.Hour,
+	}
+	for attempt, expected := range tests {
+		if d := webhooks.Backoff(attempt); d != expected {
+			t.Errorf("Backoff(%d)=%s, expected %s", attempt, d, expected)
+		}
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	body := []byte(`{"id":"e1","type":"member.joined"}`)
+	var received http.Header
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		b, _ := ioutil.ReadAll(r.Body)
+		if err := webhooks.Verify("s3cret", r.Header.Get(webhooks.SignatureHeader), b, webhooks.DefaultTolerance, time.Now()); err != nil {
+			t.Errorf("invalid signature: %+v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	d := webhooks.Delivery{ID: "d1", URL: server.URL, Secret: "s3cret", EventType: "member.joined", Body: body}
+	code, err := webhooks.Deliver(server.Client(), d)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("delivery failed: %d %+v", code, err)
+	}
+	if received.Get(webhooks.EventHeader) != "member.joined" || received.Get(webhooks.DeliveryHeader) != "d1" {
+		t.Fatalf("wrong headers: %+v", received)
+	}
+
+	status = http.StatusServiceUnavailable
+	if code, err := webhooks.Deliver(server.Client(), d); err == nil || code != http.StatusServiceUnavailable {
+		t.Fatalf("expected failure with 503, got %d %+v", code, err)
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	for _, u := range []string{"https://hooks.example.org/don8", "https://8.8.8.8/x"} {
+		if err := webhooks.CheckURL(u); err != nil {
+			t.Fatalf("%s: %+v", u, err)
+		}
+	}
+	for _, u := range []string{
+		"http://hooks.example.org/don8",
+		"https://localhost/x",
+		"https://127.0.0.1/x",
+		"https://10.1.2.3/x",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]/x",
+		"https://[::ffff:192.168.1.1]/x",
+		"https:///x",
+	} {
+		if err := webhooks.CheckURL(u); err == nil {
+			t.Fatalf("accepted %s", u)
+		}
+	}
+}
+
+//TestNewClient checks that the client refuses to connect to loopback, also when the URL passed CheckURL()
+func TestNewClient(t *testing.T) {
+	posted := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted = true
+	}))
+	defer server.Close()
+	d := webhooks.Delivery{ID: "d1", URL: server.URL, Secret: "s3cret", EventType: "member.joined", Body: []byte(`{}`)}
+	if _, err := webhooks.Deliver(webhooks.NewClient(time.Second), d); err == nil || posted {
+		t.Fatalf("posted to loopback: %+v", err)
+	}
+}